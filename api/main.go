@@ -23,6 +23,7 @@ import (
 	"code.cloudfoundry.org/korifi/api/repositories/conditions"
 	"code.cloudfoundry.org/korifi/api/routing"
 	korifiv1alpha1 "code.cloudfoundry.org/korifi/controllers/api/v1alpha1"
+	"code.cloudfoundry.org/korifi/controllers/controllers/workloads/provenance"
 	"code.cloudfoundry.org/korifi/tools"
 	"code.cloudfoundry.org/korifi/tools/image"
 	"code.cloudfoundry.org/korifi/tools/k8s"
@@ -211,7 +212,7 @@ func main() {
 		cfg.RoleMappings,
 		namespaceRetriever,
 	)
-	imageClient := image.NewClient(privilegedK8sClient)
+	imageClient := image.NewClient(privilegedK8sClient, image.WithProvenanceRecorder(provenance.NewRecorder(privilegedCRClient)))
 	imageRepo := repositories.NewImageRepository(
 		privilegedK8sClient,
 		userClientFactory,
@@ -17,6 +17,7 @@ import (
 
 //+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get,namespace=ROOT_NAMESPACE
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get,namespace=ROOT_NAMESPACE
+//+kubebuilder:rbac:groups=korifi.cloudfoundry.org,resources=imageprovenances,verbs=get;create;patch,namespace=ROOT_NAMESPACE
 
 const SourceImageResourceType = "SourceImage"
 
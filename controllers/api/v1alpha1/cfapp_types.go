@@ -24,6 +24,16 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// QuarantinedConditionType is true when the image of the current droplet
+	// of the CFApp has been quarantined, which prevents the app from running.
+	// It is unknown when the quarantine could not be checked, in which case
+	// its reason is DropletQuarantinedReason if the app was last found
+	// quarantined.
+	QuarantinedConditionType = "Quarantined"
+	DropletQuarantinedReason = "DropletQuarantined"
+)
+
 // CFAppSpec defines the desired state of CFApp
 type CFAppSpec struct {
 	// The mutable, user-friendly name of the app. Unlike metadata.name, the user can change this field.
@@ -0,0 +1,73 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImageProvenanceSpec records a push of an image
+type ImageProvenanceSpec struct {
+	// Image is the digest ref of the pushed image
+	Image string `json:"image"`
+	// Digest is the digest of the manifest of the pushed image
+	Digest string `json:"digest"`
+	// Tags that were applied to the image by the push
+	//+kubebuilder:validation:Optional
+	Tags []string `json:"tags,omitempty"`
+	// PushedAt is when the push completed
+	PushedAt metav1.Time `json:"pushedAt"`
+	// Pusher identifies the registry credentials used for the push
+	Pusher ImagePusher `json:"pusher"`
+}
+
+// ImagePusher is the identity the image was pushed with: the image pull
+// secrets and service account that held the registry credentials
+type ImagePusher struct {
+	Namespace string `json:"namespace"`
+	//+kubebuilder:validation:Optional
+	SecretNames []string `json:"secretNames,omitempty"`
+	//+kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=imageprovenances
+//+kubebuilder:printcolumn:name="Image",type="string",JSONPath=`.spec.image`
+//+kubebuilder:printcolumn:name="Pushed At",type="date",JSONPath=`.spec.pushedAt`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=`.metadata.creationTimestamp`
+
+// ImageProvenance is the Schema for the imageprovenances API
+type ImageProvenance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ImageProvenanceSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ImageProvenanceList contains a list of ImageProvenance
+type ImageProvenanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ImageProvenance `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ImageProvenance{}, &ImageProvenanceList{})
+}
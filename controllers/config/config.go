@@ -28,6 +28,8 @@ type ControllerConfig struct {
 	MaxRetainedBuildsPerApp          int                `yaml:"maxRetainedBuildsPerApp"`
 	LogLevel                         zapcore.Level      `yaml:"logLevel"`
 	SpaceFinalizerAppDeletionTimeout *int64             `yaml:"spaceFinalizerAppDeletionTimeout"`
+	RepositoryManagementAPI          string             `yaml:"repositoryManagementAPI"`
+	QuarantineCheckInterval          string             `yaml:"quarantineCheckInterval"`
 
 	// job-task-runner
 	JobTTL                                     string `yaml:"jobTTL"`
@@ -65,10 +67,11 @@ type Networking struct {
 }
 
 const (
-	defaultTaskTTL            = 30 * 24 * time.Hour
-	defaultTimeout      int64 = 60
-	defaultJobTTL             = 24 * time.Hour
-	defaultBuildCacheMB       = 2048
+	defaultTaskTTL                       = 30 * 24 * time.Hour
+	defaultTimeout                 int64 = 60
+	defaultJobTTL                        = 24 * time.Hour
+	defaultBuildCacheMB                  = 2048
+	defaultQuarantineCheckInterval       = 5 * time.Minute
 )
 
 func LoadFromPath(path string) (*ControllerConfig, error) {
@@ -110,6 +113,14 @@ func (c ControllerConfig) ParseTaskTTL() (time.Duration, error) {
 	return tools.ParseDuration(c.TaskTTL)
 }
 
+func (c ControllerConfig) ParseQuarantineCheckInterval() (time.Duration, error) {
+	if c.QuarantineCheckInterval == "" {
+		return defaultQuarantineCheckInterval, nil
+	}
+
+	return tools.ParseDuration(c.QuarantineCheckInterval)
+}
+
 func (c ControllerConfig) ParseBuilderReadinessTimeout() (time.Duration, error) {
 	return tools.ParseDuration(c.BuilderReadinessTimeout)
 }
@@ -48,6 +48,8 @@ var _ = Describe("LoadFromPath", func() {
 			JobTTL:                           "jobTTL",
 			LogLevel:                         zapcore.DebugLevel,
 			SpaceFinalizerAppDeletionTimeout: tools.PtrTo(int64(42)),
+			RepositoryManagementAPI:          "https://harbor.example.com/api/v2.0",
+			QuarantineCheckInterval:          "quarantineCheckInterval",
 			Networking: config.Networking{
 				GatewayName:      "gw-name",
 				GatewayNamespace: "gw-ns",
@@ -91,6 +93,8 @@ var _ = Describe("LoadFromPath", func() {
 			JobTTL:                           "jobTTL",
 			LogLevel:                         zapcore.DebugLevel,
 			SpaceFinalizerAppDeletionTimeout: tools.PtrTo(int64(42)),
+			RepositoryManagementAPI:          "https://harbor.example.com/api/v2.0",
+			QuarantineCheckInterval:          "quarantineCheckInterval",
 			Networking: config.Networking{
 				GatewayName:      "gw-name",
 				GatewayNamespace: "gw-ns",
@@ -186,6 +190,52 @@ var _ = Describe("ParseTaskTTL", func() {
 	})
 })
 
+var _ = Describe("ParseQuarantineCheckInterval", func() {
+	var (
+		intervalString string
+		interval       time.Duration
+		parseErr       error
+	)
+
+	BeforeEach(func() {
+		intervalString = ""
+	})
+
+	JustBeforeEach(func() {
+		cfg := config.ControllerConfig{
+			QuarantineCheckInterval: intervalString,
+		}
+
+		interval, parseErr = cfg.ParseQuarantineCheckInterval()
+	})
+
+	It("returns 5 minutes by default", func() {
+		Expect(parseErr).NotTo(HaveOccurred())
+		Expect(interval).To(Equal(5 * time.Minute))
+	})
+
+	When("entering something parseable by tools.ParseDuration", func() {
+		BeforeEach(func() {
+			intervalString = "1h30m"
+		})
+
+		It("parses ok", func() {
+			Expect(parseErr).NotTo(HaveOccurred())
+			Expect(interval).To(Equal(90 * time.Minute))
+		})
+	})
+
+	When("entering something that cannot be parsed", func() {
+		BeforeEach(func() {
+			intervalString = "often"
+		})
+
+		It("returns an error", func() {
+			Expect(parseErr).To(HaveOccurred())
+		})
+	})
+})
+
 var _ = Describe("ParseJobTTL", func() {
 	var (
 		jobTTL    time.Duration
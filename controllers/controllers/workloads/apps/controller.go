@@ -8,6 +8,7 @@ import (
 
 	korifiv1alpha1 "code.cloudfoundry.org/korifi/controllers/api/v1alpha1"
 	"code.cloudfoundry.org/korifi/controllers/controllers/shared"
+	"code.cloudfoundry.org/korifi/tools/image"
 	"code.cloudfoundry.org/korifi/tools/k8s"
 
 	"github.com/go-logr/logr"
@@ -29,21 +30,31 @@ type EnvValueBuilder interface {
 	BuildEnvValue(context.Context, *korifiv1alpha1.CFApp) (map[string][]byte, error)
 }
 
+//counterfeiter:generate -o fake -fake-name ImageQuarantineChecker . ImageQuarantineChecker
+
+type ImageQuarantineChecker interface {
+	IsQuarantined(ctx context.Context, creds image.Creds, imageRef string) (bool, error)
+}
+
 type Reconciler struct {
 	log                       logr.Logger
 	k8sClient                 client.Client
 	scheme                    *runtime.Scheme
 	vcapServicesEnvBuilder    EnvValueBuilder
 	vcapApplicationEnvBuilder EnvValueBuilder
+	quarantineChecker         ImageQuarantineChecker
+	quarantineCheckInterval   time.Duration
 }
 
-func NewReconciler(k8sClient client.Client, scheme *runtime.Scheme, log logr.Logger, vcapServicesBuilder, vcapApplicationBuilder EnvValueBuilder) *k8s.PatchingReconciler[korifiv1alpha1.CFApp, *korifiv1alpha1.CFApp] {
+func NewReconciler(k8sClient client.Client, scheme *runtime.Scheme, log logr.Logger, vcapServicesBuilder, vcapApplicationBuilder EnvValueBuilder, quarantineChecker ImageQuarantineChecker, quarantineCheckInterval time.Duration) *k8s.PatchingReconciler[korifiv1alpha1.CFApp, *korifiv1alpha1.CFApp] {
 	appReconciler := Reconciler{
 		log:                       log,
 		k8sClient:                 k8sClient,
 		scheme:                    scheme,
 		vcapServicesEnvBuilder:    vcapServicesBuilder,
 		vcapApplicationEnvBuilder: vcapApplicationBuilder,
+		quarantineChecker:         quarantineChecker,
+		quarantineCheckInterval:   quarantineCheckInterval,
 	}
 	return k8s.NewPatchingReconciler[korifiv1alpha1.CFApp, *korifiv1alpha1.CFApp](log, k8sClient, &appReconciler)
 }
@@ -161,6 +172,16 @@ func (r *Reconciler) ReconcileResource(ctx context.Context, cfApp *korifiv1alpha
 		return ctrl.Result{}, err
 	}
 
+	// the quarantine of an image can be applied or lifted at any time, so it
+	// is checked again after quarantineCheckInterval. The CFProcesses are
+	// kept so that the app resumes once the quarantine is lifted; the process
+	// reconciler stops their workloads meanwhile
+	checkQuarantineAgain := ctrl.Result{RequeueAfter: r.quarantineCheckInterval}
+	if r.checkQuarantine(ctx, cfApp, droplet) {
+		readyConditionBuilder.WithReason(korifiv1alpha1.DropletQuarantinedReason)
+		return checkQuarantineAgain, nil
+	}
+
 	reconciledProcesses, err := r.reconcileProcesses(ctx, cfApp, droplet)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -169,11 +190,11 @@ func (r *Reconciler) ReconcileResource(ctx context.Context, cfApp *korifiv1alpha
 	cfApp.Status.ActualState = getActualState(reconciledProcesses)
 	if cfApp.Status.ActualState != cfApp.Spec.DesiredState {
 		readyConditionBuilder.WithReason("DesiredStateNotReached")
-		return ctrl.Result{}, nil
+		return checkQuarantineAgain, nil
 	}
 
 	readyConditionBuilder.Ready()
-	return ctrl.Result{}, nil
+	return checkQuarantineAgain, nil
 }
 
 func (r *Reconciler) serviceBindingsReady(ctx context.Context, cfApp *korifiv1alpha1.CFApp) (bool, error) {
@@ -225,6 +246,49 @@ func (r *Reconciler) getDroplet(ctx context.Context, cfApp *korifiv1alpha1.CFApp
 	return cfBuild.Status.Droplet, nil
 }
 
+// checkQuarantine records on the app whether the droplet image has been
+// quarantined, in which case the droplet must not be run. When the quarantine
+// cannot be checked, e.g. because the management API of the registry is
+// unavailable, the condition is set to unknown and the last decision is kept.
+func (r *Reconciler) checkQuarantine(ctx context.Context, cfApp *korifiv1alpha1.CFApp, droplet *korifiv1alpha1.BuildDropletStatus) bool {
+	secretNames := []string{}
+	for _, secretRef := range droplet.Registry.ImagePullSecrets {
+		secretNames = append(secretNames, secretRef.Name)
+	}
+
+	condition := metav1.Condition{
+		Type:               korifiv1alpha1.QuarantinedConditionType,
+		Status:             metav1.ConditionFalse,
+		Reason:             "DropletNotQuarantined",
+		ObservedGeneration: cfApp.Generation,
+	}
+
+	quarantined, err := r.quarantineChecker.IsQuarantined(ctx, image.Creds{
+		Namespace:   cfApp.Namespace,
+		SecretNames: secretNames,
+	}, droplet.Registry.Image)
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Info("error checking droplet image quarantine", "image", droplet.Registry.Image, "reason", err)
+
+		lastCondition := meta.FindStatusCondition(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)
+		quarantined = lastCondition != nil && lastCondition.Reason == korifiv1alpha1.DropletQuarantinedReason
+
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "QuarantineCheckFailed"
+		if quarantined {
+			condition.Reason = korifiv1alpha1.DropletQuarantinedReason
+		}
+		condition.Message = fmt.Sprintf("Cannot check whether droplet image %q is quarantined: %s", droplet.Registry.Image, err.Error())
+	} else if quarantined {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = korifiv1alpha1.DropletQuarantinedReason
+		condition.Message = fmt.Sprintf("Droplet image %q is quarantined", droplet.Registry.Image)
+	}
+	meta.SetStatusCondition(&cfApp.Status.Conditions, condition)
+
+	return quarantined
+}
+
 func (r *Reconciler) reconcileProcesses(ctx context.Context, cfApp *korifiv1alpha1.CFApp, droplet *korifiv1alpha1.BuildDropletStatus) ([]*korifiv1alpha1.CFProcess, error) {
 	log := logr.FromContextOrDiscard(ctx).WithName("startApp")
 
@@ -1,9 +1,12 @@
 package apps_test
 
 import (
+	"errors"
+
 	korifiv1alpha1 "code.cloudfoundry.org/korifi/controllers/api/v1alpha1"
 	. "code.cloudfoundry.org/korifi/tests/matchers"
 	"code.cloudfoundry.org/korifi/tools"
+	"code.cloudfoundry.org/korifi/tools/image"
 	"code.cloudfoundry.org/korifi/tools/k8s"
 
 	"github.com/google/uuid"
@@ -330,6 +333,177 @@ var _ = Describe("CFAppReconciler Integration Tests", func() {
 		})
 	})
 
+	It("checks whether the droplet image is quarantined", func() {
+		Eventually(func(g Gomega) {
+			g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+			g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+				HasType(Equal(korifiv1alpha1.QuarantinedConditionType)),
+				HasStatus(Equal(metav1.ConditionFalse)),
+			)))
+		}).Should(Succeed())
+
+		checkedImages := map[string]image.Creds{}
+		for i := range quarantineChecker.IsQuarantinedCallCount() {
+			_, creds, imageRef := quarantineChecker.IsQuarantinedArgsForCall(i)
+			if creds.Namespace == testNamespace {
+				checkedImages[imageRef] = creds
+			}
+		}
+		Expect(checkedImages).To(Equal(map[string]image.Creds{
+			"image/registry/url": {
+				Namespace:   testNamespace,
+				SecretNames: []string{"some-image-pull-secret"},
+			},
+		}))
+	})
+
+	When("the droplet image is quarantined", func() {
+		BeforeEach(func() {
+			quarantineChecker.IsQuarantinedReturns(true, nil)
+		})
+
+		It("sets the quarantined condition to true", func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+					HasType(Equal(korifiv1alpha1.QuarantinedConditionType)),
+					HasStatus(Equal(metav1.ConditionTrue)),
+					HasReason(Equal("DropletQuarantined")),
+				)))
+			}).Should(Succeed())
+		})
+
+		It("sets the ready condition to false", func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+					HasType(Equal(korifiv1alpha1.StatusConditionReady)),
+					HasStatus(Equal(metav1.ConditionFalse)),
+					HasReason(Equal("DropletQuarantined")),
+				)))
+			}).Should(Succeed())
+		})
+
+		It("does not create processes for the droplet", func() {
+			Consistently(func(g Gomega) {
+				cfProcessList := &korifiv1alpha1.CFProcessList{}
+				g.Expect(adminClient.List(ctx, cfProcessList, client.InNamespace(testNamespace))).To(Succeed())
+				g.Expect(cfProcessList.Items).To(BeEmpty())
+			}).Should(Succeed())
+		})
+
+		When("the quarantine is lifted", func() {
+			BeforeEach(func() {
+				Eventually(func(g Gomega) {
+					g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+					g.Expect(meta.IsStatusConditionTrue(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)).To(BeTrue())
+				}).Should(Succeed())
+
+				quarantineChecker.IsQuarantinedReturns(false, nil)
+			})
+
+			It("checks the quarantine again and creates the processes", func() {
+				Eventually(func(g Gomega) {
+					g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+					g.Expect(meta.IsStatusConditionFalse(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)).To(BeTrue())
+
+					cfProcessList := &korifiv1alpha1.CFProcessList{}
+					g.Expect(adminClient.List(ctx, cfProcessList, client.InNamespace(testNamespace))).To(Succeed())
+					g.Expect(cfProcessList.Items).NotTo(BeEmpty())
+				}).Should(Succeed())
+			})
+		})
+	})
+
+	When("the droplet image is quarantined after the app has been reconciled", func() {
+		BeforeEach(func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(cfApp.Status.Conditions, korifiv1alpha1.StatusConditionReady)).To(BeTrue())
+			}).Should(Succeed())
+
+			quarantineChecker.IsQuarantinedReturns(true, nil)
+		})
+
+		It("checks the quarantine again and quarantines the app", func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(meta.IsStatusConditionTrue(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)).To(BeTrue())
+			}).Should(Succeed())
+		})
+	})
+
+	When("checking the droplet image quarantine fails", func() {
+		BeforeEach(func() {
+			quarantineChecker.IsQuarantinedReturns(false, errors.New("registry unavailable"))
+		})
+
+		It("sets the quarantined condition to unknown", func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+					HasType(Equal(korifiv1alpha1.QuarantinedConditionType)),
+					HasStatus(Equal(metav1.ConditionUnknown)),
+					HasReason(Equal("QuarantineCheckFailed")),
+					HasMessage(ContainSubstring("registry unavailable")),
+				)))
+			}).Should(Succeed())
+		})
+
+		It("still reconciles the processes", func() {
+			Eventually(func(g Gomega) {
+				cfProcessList := &korifiv1alpha1.CFProcessList{}
+				g.Expect(adminClient.List(ctx, cfProcessList, client.InNamespace(testNamespace))).To(Succeed())
+				g.Expect(cfProcessList.Items).NotTo(BeEmpty())
+			}).Should(Succeed())
+		})
+
+		It("sets the ready condition to true", func() {
+			Eventually(func(g Gomega) {
+				g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+				g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+					HasType(Equal(korifiv1alpha1.StatusConditionReady)),
+					HasStatus(Equal(metav1.ConditionTrue)),
+				)))
+			}).Should(Succeed())
+		})
+
+		When("the droplet image was found quarantined before", func() {
+			BeforeEach(func() {
+				quarantineChecker.IsQuarantinedReturns(true, nil)
+				Expect(k8s.PatchResource(ctx, adminClient, cfApp, func() {
+					cfApp.Labels = map[string]string{"quarantine-check": "1"}
+				})).To(Succeed())
+				Eventually(func(g Gomega) {
+					g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+					g.Expect(meta.IsStatusConditionTrue(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)).To(BeTrue())
+				}).Should(Succeed())
+
+				quarantineChecker.IsQuarantinedReturns(false, errors.New("registry unavailable"))
+				Expect(k8s.PatchResource(ctx, adminClient, cfApp, func() {
+					cfApp.Labels["quarantine-check"] = "2"
+				})).To(Succeed())
+			})
+
+			It("keeps the app quarantined", func() {
+				Eventually(func(g Gomega) {
+					g.Expect(adminClient.Get(ctx, client.ObjectKeyFromObject(cfApp), cfApp)).To(Succeed())
+					g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+						HasType(Equal(korifiv1alpha1.QuarantinedConditionType)),
+						HasStatus(Equal(metav1.ConditionUnknown)),
+						HasReason(Equal(korifiv1alpha1.DropletQuarantinedReason)),
+						HasMessage(ContainSubstring("registry unavailable")),
+					)))
+					g.Expect(cfApp.Status.Conditions).To(ContainElement(SatisfyAll(
+						HasType(Equal(korifiv1alpha1.StatusConditionReady)),
+						HasStatus(Equal(metav1.ConditionFalse)),
+						HasReason(Equal(korifiv1alpha1.DropletQuarantinedReason)),
+					)))
+				}).Should(Succeed())
+			})
+		})
+	})
+
 	When("the app has a service binding", func() {
 		var binding *korifiv1alpha1.CFServiceBinding
 
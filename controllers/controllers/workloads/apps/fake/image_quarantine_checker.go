@@ -0,0 +1,122 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/controllers/controllers/workloads/apps"
+	"code.cloudfoundry.org/korifi/tools/image"
+)
+
+type ImageQuarantineChecker struct {
+	IsQuarantinedStub        func(context.Context, image.Creds, string) (bool, error)
+	isQuarantinedMutex       sync.RWMutex
+	isQuarantinedArgsForCall []struct {
+		arg1 context.Context
+		arg2 image.Creds
+		arg3 string
+	}
+	isQuarantinedReturns struct {
+		result1 bool
+		result2 error
+	}
+	isQuarantinedReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantined(arg1 context.Context, arg2 image.Creds, arg3 string) (bool, error) {
+	fake.isQuarantinedMutex.Lock()
+	ret, specificReturn := fake.isQuarantinedReturnsOnCall[len(fake.isQuarantinedArgsForCall)]
+	fake.isQuarantinedArgsForCall = append(fake.isQuarantinedArgsForCall, struct {
+		arg1 context.Context
+		arg2 image.Creds
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.IsQuarantinedStub
+	fakeReturns := fake.isQuarantinedReturns
+	fake.recordInvocation("IsQuarantined", []interface{}{arg1, arg2, arg3})
+	fake.isQuarantinedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantinedCallCount() int {
+	fake.isQuarantinedMutex.RLock()
+	defer fake.isQuarantinedMutex.RUnlock()
+	return len(fake.isQuarantinedArgsForCall)
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantinedCalls(stub func(context.Context, image.Creds, string) (bool, error)) {
+	fake.isQuarantinedMutex.Lock()
+	defer fake.isQuarantinedMutex.Unlock()
+	fake.IsQuarantinedStub = stub
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantinedArgsForCall(i int) (context.Context, image.Creds, string) {
+	fake.isQuarantinedMutex.RLock()
+	defer fake.isQuarantinedMutex.RUnlock()
+	argsForCall := fake.isQuarantinedArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantinedReturns(result1 bool, result2 error) {
+	fake.isQuarantinedMutex.Lock()
+	defer fake.isQuarantinedMutex.Unlock()
+	fake.IsQuarantinedStub = nil
+	fake.isQuarantinedReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *ImageQuarantineChecker) IsQuarantinedReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.isQuarantinedMutex.Lock()
+	defer fake.isQuarantinedMutex.Unlock()
+	fake.IsQuarantinedStub = nil
+	if fake.isQuarantinedReturnsOnCall == nil {
+		fake.isQuarantinedReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.isQuarantinedReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *ImageQuarantineChecker) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.isQuarantinedMutex.RLock()
+	defer fake.isQuarantinedMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *ImageQuarantineChecker) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ apps.ImageQuarantineChecker = new(ImageQuarantineChecker)
@@ -167,7 +167,7 @@ func (r *Reconciler) ReconcileResource(ctx context.Context, cfProcess *korifiv1a
 		}
 	}
 
-	err = r.cleanUpAppWorkloads(ctx, cfProcess, cfApp.Spec.DesiredState, cfLastStopAppRev)
+	err = r.cleanUpAppWorkloads(ctx, cfProcess, desiredAppState(cfApp), cfLastStopAppRev)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -191,8 +191,19 @@ func getActualInstances(appWorkloads []korifiv1alpha1.AppWorkload) int32 {
 	return actualInstances
 }
 
+// desiredAppState is the desired state of the app, except that an app whose
+// droplet image is quarantined is stopped until the quarantine is lifted. The
+// app stays stopped while the quarantine cannot be checked.
+func desiredAppState(cfApp *korifiv1alpha1.CFApp) korifiv1alpha1.AppState {
+	quarantined := meta.FindStatusCondition(cfApp.Status.Conditions, korifiv1alpha1.QuarantinedConditionType)
+	if quarantined != nil && quarantined.Reason == korifiv1alpha1.DropletQuarantinedReason {
+		return korifiv1alpha1.StoppedState
+	}
+	return cfApp.Spec.DesiredState
+}
+
 func needsAppWorkload(cfApp *korifiv1alpha1.CFApp, cfProcess *korifiv1alpha1.CFProcess) bool {
-	if cfApp.Spec.DesiredState != korifiv1alpha1.StartedState {
+	if desiredAppState(cfApp) != korifiv1alpha1.StartedState {
 		return false
 	}
 
@@ -13,6 +13,7 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gstruct"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -386,6 +387,68 @@ var _ = Describe("CFProcessReconciler Integration Tests", func() {
 			})
 		})
 
+		When("the droplet image of the CFApp is quarantined", func() {
+			JustBeforeEach(func() {
+				eventuallyCreatedAppWorkloadShould(func(g Gomega, appWorkload korifiv1alpha1.AppWorkload) {})
+				Expect(k8s.Patch(ctx, adminClient, cfApp, func() {
+					meta.SetStatusCondition(&cfApp.Status.Conditions, metav1.Condition{
+						Type:   korifiv1alpha1.QuarantinedConditionType,
+						Status: metav1.ConditionTrue,
+						Reason: korifiv1alpha1.DropletQuarantinedReason,
+					})
+				})).To(Succeed())
+			})
+
+			It("deletes the AppWorkloads", func() {
+				Eventually(func(g Gomega) {
+					var appWorkloads korifiv1alpha1.AppWorkloadList
+					g.Expect(adminClient.List(ctx, &appWorkloads, client.InNamespace(testNamespace))).To(Succeed())
+					g.Expect(appWorkloads.Items).To(BeEmpty())
+				}).Should(Succeed())
+			})
+		})
+
+		When("the quarantine of the droplet image of the CFApp cannot be checked", func() {
+			var reason string
+
+			BeforeEach(func() {
+				reason = "QuarantineCheckFailed"
+			})
+
+			JustBeforeEach(func() {
+				eventuallyCreatedAppWorkloadShould(func(g Gomega, appWorkload korifiv1alpha1.AppWorkload) {})
+				Expect(k8s.Patch(ctx, adminClient, cfApp, func() {
+					meta.SetStatusCondition(&cfApp.Status.Conditions, metav1.Condition{
+						Type:   korifiv1alpha1.QuarantinedConditionType,
+						Status: metav1.ConditionUnknown,
+						Reason: reason,
+					})
+				})).To(Succeed())
+			})
+
+			It("keeps the AppWorkloads", func() {
+				Consistently(func(g Gomega) {
+					var appWorkloads korifiv1alpha1.AppWorkloadList
+					g.Expect(adminClient.List(ctx, &appWorkloads, client.InNamespace(testNamespace))).To(Succeed())
+					g.Expect(appWorkloads.Items).NotTo(BeEmpty())
+				}).Should(Succeed())
+			})
+
+			When("the droplet image was last found quarantined", func() {
+				BeforeEach(func() {
+					reason = korifiv1alpha1.DropletQuarantinedReason
+				})
+
+				It("deletes the AppWorkloads", func() {
+					Eventually(func(g Gomega) {
+						var appWorkloads korifiv1alpha1.AppWorkloadList
+						g.Expect(adminClient.List(ctx, &appWorkloads, client.InNamespace(testNamespace))).To(Succeed())
+						g.Expect(appWorkloads.Items).To(BeEmpty())
+					}).Should(Succeed())
+				})
+			})
+		})
+
 		When("the app process instances are scaled down to 0", func() {
 			JustBeforeEach(func() {
 				eventuallyCreatedAppWorkloadShould(func(g Gomega, appWorkload korifiv1alpha1.AppWorkload) {})
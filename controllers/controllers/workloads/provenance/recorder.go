@@ -0,0 +1,67 @@
+package provenance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	korifiv1alpha1 "code.cloudfoundry.org/korifi/controllers/api/v1alpha1"
+	"code.cloudfoundry.org/korifi/tools/image"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Recorder is an image.ProvenanceRecorder storing image provenance as
+// ImageProvenance resources in the namespace of the pusher creds. There is
+// one resource per image digest and repository, named sha256-<hex>-<repository
+// hash>, updated when the same image is pushed to the same repository again.
+// Pushes of the image to other repositories are recorded separately.
+type Recorder struct {
+	k8sClient client.Client
+}
+
+func NewRecorder(k8sClient client.Client) *Recorder {
+	return &Recorder{k8sClient: k8sClient}
+}
+
+func (r *Recorder) Record(ctx context.Context, provenance image.ImageProvenanceSpec) error {
+	imageProvenance := &korifiv1alpha1.ImageProvenance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: provenance.Pusher.Namespace,
+			Name:      resourceName(provenance),
+		},
+	}
+
+	_, err := controllerutil.CreateOrPatch(ctx, r.k8sClient, imageProvenance, func() error {
+		imageProvenance.Spec = korifiv1alpha1.ImageProvenanceSpec{
+			Image:    provenance.Image,
+			Digest:   provenance.Digest,
+			Tags:     provenance.Tags,
+			PushedAt: metav1.NewTime(provenance.PushedAt),
+			Pusher: korifiv1alpha1.ImagePusher{
+				Namespace:          provenance.Pusher.Namespace,
+				SecretNames:        provenance.Pusher.SecretNames,
+				ServiceAccountName: provenance.Pusher.ServiceAccountName,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or patch image provenance %s/%s: %w", imageProvenance.Namespace, imageProvenance.Name, err)
+	}
+
+	return nil
+}
+
+// resourceName returns the name of the ImageProvenance of the image pushed to
+// the repository of provenance.Image, made of the image digest and a hash of
+// the repository as repository names can be longer than resource names
+func resourceName(provenance image.ImageProvenanceSpec) string {
+	repo, _, _ := strings.Cut(provenance.Image, "@")
+	repoHash := sha256.Sum256([]byte(repo))
+	return strings.Replace(provenance.Digest, ":", "-", 1) + "-" + hex.EncodeToString(repoHash[:8])
+}
@@ -0,0 +1,107 @@
+package provenance_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	korifiv1alpha1 "code.cloudfoundry.org/korifi/controllers/api/v1alpha1"
+	"code.cloudfoundry.org/korifi/controllers/controllers/workloads/provenance"
+	"code.cloudfoundry.org/korifi/tools/image"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		recorder       *provenance.Recorder
+		pushProvenance image.ImageProvenanceSpec
+		pushedAt       time.Time
+		recordErr      error
+	)
+
+	BeforeEach(func() {
+		recorder = provenance.NewRecorder(k8sClient)
+
+		digest := sha256.Sum256([]byte(uuid.NewString()))
+		pushedAt = time.Now().Truncate(time.Second)
+		pushProvenance = image.ImageProvenanceSpec{
+			Image:    "registry.example.com/apps/app@sha256:" + hex.EncodeToString(digest[:]),
+			Digest:   "sha256:" + hex.EncodeToString(digest[:]),
+			Tags:     []string{"latest"},
+			PushedAt: pushedAt,
+			Pusher: image.Creds{
+				Namespace:          testNamespace,
+				ServiceAccountName: "kpack-service-account",
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		recordErr = recorder.Record(ctx, pushProvenance)
+	})
+
+	resourceName := func(repo string) string {
+		repoHash := sha256.Sum256([]byte(repo))
+		return strings.Replace(pushProvenance.Digest, ":", "-", 1) + "-" + hex.EncodeToString(repoHash[:8])
+	}
+
+	getProvenance := func(repo string) *korifiv1alpha1.ImageProvenance {
+		GinkgoHelper()
+
+		imageProvenance := &korifiv1alpha1.ImageProvenance{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{
+			Namespace: testNamespace,
+			Name:      resourceName(repo),
+		}, imageProvenance)).To(Succeed())
+		return imageProvenance
+	}
+
+	It("creates an ImageProvenance named after the digest and repository in the pusher namespace", func() {
+		Expect(recordErr).NotTo(HaveOccurred())
+		Expect(getProvenance("registry.example.com/apps/app").Spec).To(Equal(korifiv1alpha1.ImageProvenanceSpec{
+			Image:    pushProvenance.Image,
+			Digest:   pushProvenance.Digest,
+			Tags:     []string{"latest"},
+			PushedAt: metav1.NewTime(pushedAt),
+			Pusher: korifiv1alpha1.ImagePusher{
+				Namespace:          testNamespace,
+				ServiceAccountName: "kpack-service-account",
+			},
+		}))
+	})
+
+	When("the image is pushed again", func() {
+		JustBeforeEach(func() {
+			Expect(recordErr).NotTo(HaveOccurred())
+
+			pushProvenance.Tags = []string{"v2"}
+			recordErr = recorder.Record(ctx, pushProvenance)
+		})
+
+		It("updates the ImageProvenance", func() {
+			Expect(recordErr).NotTo(HaveOccurred())
+			Expect(getProvenance("registry.example.com/apps/app").Spec.Tags).To(Equal([]string{"v2"}))
+		})
+	})
+
+	When("the image is pushed to another repository", func() {
+		JustBeforeEach(func() {
+			Expect(recordErr).NotTo(HaveOccurred())
+
+			pushProvenance.Image = "registry.example.com/apps/other@" + pushProvenance.Digest
+			recordErr = recorder.Record(ctx, pushProvenance)
+		})
+
+		It("records both pushes", func() {
+			Expect(recordErr).NotTo(HaveOccurred())
+			Expect(getProvenance("registry.example.com/apps/app").Spec.Image).To(HavePrefix("registry.example.com/apps/app@"))
+			Expect(getProvenance("registry.example.com/apps/other").Spec.Image).To(HavePrefix("registry.example.com/apps/other@"))
+		})
+	})
+})
@@ -164,7 +164,20 @@ func main() {
 	}
 
 	if os.Getenv("ENABLE_CONTROLLERS") != "false" {
-		imageClient := image.NewClient(k8sClient)
+		imageOpts := []image.Option{}
+		// images are only quarantined by registries with a management API,
+		// there is nothing to check again otherwise
+		var quarantineCheckInterval time.Duration
+		if controllerConfig.RepositoryManagementAPI != "" {
+			imageOpts = append(imageOpts, image.WithRepositoryManagementAPI(controllerConfig.RepositoryManagementAPI))
+
+			quarantineCheckInterval, err = controllerConfig.ParseQuarantineCheckInterval()
+			if err != nil {
+				setupLog.Error(err, "failed to parse quarantine check interval", "controller", "CFApp", "quarantineCheckInterval", controllerConfig.QuarantineCheckInterval)
+				os.Exit(1)
+			}
+		}
+		imageClient := image.NewClient(k8sClient, imageOpts...)
 
 		if err = apps.NewReconciler(
 			mgr.GetClient(),
@@ -172,6 +185,8 @@ func main() {
 			ctrl.Log.WithName("controllers").WithName("CFApp"),
 			env.NewVCAPServicesEnvValueBuilder(mgr.GetClient()),
 			env.NewVCAPApplicationEnvValueBuilder(mgr.GetClient(), controllerConfig.ExtraVCAPApplicationValues),
+			imageClient,
+			quarantineCheckInterval,
 		).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "CFApp")
 			os.Exit(1)
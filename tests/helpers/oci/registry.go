@@ -76,6 +76,8 @@ func NewContainerRegistry(username, password string) *Registry {
 				"inmemory": configuration.Parameters{},
 				"delete":   configuration.Parameters{"enabled": true},
 			},
+			// the default applied when the config is read from a file
+			Catalog:  configuration.Catalog{MaxEntries: 1000},
 			Loglevel: "debug",
 		})),
 		username: username,
@@ -97,6 +99,8 @@ func NewNoAuthContainerRegistry() *Registry {
 				"inmemory": configuration.Parameters{},
 				"delete":   configuration.Parameters{"enabled": true},
 			},
+			// the default applied when the config is read from a file
+			Catalog:  configuration.Catalog{MaxEntries: 1000},
 			Loglevel: "debug",
 		})),
 	}
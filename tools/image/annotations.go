@@ -0,0 +1,108 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ErrAnnotationConflict is returned by AnnotateManifest in strict mode when
+// an annotation would replace an existing one with a different value
+var ErrAnnotationConflict = errors.New("annotation conflicts with an existing annotation")
+
+// WithStrictAnnotations makes AnnotateManifest fail with
+// ErrAnnotationConflict instead of replacing the value of annotations that
+// are already set on the manifest
+func WithStrictAnnotations(enabled bool) Option {
+	return func(c *Client) {
+		c.strictAnnotations = enabled
+	}
+}
+
+// AnnotateManifest adds the annotations to the manifest of the image or image
+// index at imageRef and returns the digest ref of the updated manifest. Only
+// the manifest is uploaded, the layers are left as they are. When imageRef
+// is a tag it is moved to the updated manifest; a manifest referenced by
+// digest is kept and the updated one is only reachable by its new digest.
+func (c Client) AnnotateManifest(ctx context.Context, creds Creds, imageRef string, annotations map[string]string) (string, error) {
+	c.logger.V(1).Info("annotating manifest", "ref", imageRef)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get manifest: %w", err))
+	}
+
+	existing, err := manifestAnnotations(descriptor.Manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to read annotations of %s: %w", imageRef, err)
+	}
+	if c.strictAnnotations {
+		if conflicts := conflictingAnnotations(existing, annotations); len(conflicts) > 0 {
+			return "", fmt.Errorf("%w: %v", ErrAnnotationConflict, conflicts)
+		}
+	}
+
+	original, err := descriptorArtifact(descriptor)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to read manifest: %w", err))
+	}
+	annotated := annotateArtifact(original, annotations)
+
+	digest, err := annotated.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get digest of annotated manifest: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write-manifest", func() error {
+		return remote.Put(ref.Context().Digest(digest.String()), annotated, writeOpts...)
+	})
+	if err != nil {
+		return "", pushError(imageRef, fmt.Errorf("failed to upload annotated manifest: %w", err))
+	}
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: annotated,
+		digest:   digest,
+		tags:     refTags(ref, nil),
+	}, writeOpts)
+}
+
+// conflictingAnnotations returns the sorted keys of annotations that are
+// set to another value in existing
+func conflictingAnnotations(existing, annotations map[string]string) []string {
+	conflicts := []string{}
+	for key, value := range annotations {
+		if existingValue, ok := existing[key]; ok && existingValue != value {
+			conflicts = append(conflicts, key)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// manifestAnnotations returns the annotations of an image manifest or image
+// index
+func manifestAnnotations(rawManifest []byte) (map[string]string, error) {
+	var manifest struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest.Annotations, nil
+}
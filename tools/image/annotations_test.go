@@ -0,0 +1,171 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AnnotateManifest", func() {
+	var (
+		mutex          sync.Mutex
+		blobUploads    int
+		creds          image.Creds
+		repoRef        string
+		imgRef         string
+		originalDigest string
+		annotations    map[string]string
+		annotatedRef   string
+		annotateErr    error
+	)
+
+	BeforeEach(func() {
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/blobs/uploads/") {
+				mutex.Lock()
+				blobUploads++
+				mutex.Unlock()
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{Namespace: "default"}
+		repoRef = serverURL.Host + "/annotate/" + uuid.NewString()
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		digestRef, err := imgClient.PushWithAnnotations(ctx, creds, repoRef, zipFile, map[string]string{
+			"org.opencontainers.image.title": "jim",
+		}, "jim")
+		Expect(err).NotTo(HaveOccurred())
+		originalDigest = strings.Split(digestRef, "@")[1]
+
+		mutex.Lock()
+		blobUploads = 0
+		mutex.Unlock()
+
+		imgRef = repoRef + ":jim"
+		annotations = map[string]string{"org.opencontainers.image.vendor": "Cloud Foundry"}
+	})
+
+	JustBeforeEach(func() {
+		annotatedRef, annotateErr = imgClient.AnnotateManifest(ctx, creds, imgRef, annotations)
+	})
+
+	It("adds the annotations to the manifest", func() {
+		Expect(annotateErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, annotatedRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Annotations).To(Equal(map[string]string{
+			"org.opencontainers.image.title":  "jim",
+			"org.opencontainers.image.vendor": "Cloud Foundry",
+		}))
+	})
+
+	It("moves the tag to the annotated manifest", func() {
+		Expect(annotateErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(annotatedRef).To(Equal(repoRef + "@" + digest))
+		Expect(digest).NotTo(Equal(originalDigest))
+	})
+
+	It("does not upload the layers again", func() {
+		Expect(annotateErr).NotTo(HaveOccurred())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(blobUploads).To(BeZero())
+	})
+
+	When("the image is referenced by digest", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + "@" + originalDigest
+		})
+
+		It("keeps the tags", func() {
+			Expect(annotateErr).NotTo(HaveOccurred())
+			Expect(annotatedRef).NotTo(HaveSuffix(originalDigest))
+
+			digest, err := imgClient.Digest(ctx, creds, repoRef+":jim")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(originalDigest))
+
+			exists, err := imgClient.Exists(ctx, creds, annotatedRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+		})
+	})
+
+	When("strict mode is enabled", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithStrictAnnotations(true))
+			annotations["org.opencontainers.image.title"] = "bob"
+		})
+
+		It("fails on conflicting annotations", func() {
+			Expect(annotateErr).To(MatchError(image.ErrAnnotationConflict))
+			Expect(annotateErr).To(MatchError(ContainSubstring("org.opencontainers.image.title")))
+
+			digest, err := imgClient.Digest(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(originalDigest))
+		})
+
+		When("the existing annotations are set to the same value", func() {
+			BeforeEach(func() {
+				annotations["org.opencontainers.image.title"] = "jim"
+			})
+
+			It("succeeds", func() {
+				Expect(annotateErr).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	When("strict mode is disabled", func() {
+		BeforeEach(func() {
+			annotations["org.opencontainers.image.title"] = "bob"
+		})
+
+		It("replaces existing annotations", func() {
+			Expect(annotateErr).NotTo(HaveOccurred())
+
+			config, err := imgClient.Config(ctx, creds, annotatedRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Annotations).To(HaveKeyWithValue("org.opencontainers.image.title", "bob"))
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + ":missing"
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(annotateErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,148 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ErrAttestationSupportDisabled is returned by AttachAttestation and
+// GetAttestation unless the client was created with WithAttestationSupport
+var ErrAttestationSupportDisabled = errors.New("attestation support is not enabled")
+
+// WithAttestationSupport enables AttachAttestation and GetAttestation. It is
+// disabled by default as registries without the OCI Referrers API keep the
+// referrers of an image in a sha256-<hex> fallback tag, which shows up in
+// the tags of the repository.
+func WithAttestationSupport(enabled bool) Option {
+	return func(c *Client) {
+		c.attestationSupport = enabled
+	}
+}
+
+// AttachAttestation attaches the attestation (e.g. SLSA provenance in an
+// in-toto statement) to the image as an OCI referrer whose artifact type is
+// mediaType. A tag in imageRef is resolved, so the attestation refers to the
+// digest the tag points to at the time of the call.
+func (c Client) AttachAttestation(ctx context.Context, creds Creds, imageRef string, attestation []byte, mediaType string) error {
+	c.logger.V(1).Info("attaching attestation", "ref", imageRef, "mediaType", mediaType)
+	if !c.attestationSupport {
+		return ErrAttestationSupportDisabled
+	}
+	if mediaType == "" {
+		return errors.New("an attestation media type is required")
+	}
+
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("error parsing image reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	subject, err := remote.Head(ref, remoteOpts...)
+	if err != nil {
+		return registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	attestationImage, err := referrerImage(*subject, attestation, types.MediaType(mediaType))
+	if err != nil {
+		return fmt.Errorf("failed to create attestation image: %w", err)
+	}
+
+	attestationDigest, err := attestationImage.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get attestation digest: %w", err)
+	}
+
+	attestationRef := ref.Context().Digest(attestationDigest.String())
+	err = c.retryOnError("attach-attestation", func() error {
+		return remote.Write(attestationRef, attestationImage, append(remoteOpts, c.remoteRetryOpts()...)...)
+	})
+	if err != nil {
+		return pushError(imageRef, fmt.Errorf("failed to upload attestation: %w", err))
+	}
+
+	return nil
+}
+
+// GetAttestation returns the attestation of type mediaType attached to the
+// image with AttachAttestation. A NotFoundError is returned if there is
+// none. When several are attached the one listed last by the registry is
+// returned.
+func (c Client) GetAttestation(ctx context.Context, creds Creds, imageRef, mediaType string) ([]byte, error) {
+	c.logger.V(1).Info("fetching attestation", "ref", imageRef, "mediaType", mediaType)
+	if !c.attestationSupport {
+		return nil, ErrAttestationSupportDisabled
+	}
+
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing image reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	subject, err := remote.Head(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	referrers, err := remote.Referrers(ref.Context().Digest(subject.Digest.String()), append(remoteOpts, remote.WithFilter("artifactType", mediaType))...)
+	if err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to list referrers: %w", err))
+	}
+
+	referrersManifest, err := referrers.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read referrers of %s: %w", imageRef, err)
+	}
+
+	// the filter is only a hint that registries are free to ignore
+	for i := len(referrersManifest.Manifests) - 1; i >= 0; i-- {
+		if referrersManifest.Manifests[i].ArtifactType != mediaType {
+			continue
+		}
+
+		return readAttestation(ref.Context().Digest(referrersManifest.Manifests[i].Digest.String()), remoteOpts)
+	}
+
+	return nil, &NotFoundError{
+		Ref:   imageRef,
+		Cause: fmt.Errorf("no attestation of type %s is attached to %s", mediaType, imageRef),
+	}
+}
+
+func readAttestation(ref name.Digest, remoteOpts []remote.Option) ([]byte, error) {
+	attestationImage, err := remote.Image(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(ref.String(), fmt.Errorf("failed to get attestation: %w", err))
+	}
+
+	layers, err := attestationImage.Layers()
+	if err != nil {
+		return nil, registryError(ref.String(), fmt.Errorf("failed to get attestation layers: %w", err))
+	}
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("attestation %s has %d layers, expected 1", ref, len(layers))
+	}
+
+	layerReader, err := layers[0].Uncompressed()
+	if err != nil {
+		return nil, registryError(ref.String(), fmt.Errorf("failed to read attestation: %w", err))
+	}
+	defer layerReader.Close()
+
+	return io.ReadAll(layerReader)
+}
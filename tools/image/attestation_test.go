@@ -0,0 +1,95 @@
+package image_test
+
+import (
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Attestations", func() {
+	const provenanceMediaType = "application/vnd.in-toto+json"
+
+	var (
+		creds       image.Creds
+		imgRef      string
+		attestation []byte
+		mediaType   string
+		attachErr   error
+	)
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgClient = image.NewClient(k8sClientset, image.WithAttestationSupport(true))
+		attestation = []byte(`{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1"}`)
+		mediaType = provenanceMediaType
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, err = imgClient.Push(ctx, creds, containerRegistry.ImageRef("attestation/"+uuid.NewString()), zipFile, "jim")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		attachErr = imgClient.AttachAttestation(ctx, creds, imgRef, attestation, mediaType)
+	})
+
+	It("attaches the attestation to the image", func() {
+		Expect(attachErr).NotTo(HaveOccurred())
+
+		fetched, err := imgClient.GetAttestation(ctx, creds, imgRef, provenanceMediaType)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched).To(Equal(attestation))
+	})
+
+	It("does not return attestations of other types", func() {
+		Expect(attachErr).NotTo(HaveOccurred())
+
+		_, err := imgClient.GetAttestation(ctx, creds, imgRef, "application/vnd.cyclonedx+json")
+		var notFoundErr *image.NotFoundError
+		Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+		Expect(notFoundErr.Ref).To(Equal(imgRef))
+	})
+
+	When("no media type is given", func() {
+		BeforeEach(func() {
+			mediaType = ""
+		})
+
+		It("fails", func() {
+			Expect(attachErr).To(MatchError(ContainSubstring("media type is required")))
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef("attestation/" + uuid.NewString() + ":missing")
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(attachErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+
+	When("attestation support is disabled", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+		})
+
+		It("fails", func() {
+			Expect(attachErr).To(MatchError(image.ErrAttestationSupportDisabled))
+
+			_, err := imgClient.GetAttestation(ctx, creds, imgRef, provenanceMediaType)
+			Expect(err).To(MatchError(image.ErrAttestationSupportDisabled))
+		})
+	})
+})
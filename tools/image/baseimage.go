@@ -0,0 +1,67 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	baseImageLabel       = "io.buildpacks.base.image"
+	baseImageDigestLabel = "io.buildpacks.base.digest"
+	builderImageLabel    = "io.buildpacks.builder.image"
+)
+
+var ErrNoBaseImageInfo = errors.New("image does not record its base or builder image")
+
+// GetBaseImage returns the ref of the image the app image was built from,
+// taken from its io.buildpacks.base.image label or, failing that, its
+// io.buildpacks.builder.image label. ErrNoBaseImageInfo is returned when the
+// image has neither.
+func (c Client) GetBaseImage(ctx context.Context, creds Creds, imageRef string) (string, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return "", err
+	}
+
+	for _, label := range []string{baseImageLabel, builderImageLabel} {
+		if baseImageRef := config.Labels[label]; baseImageRef != "" {
+			return baseImageRef, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNoBaseImageInfo, imageRef)
+}
+
+// IsBaseImageStale reports whether the base image recorded in the
+// io.buildpacks.base.image label of the image now points to a different
+// digest than the one recorded in its io.buildpacks.base.digest label. When
+// it does, the new digest (sha256:<hex>) is returned so that the app can be
+// restaged on it. Both labels are required.
+func (c Client) IsBaseImageStale(ctx context.Context, creds Creds, imageRef string) (bool, string, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return false, "", err
+	}
+
+	baseImageRef := config.Labels[baseImageLabel]
+	if baseImageRef == "" {
+		return false, "", fmt.Errorf("image %s has no %s label", imageRef, baseImageLabel)
+	}
+
+	recordedDigest := config.Labels[baseImageDigestLabel]
+	if recordedDigest == "" {
+		return false, "", fmt.Errorf("image %s has no %s label", imageRef, baseImageDigestLabel)
+	}
+
+	currentDigest, err := c.Digest(ctx, creds, baseImageRef)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to resolve base image %s: %w", baseImageRef, err)
+	}
+
+	if currentDigest == recordedDigest {
+		return false, "", nil
+	}
+
+	return true, currentDigest, nil
+}
@@ -0,0 +1,167 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IsBaseImageStale", func() {
+	var (
+		creds        image.Creds
+		baseImageRef string
+		baseDigest   string
+		imgRef       string
+		labels       map[string]string
+		stale        bool
+		newDigest    string
+		staleErr     error
+	)
+
+	pushBaseImage := func(user string) string {
+		GinkgoHelper()
+
+		containerRegistry.PushImage(baseImageRef, &v1.ConfigFile{Config: v1.Config{User: user}})
+		digest, err := imgClient.Digest(ctx, creds, baseImageRef)
+		Expect(err).NotTo(HaveOccurred())
+		return digest
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		baseImageRef = containerRegistry.ImageRef("baseimage/" + uuid.NewString() + ":latest")
+		baseDigest = pushBaseImage("cnb")
+
+		imgRef = containerRegistry.ImageRef("baseimage/" + uuid.NewString())
+		labels = map[string]string{
+			"io.buildpacks.base.image":  baseImageRef,
+			"io.buildpacks.base.digest": baseDigest,
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: labels}})
+		stale, newDigest, staleErr = imgClient.IsBaseImageStale(ctx, creds, imgRef)
+	})
+
+	It("reports the base image is up to date", func() {
+		Expect(staleErr).NotTo(HaveOccurred())
+		Expect(stale).To(BeFalse())
+		Expect(newDigest).To(BeEmpty())
+	})
+
+	When("the base image has been updated", func() {
+		var updatedDigest string
+
+		BeforeEach(func() {
+			updatedDigest = pushBaseImage("patched")
+		})
+
+		It("returns the new digest", func() {
+			Expect(staleErr).NotTo(HaveOccurred())
+			Expect(stale).To(BeTrue())
+			Expect(newDigest).To(Equal(updatedDigest))
+			Expect(newDigest).NotTo(Equal(baseDigest))
+		})
+	})
+
+	When("the image does not record its base image", func() {
+		BeforeEach(func() {
+			delete(labels, "io.buildpacks.base.image")
+		})
+
+		It("fails", func() {
+			Expect(staleErr).To(MatchError(ContainSubstring("has no io.buildpacks.base.image label")))
+		})
+	})
+
+	When("the image does not record the base image digest", func() {
+		BeforeEach(func() {
+			delete(labels, "io.buildpacks.base.digest")
+		})
+
+		It("fails", func() {
+			Expect(staleErr).To(MatchError(ContainSubstring("has no io.buildpacks.base.digest label")))
+		})
+	})
+
+	When("the base image no longer exists", func() {
+		BeforeEach(func() {
+			labels["io.buildpacks.base.image"] = containerRegistry.ImageRef("baseimage/" + uuid.NewString())
+		})
+
+		It("fails", func() {
+			Expect(staleErr).To(MatchError(ContainSubstring("failed to resolve base image")))
+		})
+	})
+})
+
+var _ = Describe("GetBaseImage", func() {
+	var (
+		creds        image.Creds
+		imgRef       string
+		labels       map[string]string
+		baseImageRef string
+		getErr       error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("baseimage/" + uuid.NewString())
+		labels = map[string]string{
+			"io.buildpacks.base.image":    "index.docker.io/paketobuildpacks/run-jammy-base:latest",
+			"io.buildpacks.builder.image": "index.docker.io/paketobuildpacks/builder-jammy-base:latest",
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: labels}})
+		baseImageRef, getErr = imgClient.GetBaseImage(ctx, creds, imgRef)
+	})
+
+	It("returns the base image", func() {
+		Expect(getErr).NotTo(HaveOccurred())
+		Expect(baseImageRef).To(Equal("index.docker.io/paketobuildpacks/run-jammy-base:latest"))
+	})
+
+	When("only the builder image is recorded", func() {
+		BeforeEach(func() {
+			delete(labels, "io.buildpacks.base.image")
+		})
+
+		It("returns the builder image", func() {
+			Expect(getErr).NotTo(HaveOccurred())
+			Expect(baseImageRef).To(Equal("index.docker.io/paketobuildpacks/builder-jammy-base:latest"))
+		})
+	})
+
+	When("neither is recorded", func() {
+		BeforeEach(func() {
+			labels = map[string]string{"foo": "bar"}
+		})
+
+		It("returns ErrNoBaseImageInfo", func() {
+			Expect(getErr).To(MatchError(image.ErrNoBaseImageInfo))
+		})
+	})
+
+	When("the image does not exist", func() {
+		JustBeforeEach(func() {
+			_, getErr = imgClient.GetBaseImage(ctx, creds, imgRef+":not-a-tag")
+		})
+
+		It("fails", func() {
+			Expect(getErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	defaultBuildLogPollInterval = 2 * time.Second
+	buildCompleteHeader         = "X-Build-Complete"
+)
+
+// ErrNotSupported is returned when the registry does not support an
+// operation
+var ErrNotSupported = errors.New("operation not supported by the registry")
+
+// WithBuildLogPollInterval sets how often StreamBuildLog polls for new log
+// output. Defaults to 2s.
+func WithBuildLogPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.buildLogPollInterval = interval
+	}
+}
+
+// StreamBuildLog writes the log of the build of the image at buildRef to w
+// as it is produced, until the build completes or ctx is done. The log is
+// polled from the build-log endpoint of the artifact in the management API
+// set with WithRepositoryManagementAPI:
+//
+//	GET <api>/repositories/<repository>/artifacts/<tag or digest>/build-log?offset=<bytes>
+//
+// The endpoint answers with a 200 whose body is the log output after offset,
+// possibly empty, and sets the X-Build-Complete: true header once the build
+// is over. A build that does not exist is a 404 with a JSON error body, e.g.
+// {"errors":[{"code":"NOT_FOUND","message":"..."}]}. Transient failures,
+// such as 503s, are retried at the next poll. ErrNotSupported is returned
+// when no management API is configured or the registry has no build-log
+// endpoint, i.e. the first poll is answered with a 405, a 501 or a 404
+// without a JSON error body.
+func (c Client) StreamBuildLog(ctx context.Context, creds Creds, buildRef string, w io.Writer) error {
+	ref, err := c.parseReference(buildRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", buildRef, err)
+	}
+
+	if c.repositoryManagementAPI == "" {
+		return fmt.Errorf("%w: build logs need a repository management API", ErrNotSupported)
+	}
+	c.logger.V(1).Info("streaming build log", "ref", buildRef)
+
+	interval := c.buildLogPollInterval
+	if interval <= 0 {
+		interval = defaultBuildLogPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	offset := int64(0)
+	for polls := 0; ; polls++ {
+		written, complete, err := c.pollBuildLog(ctx, creds, ref, offset, polls == 0, w)
+		offset += written
+		switch {
+		case err == nil && complete:
+			return nil
+		case err != nil && ctx.Err() == nil && isRetryable(err):
+			c.logger.Info("failed to poll build log - retrying", "ref", buildRef, "reason", err)
+		case err != nil:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollBuildLog copies the log output after offset to w and reports whether
+// the build is complete. A 404 without a JSON error body on the first poll
+// comes from a management API without the build-log endpoint rather than
+// from a missing build.
+func (c Client) pollBuildLog(ctx context.Context, creds Creds, ref name.Reference, offset int64, first bool, w io.Writer) (int64, bool, error) {
+	buildRef := ref.String()
+	path := fmt.Sprintf("%s/build-log?offset=%d", artifactPath(ref), offset)
+	resp, err := c.managementAPIRequest(ctx, creds, ref.Context(), http.MethodGet, path, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		return 0, false, fmt.Errorf("%w: build logs of %s", ErrNotSupported, buildRef)
+	}
+
+	if err = transport.CheckError(resp, http.StatusOK); err != nil {
+		var transportErr *transport.Error
+		if first && errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound && len(transportErr.Errors) == 0 {
+			return 0, false, fmt.Errorf("%w: build logs of %s", ErrNotSupported, buildRef)
+		}
+		return 0, false, registryError(buildRef, fmt.Errorf("failed to get build log: %w", err))
+	}
+
+	written, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return written, false, fmt.Errorf("failed to copy build log: %w", err)
+	}
+
+	return written, resp.Header.Get(buildCompleteHeader) == "true", nil
+}
@@ -0,0 +1,186 @@
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StreamBuildLog", func() {
+	const buildLog = "===> DETECTING\n===> BUILDING\n===> EXPORTING\n"
+
+	var (
+		mutex     sync.Mutex
+		chunkSize int
+		failures  map[int]int
+		requests  []string
+		logStatus int
+		logBody   string
+		streamCtx context.Context
+		onRequest func(count int)
+		creds     image.Creds
+		buildRef  string
+		output    *bytes.Buffer
+		streamErr error
+	)
+
+	BeforeEach(func() {
+		chunkSize = 15
+		failures = map[int]int{}
+		requests = nil
+		logStatus = http.StatusOK
+		logBody = ""
+		onRequest = func(int) {}
+
+		managementAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			requests = append(requests, r.URL.RequestURI())
+			onRequest(len(requests))
+			if status := failures[len(requests)]; status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+			if logStatus != http.StatusOK {
+				w.WriteHeader(logStatus)
+				_, err := w.Write([]byte(logBody))
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+
+			offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+			Expect(err).NotTo(HaveOccurred())
+			end := min(offset+chunkSize, len(buildLog))
+			if end == len(buildLog) {
+				w.Header().Set("X-Build-Complete", "true")
+			}
+			_, err = w.Write([]byte(buildLog[offset:end]))
+			Expect(err).NotTo(HaveOccurred())
+		}))
+		DeferCleanup(managementAPI.Close)
+
+		imgClient = image.NewClient(k8sClientset,
+			image.WithRepositoryManagementAPI(managementAPI.URL+"/api/v2.0"),
+			image.WithBuildLogPollInterval(10*time.Millisecond),
+		)
+		streamCtx = ctx
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		buildRef = containerRegistry.ImageRef("buildlog/app") + ":build-1"
+		output = &bytes.Buffer{}
+	})
+
+	JustBeforeEach(func() {
+		streamErr = imgClient.StreamBuildLog(streamCtx, creds, buildRef, output)
+	})
+
+	It("writes the log until the build completes", func() {
+		Expect(streamErr).NotTo(HaveOccurred())
+		Expect(output.String()).To(Equal(buildLog))
+		Expect(requests).To(Equal([]string{
+			"/api/v2.0/repositories/buildlog%2Fapp/artifacts/build-1/build-log?offset=0",
+			"/api/v2.0/repositories/buildlog%2Fapp/artifacts/build-1/build-log?offset=15",
+			"/api/v2.0/repositories/buildlog%2Fapp/artifacts/build-1/build-log?offset=30",
+		}))
+	})
+
+	When("the registry is temporarily unavailable", func() {
+		BeforeEach(func() {
+			failures[2] = http.StatusServiceUnavailable
+			failures[3] = http.StatusServiceUnavailable
+		})
+
+		It("retries at the next poll", func() {
+			Expect(streamErr).NotTo(HaveOccurred())
+			Expect(output.String()).To(Equal(buildLog))
+			Expect(requests).To(HaveLen(5))
+		})
+	})
+
+	When("polling fails permanently", func() {
+		BeforeEach(func() {
+			failures[2] = http.StatusBadRequest
+		})
+
+		It("returns the error", func() {
+			Expect(streamErr).To(MatchError(ContainSubstring("failed to get build log")))
+			Expect(output.String()).To(Equal(buildLog[:15]))
+		})
+	})
+
+	When("the build does not exist", func() {
+		BeforeEach(func() {
+			logStatus = http.StatusNotFound
+			logBody = `{"errors":[{"code":"NOT_FOUND","message":"artifact buildlog/app:build-1 not found"}]}`
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(streamErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+
+	When("the context is cancelled before the build completes", func() {
+		BeforeEach(func() {
+			chunkSize = 0
+			var cancel context.CancelFunc
+			streamCtx, cancel = context.WithCancel(ctx)
+			DeferCleanup(cancel)
+			onRequest = func(count int) {
+				if count == 3 {
+					cancel()
+				}
+			}
+		})
+
+		It("stops polling", func() {
+			Expect(streamErr).To(MatchError(context.Canceled))
+			Expect(requests).To(HaveLen(3))
+		})
+	})
+
+	When("the registry has no build-log endpoint", func() {
+		BeforeEach(func() {
+			logStatus = http.StatusNotImplemented
+		})
+
+		It("returns ErrNotSupported", func() {
+			Expect(errors.Is(streamErr, image.ErrNotSupported)).To(BeTrue())
+		})
+	})
+
+	When("the management API has no build-log endpoint", func() {
+		BeforeEach(func() {
+			logStatus = http.StatusNotFound
+			logBody = "404 page not found"
+		})
+
+		It("returns ErrNotSupported", func() {
+			Expect(errors.Is(streamErr, image.ErrNotSupported)).To(BeTrue())
+		})
+	})
+
+	When("no management API is configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+		})
+
+		It("returns ErrNotSupported", func() {
+			Expect(errors.Is(streamErr, image.ErrNotSupported)).To(BeTrue())
+			Expect(requests).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const buildMetadataLabel = "io.buildpacks.build.metadata"
+
+// BuildMetadata is the content of the io.buildpacks.build.metadata label
+// the CNB lifecycle sets on the images it exports
+type BuildMetadata struct {
+	Buildpacks []BuildpackInfo `json:"buildpacks"`
+	Processes  []ProcessInfo   `json:"processes"`
+	BOM        []BOMEntry      `json:"bom"`
+}
+
+type BuildpackInfo struct {
+	ID       string `json:"id"`
+	Version  string `json:"version"`
+	Homepage string `json:"homepage,omitempty"`
+}
+
+type ProcessInfo struct {
+	Type        string   `json:"type"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args"`
+	Direct      bool     `json:"direct"`
+	Default     bool     `json:"default,omitempty"`
+	BuildpackID string   `json:"buildpackID"`
+	WorkingDir  string   `json:"working-dir,omitempty"`
+}
+
+type BOMEntry struct {
+	Name      string         `json:"name"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Buildpack BuildpackInfo  `json:"buildpack"`
+}
+
+// InspectBuildMetadata returns the buildpacks, processes and bill of
+// materials recorded by the CNB lifecycle in the io.buildpacks.build.metadata
+// label of the image
+func (c Client) InspectBuildMetadata(ctx context.Context, creds Creds, imageRef string) (*BuildMetadata, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	rawMetadata, ok := config.Labels[buildMetadataLabel]
+	if !ok {
+		return nil, fmt.Errorf("image %s has no %s label", imageRef, buildMetadataLabel)
+	}
+
+	metadata := &BuildMetadata{}
+	if err = json.Unmarshal([]byte(rawMetadata), metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal build metadata %q: %w", rawMetadata, err)
+	}
+
+	return metadata, nil
+}
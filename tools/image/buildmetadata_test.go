@@ -0,0 +1,93 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InspectBuildMetadata", func() {
+	var (
+		creds      image.Creds
+		imgRef     string
+		labels     map[string]string
+		metadata   *image.BuildMetadata
+		inspectErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("buildmetadata/" + uuid.NewString())
+		labels = map[string]string{
+			"io.buildpacks.build.metadata": `{
+				"buildpacks": [{"id": "paketo-buildpacks/go", "version": "4.6.1", "homepage": "https://github.com/paketo-buildpacks/go"}],
+				"processes": [{"type": "web", "command": "/workspace/app", "args": ["--port", "8080"], "direct": true, "default": true, "buildpackID": "paketo-buildpacks/go-build"}],
+				"bom": [{"name": "go", "metadata": {"version": "1.22.3"}, "buildpack": {"id": "paketo-buildpacks/go-dist", "version": "2.5.0"}}],
+				"launcher": {"version": "0.17.5"}
+			}`,
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: labels}})
+		metadata, inspectErr = imgClient.InspectBuildMetadata(ctx, creds, imgRef)
+	})
+
+	It("returns the build metadata", func() {
+		Expect(inspectErr).NotTo(HaveOccurred())
+		Expect(metadata.Buildpacks).To(Equal([]image.BuildpackInfo{{
+			ID:       "paketo-buildpacks/go",
+			Version:  "4.6.1",
+			Homepage: "https://github.com/paketo-buildpacks/go",
+		}}))
+		Expect(metadata.Processes).To(Equal([]image.ProcessInfo{{
+			Type:        "web",
+			Command:     "/workspace/app",
+			Args:        []string{"--port", "8080"},
+			Direct:      true,
+			Default:     true,
+			BuildpackID: "paketo-buildpacks/go-build",
+		}}))
+		Expect(metadata.BOM).To(Equal([]image.BOMEntry{{
+			Name:      "go",
+			Metadata:  map[string]any{"version": "1.22.3"},
+			Buildpack: image.BuildpackInfo{ID: "paketo-buildpacks/go-dist", Version: "2.5.0"},
+		}}))
+	})
+
+	When("the label is missing", func() {
+		BeforeEach(func() {
+			labels = nil
+		})
+
+		It("fails", func() {
+			Expect(inspectErr).To(MatchError(ContainSubstring("has no io.buildpacks.build.metadata label")))
+		})
+	})
+
+	When("the label is not valid JSON", func() {
+		BeforeEach(func() {
+			labels["io.buildpacks.build.metadata"] = "{not-json"
+		})
+
+		It("fails including the label value", func() {
+			Expect(inspectErr).To(MatchError(ContainSubstring(`failed to unmarshal build metadata "{not-json"`)))
+		})
+	})
+
+	When("the image does not exist", func() {
+		JustBeforeEach(func() {
+			_, inspectErr = imgClient.InspectBuildMetadata(ctx, creds, imgRef+":not-a-tag")
+		})
+
+		It("fails", func() {
+			Expect(inspectErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
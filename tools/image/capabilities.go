@@ -0,0 +1,162 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	// capabilitiesProbeRepository and capabilitiesProbeTag name a manifest
+	// that is not expected to exist, so that probing the endpoints acting on
+	// it does not change anything in the registry
+	capabilitiesProbeRepository = "korifi-capabilities-probe"
+	capabilitiesProbeTag        = "korifi-capabilities-probe"
+	capabilitiesProbeDigest     = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// RegistryCapabilities are the optional features of a registry, for
+// choosing between the code paths that depend on them
+type RegistryCapabilities struct {
+	// SupportsReferrers is set when the registry serves the OCI 1.1
+	// referrers API rather than relying on the sha256-<hex> fallback tags
+	SupportsReferrers bool
+	// SupportsTagDelete is set unless the registry rejects deleting tags as
+	// an unsupported operation
+	SupportsTagDelete bool
+	SupportsCatalog   bool
+	SupportsHTTP2     bool
+}
+
+// RegistryCapabilities probes the registry at host (including the port, if
+// any) for the features in RegistryCapabilities, with the credentials for
+// the registry in creds. The /v2/ endpoint tells whether HTTP/2 is used and
+// the /v2/_catalog endpoint whether the catalog is served. The referrers and
+// tag deletion endpoints are probed on a manifest that does not exist, so no
+// tag is deleted. The result is cached for the lifetime of the client,
+// failed probes are not.
+func (c Client) RegistryCapabilities(ctx context.Context, creds Creds, host string) (RegistryCapabilities, error) {
+	c.logger.V(1).Info("probing registry capabilities", "host", host)
+	registry, err := c.parseRegistry(host)
+	if err != nil {
+		return RegistryCapabilities{}, fmt.Errorf("error parsing registry %s: %w", host, err)
+	}
+
+	if c.capabilitiesCache != nil {
+		if cached, ok := c.capabilitiesCache.Load(registry.RegistryStr()); ok {
+			return cached.(RegistryCapabilities), nil
+		}
+	}
+
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return RegistryCapabilities{}, authError(host, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	auth, err := keychain.Resolve(registry)
+	if err != nil {
+		return RegistryCapabilities{}, authError(host, fmt.Errorf("failed to resolve credentials from %s: %w", credsSource(creds), err))
+	}
+
+	probeRepo := registry.Repo(capabilitiesProbeRepository)
+	scopes := []string{probeRepo.Scope(transport.DeleteScope), registry.Scope(transport.CatalogScope)}
+	authTransport, err := transport.NewWithContext(ctx, registry, auth, c.transport, scopes)
+	if err != nil {
+		return RegistryCapabilities{}, registryError(host, fmt.Errorf("failed to probe registry: %w", err))
+	}
+	httpClient := &http.Client{Transport: authTransport}
+
+	baseURL := fmt.Sprintf("%s://%s/v2/", registry.Scheme(), registry.RegistryStr())
+	resp, err := probeEndpoint(ctx, httpClient, http.MethodGet, baseURL)
+	if err != nil {
+		return RegistryCapabilities{}, registryError(host, err)
+	}
+	if err = transport.CheckError(resp, http.StatusOK); err != nil {
+		return RegistryCapabilities{}, registryError(host, fmt.Errorf("failed to probe registry: %w", err))
+	}
+
+	capabilities := RegistryCapabilities{
+		SupportsHTTP2: resp.ProtoMajor == 2,
+	}
+	vendor := classifyRegistry(registry.RegistryStr(), resp.Header)
+
+	resp, err = probeEndpoint(ctx, httpClient, http.MethodGet, baseURL+"_catalog?n=1")
+	if err != nil {
+		return RegistryCapabilities{}, registryError(host, err)
+	}
+	capabilities.SupportsCatalog = resp.StatusCode == http.StatusOK
+
+	resp, err = probeEndpoint(ctx, httpClient, http.MethodGet, baseURL+capabilitiesProbeRepository+"/referrers/"+capabilitiesProbeDigest)
+	if err != nil {
+		return RegistryCapabilities{}, registryError(host, err)
+	}
+	capabilities.SupportsReferrers = isReferrersResponse(resp)
+
+	resp, err = probeEndpoint(ctx, httpClient, http.MethodDelete, baseURL+capabilitiesProbeRepository+"/manifests/"+capabilitiesProbeTag)
+	if err != nil {
+		return RegistryCapabilities{}, registryError(host, err)
+	}
+	// like DeleteTag, assume Docker Hub does not delete tags through the
+	// distribution API whatever it answers
+	capabilities.SupportsTagDelete = vendor != VendorDockerHub &&
+		!isTagDeleteUnsupported(transport.CheckError(resp, http.StatusAccepted))
+
+	c.logger.V(1).Info("probed registry capabilities", "host", host, "capabilities", capabilities)
+	if c.capabilitiesCache != nil {
+		c.capabilitiesCache.Store(registry.RegistryStr(), capabilities)
+	}
+
+	return capabilities, nil
+}
+
+// probeEndpoint sends a request without a body to the registry and returns
+// the response with its body already read, so that CheckError can still
+// decode the errors in it, and closed
+func probeEndpoint(ctx context.Context, httpClient *http.Client, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+// isReferrersResponse reports whether the registry served the referrers of
+// the probe manifest. Registries implementing the referrers API may still
+// fail with NAME_UNKNOWN as the probe repository does not exist, while the
+// others do not know the endpoint at all.
+func isReferrersResponse(resp *http.Response) bool {
+	err := transport.CheckError(resp, http.StatusOK)
+	if err == nil {
+		return true
+	}
+
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) || transportErr.StatusCode != http.StatusNotFound {
+		return false
+	}
+	for _, diagnostic := range transportErr.Errors {
+		if diagnostic.Code == transport.NameUnknownErrorCode {
+			return true
+		}
+	}
+
+	return false
+}
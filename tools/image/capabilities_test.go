@@ -0,0 +1,152 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RegistryCapabilities", func() {
+	var (
+		registryOpts []ggcrregistry.Option
+		tls          bool
+		statuses     map[string]int
+		requests     int32
+		host         string
+		capabilities image.RegistryCapabilities
+		probeErr     error
+	)
+
+	BeforeEach(func() {
+		registryOpts = nil
+		tls = false
+		statuses = map[string]int{}
+		atomic.StoreInt32(&requests, 0)
+	})
+
+	JustBeforeEach(func() {
+		registryHandler := ggcrregistry.New(append(registryOpts, ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))...)
+		registry := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			for endpoint, status := range statuses {
+				method, path, _ := strings.Cut(endpoint, " ")
+				if r.Method == method && strings.Contains(r.URL.Path, path) {
+					w.WriteHeader(status)
+					return
+				}
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		if tls {
+			registry.EnableHTTP2 = true
+			registry.StartTLS()
+		} else {
+			registry.Start()
+		}
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host = serverURL.Host
+
+		imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(host))
+		capabilities, probeErr = imgClient.RegistryCapabilities(ctx, image.Creds{Namespace: "default"}, host)
+	})
+
+	It("returns the capabilities of the registry", func() {
+		Expect(probeErr).NotTo(HaveOccurred())
+		Expect(capabilities).To(Equal(image.RegistryCapabilities{
+			SupportsTagDelete: true,
+			SupportsCatalog:   true,
+		}))
+	})
+
+	It("caches the capabilities", func() {
+		probedRequests := atomic.LoadInt32(&requests)
+
+		cached, err := imgClient.RegistryCapabilities(ctx, image.Creds{Namespace: "default"}, host)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(Equal(capabilities))
+		Expect(atomic.LoadInt32(&requests)).To(Equal(probedRequests))
+	})
+
+	When("the registry serves the referrers API", func() {
+		BeforeEach(func() {
+			registryOpts = append(registryOpts, ggcrregistry.WithReferrersSupport(true))
+		})
+
+		It("supports referrers", func() {
+			Expect(probeErr).NotTo(HaveOccurred())
+			Expect(capabilities.SupportsReferrers).To(BeTrue())
+		})
+	})
+
+	When("the registry does not serve the catalog", func() {
+		BeforeEach(func() {
+			statuses["GET /v2/_catalog"] = http.StatusNotFound
+		})
+
+		It("does not support the catalog", func() {
+			Expect(probeErr).NotTo(HaveOccurred())
+			Expect(capabilities.SupportsCatalog).To(BeFalse())
+		})
+	})
+
+	When("the registry does not allow deleting manifests", func() {
+		BeforeEach(func() {
+			statuses["DELETE /manifests/"] = http.StatusMethodNotAllowed
+		})
+
+		It("does not support deleting tags", func() {
+			Expect(probeErr).NotTo(HaveOccurred())
+			Expect(capabilities.SupportsTagDelete).To(BeFalse())
+		})
+	})
+
+	When("the registry is served over HTTP/2", func() {
+		BeforeEach(func() {
+			tls = true
+		})
+
+		It("supports HTTP/2", func() {
+			Expect(probeErr).NotTo(HaveOccurred())
+			Expect(capabilities.SupportsHTTP2).To(BeTrue())
+		})
+	})
+
+	When("the registry cannot be probed", func() {
+		BeforeEach(func() {
+			statuses["GET /v2/"] = http.StatusInternalServerError
+		})
+
+		It("fails without caching the failure", func() {
+			Expect(probeErr).To(MatchError(ContainSubstring("failed to probe registry")))
+
+			delete(statuses, "GET /v2/")
+			_, err := imgClient.RegistryCapabilities(ctx, image.Creds{Namespace: "default"}, host)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the registry requires authentication", func() {
+		It("probes it with the credentials", func() {
+			registryURL, err := url.Parse(containerRegistry.URL())
+			Expect(err).NotTo(HaveOccurred())
+
+			authCapabilities, err := imgClient.RegistryCapabilities(ctx, image.Creds{
+				Namespace:   "default",
+				SecretNames: []string{secretName},
+			}, registryURL.Host)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authCapabilities.SupportsCatalog).To(BeTrue())
+		})
+	})
+})
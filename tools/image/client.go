@@ -2,36 +2,91 @@ package image
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/buildpacks/pack/pkg/archive"
 	"github.com/go-logr/logr"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
 	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/empty"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
-	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/utils/net"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 type Client struct {
-	k8sClient kubernetes.Interface
-	logger    logr.Logger
+	k8sClient         kubernetes.Interface
+	logger            logr.Logger
+	retryBackoff      wait.Backoff
+	tempDir           string
+	inMemoryThreshold int64
+	transport         http.RoundTripper
+	// registryHTTPClient is shared by copies of the client so that
+	// connections to registries are reused
+	registryHTTPClient *http.Client
+	// insecureRegistries allow plain HTTP and unverified TLS
+	insecureRegistries []string
+	signer             *cosignSigner
+	verifier           *cosignVerifier
+	tagConcurrency     int
+	watchInterval      time.Duration
+	progressWriter     io.Writer
+	configCache        *configCache
+	metrics            *clientMetrics
+	credentialCache    CredentialCache
+	deduplicate        bool
+	platform           *v1.Platform
+	stagingLogWriter   io.Writer
+	http2              bool
+	// rootCAs verify registry certificates instead of the system CAs when set
+	rootCAs *x509.CertPool
+	// workloadIdentityAudience enables workload identity when not empty
+	workloadIdentityAudience string
+	reservedLabelPrefixes    []string
+	tracerProvider           trace.TracerProvider
+	attestationSupport       bool
+	strictAnnotations        bool
+	layerCompression         CompressionAlgorithm
+	// repositoryManagementAPI is the base URL of the registry management API
+	repositoryManagementAPI string
+	buildLogPollInterval    time.Duration
+	pullConcurrency         int
+	pinDigest               bool
+	scan                    ScanFunc
+	provenanceRecorder      ProvenanceRecorder
+	maxDeleteRedirects      int
+	maxManifestSize         int64
+	rateLimitObserver       func(retryAfter time.Duration)
+	maxRateLimitWait        time.Duration
+	reproducibleTimestamps  bool
+	// capabilitiesCache is shared by copies of the client
+	capabilitiesCache     *sync.Map
+	allowEntrypointChange bool
+	// registryMirrors are the mirror hosts of upstream registry hosts
+	registryMirrors map[string]string
 }
 
+type Option func(*Client)
+
 type Creds struct {
 	Namespace string
-	// At most one of SecretNames and ServiceAccountName should be set.
-	// If both unset, the fallback auth approach will be used.
+	// SecretNames and the image pull secrets of ServiceAccountName are
+	// combined when both are set. If both unset, the fallback auth approach
+	// will be used.
 	SecretNames        []string
 	ServiceAccountName string
 }
@@ -40,107 +95,539 @@ type Config struct {
 	Labels       map[string]string
 	User         string
 	ExposedPorts []int32
+	Annotations  map[string]string
+	LayerCount   int
+	// UncompressedSizeBytes falls back to the compressed size of layers whose
+	// uncompressed size is not known without downloading them. SizeApproximate
+	// is set when that happens.
+	UncompressedSizeBytes int64
+	SizeApproximate       bool
+	// SchemaVersion is 2 for Docker schema 2 and OCI manifests and 1 for the
+	// deprecated Docker schema 1 manifests
+	SchemaVersion int
+	// CreatedAt is nil when the image config does not record when the image
+	// was created
+	CreatedAt *time.Time
+	// Healthcheck is nil when the image does not define a HEALTHCHECK
+	Healthcheck *HealthcheckConfig
+	// OS and Architecture are the platform the image was built for. OSVersion
+	// and OSFeatures are usually only set by Windows images.
+	OS           string
+	Architecture string
+	OSVersion    string
+	OSFeatures   []string
+}
+
+// HealthcheckConfig is the HEALTHCHECK of a Docker image. Test is the
+// command, starting with CMD or CMD-SHELL, or {"NONE"} when the healthcheck
+// of the base image is disabled. Zero durations and retries mean the Docker
+// defaults.
+type HealthcheckConfig struct {
+	Test     []string
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+}
+
+func NewClient(k8sClient kubernetes.Interface, opts ...Option) Client {
+	c := Client{
+		k8sClient:              k8sClient,
+		logger:                 ctrl.Log.WithName("image.client"),
+		retryBackoff:           noRetryBackoff,
+		inMemoryThreshold:      defaultInMemoryThreshold,
+		tagConcurrency:         defaultTagConcurrency,
+		pullConcurrency:        defaultPullConcurrency,
+		watchInterval:          defaultWatchInterval,
+		http2:                  true,
+		reproducibleTimestamps: true,
+		reservedLabelPrefixes:  defaultReservedLabelPrefixes,
+		tracerProvider:         otel.GetTracerProvider(),
+		capabilitiesCache:      &sync.Map{},
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.registryHTTPClient == nil {
+		c.registryHTTPClient = newRegistryHTTPClient(c.http2, c.rootCAs)
+	}
+	if c.transport == nil {
+		c.transport = c.registryHTTPClient.Transport
+	}
+
+	if len(c.insecureRegistries) > 0 {
+		c.transport = newInsecureRegistriesTransport(c.transport, c.insecureRegistries)
+	}
+	c.transport = newRateLimitTransport(c.transport, c.logger, c.rateLimitObserver, c.maxRateLimitWait)
+	c.transport = newDeleteRedirectTransport(c.transport, c.maxDeleteRedirects)
+
+	return c
+}
+
+// WithLogger returns a copy of the client that logs with the given logger.
+// Controllers can use it to pass a logger carrying the key-value pairs of the
+// object being reconciled (e.g. app or build GUIDs).
+func (c Client) WithLogger(logger logr.Logger) Client {
+	c.logger = logger.WithName("image.client")
+	return c
 }
 
-func NewClient(k8sClient kubernetes.Interface) Client {
-	return Client{
-		k8sClient: k8sClient,
-		logger:    ctrl.Log.WithName("image.client"),
+// WithTempDir sets the directory the source archive is buffered into during
+// Push and layers are downloaded into during Pull. Defaults to os.TempDir().
+func WithTempDir(dir string) Option {
+	return func(c *Client) {
+		c.tempDir = dir
 	}
 }
 
+type pushConfig struct {
+	tags        []string
+	platforms   []v1.Platform
+	annotations map[string]string
+	labels      map[string]string
+	// sbom is attached to the image as a referrer when set
+	sbom          []byte
+	sbomMediaType types.MediaType
+	// deduplicate labels the image with sourceSHA256, the hash of the
+	// source zip, and reuses an already pushed image with the same label
+	deduplicate  bool
+	sourceSHA256 string
+	// compression overrides the layer compression of the client when set
+	compression CompressionAlgorithm
+	// keychain is used instead of the keychain of the creds when set
+	keychain authn.Keychain
+}
+
 func (c Client) Push(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, tags ...string) (string, error) {
-	tmpFile, err := os.CreateTemp(os.TempDir(), "sourceimg-%s")
+	return c.push(ctx, creds, repoRef, zipReader, pushConfig{tags: tags, deduplicate: c.deduplicate})
+}
+
+// PushMultiPlatform pushes the zip archive as an image for each of the given
+// platforms. When more than one platform is given, the images are assembled
+// into an image index and the digest of the index is returned.
+func (c Client) PushMultiPlatform(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, platforms []v1.Platform, tags ...string) (string, error) {
+	return c.push(ctx, creds, repoRef, zipReader, pushConfig{tags: tags, platforms: platforms})
+}
+
+// PushWithAnnotations pushes the zip archive as an image whose manifest
+// carries the given annotations. Annotation keys should be namespaced in
+// reverse domain notation (e.g. korifi.cloudfoundry.org/build-guid); the
+// org.opencontainers.image. prefix is reserved for the keys defined by the
+// OCI image spec.
+func (c Client) PushWithAnnotations(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, annotations map[string]string, tags ...string) (string, error) {
+	return c.push(ctx, creds, repoRef, zipReader, pushConfig{tags: tags, annotations: annotations})
+}
+
+// PushDir pushes the contents of a directory as a single layer image. File
+// permissions and symlinks are preserved and device files are skipped.
+func (c Client) PushDir(ctx context.Context, creds Creds, repoRef string, dir string, tags ...string) (_ string, err error) {
+	defer c.metrics.observe("push", repoRef, time.Now(), &err)
+	ctx, endSpan := c.startSpan(ctx, "Push", repoRef)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("pushing directory", "ref", repoRef, "dir", dir, "tags", tags)
+	layer, err := c.dirLayer(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to create a temp file for image: %w", err)
+		return "", err
 	}
-	defer tmpFile.Close()
 
-	if _, err = io.Copy(tmpFile, zipReader); err != nil {
-		return "", fmt.Errorf("failed to copy image source into temp file '%s' %w", tmpFile.Name(), err)
+	return c.pushSourceLayer(ctx, creds, repoRef, layer, pushConfig{tags: tags})
+}
+
+func (c Client) push(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, cfg pushConfig) (_ string, err error) {
+	defer c.metrics.observe("push", repoRef, time.Now(), &err)
+	ctx, endSpan := c.startSpan(ctx, "Push", repoRef)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("pushing", "ref", repoRef, "tags", cfg.tags)
+	if cfg.compression != "" {
+		c.layerCompression = cfg.compression
 	}
 
-	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
-		return archive.ReadZipAsTar(tmpFile.Name(), "/", 0, 0, -1, true, nil), nil
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create a layer out of '%s': %w", tmpFile.Name(), err)
+	sourceHash := sha256.New()
+	if cfg.deduplicate {
+		zipReader = io.TeeReader(zipReader, sourceHash)
 	}
 
-	image, err := mutate.AppendLayers(empty.Image, layer)
+	layer, cleanup, err := c.zipLayer(zipReader)
 	if err != nil {
-		return "", fmt.Errorf("failed to append layer: %w", err)
+		return "", err
 	}
+	defer cleanup()
 
-	ref, err := name.ParseReference(repoRef)
+	if cfg.deduplicate {
+		cfg.sourceSHA256 = hex.EncodeToString(sourceHash.Sum(nil))
+	}
+
+	return c.pushSourceLayer(ctx, creds, repoRef, layer, cfg)
+}
+
+func (c Client) pushSourceLayer(ctx context.Context, creds Creds, repoRef string, layer v1.Layer, cfg pushConfig) (string, error) {
+	if err := c.validateLabels(repoRef, cfg.labels); err != nil {
+		return "", err
+	}
+
+	artifact, err := buildArtifact(layer, cfg)
 	if err != nil {
-		return "", fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+		return "", err
+	}
+
+	if err = c.validateManifestSize(repoRef, artifact); err != nil {
+		return "", err
 	}
 
-	authOpt, err := c.authOpt(ctx, creds)
+	ref, err := c.parseReference(repoRef)
 	if err != nil {
-		return "", fmt.Errorf("error creating keychain: %w", err)
+		return "", fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
 	}
 
-	if err = remote.Write(ref, image, authOpt); err != nil {
-		return "", fmt.Errorf("failed to upload image: %w", err)
+	keychain := cfg.keychain
+	if keychain == nil {
+		keychain, err = c.keychain(ctx, creds)
+		if err != nil {
+			return "", authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+		}
 	}
+	remoteOpts := c.keychainRemoteOpts(ctx, keychain)
 
-	for _, tag := range tags {
-		err = remote.Tag(ref.Context().Tag(tag), image, authOpt)
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	if cfg.sourceSHA256 != "" {
+		var existing *remote.Descriptor
+		existing, err = c.findBySourceSHA256(ref.Context(), cfg.sourceSHA256, remoteOpts)
 		if err != nil {
-			return "", fmt.Errorf("failed to tag image: %w", err)
+			return "", fmt.Errorf("failed to look for an image with the same source: %w", err)
+		}
+		if existing != nil {
+			var reusedRef string
+			tags := refTags(ref, cfg.tags)
+			reusedRef, err = c.reuseImage(ref.Context(), existing, tags, writeOpts)
+			if err != nil {
+				return "", err
+			}
+
+			if err = c.recordProvenance(ctx, creds, ref.Context(), existing.Digest, tags); err != nil {
+				return "", err
+			}
+			return reusedRef, nil
 		}
 	}
 
-	imgDigest, err := image.Digest()
+	digest, err := artifact.Digest()
 	if err != nil {
 		return "", fmt.Errorf("failed to get image digest: %w", err)
 	}
 
-	refWithDigest, err := name.NewDigest(fmt.Sprintf("%s@%s", ref.Context().Name(), imgDigest.String()))
+	err = c.retryOnError("write", func() error {
+		progressOpts, waitForProgress := c.progressOpts()
+		defer waitForProgress()
+
+		return writeArtifact(ref.Context().Digest(digest.String()), artifact, append(writeOpts, progressOpts...)...)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create digest: %w", err)
+		c.reportDiagnostics(err)
+		return "", pushError(repoRef, fmt.Errorf("failed to upload image: %w", err))
 	}
 
-	return refWithDigest.Name(), nil
+	written := writtenManifest{
+		repo:     ref.Context(),
+		manifest: artifact,
+		digest:   digest,
+		tags:     refTags(ref, cfg.tags),
+	}
+	if len(cfg.sbom) > 0 {
+		written.beforeTagging = func() error {
+			return c.attachSBOM(ref.Context(), artifact, cfg.sbom, cfg.sbomMediaType, writeOpts)
+		}
+	}
+
+	return c.finishWrite(ctx, creds, keychain, written, writeOpts)
+}
+
+// reuseImage tags an image that was pushed from the same source instead of
+// uploading it again
+func (c Client) reuseImage(repo name.Repository, existing *remote.Descriptor, tags []string, writeOpts []remote.Option) (string, error) {
+	c.logger.Info("image with the same source already pushed, skipping upload", "repo", repo, "digest", existing.Digest)
+
+	if c.signer != nil {
+		if err := c.sign(repo, existing.Digest, writeOpts); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.tagAll(repo, existing, tags, writeOpts); err != nil {
+		return "", pushError(repo.String(), fmt.Errorf("failed to tag image: %w", err))
+	}
+
+	return repo.Digest(existing.Digest.String()).Name(), nil
+}
+
+// writtenManifest is a manifest the client wrote to repo by digest, which
+// finishWrite tags once the post-write hooks accept it
+type writtenManifest struct {
+	repo     name.Repository
+	manifest remote.Taggable
+	digest   v1.Hash
+	tags     []string
+	// beforeTagging, when set, runs once the manifest is scanned and signed,
+	// e.g. to attach an SBOM
+	beforeTagging func() error
+}
+
+// finishWrite runs the hooks due on every manifest the client writes and
+// returns its digest ref. The manifest is scanned, signed, tagged, checked to
+// be served at its digest and its provenance is recorded, in that order so
+// that tags never point to an image that failed scan or is unsigned. The
+// keychain, when nil, is only created from creds if the digest is pinned.
+func (c Client) finishWrite(ctx context.Context, creds Creds, keychain authn.Keychain, written writtenManifest, writeOpts []remote.Option) (string, error) {
+	ref := written.repo.Digest(written.digest.String())
+
+	if err := c.scanImage(ctx, ref, writeOpts); err != nil {
+		return "", err
+	}
+
+	if c.signer != nil {
+		if err := c.sign(written.repo, written.digest, writeOpts); err != nil {
+			return "", err
+		}
+	}
+
+	if written.beforeTagging != nil {
+		if err := written.beforeTagging(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.tagAll(written.repo, written.manifest, written.tags, writeOpts); err != nil {
+		return "", pushError(written.repo.String(), fmt.Errorf("failed to tag image: %w", err))
+	}
+
+	if c.pinDigest {
+		if keychain == nil {
+			var err error
+			if keychain, err = c.keychain(ctx, creds); err != nil {
+				return "", authError(ref.Name(), fmt.Errorf("error creating keychain: %w", err))
+			}
+		}
+		if err := c.confirmDigest(ctx, keychain, written.repo, written.digest); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.recordProvenance(ctx, creds, written.repo, written.digest, written.tags); err != nil {
+		return "", err
+	}
+
+	return ref.Name(), nil
 }
 
-func (c Client) Config(ctx context.Context, creds Creds, imageRef string) (Config, error) {
-	ref, err := name.ParseReference(imageRef)
+// refTags returns tags with the tag of ref added when ref is a tag, for
+// writers that write by digest and leave the tagging to finishWrite
+func refTags(ref name.Reference, tags []string) []string {
+	tag, isTag := ref.(name.Tag)
+	if !isTag || slices.Contains(tags, tag.TagStr()) {
+		return tags
+	}
+
+	return append([]string{tag.TagStr()}, tags...)
+}
+
+// Config returns the config of the image. For an image index the config of
+// the image matching the platform set with WithPlatform is returned,
+// defaulting to linux/amd64.
+func (c Client) Config(ctx context.Context, creds Creds, imageRef string) (_ Config, err error) {
+	defer c.metrics.observe("config", imageRef, time.Now(), &err)
+	ctx, endSpan := c.startSpan(ctx, "Config", imageRef)
+	defer endSpan(&err)
+
+	ref, err := c.parseReadReference(imageRef)
 	if err != nil {
 		return Config{}, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
 	}
 
-	authOpt, err := c.authOpt(ctx, creds)
+	if ref, err = c.verifySigned(ctx, creds, ref); err != nil {
+		return Config{}, err
+	}
+
+	_, isDigest := ref.(name.Digest)
+	if c.configCache == nil || isDigest {
+		return c.fetchConfig(ctx, creds, ref)
+	}
+
+	if config, ok := c.configCache.get(imageRef); ok {
+		c.logger.V(1).Info("using cached config", "ref", imageRef)
+		return config, nil
+	}
+
+	config, err := c.fetchConfig(ctx, creds, ref)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c.configCache.add(imageRef, config)
+	return config, nil
+}
+
+func (c Client) fetchConfig(ctx context.Context, creds Creds, ref name.Reference) (Config, error) {
+	c.logger.V(1).Info("fetching config", "ref", ref)
+	remoteOpts, err := c.remoteOpts(ctx, creds)
 	if err != nil {
-		return Config{}, fmt.Errorf("error creating keychain: %w", err)
+		return Config{}, authError(ref.String(), fmt.Errorf("error creating keychain: %w", err))
 	}
 
-	img, err := remote.Image(ref, authOpt)
+	if c.platform != nil {
+		remoteOpts = append(remoteOpts, remote.WithPlatform(*c.platform))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to get image: %w", err)
+		return Config{}, registryError(ref.String(), fmt.Errorf("failed to get image: %w", err))
 	}
 
+	if isSchema1(descriptor.MediaType) {
+		c.logger.Info("image uses deprecated docker schema 1 manifest", "ref", ref)
+		return schema1Config(descriptor.Manifest)
+	}
+
+	img, err := descriptor.Image()
+	if err != nil {
+		return Config{}, registryError(ref.String(), fmt.Errorf("failed to get image: %w", err))
+	}
+
+	return imageConfig(img)
+}
+
+func (c Client) remoteImage(ctx context.Context, creds Creds, imageRef string) (v1.Image, error) {
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	return c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+}
+
+// verifiedImage fetches the image at ref once its signature is verified, by
+// the digest of the verified manifest when the client requires signatures
+func (c Client) verifiedImage(ctx context.Context, creds Creds, ref name.Reference, imageRef string, remoteOpts []remote.Option) (v1.Image, error) {
+	ref, err := c.verifySigned(ctx, creds, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := remote.Image(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	return img, nil
+}
+
+func imageConfig(img v1.Image) (Config, error) {
 	cfgFile, err := img.ConfigFile()
 	if err != nil {
 		return Config{}, fmt.Errorf("error getting image config file: %w", err)
 	}
 
+	ports, err := exposedPorts(cfgFile.Config.ExposedPorts)
+	if err != nil {
+		return Config{}, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return Config{}, fmt.Errorf("error getting image manifest: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return Config{}, fmt.Errorf("error getting image layers: %w", err)
+	}
+
+	size, approximate, err := layersSize(layers)
+	if err != nil {
+		return Config{}, fmt.Errorf("error getting image size: %w", err)
+	}
+
+	var createdAt *time.Time
+	if !cfgFile.Created.IsZero() {
+		createdAt = &cfgFile.Created.Time
+	}
+
+	return Config{
+		Labels:                cfgFile.Config.Labels,
+		User:                  cfgFile.Config.User,
+		ExposedPorts:          ports,
+		Annotations:           manifest.Annotations,
+		LayerCount:            len(layers),
+		UncompressedSizeBytes: size,
+		SizeApproximate:       approximate,
+		SchemaVersion:         2,
+		CreatedAt:             createdAt,
+		Healthcheck:           healthcheckConfig(cfgFile.Config.Healthcheck),
+		OS:                    cfgFile.OS,
+		Architecture:          cfgFile.Architecture,
+		OSVersion:             cfgFile.OSVersion,
+		OSFeatures:            cfgFile.OSFeatures,
+	}, nil
+}
+
+func healthcheckConfig(healthcheck *v1.HealthConfig) *HealthcheckConfig {
+	if healthcheck == nil || len(healthcheck.Test) == 0 {
+		return nil
+	}
+
+	return &HealthcheckConfig{
+		Test:     healthcheck.Test,
+		Interval: healthcheck.Interval,
+		Timeout:  healthcheck.Timeout,
+		Retries:  healthcheck.Retries,
+	}
+}
+
+func exposedPorts(portSet map[string]struct{}) ([]int32, error) {
 	ports := []int32{}
-	for _, p := range parseExposedPorts(cfgFile.Config.ExposedPorts) {
+	for _, p := range parseExposedPorts(portSet) {
 		parsed, err := net.ParsePort(p, false)
 		if err != nil {
-			return Config{}, fmt.Errorf("error getting exposed ports: %w", err)
+			return nil, fmt.Errorf("error getting exposed ports: %w", err)
 		}
 		ports = append(ports, int32(parsed))
 	}
 
-	return Config{
-		Labels:       cfgFile.Config.Labels,
-		User:         cfgFile.Config.User,
-		ExposedPorts: ports,
-	}, nil
+	return ports, nil
+}
+
+type withUncompressedSize interface {
+	UncompressedSize() (int64, error)
+}
+
+func layersSize(layers []v1.Layer) (int64, bool, error) {
+	var total int64
+	approximate := false
+
+	for _, layer := range layers {
+		if l, ok := layer.(withUncompressedSize); ok {
+			size, err := l.UncompressedSize()
+			if err == nil && size >= 0 {
+				total += size
+				continue
+			}
+		}
+
+		size, err := layer.Size()
+		if err != nil {
+			return 0, false, err
+		}
+		total += size
+		approximate = true
+	}
+
+	return total, approximate, nil
 }
 
 func parseExposedPorts(ports map[string]struct{}) []string {
@@ -152,21 +639,25 @@ func parseExposedPorts(ports map[string]struct{}) []string {
 	return result
 }
 
-func (c Client) Delete(ctx context.Context, creds Creds, imageRef string, tagsToDelete ...string) error {
+func (c Client) Delete(ctx context.Context, creds Creds, imageRef string, tagsToDelete ...string) (err error) {
+	defer c.metrics.observe("delete", imageRef, time.Now(), &err)
+	ctx, endSpan := c.startSpan(ctx, "Delete", imageRef)
+	defer endSpan(&err)
+
 	c.logger.V(1).Info("deleting", "ref", imageRef)
-	ref, err := name.ParseReference(imageRef)
+	ref, err := c.parseReference(imageRef)
 	if err != nil {
 		return err
 	}
 
-	authOpt, err := c.authOpt(ctx, creds)
+	remoteOpts, err := c.remoteOpts(ctx, creds)
 	if err != nil {
-		return fmt.Errorf("error creating keychain: %w", err)
+		return authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
 	}
 
-	allTagSet, err := c.getTagSet(ref, authOpt)
-	if err != nil {
-		return fmt.Errorf("failed to list tags: %w", err)
+	allTagSet, err := c.getTagSet(ref, remoteOpts)
+	if err = ignoreNotFound(err); err != nil {
+		return registryError(imageRef, fmt.Errorf("failed to list tags: %w", err))
 	}
 
 	for _, tag := range tagsToDelete {
@@ -175,7 +666,7 @@ func (c Client) Delete(ctx context.Context, creds Creds, imageRef string, tagsTo
 			continue
 		}
 
-		if err = c.deleteTag(ref, tag, authOpt); err != nil {
+		if err = c.deleteTag(ref, tag, remoteOpts); err != nil {
 			c.logger.Info("failed to delete tag", "reason", err)
 			continue
 		}
@@ -186,7 +677,7 @@ func (c Client) Delete(ctx context.Context, creds Creds, imageRef string, tagsTo
 	// remaining tag, remove it to prevent digest deletion errors
 	latestTag := "latest"
 	if len(allTagSet) == 1 && allTagSet[latestTag] {
-		if err = c.deleteTag(ref, latestTag, authOpt); err != nil {
+		if err = c.deleteTag(ref, latestTag, remoteOpts); err != nil {
 			c.logger.Info("failed to delete tag", "reason", err)
 		} else {
 			delete(allTagSet, latestTag)
@@ -194,20 +685,14 @@ func (c Client) Delete(ctx context.Context, creds Creds, imageRef string, tagsTo
 	}
 
 	if len(allTagSet) == 0 {
-		err = remote.Delete(ref, authOpt)
-		if err != nil {
-			if structuredErr, ok := err.(*transport.Error); ok && structuredErr.StatusCode == http.StatusNotFound {
-				c.logger.V(1).Info("manifest disappeared - continuing", "reason", err)
-				return nil
-			}
-		}
+		return ignoreNotFound(remote.Delete(ref, remoteOpts...))
 	}
 
-	return err
+	return nil
 }
 
-func (c Client) getTagSet(ref name.Reference, authOpt remote.Option) (map[string]bool, error) {
-	allTags, err := remote.List(ref.Context(), authOpt)
+func (c Client) getTagSet(ref name.Reference, remoteOpts []remote.Option) (map[string]bool, error) {
+	allTags, err := remote.List(ref.Context(), remoteOpts...)
 	if err != nil {
 		c.logger.V(1).Info("failed to list tags - skipping tag deletion", "reason", err)
 		return nil, err
@@ -215,17 +700,15 @@ func (c Client) getTagSet(ref name.Reference, authOpt remote.Option) (map[string
 
 	allTagSet := map[string]bool{}
 	for _, t := range allTags {
-		var tagRef name.Reference
-		tagRef, err = name.ParseReference(ref.Context().String() + ":" + t)
-		if err != nil {
-			return nil, fmt.Errorf("couldn't create a tag ref: %w", err)
-		}
-
 		var descriptor *remote.Descriptor
-		descriptor, err = remote.Get(tagRef, authOpt)
-		if err != nil {
+		descriptor, err = remote.Get(ref.Context().Tag(t), remoteOpts...)
+		if err = ignoreNotFound(err); err != nil {
 			return nil, fmt.Errorf("couldn't get tag: %w", err)
 		}
+		if descriptor == nil {
+			// the tag was deleted after listing
+			continue
+		}
 
 		if descriptor.Digest.String() == ref.Identifier() {
 			allTagSet[t] = true
@@ -235,13 +718,9 @@ func (c Client) getTagSet(ref name.Reference, authOpt remote.Option) (map[string
 	return allTagSet, nil
 }
 
-func (c Client) deleteTag(ref name.Reference, tag string, authOpt remote.Option) error {
-	tagRef, err := name.ParseReference(ref.Context().String() + ":" + tag)
-	if err != nil {
-		return fmt.Errorf("couldn't create a tag ref: %w", err)
-	}
-	var descriptor *remote.Descriptor
-	descriptor, err = remote.Get(tagRef, authOpt)
+func (c Client) deleteTag(ref name.Reference, tag string, remoteOpts []remote.Option) error {
+	tagRef := ref.Context().Tag(tag)
+	descriptor, err := remote.Get(tagRef, remoteOpts...)
 	if err != nil {
 		c.logger.V(1).Info("failed get tag - continuing", "reason", err)
 		return nil
@@ -249,7 +728,7 @@ func (c Client) deleteTag(ref name.Reference, tag string, authOpt remote.Option)
 
 	if descriptor.Digest.String() == ref.Identifier() {
 		c.logger.V(1).Info("deleting tag", "tag", tag)
-		err = remote.Delete(tagRef, authOpt)
+		err = remote.Delete(tagRef, remoteOpts...)
 		if err != nil {
 			c.logger.V(1).Info("failed to delete tag", "reason", err)
 		}
@@ -258,26 +737,68 @@ func (c Client) deleteTag(ref name.Reference, tag string, authOpt remote.Option)
 	return nil
 }
 
-func (c Client) authOpt(ctx context.Context, creds Creds) (remote.Option, error) {
-	var keychain authn.Keychain
-	var err error
+func (c Client) remoteOpts(ctx context.Context, creds Creds) ([]remote.Option, error) {
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(creds.SecretNames) > 0 {
-		keychain, err = k8schain.New(ctx, c.k8sClient, k8schain.Options{
-			Namespace:        creds.Namespace,
-			ImagePullSecrets: creds.SecretNames,
-		})
-	} else if creds.ServiceAccountName != "" {
-		keychain, err = k8schain.New(ctx, c.k8sClient, k8schain.Options{
-			Namespace:          creds.Namespace,
-			ServiceAccountName: creds.ServiceAccountName,
-		})
-	} else {
-		keychain, err = k8schain.NewNoClient(ctx)
+	return c.keychainRemoteOpts(ctx, keychain), nil
+}
+
+func (c Client) keychainRemoteOpts(ctx context.Context, keychain authn.Keychain) []remote.Option {
+	opts := []remote.Option{
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithContext(ctx),
+	}
+	if c.transport != nil {
+		opts = append(opts, remote.WithTransport(c.transport))
 	}
+
+	return opts
+}
+
+func (c Client) keychain(ctx context.Context, creds Creds) (authn.Keychain, error) {
+	keychain, err := c.credsKeychain(ctx, creds)
 	if err != nil {
 		return nil, err
 	}
 
-	return remote.WithAuthFromKeychain(keychain), nil
+	return c.withMirrorCredentials(keychain), nil
+}
+
+func (c Client) credsKeychain(ctx context.Context, creds Creds) (authn.Keychain, error) {
+	if len(creds.SecretNames) == 0 && creds.ServiceAccountName == "" {
+		keychain, err := k8schain.NewNoClient(ctx)
+		if err != nil || c.workloadIdentityAudience == "" {
+			return keychain, err
+		}
+
+		return authn.NewMultiKeychain(workloadIdentityKeychain{
+			ctx:       ctx,
+			client:    c,
+			namespace: creds.Namespace,
+		}, keychain), nil
+	}
+
+	if c.credentialCache != nil {
+		if keychain, ok := c.credentialCache.Get(creds); ok {
+			return keychain, nil
+		}
+	}
+
+	keychain, err := k8schain.New(ctx, c.k8sClient, k8schain.Options{
+		Namespace:          creds.Namespace,
+		ImagePullSecrets:   creds.SecretNames,
+		ServiceAccountName: creds.ServiceAccountName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.credentialCache != nil {
+		c.credentialCache.Set(creds, keychain)
+	}
+
+	return keychain, nil
 }
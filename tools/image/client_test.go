@@ -1,14 +1,40 @@
 package image_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
 	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/go-logr/logr/funcr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Client", func() {
@@ -100,6 +126,142 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		When("the context is cancelled mid-push", func() {
+			BeforeEach(func() {
+				requestReceived := make(chan struct{})
+				registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+				slowRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+						_, _ = io.Copy(io.Discard, r.Body)
+						close(requestReceived)
+						select {
+						case <-r.Context().Done():
+						case <-time.After(10 * time.Second):
+						}
+						return
+					}
+					registryHandler.ServeHTTP(w, r)
+				}))
+				DeferCleanup(slowRegistry.Close)
+
+				serverURL, err := url.Parse(slowRegistry.URL)
+				Expect(err).NotTo(HaveOccurred())
+				pushRef = serverURL.Host + "/foo/bar"
+				creds.SecretNames = []string{}
+
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				DeferCleanup(func() {
+					ctx = context.Background()
+				})
+				go func() {
+					<-requestReceived
+					cancel()
+				}()
+			})
+
+			It("fails with the context error", func() {
+				Expect(errors.Is(testErr, context.Canceled)).To(BeTrue())
+			})
+		})
+
+		When("a logger is provided", func() {
+			var logLines []string
+
+			BeforeEach(func() {
+				logLines = []string{}
+				logger := funcr.New(func(prefix, args string) {
+					logLines = append(logLines, prefix+" "+args)
+				}, funcr.Options{Verbosity: 1}).WithValues("appGUID", "my-app")
+				imgClient = imgClient.WithLogger(logger)
+			})
+
+			It("logs with the logger values", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(logLines).To(ContainElement(SatisfyAll(
+					ContainSubstring("image.client"),
+					ContainSubstring(`"appGUID"="my-app"`),
+					ContainSubstring(`"ref"=`),
+				)))
+			})
+		})
+
+		When("the source is larger than the in-memory threshold", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset, image.WithInMemoryThreshold(10))
+			})
+
+			It("pushes the same image as when buffering in memory", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+
+				inMemoryZip, err := os.Open("fixtures/layer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				defer inMemoryZip.Close()
+
+				inMemoryRef, err := image.NewClient(k8sClientset).Push(ctx, creds, pushRef, inMemoryZip)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inMemoryRef).To(Equal(imgRef))
+			})
+		})
+
+		When("a progress writer is configured", func() {
+			var progress *bytes.Buffer
+
+			BeforeEach(func() {
+				progress = &bytes.Buffer{}
+				imgClient = image.NewClient(k8sClientset, image.WithProgressWriter(progress))
+				// blobs already in the repository are not uploaded again
+				pushRef = containerRegistry.ImageRef("progress/" + uuid.NewString())
+			})
+
+			It("reports the upload progress as JSON", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+
+				type report struct {
+					BytesWritten int64  `json:"bytes_written"`
+					Total        *int64 `json:"total"`
+				}
+				reports := []report{}
+				decoder := json.NewDecoder(progress)
+				for decoder.More() {
+					var r report
+					Expect(decoder.Decode(&r)).To(Succeed())
+					reports = append(reports, r)
+				}
+
+				Expect(reports).NotTo(BeEmpty())
+				last := reports[len(reports)-1]
+				Expect(last.BytesWritten).To(BeNumerically(">", 0))
+				Expect(last.Total).NotTo(BeNil())
+				Expect(last.BytesWritten).To(Equal(*last.Total))
+			})
+		})
+
+		When("the temp dir does not exist", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset, image.WithTempDir("/not/a/dir"), image.WithInMemoryThreshold(0))
+			})
+
+			It("fails", func() {
+				Expect(testErr).To(MatchError(ContainSubstring("failed to create a temp file for image")))
+				Expect(errors.Is(testErr, fs.ErrNotExist)).To(BeTrue())
+			})
+		})
+
+		When("a temp dir is configured", func() {
+			var tempDir string
+
+			BeforeEach(func() {
+				tempDir = GinkgoT().TempDir()
+				imgClient = image.NewClient(k8sClientset, image.WithTempDir(tempDir), image.WithInMemoryThreshold(0))
+			})
+
+			It("cleans up the temp file after pushing", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(os.ReadDir(tempDir)).To(BeEmpty())
+			})
+		})
+
 		When("using a service account for secrets", func() {
 			BeforeEach(func() {
 				creds.SecretNames = []string{}
@@ -115,6 +277,47 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		When("using both secrets and a service account", func() {
+			var otherRegistry *oci.Registry
+
+			BeforeEach(func() {
+				otherRegistry = oci.NewContainerRegistry("other-user", "other-password")
+				otherSecretName := uuid.NewString()
+				otherSecret, err := dockercfg.CreateDockerConfigSecret("default", otherSecretName, dockercfg.DockerServerConfig{
+					Server:   otherRegistry.URL(),
+					Username: "other-user",
+					Password: "other-password",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Create(ctx, otherSecret)).To(Succeed())
+
+				otherServiceAccountName := uuid.NewString()
+				Expect(k8sClient.Create(ctx, &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      otherServiceAccountName,
+					},
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: otherSecretName}},
+				})).To(Succeed())
+
+				creds.ServiceAccountName = otherServiceAccountName
+			})
+
+			It("authenticates with the secrets", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(imgRef).To(HavePrefix(pushRef))
+			})
+
+			It("authenticates with the service account secrets", func() {
+				_, err := zipFile.Seek(0, 0)
+				Expect(err).NotTo(HaveOccurred())
+
+				otherRef, err := imgClient.Push(ctx, creds, otherRegistry.ImageRef("foo/bar"), zipFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(otherRef).To(HavePrefix(otherRegistry.ImageRef("foo/bar")))
+			})
+		})
+
 		When("seret name is empty (simulating ECR)", func() {
 			BeforeEach(func() {
 				ecrRegistry := oci.NewNoAuthContainerRegistry()
@@ -129,6 +332,165 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Describe("PushMultiPlatform", func() {
+		var platforms []v1.Platform
+
+		BeforeEach(func() {
+			platforms = []v1.Platform{
+				{OS: "linux", Architecture: "amd64"},
+				{OS: "linux", Architecture: "arm64"},
+			}
+		})
+
+		JustBeforeEach(func() {
+			imgRef, testErr = imgClient.PushMultiPlatform(ctx, creds, pushRef, zipFile, platforms, "jim")
+		})
+
+		It("pushes an image index with an image per platform", func() {
+			Expect(testErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(HavePrefix(pushRef))
+
+			ref, err := name.ParseReference(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			index, err := remote.Index(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+			Expect(err).NotTo(HaveOccurred())
+
+			indexDigest, err := index.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imgRef).To(HaveSuffix("@" + indexDigest.String()))
+
+			manifest, err := index.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.Manifests).To(HaveLen(2))
+			Expect(manifest.Manifests[0].Platform.Architecture).To(Equal("amd64"))
+			Expect(manifest.Manifests[1].Platform.Architecture).To(Equal("arm64"))
+
+			_, err = imgClient.Config(ctx, creds, pushRef+":jim")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		When("a single platform is given", func() {
+			BeforeEach(func() {
+				platforms = []v1.Platform{{OS: "linux", Architecture: "arm64"}}
+			})
+
+			It("pushes a single image for that platform", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+
+				ref, err := name.ParseReference(imgRef)
+				Expect(err).NotTo(HaveOccurred())
+				img, err := remote.Image(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+				Expect(err).NotTo(HaveOccurred())
+
+				cfgFile, err := img.ConfigFile()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfgFile.Architecture).To(Equal("arm64"))
+			})
+		})
+	})
+
+	Describe("PushWithAnnotations", func() {
+		var annotations map[string]string
+
+		BeforeEach(func() {
+			annotations = map[string]string{
+				"korifi.cloudfoundry.org/build-guid": "my-build",
+			}
+		})
+
+		JustBeforeEach(func() {
+			imgRef, testErr = imgClient.PushWithAnnotations(ctx, creds, pushRef, zipFile, annotations, "jim")
+		})
+
+		It("annotates the image manifest", func() {
+			Expect(testErr).NotTo(HaveOccurred())
+
+			config, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Annotations).To(Equal(annotations))
+		})
+	})
+
+	Describe("PushDir", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(dir, "bin"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "bin", "run"), []byte("#!/bin/sh"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "config.yml"), []byte("foo: bar"), 0o600)).To(Succeed())
+			Expect(os.Symlink("bin/run", filepath.Join(dir, "start"))).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			imgRef, testErr = imgClient.PushDir(ctx, creds, pushRef, dir, "jim")
+		})
+
+		It("pushes the directory contents as a layer", func() {
+			Expect(testErr).NotTo(HaveOccurred())
+
+			ref, err := name.ParseReference(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			img, err := remote.Image(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+			Expect(err).NotTo(HaveOccurred())
+			layers, err := img.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(HaveLen(1))
+
+			contents, err := layers[0].Uncompressed()
+			Expect(err).NotTo(HaveOccurred())
+			defer contents.Close()
+
+			headers := map[string]*tar.Header{}
+			tr := tar.NewReader(contents)
+			for {
+				header, err := tr.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				headers[header.Name] = header
+			}
+
+			Expect(headers).To(HaveKey("/bin"))
+			Expect(headers).To(HaveKey("/bin/run"))
+			Expect(headers["/bin/run"].FileInfo().Mode().Perm()).To(Equal(fs.FileMode(0o755)))
+			Expect(headers).To(HaveKey("/config.yml"))
+			Expect(headers["/config.yml"].FileInfo().Mode().Perm()).To(Equal(fs.FileMode(0o600)))
+			Expect(headers).To(HaveKey("/start"))
+			Expect(headers["/start"].Typeflag).To(BeEquivalentTo(tar.TypeSymlink))
+			Expect(headers["/start"].Linkname).To(Equal("bin/run"))
+		})
+
+		It("tags the image", func() {
+			Expect(testErr).NotTo(HaveOccurred())
+
+			exists, err := imgClient.Exists(ctx, creds, pushRef+":jim")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+		})
+
+		When("the directory does not exist", func() {
+			BeforeEach(func() {
+				dir = filepath.Join(dir, "not-there")
+			})
+
+			It("fails", func() {
+				Expect(testErr).To(MatchError(ContainSubstring("failed to read image source directory")))
+			})
+		})
+
+		When("the path is not a directory", func() {
+			BeforeEach(func() {
+				dir = filepath.Join(dir, "config.yml")
+			})
+
+			It("fails", func() {
+				Expect(testErr).To(MatchError(ContainSubstring("is not a directory")))
+			})
+		})
+	})
+
 	Describe("Config", func() {
 		var config image.Config
 
@@ -145,6 +507,70 @@ var _ = Describe("Client", func() {
 			Expect(config.Labels).To(Equal(map[string]string{"foo": "bar"}))
 			Expect(config.User).To(Equal("my-user"))
 			Expect(config.ExposedPorts).To(ConsistOf(int32(123), int32(456)))
+			Expect(config.Annotations).To(BeEmpty())
+			Expect(config.SchemaVersion).To(Equal(2))
+		})
+
+		It("leaves the creation time unset", func() {
+			Expect(config.CreatedAt).To(BeNil())
+		})
+
+		When("the image records its creation time", func() {
+			BeforeEach(func() {
+				imgCfg.Created = v1.Time{Time: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)}
+				containerRegistry.PushImage(pushRef, imgCfg)
+			})
+
+			It("returns it", func() {
+				Expect(config.CreatedAt).To(PointTo(BeTemporally("==", imgCfg.Created.Time)))
+			})
+		})
+
+		It("leaves the healthcheck unset", func() {
+			Expect(config.Healthcheck).To(BeNil())
+		})
+
+		When("the image defines a healthcheck", func() {
+			BeforeEach(func() {
+				imgCfg.Config.Healthcheck = &v1.HealthConfig{
+					Test:        []string{"CMD", "curl", "-f", "http://localhost:8080/health"},
+					Interval:    10 * time.Second,
+					Timeout:     2 * time.Second,
+					StartPeriod: time.Minute,
+					Retries:     5,
+				}
+				containerRegistry.PushImage(pushRef, imgCfg)
+			})
+
+			It("returns it", func() {
+				Expect(config.Healthcheck).To(Equal(&image.HealthcheckConfig{
+					Test:     []string{"CMD", "curl", "-f", "http://localhost:8080/health"},
+					Interval: 10 * time.Second,
+					Timeout:  2 * time.Second,
+					Retries:  5,
+				}))
+			})
+		})
+
+		It("reports the image has no layers", func() {
+			Expect(config.LayerCount).To(BeZero())
+			Expect(config.UncompressedSizeBytes).To(BeZero())
+			Expect(config.SizeApproximate).To(BeFalse())
+		})
+
+		When("the image has layers", func() {
+			BeforeEach(func() {
+				var err error
+				pushRef, err = imgClient.Push(ctx, creds, pushRef, zipFile)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reports the layer count and size", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(config.LayerCount).To(Equal(1))
+				Expect(config.UncompressedSizeBytes).To(BeNumerically(">", 0))
+				Expect(config.SizeApproximate).To(BeTrue())
+			})
 		})
 
 		When("the ref is invalid", func() {
@@ -194,6 +620,78 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		When("the ref points to an image index", func() {
+			BeforeEach(func() {
+				var err error
+				pushRef, err = imgClient.PushMultiPlatform(ctx, creds, pushRef+"/index", zipFile, []v1.Platform{
+					{OS: "linux", Architecture: "arm64"},
+					{OS: "linux", Architecture: "amd64"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fetches the config of the platform image", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(config.LayerCount).To(Equal(1))
+				Expect(config.SchemaVersion).To(Equal(2))
+			})
+		})
+
+		When("a platform is set on the client", func() {
+			BeforeEach(func() {
+				var index v1.ImageIndex = empty.Index
+				for _, arch := range []string{"amd64", "arm64"} {
+					img, err := random.Image(64, 1)
+					Expect(err).NotTo(HaveOccurred())
+					cfgFile, err := img.ConfigFile()
+					Expect(err).NotTo(HaveOccurred())
+					cfgFile.OS = "linux"
+					cfgFile.Architecture = arch
+					cfgFile.Config.Labels = map[string]string{"arch": arch}
+					img, err = mutate.ConfigFile(img, cfgFile)
+					Expect(err).NotTo(HaveOccurred())
+
+					index = mutate.AppendManifests(index, mutate.IndexAddendum{
+						Add:        img,
+						Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+					})
+				}
+
+				pushRef += "/multi-arch"
+				ref, err := name.ParseReference(pushRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(remote.WriteIndex(ref, index, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+
+				imgClient = image.NewClient(k8sClientset, image.WithPlatform("linux", "arm64"))
+			})
+
+			It("fetches the config of the image for that platform", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+				Expect(config.Labels).To(Equal(map[string]string{"arch": "arm64"}))
+			})
+
+			When("the index has no image for the platform", func() {
+				BeforeEach(func() {
+					imgClient = image.NewClient(k8sClientset, image.WithPlatform("windows", "amd64"))
+				})
+
+				It("fails", func() {
+					Expect(testErr).To(MatchError(ContainSubstring("failed to get image")))
+				})
+			})
+
+			When("the ref points to an image", func() {
+				BeforeEach(func() {
+					pushRef = strings.TrimSuffix(pushRef, "/multi-arch")
+				})
+
+				It("fetches its config", func() {
+					Expect(testErr).NotTo(HaveOccurred())
+					Expect(config.Labels).To(Equal(map[string]string{"foo": "bar"}))
+				})
+			})
+		})
+
 		When("ports are in the format 'port/protocol'", func() {
 			BeforeEach(func() {
 				imgCfg.Config.ExposedPorts = map[string]struct{}{
@@ -258,6 +756,26 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		When("the image has already been deleted", func() {
+			BeforeEach(func() {
+				Expect(imgClient.Delete(ctx, creds, imgRef, tagsToDelete...)).To(Succeed())
+			})
+
+			It("succeeds", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the repository has already been deleted", func() {
+			BeforeEach(func() {
+				Expect(imgClient.DeleteRepository(ctx, creds, pushRef)).To(Succeed())
+			})
+
+			It("succeeds", func() {
+				Expect(testErr).NotTo(HaveOccurred())
+			})
+		})
+
 		When("the secret doesn't exist", func() {
 			BeforeEach(func() {
 				creds.SecretNames = []string{"not-a-secret"}
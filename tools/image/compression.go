@@ -0,0 +1,65 @@
+package image
+
+import (
+	"github.com/google/go-containerregistry/pkg/compression"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// CompressionAlgorithm is the algorithm the source layer of pushed images is
+// compressed with
+type CompressionAlgorithm string
+
+const (
+	CompressionGzip CompressionAlgorithm = "gzip"
+	// CompressionZstd is faster and compresses better than gzip, but is
+	// rejected by some older registries and container runtimes
+	CompressionZstd CompressionAlgorithm = "zstd"
+)
+
+// WithLayerCompression sets the algorithm the layers built from the sources
+// passed to Push and PushDir are compressed with. Defaults to gzip. Images
+// with zstd layers use OCI media types, as Docker manifests cannot describe
+// them.
+func WithLayerCompression(algo CompressionAlgorithm) Option {
+	return func(c *Client) {
+		c.layerCompression = algo
+	}
+}
+
+// WithCompression overrides the layer compression of the client for a
+// single push
+func WithCompression(algo CompressionAlgorithm) PushOption {
+	return func(cfg *pushConfig) {
+		cfg.compression = algo
+	}
+}
+
+func (c Client) layerOptions() []tarball.LayerOption {
+	if c.layerCompression == CompressionZstd {
+		return []tarball.LayerOption{
+			tarball.WithCompression(compression.ZStd),
+			tarball.WithMediaType(types.OCILayerZStd),
+		}
+	}
+
+	return nil
+}
+
+// baseImage returns the empty image the layer is appended to, using OCI
+// media types for zstd layers
+func baseImage(layer v1.Layer) (v1.Image, error) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType != types.OCILayerZStd {
+		return empty.Image, nil
+	}
+
+	return mutate.MediaType(mutate.ConfigMediaType(empty.Image, types.OCIConfigJSON), types.OCIManifestSchema1), nil
+}
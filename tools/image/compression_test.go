@@ -0,0 +1,135 @@
+package image_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithLayerCompression", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+		opts    []image.PushOption
+		imgRef  string
+		pushErr error
+	)
+
+	zstdMagic := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic := []byte{0x1f, 0x8b}
+
+	pushedImage := func() (*v1.Manifest, []byte) {
+		GinkgoHelper()
+
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := remote.Image(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+		Expect(err).NotTo(HaveOccurred())
+
+		manifest, err := img.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+
+		layers, err := img.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layers).To(HaveLen(1))
+		compressed, err := layers[0].Compressed()
+		Expect(err).NotTo(HaveOccurred())
+		defer compressed.Close()
+		header := make([]byte, 4)
+		_, err = io.ReadFull(compressed, header)
+		Expect(err).NotTo(HaveOccurred())
+
+		return manifest, header
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgClient = image.NewClient(k8sClientset)
+		pushRef = containerRegistry.ImageRef("compression/" + uuid.NewString())
+		opts = nil
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.PushWithOptions(ctx, creds, pushRef, zipFile, opts...)
+	})
+
+	It("compresses layers with gzip by default", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		manifest, header := pushedImage()
+		Expect(manifest.MediaType).To(Equal(types.DockerManifestSchema2))
+		Expect(manifest.Layers[0].MediaType).To(Equal(types.DockerLayer))
+		Expect(bytes.HasPrefix(header, gzipMagic)).To(BeTrue())
+	})
+
+	When("zstd is selected", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithLayerCompression(image.CompressionZstd))
+		})
+
+		It("compresses layers with zstd in an OCI image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			manifest, header := pushedImage()
+			Expect(manifest.MediaType).To(Equal(types.OCIManifestSchema1))
+			Expect(manifest.Config.MediaType).To(Equal(types.OCIConfigJSON))
+			Expect(manifest.Layers[0].MediaType).To(Equal(types.OCILayerZStd))
+			Expect(header).To(Equal(zstdMagic))
+
+			config, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.LayerCount).To(Equal(1))
+		})
+
+		When("gzip is selected for the push", func() {
+			BeforeEach(func() {
+				opts = []image.PushOption{image.WithCompression(image.CompressionGzip)}
+			})
+
+			It("compresses layers with gzip", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+
+				manifest, header := pushedImage()
+				Expect(manifest.Layers[0].MediaType).To(Equal(types.DockerLayer))
+				Expect(bytes.HasPrefix(header, gzipMagic)).To(BeTrue())
+			})
+		})
+	})
+
+	When("zstd is selected for a multi-platform push", func() {
+		BeforeEach(func() {
+			opts = []image.PushOption{
+				image.WithCompression(image.CompressionZstd),
+				image.WithPushPlatform("linux", "amd64"),
+				image.WithPushPlatform("linux", "arm64"),
+			}
+		})
+
+		It("pushes an OCI image index", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			ref, err := name.ParseReference(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			descriptor, err := remote.Get(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(descriptor.MediaType).To(Equal(types.OCIImageIndex))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package image
+
+import (
+	"container/list"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithConfigCache makes Config keep up to maxEntries configs in memory for
+// ttl, keyed on the image ref. Only successful lookups are cached, and refs
+// including a digest always go to the registry as their content cannot
+// change. With WithRequireSignature every ref is verified and read by digest,
+// so nothing is cached. Copies of the client share the cache.
+func WithConfigCache(maxEntries int, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.configCache = newConfigCache(maxEntries, ttl)
+	}
+}
+
+type configCache struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mutex sync.Mutex
+	// lru holds *configCacheEntry values, most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type configCacheEntry struct {
+	imageRef  string
+	config    Config
+	expiresAt time.Time
+}
+
+func newConfigCache(maxEntries int, ttl time.Duration) *configCache {
+	return &configCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *configCache) get(imageRef string) (Config, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[imageRef]
+	if !ok {
+		return Config{}, false
+	}
+
+	entry := element.Value.(*configCacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return Config{}, false
+	}
+
+	c.lru.MoveToFront(element)
+	return copyConfig(entry.config), true
+}
+
+func (c *configCache) add(imageRef string, config Config) {
+	if c.maxEntries < 1 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &configCacheEntry{
+		imageRef:  imageRef,
+		config:    copyConfig(config),
+		expiresAt: c.now().Add(c.ttl),
+	}
+
+	if element, ok := c.entries[imageRef]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[imageRef] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *configCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*configCacheEntry).imageRef)
+}
+
+// copyConfig stops callers modifying a returned config from changing the
+// cached one
+func copyConfig(config Config) Config {
+	config.Labels = maps.Clone(config.Labels)
+	config.Annotations = maps.Clone(config.Annotations)
+	config.ExposedPorts = slices.Clone(config.ExposedPorts)
+	config.OSFeatures = slices.Clone(config.OSFeatures)
+	if config.CreatedAt != nil {
+		createdAt := *config.CreatedAt
+		config.CreatedAt = &createdAt
+	}
+	if config.Healthcheck != nil {
+		healthcheck := *config.Healthcheck
+		healthcheck.Test = slices.Clone(healthcheck.Test)
+		config.Healthcheck = &healthcheck
+	}
+	return config
+}
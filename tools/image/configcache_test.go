@@ -0,0 +1,154 @@
+package image_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConfigCache", func() {
+	var (
+		creds      image.Creds
+		maxEntries int
+		ttl        time.Duration
+		imgRef     string
+	)
+
+	pushWithLabel := func(ref, value string) {
+		GinkgoHelper()
+
+		containerRegistry.PushImage(ref, &v1.ConfigFile{
+			Config: v1.Config{
+				Labels:      map[string]string{"version": value},
+				Healthcheck: &v1.HealthConfig{Test: []string{"CMD", "true"}},
+			},
+			OSFeatures: []string{"win32k"},
+		})
+	}
+
+	configLabel := func(ref string) string {
+		GinkgoHelper()
+
+		config, err := imgClient.Config(ctx, creds, ref)
+		Expect(err).NotTo(HaveOccurred())
+		return config.Labels["version"]
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		maxEntries = 10
+		ttl = time.Hour
+		imgRef = containerRegistry.ImageRef("config-cache/"+uuid.NewString()) + ":latest"
+		pushWithLabel(imgRef, "1")
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, image.WithConfigCache(maxEntries, ttl))
+		Expect(configLabel(imgRef)).To(Equal("1"))
+		pushWithLabel(imgRef, "2")
+	})
+
+	It("returns the cached config", func() {
+		Expect(configLabel(imgRef)).To(Equal("1"))
+	})
+
+	It("is not affected by changes to returned configs", func() {
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		config.Labels["version"] = "changed"
+
+		Expect(configLabel(imgRef)).To(Equal("1"))
+	})
+
+	It("is not affected by changes to the healthcheck of returned configs", func() {
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		config.Healthcheck.Test[1] = "false"
+		config.Healthcheck.Retries = 5
+
+		config, err = imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Healthcheck).To(Equal(&image.HealthcheckConfig{Test: []string{"CMD", "true"}}))
+	})
+
+	It("is not affected by changes to the OS features of returned configs", func() {
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		config.OSFeatures[0] = "changed"
+
+		config, err = imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.OSFeatures).To(Equal([]string{"win32k"}))
+	})
+
+	It("is shared by copies of the client", func() {
+		imgClient = imgClient.WithLogger(GinkgoLogr)
+		Expect(configLabel(imgRef)).To(Equal("1"))
+	})
+
+	When("the entry expires", func() {
+		BeforeEach(func() {
+			ttl = 100 * time.Millisecond
+		})
+
+		It("fetches the config again", func() {
+			time.Sleep(150 * time.Millisecond)
+			Expect(configLabel(imgRef)).To(Equal("2"))
+		})
+	})
+
+	When("the cache is full", func() {
+		BeforeEach(func() {
+			maxEntries = 1
+		})
+
+		It("evicts the least recently used entry", func() {
+			otherRef := containerRegistry.ImageRef("config-cache/"+uuid.NewString()) + ":latest"
+			pushWithLabel(otherRef, "other")
+			Expect(configLabel(otherRef)).To(Equal("other"))
+
+			Expect(configLabel(imgRef)).To(Equal("2"))
+		})
+	})
+
+	When("the ref includes a digest", func() {
+		var digestRef string
+
+		JustBeforeEach(func() {
+			digest, err := imgClient.Digest(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			digestRef = imgRef + "@" + digest
+			Expect(configLabel(digestRef)).To(Equal("2"))
+
+			Expect(imgClient.Delete(ctx, creds, digestRef)).To(Succeed())
+		})
+
+		It("does not cache the config", func() {
+			_, err := imgClient.Config(ctx, creds, digestRef)
+			Expect(err).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+
+	When("the lookup fails", func() {
+		var missingRef string
+
+		JustBeforeEach(func() {
+			missingRef = containerRegistry.ImageRef("config-cache/"+uuid.NewString()) + ":latest"
+			_, err := imgClient.Config(ctx, creds, missingRef)
+			Expect(err).To(HaveOccurred())
+
+			pushWithLabel(missingRef, "pushed")
+		})
+
+		It("does not cache the failure", func() {
+			Expect(configLabel(missingRef)).To(Equal("pushed"))
+		})
+	})
+})
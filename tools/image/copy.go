@@ -0,0 +1,81 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Copy copies the image (or image index) at srcRef to dstRef without
+// re-staging it and returns the digest reference of the copy. Like every
+// manifest the client writes, the copy is scanned and signed before dstRef is
+// tagged.
+func (c Client) Copy(ctx context.Context, srcCreds Creds, srcRef string, dstCreds Creds, dstRef string) (_ string, err error) {
+	ctx, endSpan := c.startSpan(ctx, "Copy", dstRef)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("copying", "src", srcRef, "dst", dstRef)
+	src, err := c.parseReadReference(srcRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing source reference %s: %w", srcRef, err)
+	}
+
+	dst, err := c.parseReference(dstRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing destination reference %s: %w", dstRef, err)
+	}
+
+	if src.Context().RegistryStr() == dst.Context().RegistryStr() {
+		c.logger.Info("copying within the same registry - consider tagging instead", "src", srcRef, "dst", dstRef)
+	}
+
+	srcOpts, err := c.remoteOpts(ctx, srcCreds)
+	if err != nil {
+		return "", authError(srcRef, fmt.Errorf("error creating source keychain: %w", err))
+	}
+
+	dstOpts, err := c.remoteOpts(ctx, dstCreds)
+	if err != nil {
+		return "", authError(dstRef, fmt.Errorf("error creating destination keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(src, srcOpts...)
+	if err != nil {
+		return "", registryError(srcRef, fmt.Errorf("failed to get source image: %w", err))
+	}
+
+	srcArtifact, err := descriptorArtifact(descriptor)
+	if err != nil {
+		return "", registryError(srcRef, fmt.Errorf("failed to read source image: %w", err))
+	}
+
+	digest, err := srcArtifact.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image digest: %w", err)
+	}
+
+	writeOpts := append(dstOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("copy", func() error {
+		return writeArtifact(dst.Context().Digest(digest.String()), srcArtifact, writeOpts...)
+	})
+	if err != nil {
+		return "", pushError(dstRef, fmt.Errorf("failed to write destination image: %w", err))
+	}
+
+	return c.finishWrite(ctx, dstCreds, nil, writtenManifest{
+		repo:     dst.Context(),
+		manifest: srcArtifact,
+		digest:   digest,
+		tags:     refTags(dst, nil),
+	}, writeOpts)
+}
+
+// descriptorArtifact returns the image index or the image described by
+// descriptor
+func descriptorArtifact(descriptor *remote.Descriptor) (artifact, error) {
+	if descriptor.MediaType.IsIndex() {
+		return descriptor.ImageIndex()
+	}
+	return descriptor.Image()
+}
@@ -0,0 +1,73 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Copy", func() {
+	var (
+		srcCreds    image.Creds
+		dstCreds    image.Creds
+		srcRef      string
+		dstRef      string
+		dstRegistry *oci.Registry
+		copiedRef   string
+		copyErr     error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		srcCreds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		dstCreds = image.Creds{Namespace: "default"}
+
+		srcRef = containerRegistry.ImageRef("copy/src")
+		containerRegistry.PushImage(srcRef, &v1.ConfigFile{
+			Config: v1.Config{
+				Labels: map[string]string{"foo": "bar"},
+			},
+		})
+
+		dstRegistry = oci.NewNoAuthContainerRegistry()
+		dstRef = dstRegistry.ImageRef("copy/dst")
+	})
+
+	JustBeforeEach(func() {
+		copiedRef, copyErr = imgClient.Copy(ctx, srcCreds, srcRef, dstCreds, dstRef)
+	})
+
+	It("copies the image to the destination registry", func() {
+		Expect(copyErr).NotTo(HaveOccurred())
+		Expect(copiedRef).To(HavePrefix(dstRef + "@sha256:"))
+
+		config, err := imgClient.Config(ctx, dstCreds, copiedRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Labels).To(Equal(map[string]string{"foo": "bar"}))
+	})
+
+	When("the source does not exist", func() {
+		BeforeEach(func() {
+			srcRef = containerRegistry.ImageRef("copy/missing")
+		})
+
+		It("fails", func() {
+			Expect(copyErr).To(MatchError(ContainSubstring("failed to get source image")))
+		})
+	})
+
+	When("the destination ref is invalid", func() {
+		BeforeEach(func() {
+			dstRef += "::bad"
+		})
+
+		It("fails", func() {
+			Expect(copyErr).To(MatchError(ContainSubstring("error parsing destination reference")))
+		})
+	})
+})
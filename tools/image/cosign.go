@@ -0,0 +1,245 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	cosignremote "github.com/sigstore/cosign/v2/pkg/cosign/remote"
+	ocimutate "github.com/sigstore/cosign/v2/pkg/oci/mutate"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+)
+
+// cosignPasswordEnv holds the password of encrypted signing keys, as for the
+// cosign CLI
+const cosignPasswordEnv = "COSIGN_PASSWORD"
+
+// WithCosignSigner makes the client sign every pushed image with the cosign
+// private key at keyRef. Encrypted keys are decrypted using the
+// COSIGN_PASSWORD environment variable, like the cosign CLI does. The key is
+// loaded on the first push.
+func WithCosignSigner(keyRef string) Option {
+	return func(c *Client) {
+		c.signer = &cosignSigner{keyRef: keyRef}
+	}
+}
+
+// ErrSignatureNotFound and ErrSignatureInvalid are returned by the methods
+// reading images when the client requires signatures and the image has no
+// cosign signature or none made with the required key
+var (
+	ErrSignatureNotFound = errors.New("image signature not found")
+	ErrSignatureInvalid  = errors.New("image signature invalid")
+)
+
+// WithRequireSignature makes the methods reading images, such as Config,
+// Inspect, Pull and Rebase, fail unless the image has a cosign signature made
+// with the private key of the PEM encoded public key at keyRef, like `cosign
+// verify --key` does. The image is then read by the digest of the verified
+// manifest. For an image index the signature of the index is required. The
+// key is loaded on the first call.
+func WithRequireSignature(keyRef string) Option {
+	return func(c *Client) {
+		c.verifier = &cosignVerifier{keyRef: keyRef}
+	}
+}
+
+type cosignVerifier struct {
+	keyRef string
+
+	loadOnce sync.Once
+	verifier signature.Verifier
+	loadErr  error
+}
+
+type cosignSigner struct {
+	keyRef string
+
+	loadOnce sync.Once
+	signer   signature.SignerVerifier
+	loadErr  error
+}
+
+// sign pushes a cosign signature for the manifest with the given digest to
+// the sha256-<hex>.sig tag of the repository, as `cosign sign --key` does.
+// Signatures made by other keys are kept, and an existing signature by the
+// same key is not duplicated.
+func (c Client) sign(repo name.Repository, digest v1.Hash, remoteOpts []remote.Option) error {
+	signer, err := c.signer.load()
+	if err != nil {
+		return err
+	}
+
+	digestRef := repo.Digest(digest.String())
+	signedPayload, err := (&payload.Cosign{Image: digestRef}).MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to create signature payload: %w", err)
+	}
+
+	sig, err := signer.SignMessage(bytes.NewReader(signedPayload))
+	if err != nil {
+		return fmt.Errorf("failed to sign image: %w", err)
+	}
+
+	ociSig, err := static.NewSignature(signedPayload, base64.StdEncoding.EncodeToString(sig))
+	if err != nil {
+		return fmt.Errorf("failed to create signature: %w", err)
+	}
+
+	ociOpts := ociremote.WithRemoteOptions(remoteOpts...)
+	entity, err := ociremote.SignedEntity(digestRef, ociOpts)
+	if err != nil {
+		return registryError(repo.String(), fmt.Errorf("failed to get signed image: %w", err))
+	}
+
+	signed, err := ocimutate.AttachSignatureToEntity(entity, ociSig, ocimutate.WithDupeDetector(cosignremote.NewDupeDetector(signer)))
+	if err != nil {
+		return fmt.Errorf("failed to attach signature: %w", err)
+	}
+
+	c.logger.V(1).Info("pushing signature", "ref", digestRef)
+	err = c.retryOnError("sign", func() error {
+		return ociremote.WriteSignatures(repo, signed, ociOpts)
+	})
+	if err != nil {
+		return pushError(repo.String(), fmt.Errorf("failed to upload signature: %w", err))
+	}
+
+	return nil
+}
+
+// verifySigned returns an error wrapping ErrSignatureNotFound or
+// ErrSignatureInvalid unless the manifest ref resolves to is signed with the
+// key of the verifier. The digest ref of the verified manifest is returned
+// and callers fetch it rather than ref, so that a tag moved after the check
+// cannot serve an unverified image. Nothing is checked and ref is returned as
+// is when no signature is required.
+func (c Client) verifySigned(ctx context.Context, creds Creds, ref name.Reference) (name.Reference, error) {
+	if c.verifier == nil {
+		return ref, nil
+	}
+
+	verifier, err := c.verifier.load()
+	if err != nil {
+		return nil, err
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(ref.String(), fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Head(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(ref.String(), fmt.Errorf("failed to get image digest: %w", err))
+	}
+
+	digestRef := ref.Context().Digest(descriptor.Digest.String())
+	_, _, err = cosign.VerifyImageSignatures(ctx, digestRef, &cosign.CheckOpts{
+		RegistryClientOpts: []ociremote.Option{ociremote.WithRemoteOptions(remoteOpts...)},
+		SigVerifier:        verifier,
+		ClaimVerifier:      cosign.SimpleClaimVerifier,
+		// signatures made with a key are not uploaded to a transparency
+		// log, as with `cosign verify --key --insecure-ignore-tlog`
+		IgnoreTlog: true,
+	})
+	if err != nil {
+		var noSignatures *cosign.ErrNoSignaturesFound
+		if errors.As(err, &noSignatures) {
+			return nil, fmt.Errorf("%w: %s has no signature", ErrSignatureNotFound, ref)
+		}
+
+		var noMatchingSignatures *cosign.ErrNoMatchingSignatures
+		if errors.As(err, &noMatchingSignatures) {
+			return nil, fmt.Errorf("%w: %s is not signed with %s: %w", ErrSignatureInvalid, ref, c.verifier.keyRef, err)
+		}
+
+		return nil, registryError(ref.String(), fmt.Errorf("failed to verify signatures: %w", err))
+	}
+
+	c.logger.V(1).Info("verified image signature", "ref", ref, "digest", descriptor.Digest)
+	return digestRef, nil
+}
+
+func (v *cosignVerifier) load() (signature.Verifier, error) {
+	v.loadOnce.Do(func() {
+		v.verifier, v.loadErr = loadCosignPublicKey(v.keyRef)
+	})
+	return v.verifier, v.loadErr
+}
+
+func loadCosignPublicKey(keyRef string) (signature.Verifier, error) {
+	keyPEM, err := os.ReadFile(keyRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification key: %w", err)
+	}
+
+	key, err := cryptoutils.UnmarshalPEMToPublicKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verification key: %w", err)
+	}
+
+	verifier, err := signature.LoadVerifier(key, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load verification key: %w", err)
+	}
+
+	return verifier, nil
+}
+
+func (s *cosignSigner) load() (signature.SignerVerifier, error) {
+	s.loadOnce.Do(func() {
+		s.signer, s.loadErr = loadCosignKey(s.keyRef, os.Getenv(cosignPasswordEnv))
+	})
+	return s.signer, s.loadErr
+}
+
+// loadCosignKey loads the private key at keyRef. Keys encrypted by `cosign
+// generate-key-pair` or `cosign import-key-pair` are decrypted with password,
+// other PEM encoded ECDSA, RSA or ED25519 keys are used as is.
+func loadCosignKey(keyRef, password string) (signature.SignerVerifier, error) {
+	keyPEM, err := os.ReadFile(keyRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q is not PEM encoded", keyRef)
+	}
+
+	if strings.HasPrefix(block.Type, "ENCRYPTED ") {
+		signer, loadErr := cosign.LoadPrivateKey(keyPEM, []byte(password))
+		if loadErr != nil {
+			return nil, fmt.Errorf("failed to load signing key: %w", loadErr)
+		}
+		return signer, nil
+	}
+
+	key, err := cryptoutils.UnmarshalPEMToPrivateKey(keyPEM, cryptoutils.SkipPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	signer, err := signature.LoadSignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,392 @@
+package image_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+)
+
+var _ = Describe("CosignSigner", func() {
+	var (
+		creds      image.Creds
+		privateKey *ecdsa.PrivateKey
+		keyPath    string
+		pushRef    string
+		imgRef     string
+		pushErr    error
+	)
+
+	writeKey := func(pemType string, der []byte) {
+		Expect(os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0o600)).To(Succeed())
+	}
+
+	getSignatures := func() (v1.Image, error) {
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		digest := ref.(name.Digest)
+		hash, err := v1.NewHash(digest.DigestStr())
+		Expect(err).NotTo(HaveOccurred())
+		sigRef := digest.Context().Tag(hash.Algorithm + "-" + hash.Hex + ".sig")
+
+		return remote.Image(sigRef, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		pushRef = containerRegistry.ImageRef("cosign/" + uuid.NewString())
+
+		var err error
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyPath = filepath.Join(GinkgoT().TempDir(), "cosign.key")
+		writeKey("PRIVATE KEY", der)
+
+		imgClient = image.NewClient(k8sClientset, image.WithCosignSigner(keyPath))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.Push(ctx, creds, pushRef, zipFile, "jim")
+	})
+
+	It("pushes a cosign signature for the image", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		sigImage, err := getSignatures()
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := sigImage.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(HaveLen(1))
+		Expect(string(manifest.Layers[0].MediaType)).To(Equal("application/vnd.dev.cosign.simplesigning.v1+json"))
+
+		layers, err := sigImage.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		payloadReader, err := layers[0].Uncompressed()
+		Expect(err).NotTo(HaveOccurred())
+		defer payloadReader.Close()
+		payload, err := io.ReadAll(payloadReader)
+		Expect(err).NotTo(HaveOccurred())
+
+		var simpleSigning struct {
+			Critical struct {
+				Identity struct {
+					DockerReference string `json:"docker-reference"`
+				} `json:"identity"`
+				Image struct {
+					DockerManifestDigest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+				Type string `json:"type"`
+			} `json:"critical"`
+		}
+		Expect(json.Unmarshal(payload, &simpleSigning)).To(Succeed())
+		Expect(simpleSigning.Critical.Type).To(Equal("cosign container image signature"))
+		Expect(simpleSigning.Critical.Identity.DockerReference).To(Equal(pushRef))
+		Expect(imgRef).To(HaveSuffix("@" + simpleSigning.Critical.Image.DockerManifestDigest))
+
+		signature, err := base64.StdEncoding.DecodeString(manifest.Layers[0].Annotations["dev.cosignproject.cosign/signature"])
+		Expect(err).NotTo(HaveOccurred())
+		payloadDigest := sha256.Sum256(payload)
+		Expect(ecdsa.VerifyASN1(&privateKey.PublicKey, payloadDigest[:], signature)).To(BeTrue())
+	})
+
+	When("the image is pushed again", func() {
+		JustBeforeEach(func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+
+			_, pushErr = imgClient.Push(ctx, creds, pushRef, zipFile, "jim")
+		})
+
+		It("does not duplicate the signature", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			sigImage, err := getSignatures()
+			Expect(err).NotTo(HaveOccurred())
+			layers, err := sigImage.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(HaveLen(1))
+		})
+	})
+
+	When("the image is copied", func() {
+		JustBeforeEach(func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			imgRef, pushErr = imgClient.Copy(ctx, creds, imgRef, creds, containerRegistry.ImageRef("cosign/"+uuid.NewString()))
+		})
+
+		It("signs the copy", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			_, err := getSignatures()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the key is encrypted", func() {
+		var password string
+
+		BeforeEach(func() {
+			password = "s3cr3t"
+			keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) {
+				return []byte(password), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(keyPath, keys.PrivateBytes, 0o600)).To(Succeed())
+		})
+
+		When("COSIGN_PASSWORD is correct", func() {
+			BeforeEach(func() {
+				setEnv("COSIGN_PASSWORD", password)
+			})
+
+			It("signs the image", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+				_, err := getSignatures()
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("COSIGN_PASSWORD is wrong", func() {
+			BeforeEach(func() {
+				setEnv("COSIGN_PASSWORD", "not-the-password")
+			})
+
+			It("fails the push", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("failed to load signing key")))
+			})
+		})
+	})
+
+	When("the key does not exist", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithCosignSigner(filepath.Join(GinkgoT().TempDir(), "not-there.key")))
+		})
+
+		It("fails the push", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("failed to read signing key")))
+		})
+
+		It("does not tag the unsigned image", func() {
+			exists, err := imgClient.Exists(ctx, creds, pushRef+":jim")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	When("no signer is configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+		})
+
+		It("does not sign the image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			_, err := getSignatures()
+			Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+		})
+	})
+})
+
+var _ = Describe("WithRequireSignature", func() {
+	var (
+		creds         image.Creds
+		keyDir        string
+		publicKeyPath string
+		signingClient image.Client
+		imgRef        string
+		configErr     error
+	)
+
+	writeKeyPair := func(name string) (string, string) {
+		GinkgoHelper()
+
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+		privatePath := filepath.Join(keyDir, name+".key")
+		Expect(os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600)).To(Succeed())
+
+		publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+		Expect(err).NotTo(HaveOccurred())
+		publicPath := filepath.Join(keyDir, name+".pub")
+		Expect(os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o600)).To(Succeed())
+
+		return privatePath, publicPath
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		keyDir = GinkgoT().TempDir()
+
+		var privateKeyPath string
+		privateKeyPath, publicKeyPath = writeKeyPair("cosign")
+		signingClient = image.NewClient(k8sClientset, image.WithCosignSigner(privateKeyPath))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, err = signingClient.Push(ctx, creds, containerRegistry.ImageRef("cosign/"+uuid.NewString()), zipFile, "jim")
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset, image.WithRequireSignature(publicKeyPath))
+		_, configErr = imgClient.Config(ctx, creds, imgRef)
+	})
+
+	It("returns the config of signed images", func() {
+		Expect(configErr).NotTo(HaveOccurred())
+	})
+
+	It("pulls signed images", func() {
+		tarball, err := imgClient.Pull(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		defer tarball.Close()
+		_, err = io.Copy(io.Discard, tarball)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reads tagged images by the verified digest", func() {
+		recorder := &registryRequestRecorder{}
+		verifyingClient := image.NewClient(k8sClientset, image.WithRequireSignature(publicKeyPath), image.WithTransport(recorder))
+
+		_, err := verifyingClient.Config(ctx, creds, strings.Split(imgRef, "@")[0]+":jim")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.recorded(http.MethodGet, "/manifests/jim")).To(BeEmpty())
+		Expect(recorder.recorded(http.MethodGet, "/manifests/"+strings.Split(imgRef, "@")[1])).NotTo(BeEmpty())
+	})
+
+	When("the image is not signed", func() {
+		BeforeEach(func() {
+			signingClient = image.NewClient(k8sClientset)
+		})
+
+		It("fails with ErrSignatureNotFound", func() {
+			Expect(configErr).To(MatchError(image.ErrSignatureNotFound))
+
+			_, err := imgClient.Pull(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+		})
+
+		It("fails the other reads of the image", func() {
+			_, err := imgClient.Inspect(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, _, err = imgClient.InspectEntrypoint(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, _, err = imgClient.GetLabel(ctx, creds, imgRef, "version")
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, _, err = imgClient.ImageSize(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, err = imgClient.GetOSInfo(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, err = imgClient.GetImageID(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+			_, err = imgClient.Rebase(ctx, creds, imgRef, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureNotFound))
+		})
+	})
+
+	When("the image is signed with another key", func() {
+		BeforeEach(func() {
+			_, publicKeyPath = writeKeyPair("other")
+		})
+
+		It("fails with ErrSignatureInvalid", func() {
+			Expect(configErr).To(MatchError(image.ErrSignatureInvalid))
+
+			_, err := imgClient.Pull(ctx, creds, imgRef)
+			Expect(err).To(MatchError(image.ErrSignatureInvalid))
+		})
+	})
+
+	When("the verification key cannot be read", func() {
+		BeforeEach(func() {
+			publicKeyPath = filepath.Join(keyDir, "missing.pub")
+		})
+
+		It("fails", func() {
+			Expect(configErr).To(MatchError(ContainSubstring("failed to read verification key")))
+		})
+	})
+})
+
+func setEnv(key, value string) {
+	GinkgoHelper()
+
+	oldValue, wasSet := os.LookupEnv(key)
+	Expect(os.Setenv(key, value)).To(Succeed())
+	DeferCleanup(func() {
+		if wasSet {
+			Expect(os.Setenv(key, oldValue)).To(Succeed())
+			return
+		}
+		Expect(os.Unsetenv(key)).To(Succeed())
+	})
+}
+
+// writeCosignKey writes a new unencrypted cosign private key and returns its
+// path
+func writeCosignKey() string {
+	GinkgoHelper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyPath := filepath.Join(GinkgoT().TempDir(), "cosign.key")
+	Expect(os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)).To(Succeed())
+	return keyPath
+}
+
+// getCosignSignature fetches the cosign signature image of the image at
+// digestRef
+func getCosignSignature(digestRef string) (v1.Image, error) {
+	GinkgoHelper()
+
+	ref, err := name.NewDigest(digestRef)
+	Expect(err).NotTo(HaveOccurred())
+	hash, err := v1.NewHash(ref.DigestStr())
+	Expect(err).NotTo(HaveOccurred())
+	sigRef := ref.Context().Tag(hash.Algorithm + "-" + hash.Hex + ".sig")
+
+	return remote.Image(sigRef, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+}
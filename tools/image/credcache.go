@@ -0,0 +1,112 @@
+package image
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// CredentialCache stores the keychains built from the image pull secrets of
+// Creds, saving a round trip to the API server on every registry call.
+// Delete is called by Client.InvalidateCreds.
+type CredentialCache interface {
+	Get(creds Creds) (authn.Keychain, bool)
+	Set(creds Creds, kc authn.Keychain)
+	Delete(creds Creds)
+}
+
+// WithCredentialCache makes the client reuse keychains from cache. The
+// cached keychain keeps using the secret contents it was built from, so
+// controllers should call InvalidateCreds when a secret changes.
+func WithCredentialCache(cache CredentialCache) Option {
+	return func(c *Client) {
+		c.credentialCache = cache
+	}
+}
+
+// InvalidateCreds drops the cached keychain for creds, if any, so that the
+// next call reads the secrets again. It is meant to be called from a Secret
+// watch handler.
+func (c Client) InvalidateCreds(creds Creds) {
+	if c.credentialCache == nil {
+		return
+	}
+
+	c.logger.V(1).Info("invalidating cached credentials", "namespace", creds.Namespace, "secrets", creds.SecretNames, "serviceAccount", creds.ServiceAccountName)
+	c.credentialCache.Delete(creds)
+}
+
+type ttlCredentialCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]ttlCredentialCacheEntry
+}
+
+type ttlCredentialCacheEntry struct {
+	keychain  authn.Keychain
+	expiresAt time.Time
+}
+
+// NewCredentialCache returns a CredentialCache whose entries expire ttl after
+// being set
+func NewCredentialCache(ttl time.Duration) CredentialCache {
+	return &ttlCredentialCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]ttlCredentialCacheEntry{},
+	}
+}
+
+func (c *ttlCredentialCache) Get(creds Creds) (authn.Keychain, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := credsKey(creds)
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.keychain, true
+}
+
+func (c *ttlCredentialCache) Set(creds Creds, kc authn.Keychain) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// drop expired entries so that creds that are no longer used do not
+	// accumulate
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[credsKey(creds)] = ttlCredentialCacheEntry{
+		keychain:  kc,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+func (c *ttlCredentialCache) Delete(creds Creds) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, credsKey(creds))
+}
+
+// credsKey keeps the order of the secret names, as it decides which secret
+// wins when several hold credentials for the same registry
+func credsKey(creds Creds) string {
+	return creds.Namespace + "/" + creds.ServiceAccountName + "/" + strings.Join(creds.SecretNames, ",")
+}
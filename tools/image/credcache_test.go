@@ -0,0 +1,99 @@
+package image_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("CredentialCache", func() {
+	var (
+		creds    image.Creds
+		secret   *corev1.Secret
+		ttl      time.Duration
+		imgRef   string
+		existErr error
+	)
+
+	dockerConfigSecret := func(name, password string) *corev1.Secret {
+		GinkgoHelper()
+
+		s, err := dockercfg.CreateDockerConfigSecret("default", name, dockercfg.DockerServerConfig{
+			Server:   containerRegistry.URL(),
+			Username: "user",
+			Password: password,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	BeforeEach(func() {
+		ttl = time.Hour
+		secret = dockerConfigSecret(uuid.NewString(), "password")
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secret.Name},
+		}
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+		imgRef, err = image.NewClient(k8sClientset).Push(ctx, creds, containerRegistry.ImageRef("credcache/"+uuid.NewString()), zipFile)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, image.WithCredentialCache(image.NewCredentialCache(ttl)))
+		Expect(imgClient.Exists(ctx, creds, imgRef)).To(BeTrue())
+
+		secret.Data = dockerConfigSecret(secret.Name, "rotated").Data
+		_, err := k8sClientset.CoreV1().Secrets("default").Update(ctx, secret, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("keeps using the cached credentials", func() {
+		Expect(imgClient.Exists(ctx, creds, imgRef)).To(BeTrue())
+	})
+
+	When("the credentials are invalidated", func() {
+		JustBeforeEach(func() {
+			imgClient.InvalidateCreds(creds)
+			_, existErr = imgClient.Exists(ctx, creds, imgRef)
+		})
+
+		It("reads the rotated secret", func() {
+			Expect(existErr).To(MatchError(ContainSubstring("401 Unauthorized")))
+		})
+	})
+
+	When("the cached credentials expire", func() {
+		BeforeEach(func() {
+			ttl = 100 * time.Millisecond
+		})
+
+		It("reads the rotated secret", func() {
+			time.Sleep(150 * time.Millisecond)
+			_, existErr = imgClient.Exists(ctx, creds, imgRef)
+			Expect(existErr).To(MatchError(ContainSubstring("401 Unauthorized")))
+		})
+	})
+
+	When("no cache is configured", func() {
+		JustBeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+			_, existErr = imgClient.Exists(ctx, creds, imgRef)
+		})
+
+		It("reads the secret on every call", func() {
+			Expect(existErr).To(MatchError(ContainSubstring("401 Unauthorized")))
+		})
+	})
+})
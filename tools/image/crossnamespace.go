@@ -0,0 +1,36 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/authn/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PushCrossNamespace is like Push for images of targetNamespace whose
+// registry credentials are in the secretName secret of secretNamespace, e.g.
+// a secret shared by all spaces in the root namespace. The secret is read
+// with the k8s client of the Client, which needs access to secretNamespace,
+// and its dockerconfigjson is used as the keychain directly instead of
+// resolving image pull secrets in targetNamespace.
+func (c Client) PushCrossNamespace(ctx context.Context, secretNamespace, secretName, targetNamespace, repoRef string, zipReader io.Reader) (string, error) {
+	c.logger.V(1).Info("pushing with credentials from another namespace", "ref", repoRef, "secret", secretNamespace+"/"+secretName, "namespace", targetNamespace)
+	secret, err := c.k8sClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", authError(repoRef, fmt.Errorf("%w: %s/%s", ErrCredentialNotFound, secretNamespace, secretName))
+		}
+		return "", authError(repoRef, fmt.Errorf("failed to get secret %s/%s: %w", secretNamespace, secretName, err))
+	}
+
+	keychain, err := kubernetes.NewFromPullSecrets(ctx, []corev1.Secret{*secret})
+	if err != nil {
+		return "", authError(repoRef, fmt.Errorf("error creating keychain from secret %s/%s: %w", secretNamespace, secretName, err))
+	}
+
+	return c.push(ctx, Creds{Namespace: targetNamespace}, repoRef, zipReader, pushConfig{keychain: keychain})
+}
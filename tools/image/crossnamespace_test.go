@@ -0,0 +1,92 @@
+package image_test
+
+import (
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("PushCrossNamespace", func() {
+	var (
+		secretNamespace string
+		pushSecretName  string
+		targetNamespace string
+		pushRef         string
+		imgRef          string
+		pushErr         error
+	)
+
+	BeforeEach(func() {
+		namespace, err := k8sClientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: uuid.NewString()},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		secretNamespace = namespace.Name
+
+		secret, err := dockercfg.CreateDockerConfigSecret(secretNamespace, uuid.NewString(), dockercfg.DockerServerConfig{
+			Server:   containerRegistry.URL(),
+			Username: "user",
+			Password: "password",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		pushSecretName = secret.Name
+
+		imgClient = image.NewClient(k8sClientset)
+		targetNamespace = "default"
+		pushRef = containerRegistry.ImageRef("crossnamespace/" + uuid.NewString())
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, pushErr = imgClient.PushCrossNamespace(ctx, secretNamespace, pushSecretName, targetNamespace, pushRef, zipFile)
+	})
+
+	It("pushes the image with the credentials of the secret", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(imgRef).To(HavePrefix(pushRef + "@sha256:"))
+
+		exists, err := imgClient.Exists(ctx, image.Creds{Namespace: "default", SecretNames: []string{secretName}}, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+	})
+
+	When("the secret does not exist", func() {
+		BeforeEach(func() {
+			pushSecretName = "not-a-secret"
+		})
+
+		It("returns an AuthError", func() {
+			var authErr *image.AuthError
+			Expect(errors.As(pushErr, &authErr)).To(BeTrue())
+			Expect(pushErr).To(MatchError(image.ErrCredentialNotFound))
+		})
+	})
+
+	When("the secret has the wrong credentials", func() {
+		BeforeEach(func() {
+			secret, err := dockercfg.CreateDockerConfigSecret(secretNamespace, uuid.NewString(), dockercfg.DockerServerConfig{
+				Server:   containerRegistry.URL(),
+				Username: "user",
+				Password: "wrong",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			pushSecretName = secret.Name
+		})
+
+		It("fails to push", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("failed to upload image")))
+		})
+	})
+})
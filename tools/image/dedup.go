@@ -0,0 +1,64 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const sourceSHA256Label = "korifi.cloudfoundry.org/source-sha256"
+
+// WithDeduplication makes Push label images with the SHA256 of the source
+// zip and, before uploading, look for an image with the same label in the
+// target repository. When one is found the upload is skipped, the tags are
+// applied to the existing image and its digest ref is returned. Finding it
+// reads the config of every tagged image, which is slow on registries with a
+// expensive tag list API, so it is disabled by default. The other push
+// methods do not deduplicate.
+func WithDeduplication(enabled bool) Option {
+	return func(c *Client) {
+		c.deduplicate = enabled
+	}
+}
+
+func withSourceSHA256Label(image v1.Image, sourceSHA256 string) (v1.Image, error) {
+	return withLabels(image, map[string]string{sourceSHA256Label: sourceSHA256})
+}
+
+// findBySourceSHA256 returns the descriptor of a tagged image in repo whose
+// source label matches, or nil if there is none
+func (c Client) findBySourceSHA256(repo name.Repository, sourceSHA256 string, remoteOpts []remote.Option) (*remote.Descriptor, error) {
+	tags, err := remote.List(repo, remoteOpts...)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, registryError(repo.String(), fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	seen := map[v1.Hash]bool{}
+	for _, tag := range tags {
+		descriptor, err := remote.Get(repo.Tag(tag), remoteOpts...)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, registryError(repo.String(), fmt.Errorf("failed to get image: %w", err))
+		}
+		if descriptor == nil || seen[descriptor.Digest] || !descriptor.MediaType.IsImage() {
+			continue
+		}
+		seen[descriptor.Digest] = true
+
+		img, err := descriptor.Image()
+		if err != nil {
+			return nil, registryError(repo.String(), fmt.Errorf("failed to get image: %w", err))
+		}
+		cfgFile, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image config: %w", err)
+		}
+
+		if cfgFile.Config.Labels[sourceSHA256Label] == sourceSHA256 {
+			return descriptor, nil
+		}
+	}
+
+	return nil, nil
+}
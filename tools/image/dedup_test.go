@@ -0,0 +1,147 @@
+package image_test
+
+import (
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deduplication", func() {
+	var (
+		creds       image.Creds
+		repoRef     string
+		blobUploads *blobUploadRecorder
+		firstRef    string
+		imgRef      string
+		pushErr     error
+	)
+
+	push := func(fixture string, tags ...string) (string, error) {
+		zipFile, err := os.Open(fixture)
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		return imgClient.Push(ctx, creds, repoRef, zipFile, tags...)
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("dedup/" + uuid.NewString())
+		blobUploads = &blobUploadRecorder{}
+		imgClient = image.NewClient(k8sClientset, image.WithDeduplication(true), image.WithTransport(blobUploads))
+
+		var err error
+		firstRef, err = push("fixtures/layer.zip", "first")
+		Expect(err).NotTo(HaveOccurred())
+		blobUploads.reset()
+	})
+
+	It("labels the image with the source hash", func() {
+		config, err := imgClient.Config(ctx, creds, firstRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Labels).To(HaveKeyWithValue("korifi.cloudfoundry.org/source-sha256", MatchRegexp("^[0-9a-f]{64}$")))
+	})
+
+	When("the same source is pushed again", func() {
+		JustBeforeEach(func() {
+			imgRef, pushErr = push("fixtures/layer.zip", "second")
+		})
+
+		It("returns the existing image without uploading it", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(Equal(firstRef))
+			Expect(blobUploads.uploaded()).To(BeEmpty())
+		})
+
+		It("tags the existing image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgClient.ResolveTag(ctx, creds, repoRef+":second")).To(Equal(firstRef))
+		})
+	})
+
+	When("the same source is pushed again after a different one", func() {
+		JustBeforeEach(func() {
+			_, err := push("fixtures/anotherLayer.zip")
+			Expect(err).NotTo(HaveOccurred())
+
+			imgRef, pushErr = push("fixtures/layer.zip")
+		})
+
+		It("moves the tag of the repository reference back to the existing image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(Equal(firstRef))
+			Expect(imgClient.ResolveTag(ctx, creds, repoRef)).To(Equal(firstRef))
+		})
+	})
+
+	When("a different source is pushed", func() {
+		JustBeforeEach(func() {
+			imgRef, pushErr = push("fixtures/anotherLayer.zip", "second")
+		})
+
+		It("uploads a new image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).NotTo(Equal(firstRef))
+			Expect(blobUploads.uploaded()).NotTo(BeEmpty())
+		})
+	})
+
+	When("the same source is pushed again with options", func() {
+		JustBeforeEach(func() {
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			defer zipFile.Close()
+
+			imgRef, pushErr = imgClient.PushWithOptions(ctx, creds, repoRef, zipFile, image.WithExtraLabels(map[string]string{"version": "2"}))
+		})
+
+		It("pushes a new image with the options applied", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).NotTo(Equal(firstRef))
+
+			config, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("version", "2"))
+		})
+	})
+
+	When("the same source is pushed again with labels", func() {
+		JustBeforeEach(func() {
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			defer zipFile.Close()
+
+			imgRef, pushErr = imgClient.PushWithLabels(ctx, creds, repoRef, zipFile, map[string]string{"version": "3"})
+		})
+
+		It("pushes a new image with the labels", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).NotTo(Equal(firstRef))
+
+			config, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("version", "3"))
+		})
+	})
+
+	When("deduplication is disabled", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithDeduplication(false))
+		})
+
+		It("does not label the image", func() {
+			imgRef, pushErr = push("fixtures/layer.zip")
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			config, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Labels).NotTo(HaveKey("korifi.cloudfoundry.org/source-sha256"))
+		})
+	})
+})
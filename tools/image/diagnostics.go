@@ -0,0 +1,47 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// WithStagingLogWriter makes the push methods write the diagnostics returned
+// by the registry when an upload fails to w, one per line, so that messages
+// such as quota errors reach the app staging logs rather than only the
+// controller logs
+func WithStagingLogWriter(w io.Writer) Option {
+	return func(c *Client) {
+		c.stagingLogWriter = w
+	}
+}
+
+// registryDiagnostics returns the messages from the error body returned by
+// the registry, or nil if err is not a registry error
+func registryDiagnostics(err error) []string {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return nil
+	}
+
+	diagnostics := []string{}
+	for _, diagnostic := range transportErr.Errors {
+		diagnostics = append(diagnostics, diagnostic.String())
+	}
+	return diagnostics
+}
+
+func (c Client) reportDiagnostics(err error) {
+	if c.stagingLogWriter == nil {
+		return
+	}
+
+	for _, diagnostic := range registryDiagnostics(err) {
+		if _, writeErr := fmt.Fprintf(c.stagingLogWriter, "registry error: %s\n", diagnostic); writeErr != nil {
+			c.logger.V(1).Info("failed to write registry diagnostics", "reason", writeErr)
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package image_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithStagingLogWriter", func() {
+	var (
+		stagingLog *bytes.Buffer
+		creds      image.Creds
+		pushRef    string
+		pushErr    error
+	)
+
+	BeforeEach(func() {
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		quotaRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":[{"code":"DENIED","message":"storage quota of 10GiB exceeded for project foo"}]}`))
+				return
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(quotaRegistry.Close)
+
+		serverURL, err := url.Parse(quotaRegistry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		pushRef = serverURL.Host + "/foo/bar"
+		creds = image.Creds{}
+
+		stagingLog = &bytes.Buffer{}
+		imgClient = image.NewClient(k8sClientset, image.WithStagingLogWriter(stagingLog))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		_, pushErr = imgClient.Push(ctx, creds, pushRef, zipFile)
+	})
+
+	It("returns the registry message in the error", func() {
+		Expect(pushErr).To(MatchError(ContainSubstring("DENIED: storage quota of 10GiB exceeded for project foo")))
+	})
+
+	It("writes the registry message to the staging log", func() {
+		Expect(stagingLog.String()).To(Equal("registry error: DENIED: storage quota of 10GiB exceeded for project foo\n"))
+	})
+
+	When("the push succeeds", func() {
+		BeforeEach(func() {
+			pushRef = containerRegistry.ImageRef("diagnostics/foo")
+			creds = image.Creds{
+				Namespace:   "default",
+				SecretNames: []string{secretName},
+			}
+		})
+
+		It("writes nothing", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(stagingLog.String()).To(BeEmpty())
+		})
+	})
+})
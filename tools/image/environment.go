@@ -0,0 +1,27 @@
+package image
+
+import (
+	"context"
+	"strings"
+)
+
+const launchEnvLabelPrefix = "io.buildpacks.launch.env."
+
+// GetEnvironment returns the launch environment variables buildpacks recorded
+// in the io.buildpacks.launch.env.<NAME> labels of the image, keyed by NAME
+func (c Client) GetEnvironment(ctx context.Context, creds Creds, imageRef string) (map[string]string, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for key, value := range config.Labels {
+		name, ok := strings.CutPrefix(key, launchEnvLabelPrefix)
+		if ok && name != "" {
+			env[name] = value
+		}
+	}
+
+	return env, nil
+}
@@ -0,0 +1,69 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetEnvironment", func() {
+	var (
+		creds  image.Creds
+		imgRef string
+		labels map[string]string
+		env    map[string]string
+		envErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("environment/" + uuid.NewString())
+		labels = map[string]string{
+			"io.buildpacks.launch.env.JAVA_OPTS": "-Xmx512m",
+			"io.buildpacks.launch.env.PORT":      "8080",
+			"io.buildpacks.launch.env.":          "no-name",
+			"io.buildpacks.build.metadata":       "{}",
+			"foo":                                "bar",
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: labels}})
+		env, envErr = imgClient.GetEnvironment(ctx, creds, imgRef)
+	})
+
+	It("returns the launch environment variables", func() {
+		Expect(envErr).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{
+			"JAVA_OPTS": "-Xmx512m",
+			"PORT":      "8080",
+		}))
+	})
+
+	When("the image has no launch environment labels", func() {
+		BeforeEach(func() {
+			labels = nil
+		})
+
+		It("returns an empty map", func() {
+			Expect(envErr).NotTo(HaveOccurred())
+			Expect(env).To(BeEmpty())
+		})
+	})
+
+	When("the image does not exist", func() {
+		JustBeforeEach(func() {
+			env, envErr = imgClient.GetEnvironment(ctx, creds, imgRef+":not-a-tag")
+		})
+
+		It("fails", func() {
+			Expect(envErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
@@ -0,0 +1,152 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// The client methods return these errors when a registry call fails so that
+// callers can tell failures apart with errors.As. The error message is the
+// one of Cause, StatusCode is the HTTP status returned by the registry, or 0
+// if the call did not get a response.
+
+// PushError is returned when uploading or tagging an image fails for a reason
+// other than the credentials
+type PushError struct {
+	Ref        string
+	StatusCode int
+	Cause      error
+}
+
+func (e *PushError) Error() string { return e.Cause.Error() }
+func (e *PushError) Unwrap() error { return e.Cause }
+
+// Retryable reports whether the push failed transiently, e.g. on a timeout or
+// a 5xx response, and may succeed if tried again
+func (e *PushError) Retryable() bool {
+	return isRetryable(e.Cause)
+}
+
+// AuthError is returned when the credentials for Ref cannot be resolved or
+// are rejected by the registry
+type AuthError struct {
+	Ref        string
+	StatusCode int
+	Cause      error
+}
+
+func (e *AuthError) Error() string { return e.Cause.Error() }
+func (e *AuthError) Unwrap() error { return e.Cause }
+
+// NotFoundError is returned when Ref does not exist in the registry
+type NotFoundError struct {
+	Ref        string
+	StatusCode int
+	Cause      error
+}
+
+func (e *NotFoundError) Error() string { return e.Cause.Error() }
+func (e *NotFoundError) Unwrap() error { return e.Cause }
+
+// DigestMismatchError is returned by PullVerified, and by pushes with
+// WithPinDigestToStatus, when the digest of the manifest of Ref is Actual
+// rather than Expected. It matches ErrDigestMismatch with errors.Is.
+type DigestMismatchError struct {
+	Ref        string
+	StatusCode int
+	Expected   string
+	Actual     string
+	Cause      error
+}
+
+func (e *DigestMismatchError) Error() string { return e.Cause.Error() }
+func (e *DigestMismatchError) Unwrap() error { return e.Cause }
+
+// ValidationError is returned when an image is not pushed because the keys
+// of its labels Keys use prefixes reserved with WithReservedLabelPrefixes
+type ValidationError struct {
+	Ref  string
+	Keys []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("labels of image %s use reserved prefixes: %s", e.Ref, strings.Join(e.Keys, ", "))
+}
+
+// ScanFailedError is returned when the ScanFunc set with WithScanFunc
+// rejects the pushed image Ref. The image is deleted and Cause wraps the
+// error returned by the scanner.
+type ScanFailedError struct {
+	Ref   string
+	Cause error
+}
+
+func (e *ScanFailedError) Error() string { return e.Cause.Error() }
+func (e *ScanFailedError) Unwrap() error { return e.Cause }
+
+// MultiError is returned by MirrorImage with the error of every destination
+// that failed, keyed by the RepoRef of the destination
+type MultiError struct {
+	Errors map[string]error
+}
+
+func (e *MultiError) Error() string {
+	failures := []string{}
+	for _, ref := range sortedKeys(e.Errors) {
+		failures = append(failures, fmt.Sprintf("%s: %s", ref, e.Errors[ref]))
+	}
+	return fmt.Sprintf("failed for %d destinations: %s", len(e.Errors), strings.Join(failures, "; "))
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := []error{}
+	for _, ref := range sortedKeys(e.Errors) {
+		errs = append(errs, e.Errors[ref])
+	}
+	return errs
+}
+
+func statusCode(err error) int {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return 0
+	}
+	return transportErr.StatusCode
+}
+
+func isAuthStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// authError wraps a failure to resolve the credentials for ref
+func authError(ref string, err error) error {
+	return &AuthError{Ref: ref, StatusCode: statusCode(err), Cause: err}
+}
+
+// registryError wraps a failed registry read, or delete, of ref in an
+// AuthError or a NotFoundError. Other errors are returned as is.
+func registryError(ref string, err error) error {
+	code := statusCode(err)
+	switch {
+	case isAuthStatus(code):
+		return &AuthError{Ref: ref, StatusCode: code, Cause: err}
+	case code == http.StatusNotFound:
+		return &NotFoundError{Ref: ref, StatusCode: code, Cause: err}
+	default:
+		return err
+	}
+}
+
+// pushError wraps a failed upload to ref in an AuthError when the registry
+// rejected the credentials and in a PushError otherwise
+func pushError(ref string, err error) error {
+	code := statusCode(err)
+	if isAuthStatus(code) {
+		return &AuthError{Ref: ref, StatusCode: code, Cause: err}
+	}
+	return &PushError{Ref: ref, StatusCode: code, Cause: err}
+}
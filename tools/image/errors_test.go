@@ -0,0 +1,140 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+	)
+
+	push := func(ref string) error {
+		GinkgoHelper()
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		_, err = imgClient.Push(ctx, creds, ref, zipFile)
+		return err
+	}
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		pushRef = containerRegistry.ImageRef("errors/foo")
+		imgClient = image.NewClient(k8sClientset)
+	})
+
+	When("the registry rejects the credentials", func() {
+		BeforeEach(func() {
+			creds = image.Creds{}
+		})
+
+		It("returns an AuthError", func() {
+			err := push(pushRef)
+
+			var authErr *image.AuthError
+			Expect(errors.As(err, &authErr)).To(BeTrue())
+			Expect(authErr.Ref).To(Equal(pushRef))
+			Expect(authErr.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	When("the image does not exist", func() {
+		It("returns a NotFoundError", func() {
+			imageRef := containerRegistry.ImageRef("errors/does-not-exist")
+			_, err := imgClient.Digest(ctx, creds, imageRef)
+
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+			Expect(notFoundErr.Ref).To(Equal(imageRef))
+			Expect(notFoundErr.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	When("the digest does not match", func() {
+		It("returns a DigestMismatchError", func() {
+			Expect(push(pushRef)).To(Succeed())
+
+			expectedDigest := "sha256:" + strings.Repeat("0", 64)
+			_, err := imgClient.PullVerified(ctx, creds, pushRef, expectedDigest)
+
+			var mismatchErr *image.DigestMismatchError
+			Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+			Expect(mismatchErr.Ref).To(Equal(pushRef))
+			Expect(mismatchErr.Expected).To(Equal(expectedDigest))
+			Expect(mismatchErr.Actual).To(HavePrefix("sha256:"))
+			Expect(err).To(MatchError(image.ErrDigestMismatch))
+		})
+	})
+
+	Describe("PushError", func() {
+		var manifestStatus int
+
+		BeforeEach(func() {
+			registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+			failingRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+					w.WriteHeader(manifestStatus)
+					return
+				}
+				registryHandler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(failingRegistry.Close)
+
+			serverURL, err := url.Parse(failingRegistry.URL)
+			Expect(err).NotTo(HaveOccurred())
+			pushRef = serverURL.Host + "/foo/bar"
+			creds = image.Creds{}
+			imgClient = image.NewClient(k8sClientset, image.WithRetry(2, time.Millisecond))
+		})
+
+		When("the registry fails transiently", func() {
+			BeforeEach(func() {
+				manifestStatus = http.StatusServiceUnavailable
+			})
+
+			It("is retryable", func() {
+				err := push(pushRef)
+
+				var pushErr *image.PushError
+				Expect(errors.As(err, &pushErr)).To(BeTrue())
+				Expect(pushErr.Ref).To(Equal(pushRef))
+				Expect(pushErr.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(pushErr.Retryable()).To(BeTrue())
+			})
+		})
+
+		When("the registry rejects the image", func() {
+			BeforeEach(func() {
+				manifestStatus = http.StatusBadRequest
+			})
+
+			It("is not retryable", func() {
+				err := push(pushRef)
+
+				var pushErr *image.PushError
+				Expect(errors.As(err, &pushErr)).To(BeTrue())
+				Expect(pushErr.StatusCode).To(Equal(http.StatusBadRequest))
+				Expect(pushErr.Retryable()).To(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/hashicorp/go-multierror"
+)
+
+// GarbageCollect deletes the manifests in the repository that no tag points
+// to, e.g. the images left behind when a tag is moved to a new image, and
+// returns how many were deleted. The distribution API has no way to list
+// untagged manifests, so they are taken from the manifest map that registries
+// such as GCR and Artifact Registry add to the tags list. Other registries
+// report nothing to delete. The manifests of tagged image indexes and the
+// referrers of remaining manifests are kept.
+func (c Client) GarbageCollect(ctx context.Context, creds Creds, repoRef string) (int, error) {
+	c.logger.V(1).Info("collecting garbage", "repo", repoRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return 0, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return 0, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	listing, err := google.List(repo, google.WithAuthFromKeychain(keychain), google.WithTransport(c.transport), google.WithContext(ctx))
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, registryError(repoRef, fmt.Errorf("failed to list manifests: %w", err))
+	}
+
+	untagged, err := c.untaggedManifests(repo, listing.Manifests, remoteOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	var gcErr *multierror.Error
+	deleted := 0
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	for _, digest := range untagged {
+		err = c.retryOnError("delete", func() error {
+			return remote.Delete(repo.Digest(digest), writeOpts...)
+		})
+		if err != nil {
+			gcErr = multierror.Append(gcErr, registryError(repoRef, fmt.Errorf("failed to delete manifest %s: %w", digest, err)))
+			continue
+		}
+
+		c.logger.V(1).Info("deleted untagged manifest", "repo", repoRef, "digest", digest)
+		deleted++
+	}
+
+	return deleted, gcErr.ErrorOrNil()
+}
+
+// untaggedManifests returns the sorted digests of the manifests without tags
+// that are neither part of a tagged image index nor refer to a manifest that
+// is kept
+func (c Client) untaggedManifests(repo name.Repository, manifests map[string]google.ManifestInfo, remoteOpts []remote.Option) ([]string, error) {
+	kept := map[string]bool{}
+	for digest, info := range manifests {
+		if len(info.Tags) == 0 {
+			continue
+		}
+
+		kept[digest] = true
+		if !types.MediaType(info.MediaType).IsIndex() {
+			continue
+		}
+
+		index, err := remote.Index(repo.Digest(digest), remoteOpts...)
+		if err != nil {
+			return nil, registryError(repo.String(), fmt.Errorf("failed to get image index %s: %w", digest, err))
+		}
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, registryError(repo.String(), fmt.Errorf("failed to get image index %s: %w", digest, err))
+		}
+		for _, child := range indexManifest.Manifests {
+			kept[child.Digest.String()] = true
+		}
+	}
+
+	untagged := []string{}
+	for digest := range manifests {
+		if kept[digest] {
+			continue
+		}
+
+		subject, err := manifestSubject(repo.Digest(digest), remoteOpts)
+		if err != nil {
+			return nil, err
+		}
+		if subject != "" && kept[subject] {
+			continue
+		}
+
+		untagged = append(untagged, digest)
+	}
+
+	sort.Strings(untagged)
+	return untagged, nil
+}
+
+// manifestSubject returns the digest of the manifest the manifest at ref
+// refers to, or an empty string if it is not a referrer
+func manifestSubject(ref name.Digest, remoteOpts []remote.Option) (string, error) {
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return "", registryError(ref.String(), fmt.Errorf("failed to get manifest: %w", err))
+	}
+
+	var manifest struct {
+		Subject *v1.Descriptor `json:"subject"`
+	}
+	if err = json.Unmarshal(descriptor.Manifest, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse manifest %s: %w", ref.DigestStr(), err)
+	}
+	if manifest.Subject == nil {
+		return "", nil
+	}
+
+	return manifest.Subject.Digest.String(), nil
+}
@@ -0,0 +1,261 @@
+package image_test
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GarbageCollect", func() {
+	var (
+		mutex       sync.Mutex
+		written     []string
+		listFails   bool
+		registryURL string
+		creds       image.Creds
+		repoRef     string
+		deleted     int
+		gcErr       error
+
+		taggedDigest   string
+		orphanDigest   string
+		childDigests   []string
+		referrerDigest string
+	)
+
+	// gcrTagsList adds the manifest map GCR returns to the tags list of the
+	// repository served by registryHandler, built from the written digests
+	gcrTagsList := func(registryHandler http.Handler, w http.ResponseWriter, r *http.Request) {
+		repoPath := strings.TrimSuffix(r.URL.Path, "/tags/list")
+
+		serve := func(method, path string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			registryHandler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+			return recorder
+		}
+
+		listing := serve(http.MethodGet, r.URL.Path)
+		if listing.Code != http.StatusOK {
+			w.WriteHeader(listing.Code)
+			return
+		}
+
+		var tags struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}
+		Expect(json.Unmarshal(listing.Body.Bytes(), &tags)).To(Succeed())
+
+		tagsByDigest := map[string][]string{}
+		for _, tag := range tags.Tags {
+			head := serve(http.MethodHead, repoPath+"/manifests/"+tag)
+			digest := head.Header().Get("Docker-Content-Digest")
+			tagsByDigest[digest] = append(tagsByDigest[digest], tag)
+		}
+
+		manifests := map[string]any{}
+		mutex.Lock()
+		for _, digest := range written {
+			head := serve(http.MethodHead, repoPath+"/manifests/"+digest)
+			if head.Code != http.StatusOK {
+				continue
+			}
+			manifests[digest] = map[string]any{
+				"mediaType": head.Header().Get("Content-Type"),
+				"tag":       append([]string{}, tagsByDigest[digest]...),
+			}
+		}
+		mutex.Unlock()
+
+		Expect(json.NewEncoder(w).Encode(map[string]any{
+			"name":     tags.Name,
+			"tags":     tags.Tags,
+			"manifest": manifests,
+			"child":    []string{},
+		})).To(Succeed())
+	}
+
+	// write writes the artifact to the tag, or by digest if tag is empty,
+	// and returns its digest
+	write := func(tag string, artifact remote.Taggable) string {
+		GinkgoHelper()
+
+		digester := artifact.(interface{ Digest() (v1.Hash, error) })
+		digest, err := digester.Digest()
+		Expect(err).NotTo(HaveOccurred())
+
+		ref := repoRef + "@" + digest.String()
+		if tag != "" {
+			ref = repoRef + ":" + tag
+		}
+		parsedRef, err := name.ParseReference(ref)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Put(parsedRef, artifact)).To(Succeed())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		written = append(written, digest.String())
+		if index, ok := artifact.(v1.ImageIndex); ok {
+			indexManifest, err := index.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			for _, child := range indexManifest.Manifests {
+				written = append(written, child.Digest.String())
+			}
+		}
+		return digest.String()
+	}
+
+	randomImage := func() v1.Image {
+		GinkgoHelper()
+
+		img, err := random.Image(64, 1)
+		Expect(err).NotTo(HaveOccurred())
+		return img
+	}
+
+	BeforeEach(func() {
+		written = nil
+		listFails = false
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/tags/list") {
+				mutex.Lock()
+				fail := listFails
+				mutex.Unlock()
+				if fail {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				gcrTagsList(registryHandler, w, r)
+				return
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		registryURL = serverURL.Host
+
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{Namespace: "default"}
+		repoRef = registryURL + "/gc/" + uuid.NewString()
+
+		taggedDigest = write("tagged", randomImage())
+
+		orphanDigest = write("moved", randomImage())
+		write("moved", randomImage())
+
+		index, err := random.Index(64, 1, 2)
+		Expect(err).NotTo(HaveOccurred())
+		write("index", index)
+		indexManifest, err := index.IndexManifest()
+		Expect(err).NotTo(HaveOccurred())
+		childDigests = []string{
+			indexManifest.Manifests[0].Digest.String(),
+			indexManifest.Manifests[1].Digest.String(),
+		}
+
+		taggedRef, err := name.ParseReference(repoRef + "@" + taggedDigest)
+		Expect(err).NotTo(HaveOccurred())
+		taggedImg, err := remote.Image(taggedRef)
+		Expect(err).NotTo(HaveOccurred())
+		subject, err := partial.Descriptor(taggedImg)
+		Expect(err).NotTo(HaveOccurred())
+		referrerDigest = write("", mutate.Subject(randomImage(), *subject).(v1.Image))
+
+		// only keep the referrer through its subject
+		fallbackTag, err := name.ParseReference(repoRef + ":" + strings.Replace(taggedDigest, ":", "-", 1))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Delete(fallbackTag)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		deleted, gcErr = imgClient.GarbageCollect(ctx, creds, repoRef)
+	})
+
+	exists := func(digest string) bool {
+		GinkgoHelper()
+
+		exists, err := imgClient.Exists(ctx, creds, repoRef+"@"+digest)
+		Expect(err).NotTo(HaveOccurred())
+		return exists
+	}
+
+	It("deletes the untagged manifests", func() {
+		Expect(gcErr).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal(1))
+		Expect(exists(orphanDigest)).To(BeFalse())
+	})
+
+	It("keeps the tagged manifests", func() {
+		Expect(gcErr).NotTo(HaveOccurred())
+		Expect(exists(taggedDigest)).To(BeTrue())
+
+		tags, err := imgClient.ListTags(ctx, creds, repoRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(ConsistOf("tagged", "moved", "index"))
+	})
+
+	It("keeps the manifests of tagged image indexes", func() {
+		Expect(gcErr).NotTo(HaveOccurred())
+		for _, digest := range childDigests {
+			Expect(exists(digest)).To(BeTrue())
+		}
+	})
+
+	It("keeps the referrers of tagged manifests", func() {
+		Expect(gcErr).NotTo(HaveOccurred())
+		Expect(exists(referrerDigest)).To(BeTrue())
+	})
+
+	When("the repository is collected again", func() {
+		JustBeforeEach(func() {
+			deleted, gcErr = imgClient.GarbageCollect(ctx, creds, repoRef)
+		})
+
+		It("deletes nothing", func() {
+			Expect(gcErr).NotTo(HaveOccurred())
+			Expect(deleted).To(BeZero())
+		})
+	})
+
+	When("the repository does not exist", func() {
+		BeforeEach(func() {
+			repoRef = registryURL + "/gc/missing-" + uuid.NewString()
+		})
+
+		It("deletes nothing", func() {
+			Expect(gcErr).NotTo(HaveOccurred())
+			Expect(deleted).To(BeZero())
+		})
+	})
+
+	When("listing the manifests fails", func() {
+		BeforeEach(func() {
+			listFails = true
+		})
+
+		It("returns an error", func() {
+			Expect(gcErr).To(MatchError(ContainSubstring("failed to list manifests")))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package imagetest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestImagetest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Imagetest Suite")
+}
@@ -0,0 +1,128 @@
+// Package imagetest provides an in-process registry for tests of code that
+// uses image.Client
+package imagetest
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"k8s.io/client-go/kubernetes"
+)
+
+// FakeRegistry serves the OCI distribution API from memory, without
+// authentication, and records the manifests pushed to and deleted from it
+type FakeRegistry struct {
+	server *httptest.Server
+
+	mutex        sync.Mutex
+	pushedImages []string
+	deletedRefs  []string
+}
+
+// TB is the part of testing.TB used by NewFakeRegistry. Unlike testing.TB it
+// is also implemented by GinkgoT().
+type TB interface {
+	Helper()
+	Cleanup(func())
+}
+
+var _ TB = testing.TB(nil)
+
+// NewFakeRegistry starts a registry that is stopped when the test finishes
+func NewFakeRegistry(t TB) *FakeRegistry {
+	t.Helper()
+
+	r := &FakeRegistry{}
+	handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, req)
+		r.record(req, recorder.status)
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// Host returns the host and port the registry listens on
+func (r *FakeRegistry) Host() string {
+	serverURL, err := url.Parse(r.server.URL)
+	if err != nil {
+		panic(err)
+	}
+	return serverURL.Host
+}
+
+// ImageRef returns the ref of repo in the registry, e.g. ImageRef("foo/bar")
+// returns 127.0.0.1:<port>/foo/bar
+func (r *FakeRegistry) ImageRef(repo string) string {
+	return r.Host() + "/" + repo
+}
+
+// NewClient returns an image client that talks to the registry over plain
+// HTTP. The registry accepts any credentials, so empty Creds can be used.
+func (r *FakeRegistry) NewClient(k8sClient kubernetes.Interface, opts ...image.Option) image.Client {
+	return image.NewClient(k8sClient, append([]image.Option{image.WithInsecureRegistries(r.Host())}, opts...)...)
+}
+
+// PushedImages returns the refs of the manifests pushed so far, in the form
+// host/repo:tag or host/repo@sha256:<hex>
+func (r *FakeRegistry) PushedImages() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.pushedImages...)
+}
+
+// DeletedRefs returns the refs of the manifests deleted so far, in the same
+// form as PushedImages
+func (r *FakeRegistry) DeletedRefs() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.deletedRefs...)
+}
+
+func (r *FakeRegistry) record(req *http.Request, status int) {
+	if status < 200 || status >= 300 {
+		return
+	}
+
+	repo, reference, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/")
+	if !ok {
+		return
+	}
+
+	ref := r.Host() + "/" + repo + ":" + reference
+	if strings.Contains(reference, ":") {
+		ref = r.Host() + "/" + repo + "@" + reference
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch req.Method {
+	case http.MethodPut:
+		r.pushedImages = append(r.pushedImages, ref)
+	case http.MethodDelete:
+		r.deletedRefs = append(r.deletedRefs, ref)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,55 @@
+package imagetest_test
+
+import (
+	"context"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"code.cloudfoundry.org/korifi/tools/image/imagetest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeRegistry", func() {
+	var (
+		ctx       context.Context
+		registry  *imagetest.FakeRegistry
+		imgClient image.Client
+		repoRef   string
+		imgRef    string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		registry = imagetest.NewFakeRegistry(GinkgoT())
+		imgClient = registry.NewClient(nil)
+		repoRef = registry.ImageRef("foo/bar")
+
+		zipFile, err := os.Open("../fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, err = imgClient.Push(ctx, image.Creds{}, repoRef, zipFile, "jim")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("records pushed images", func() {
+		Expect(registry.PushedImages()).To(ContainElements(repoRef+":latest", repoRef+":jim"))
+		Expect(registry.DeletedRefs()).To(BeEmpty())
+	})
+
+	It("serves pushed images", func() {
+		tags, err := imgClient.ListTags(ctx, image.Creds{}, repoRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(ContainElement("jim"))
+
+		Expect(imgClient.Exists(ctx, image.Creds{}, imgRef)).To(BeTrue())
+	})
+
+	It("records deleted refs", func() {
+		Expect(imgClient.Delete(ctx, image.Creds{}, imgRef, "jim")).To(Succeed())
+		Expect(registry.DeletedRefs()).To(ContainElements(repoRef+":jim", imgRef))
+
+		Expect(imgClient.Exists(ctx, image.Creds{}, imgRef)).To(BeFalse())
+	})
+})
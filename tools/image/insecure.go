@@ -0,0 +1,107 @@
+package image
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// WithInsecureRegistries allows plain HTTP and unverified TLS connections to
+// the given registry hosts (including the port, if any). Every other registry
+// is only reached over verified TLS. TLS connections to the given hosts fail
+// when the transport set with WithTransport is not an *http.Transport.
+func WithInsecureRegistries(hosts ...string) Option {
+	return func(c *Client) {
+		c.insecureRegistries = append(c.insecureRegistries, hosts...)
+	}
+}
+
+func (c Client) isInsecure(registry string) bool {
+	return slices.Contains(c.insecureRegistries, registry)
+}
+
+func (c Client) parseReference(imageRef string) (name.Reference, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil || !c.isInsecure(ref.Context().RegistryStr()) {
+		return ref, err
+	}
+
+	c.logger.Info("using insecure registry", "registry", ref.Context().RegistryStr())
+	return name.ParseReference(imageRef, name.Insecure)
+}
+
+func (c Client) parseRepository(repoRef string) (name.Repository, error) {
+	repo, err := name.NewRepository(repoRef)
+	if err != nil || !c.isInsecure(repo.RegistryStr()) {
+		return repo, err
+	}
+
+	c.logger.Info("using insecure registry", "registry", repo.RegistryStr())
+	return name.NewRepository(repoRef, name.Insecure)
+}
+
+func (c Client) parseRegistry(registryHost string) (name.Registry, error) {
+	registry, err := name.NewRegistry(registryHost)
+	if err != nil || !c.isInsecure(registry.RegistryStr()) {
+		return registry, err
+	}
+
+	c.logger.Info("using insecure registry", "registry", registry.RegistryStr())
+	return name.NewRegistry(registryHost, name.Insecure)
+}
+
+// insecureRegistriesTransport skips TLS verification for the allowed
+// registries only and sends everything else through the regular transport
+type insecureRegistriesTransport struct {
+	hosts  []string
+	secure http.RoundTripper
+	// insecure is nil when the regular transport is not an *http.Transport,
+	// as its TLS config cannot be changed then. The TLS requests to the
+	// allowed registries fail rather than being verified or sent through
+	// another transport.
+	insecure http.RoundTripper
+}
+
+func newInsecureRegistriesTransport(base http.RoundTripper, hosts []string) http.RoundTripper {
+	if base == nil {
+		base = remote.DefaultTransport
+	}
+
+	transport := insecureRegistriesTransport{
+		hosts:  hosts,
+		secure: base,
+	}
+
+	httpTransport, ok := base.(*http.Transport)
+	if !ok {
+		return transport
+	}
+
+	insecure := httpTransport.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	}
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	transport.insecure = insecure
+
+	return transport
+}
+
+func (t insecureRegistriesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(t.hosts, req.URL.Host) || req.URL.Scheme != "https" {
+		return t.secure.RoundTrip(req)
+	}
+
+	if t.insecure == nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("cannot skip TLS verification for insecure registry %s: transport %T is not an *http.Transport", req.URL.Host, t.secure)
+	}
+
+	return t.insecure.RoundTrip(req)
+}
@@ -0,0 +1,97 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InsecureRegistries", func() {
+	var (
+		registryHost string
+		pushRef      string
+		imgRef       string
+		pushErr      error
+	)
+
+	BeforeEach(func() {
+		selfSignedRegistry := httptest.NewTLSServer(ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0))))
+		DeferCleanup(selfSignedRegistry.Close)
+
+		serverURL, err := url.Parse(selfSignedRegistry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		registryHost = serverURL.Host
+		pushRef = registryHost + "/foo/bar"
+
+		imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(registryHost))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.Push(ctx, image.Creds{Namespace: "default"}, pushRef, zipFile, "jim")
+	})
+
+	It("pushes to the allowed registry without verifying its certificate", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		exists, err := imgClient.Exists(ctx, image.Creds{Namespace: "default"}, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+	})
+
+	When("the registry is not in the allowlist", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries("some.other.registry:5000"))
+		})
+
+		It("fails to verify the registry certificate", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("certificate")))
+		})
+	})
+
+	When("insecure registries are not configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+		})
+
+		It("fails to verify the registry certificate", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("certificate")))
+		})
+	})
+
+	When("a custom transport is configured too", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset,
+				image.WithInsecureRegistries(registryHost),
+				image.WithTransport(&http.Transport{}),
+			)
+		})
+
+		It("still skips verification for the allowed registry", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the custom transport is not an *http.Transport", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset,
+				image.WithInsecureRegistries(registryHost),
+				image.WithTransport(&blobUploadRecorder{}),
+			)
+		})
+
+		It("fails rather than verifying the registry certificate", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("cannot skip TLS verification for insecure registry " + registryHost)))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const baseImageNameAnnotation = "org.opencontainers.image.base.name"
+
+// ImageInfo is the Config of an image, which includes its creation time and
+// platform, together with its entrypoint and base image
+type ImageInfo struct {
+	Config
+	Entrypoint []string
+	// BaseImageRef is taken from the org.opencontainers.image.base.name
+	// manifest annotation and is empty when the image does not set it
+	BaseImageRef string
+}
+
+// Inspect returns the image config, including the image creation time and
+// platform, together with its entrypoint and base image
+func (c Client) Inspect(ctx context.Context, creds Creds, imageRef string) (ImageInfo, error) {
+	c.logger.V(1).Info("inspecting", "ref", imageRef)
+	img, err := c.remoteImage(ctx, creds, imageRef)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	config, err := imageConfig(img)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	cfgFile, err := img.ConfigFile()
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("error getting image config file: %w", err)
+	}
+
+	return ImageInfo{
+		Config:       config,
+		Entrypoint:   cfgFile.Config.Entrypoint,
+		BaseImageRef: config.Annotations[baseImageNameAnnotation],
+	}, nil
+}
+
+// InspectEntrypoint returns the ENTRYPOINT and CMD of the image, e.g. to
+// build the process definitions of an app. Unlike Config, the image layers
+// are not looked at and only the two fields are decoded from the config
+// blob, which keeps large labels such as the build metadata of buildpack
+// images from being parsed.
+func (c Client) InspectEntrypoint(ctx context.Context, creds Creds, imageRef string) (entrypoint, cmd []string, err error) {
+	c.logger.V(1).Info("inspecting entrypoint", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, nil, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	if c.platform != nil {
+		remoteOpts = append(remoteOpts, remote.WithPlatform(*c.platform))
+	}
+
+	img, err := c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return nil, nil, registryError(imageRef, fmt.Errorf("failed to get image config: %w", err))
+	}
+
+	var configFile struct {
+		Config struct {
+			Entrypoint []string `json:"Entrypoint"`
+			Cmd        []string `json:"Cmd"`
+		} `json:"config"`
+	}
+	if err = json.Unmarshal(rawConfig, &configFile); err != nil {
+		return nil, nil, fmt.Errorf("error parsing image config of %s: %w", imageRef, err)
+	}
+
+	return configFile.Config.Entrypoint, configFile.Config.Cmd, nil
+}
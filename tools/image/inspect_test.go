@@ -0,0 +1,220 @@
+package image_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inspect", func() {
+	var (
+		creds      image.Creds
+		imgRef     string
+		created    time.Time
+		info       image.ImageInfo
+		inspectErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		created = time.Now().Add(-time.Hour).Truncate(time.Second)
+
+		img, err := random.Image(64, 2)
+		Expect(err).NotTo(HaveOccurred())
+		cfgFile, err := img.ConfigFile()
+		Expect(err).NotTo(HaveOccurred())
+		cfgFile = cfgFile.DeepCopy()
+		cfgFile.Created = v1.Time{Time: created}
+		cfgFile.OS = "linux"
+		cfgFile.Architecture = "arm64"
+		cfgFile.Config.Entrypoint = []string{"/cnb/lifecycle/launcher"}
+		cfgFile.Config.Labels = map[string]string{"foo": "bar"}
+		img, err = mutate.ConfigFile(img, cfgFile)
+		Expect(err).NotTo(HaveOccurred())
+		img = mutate.Annotations(img, map[string]string{
+			"org.opencontainers.image.base.name": "docker.io/library/ubuntu:jammy",
+		}).(v1.Image)
+
+		imgRef = containerRegistry.ImageRef("inspect/app:latest")
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, img, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		info, inspectErr = imgClient.Inspect(ctx, creds, imgRef)
+	})
+
+	It("returns the image metadata", func() {
+		Expect(inspectErr).NotTo(HaveOccurred())
+		Expect(info.CreatedAt).NotTo(BeNil())
+		Expect(*info.CreatedAt).To(BeTemporally("==", created))
+		Expect(info.OS).To(Equal("linux"))
+		Expect(info.Architecture).To(Equal("arm64"))
+		Expect(info.Entrypoint).To(Equal([]string{"/cnb/lifecycle/launcher"}))
+		Expect(info.BaseImageRef).To(Equal("docker.io/library/ubuntu:jammy"))
+	})
+
+	It("includes the image config", func() {
+		Expect(inspectErr).NotTo(HaveOccurred())
+		Expect(info.Labels).To(Equal(map[string]string{"foo": "bar"}))
+		Expect(info.LayerCount).To(Equal(2))
+	})
+
+	When("the image has no base image annotation", func() {
+		BeforeEach(func() {
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+
+			imgRef, err = imgClient.Push(ctx, creds, containerRegistry.ImageRef("inspect/pushed"), zipFile)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("leaves the base image ref empty", func() {
+			Expect(inspectErr).NotTo(HaveOccurred())
+			Expect(info.BaseImageRef).To(BeEmpty())
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef("inspect/not-there")
+		})
+
+		It("fails", func() {
+			Expect(inspectErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
+
+var _ = Describe("InspectEntrypoint", func() {
+	var (
+		creds      image.Creds
+		imgRef     string
+		entrypoint []string
+		cmd        []string
+		inspectErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		imgRef = containerRegistry.ImageRef("inspect/entrypoint:latest")
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{
+			Config: v1.Config{
+				Entrypoint: []string{"/cnb/process/web"},
+				Cmd:        []string{"--port", "8080"},
+				Labels:     map[string]string{"io.buildpacks.build.metadata": `{"processes":[]}`},
+			},
+		})
+	})
+
+	JustBeforeEach(func() {
+		entrypoint, cmd, inspectErr = imgClient.InspectEntrypoint(ctx, creds, imgRef)
+	})
+
+	It("returns the entrypoint and command", func() {
+		Expect(inspectErr).NotTo(HaveOccurred())
+		Expect(entrypoint).To(Equal([]string{"/cnb/process/web"}))
+		Expect(cmd).To(Equal([]string{"--port", "8080"}))
+	})
+
+	When("the image has neither", func() {
+		BeforeEach(func() {
+			containerRegistry.PushImage(imgRef, &v1.ConfigFile{})
+		})
+
+		It("returns nil slices", func() {
+			Expect(inspectErr).NotTo(HaveOccurred())
+			Expect(entrypoint).To(BeNil())
+			Expect(cmd).To(BeNil())
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef("inspect/not-there")
+		})
+
+		It("fails", func() {
+			Expect(inspectErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
+
+// BenchmarkInspectEntrypoint compares InspectEntrypoint with Config for a
+// buildpack image with a 4MB build metadata label
+func BenchmarkInspectEntrypoint(b *testing.B) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		b.Fatal(err)
+	}
+	img, err = mutate.Config(img, v1.Config{
+		Entrypoint: []string{"/cnb/process/web"},
+		Labels:     map[string]string{"io.buildpacks.build.metadata": `"` + strings.Repeat("x", 4*1024*1024) + `"`},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	imgRef := serverURL.Host + "/bench/inspect:latest"
+	ref, err := name.ParseReference(imgRef)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = remote.Write(ref, img); err != nil {
+		b.Fatal(err)
+	}
+
+	client := image.NewClient(nil)
+
+	b.Run("InspectEntrypoint", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := client.InspectEntrypoint(context.Background(), image.Creds{}, imgRef); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Config", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := client.Config(context.Background(), image.Creds{}, imgRef); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// defaultReservedLabelPrefixes are used unless WithReservedLabelPrefixes is
+// set
+var defaultReservedLabelPrefixes = []string{"cloudfoundry.org/"}
+
+// WithReservedLabelPrefixes sets the label key prefixes that images pushed
+// by the client may not use, replacing the default cloudfoundry.org/. Pushes
+// of images with such labels fail with a ValidationError before anything is
+// uploaded. No prefix is reserved when called without prefixes.
+func WithReservedLabelPrefixes(prefixes ...string) Option {
+	return func(c *Client) {
+		c.reservedLabelPrefixes = prefixes
+	}
+}
+
+// PushWithLabels pushes the zip archive as an image whose config carries the
+// given labels. It does not deduplicate, as the existing image would lack
+// the labels.
+func (c Client) PushWithLabels(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, labels map[string]string, tags ...string) (string, error) {
+	return c.push(ctx, creds, repoRef, zipReader, pushConfig{tags: tags, labels: labels})
+}
+
+// GetLabel returns the value of the labelKey label of the image and whether
+// the image has it. Only the manifest and the config blob are fetched, and
+// the labels are read straight from the config file without building a
+// Config, e.g. for controllers only interested in io.buildpacks.build.metadata.
+func (c Client) GetLabel(ctx context.Context, creds Creds, imageRef, labelKey string) (string, bool, error) {
+	c.logger.V(1).Info("getting label", "ref", imageRef, "label", labelKey)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return "", false, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", false, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	if c.platform != nil {
+		remoteOpts = append(remoteOpts, remote.WithPlatform(*c.platform))
+	}
+
+	img, err := c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+	if err != nil {
+		return "", false, err
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return "", false, registryError(imageRef, fmt.Errorf("failed to get image config: %w", err))
+	}
+
+	value, ok := configFile.Config.Labels[labelKey]
+	return value, ok, nil
+}
+
+// SetLabel sets the key label of the image at imageRef to value and returns
+// the digest ref of the updated image, e.g. to bump a version label during
+// upgrades. Only the new config blob and manifest are uploaded, the layers
+// are left as they are. Like AnnotateManifest, a tag is moved to the updated
+// image while an image referenced by digest is kept, and the updated image is
+// signed when a signer is set. Keys with a reserved prefix are rejected with
+// a ValidationError and image indexes with ErrNotSupported.
+func (c Client) SetLabel(ctx context.Context, creds Creds, imageRef, key, value string) (string, error) {
+	c.logger.V(1).Info("setting label", "ref", imageRef, "label", key)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	if err = c.validateLabels(imageRef, map[string]string{key: value}); err != nil {
+		return "", err
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	img, err := updatableImage(ref, imageRef, remoteOpts)
+	if err != nil {
+		return "", err
+	}
+
+	labelled, err := withLabels(img, map[string]string{key: value})
+	if err != nil {
+		return "", err
+	}
+
+	return c.putUpdatedImage(ctx, creds, ref, imageRef, labelled, remoteOpts)
+}
+
+// updatableImage fetches the image at ref to be updated by SetLabel or
+// PushConfig. Image indexes are rejected with ErrNotSupported whatever the
+// platform of the client, as moving their tag to an updated child would drop
+// the other platforms.
+func updatableImage(ref name.Reference, imageRef string, remoteOpts []remote.Option) (v1.Image, error) {
+	desc, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	if desc.MediaType.IsIndex() {
+		return nil, fmt.Errorf("%w: %s is an image index, only single images can be updated", ErrNotSupported, imageRef)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	return img, nil
+}
+
+// putUpdatedImage uploads the config blob and manifest of updated, derived
+// from the image at ref, and runs the post-write hooks on it. A tag is moved
+// to the updated image while an image referenced by digest is kept.
+func (c Client) putUpdatedImage(ctx context.Context, creds Creds, ref name.Reference, imageRef string, updated v1.Image, remoteOpts []remote.Option) (string, error) {
+	configLayer, err := partial.ConfigLayer(updated)
+	if err != nil {
+		return "", fmt.Errorf("failed to get image config: %w", err)
+	}
+
+	digest, err := updated.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get digest of updated image: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write-manifest", func() error {
+		if configErr := remote.WriteLayer(ref.Context(), configLayer, writeOpts...); configErr != nil {
+			return configErr
+		}
+		return remote.Put(ref.Context().Digest(digest.String()), updated, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return "", pushError(imageRef, fmt.Errorf("failed to upload updated image: %w", err))
+	}
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: updated,
+		digest:   digest,
+		tags:     refTags(ref, nil),
+	}, writeOpts)
+}
+
+// DiffLabels compares the labels of the image with desired. added holds the
+// desired labels missing from the image, removed the image labels that are
+// not desired and changed the desired values of labels the image has with a
+// different value. All three maps are empty when the labels match.
+func (c Client) DiffLabels(ctx context.Context, creds Creds, imageRef string, desired map[string]string) (added, removed, changed map[string]string, err error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	added, removed, changed = diffLabels(config.Labels, desired)
+	return added, removed, changed, nil
+}
+
+func diffLabels(actual, desired map[string]string) (added, removed, changed map[string]string) {
+	added = map[string]string{}
+	removed = map[string]string{}
+	changed = map[string]string{}
+
+	for key, desiredValue := range desired {
+		actualValue, ok := actual[key]
+		if !ok {
+			added[key] = desiredValue
+		} else if actualValue != desiredValue {
+			changed[key] = desiredValue
+		}
+	}
+
+	for key, actualValue := range actual {
+		if _, ok := desired[key]; !ok {
+			removed[key] = actualValue
+		}
+	}
+
+	return added, removed, changed
+}
+
+// validateLabels returns a ValidationError listing the keys of labels that
+// use a reserved prefix
+func (c Client) validateLabels(ref string, labels map[string]string) error {
+	reservedKeys := []string{}
+	for key := range labels {
+		for _, prefix := range c.reservedLabelPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				reservedKeys = append(reservedKeys, key)
+				break
+			}
+		}
+	}
+	if len(reservedKeys) == 0 {
+		return nil
+	}
+
+	sort.Strings(reservedKeys)
+	return &ValidationError{Ref: ref, Keys: reservedKeys}
+}
+
+func (c Client) validateImageLabels(ref string, img v1.Image) error {
+	cfgFile, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("failed to get image config: %w", err)
+	}
+
+	return c.validateLabels(ref, cfgFile.Config.Labels)
+}
+
+func withLabels(image v1.Image, labels map[string]string) (v1.Image, error) {
+	cfgFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error getting image config file: %w", err)
+	}
+
+	cfgFile = cfgFile.DeepCopy()
+	if cfgFile.Config.Labels == nil {
+		cfgFile.Config.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		cfgFile.Config.Labels[key] = value
+	}
+
+	labelledImage, err := mutate.ConfigFile(image, cfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set labels: %w", err)
+	}
+
+	return labelledImage, nil
+}
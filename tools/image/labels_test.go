@@ -0,0 +1,419 @@
+package image_test
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffLabels", func() {
+	var (
+		creds   image.Creds
+		imgRef  string
+		desired map[string]string
+		added   map[string]string
+		removed map[string]string
+		changed map[string]string
+		diffErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: map[string]string{
+			"same":    "value",
+			"changed": "old",
+			"removed": "gone",
+		}}})
+
+		desired = map[string]string{
+			"same":    "value",
+			"changed": "new",
+			"added":   "here",
+		}
+	})
+
+	JustBeforeEach(func() {
+		added, removed, changed, diffErr = imgClient.DiffLabels(ctx, creds, imgRef, desired)
+	})
+
+	It("returns the differences", func() {
+		Expect(diffErr).NotTo(HaveOccurred())
+		Expect(added).To(Equal(map[string]string{"added": "here"}))
+		Expect(removed).To(Equal(map[string]string{"removed": "gone"}))
+		Expect(changed).To(Equal(map[string]string{"changed": "new"}))
+	})
+
+	When("the labels match", func() {
+		BeforeEach(func() {
+			desired = map[string]string{
+				"same":    "value",
+				"changed": "old",
+				"removed": "gone",
+			}
+		})
+
+		It("returns empty maps", func() {
+			Expect(diffErr).NotTo(HaveOccurred())
+			Expect(added).To(BeEmpty())
+			Expect(removed).To(BeEmpty())
+			Expect(changed).To(BeEmpty())
+		})
+	})
+
+	When("no labels are desired", func() {
+		BeforeEach(func() {
+			desired = nil
+		})
+
+		It("reports all image labels as removed", func() {
+			Expect(diffErr).NotTo(HaveOccurred())
+			Expect(added).To(BeEmpty())
+			Expect(removed).To(HaveLen(3))
+			Expect(changed).To(BeEmpty())
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+		})
+
+		It("fails", func() {
+			Expect(diffErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
+
+// registryRequestRecorder records the manifest and blob requests sent to
+// registries as "<method> <path>"
+type registryRequestRecorder struct {
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (r *registryRequestRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "/manifests/") || strings.Contains(req.URL.Path, "/blobs/") {
+		r.mutex.Lock()
+		r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+		r.mutex.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (r *registryRequestRecorder) recorded(method, pathPart string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	matching := []string{}
+	for _, request := range r.requests {
+		if strings.HasPrefix(request, method+" ") && strings.Contains(request, pathPart) {
+			matching = append(matching, request)
+		}
+	}
+	return matching
+}
+
+var _ = Describe("GetLabel", func() {
+	var (
+		creds    image.Creds
+		imgRef   string
+		labelKey string
+		recorder *registryRequestRecorder
+		value    string
+		found    bool
+		labelErr error
+	)
+
+	BeforeEach(func() {
+		recorder = &registryRequestRecorder{}
+		imgClient = image.NewClient(k8sClientset, image.WithTransport(recorder))
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: map[string]string{
+			"io.buildpacks.build.metadata": `{"processes":[]}`,
+			"foo":                          "bar",
+		}}})
+		labelKey = "io.buildpacks.build.metadata"
+	})
+
+	JustBeforeEach(func() {
+		value, found, labelErr = imgClient.GetLabel(ctx, creds, imgRef, labelKey)
+	})
+
+	It("returns the label value", func() {
+		Expect(labelErr).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(value).To(Equal(`{"processes":[]}`))
+	})
+
+	It("only fetches the manifest and the config blob", func() {
+		Expect(labelErr).NotTo(HaveOccurred())
+		Expect(recorder.requests).To(HaveLen(2))
+		Expect(recorder.requests[0]).To(HavePrefix("GET /v2/labels/"))
+		Expect(recorder.requests[0]).To(ContainSubstring("/manifests/"))
+		Expect(recorder.requests[1]).To(HavePrefix("GET /v2/labels/"))
+		Expect(recorder.requests[1]).To(ContainSubstring("/blobs/"))
+	})
+
+	When("the image does not have the label", func() {
+		BeforeEach(func() {
+			labelKey = "missing"
+		})
+
+		It("reports it is not found", func() {
+			Expect(labelErr).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(value).To(BeEmpty())
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(labelErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("PushWithLabels", func() {
+	var (
+		creds   image.Creds
+		repoRef string
+		labels  map[string]string
+		imgRef  string
+		pushErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+		labels = map[string]string{"team": "payments"}
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.PushWithLabels(ctx, creds, repoRef, zipFile, labels)
+	})
+
+	It("pushes an image with the labels", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Labels).To(Equal(labels))
+	})
+
+	When("a label uses a reserved prefix", func() {
+		BeforeEach(func() {
+			labels["cloudfoundry.org/app-guid"] = "app"
+			labels["cloudfoundry.org/space-guid"] = "space"
+		})
+
+		It("fails with a ValidationError listing the offending keys", func() {
+			var validationErr *image.ValidationError
+			Expect(errors.As(pushErr, &validationErr)).To(BeTrue())
+			Expect(validationErr.Ref).To(Equal(repoRef))
+			Expect(validationErr.Keys).To(Equal([]string{"cloudfoundry.org/app-guid", "cloudfoundry.org/space-guid"}))
+			Expect(pushErr).To(MatchError(ContainSubstring("use reserved prefixes: cloudfoundry.org/app-guid, cloudfoundry.org/space-guid")))
+		})
+
+		It("does not push the image", func() {
+			_, err := imgClient.ListTags(ctx, creds, repoRef)
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(err, &notFoundErr)).To(BeTrue())
+		})
+	})
+
+	When("the reserved prefixes are configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithReservedLabelPrefixes("korifi.example.com/"))
+			labels["cloudfoundry.org/app-guid"] = "app"
+		})
+
+		It("allows the default prefix", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+
+		When("a label uses a configured prefix", func() {
+			BeforeEach(func() {
+				labels["korifi.example.com/owner"] = "me"
+			})
+
+			It("fails", func() {
+				var validationErr *image.ValidationError
+				Expect(errors.As(pushErr, &validationErr)).To(BeTrue())
+				Expect(validationErr.Keys).To(Equal([]string{"korifi.example.com/owner"}))
+			})
+		})
+	})
+})
+
+var _ = Describe("SetLabel", func() {
+	var (
+		creds          image.Creds
+		recorder       *registryRequestRecorder
+		repoRef        string
+		imgRef         string
+		originalDigest string
+		key            string
+		labelledRef    string
+		setErr         error
+	)
+
+	BeforeEach(func() {
+		recorder = &registryRequestRecorder{}
+		imgClient = image.NewClient(k8sClientset, image.WithTransport(recorder))
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("labels/" + uuid.NewString())
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		digestRef, err := imgClient.PushWithLabels(ctx, creds, repoRef, zipFile, map[string]string{
+			"version": "1.0",
+			"team":    "payments",
+		}, "v1")
+		Expect(err).NotTo(HaveOccurred())
+		originalDigest = strings.Split(digestRef, "@")[1]
+
+		recorder.mutex.Lock()
+		recorder.requests = nil
+		recorder.mutex.Unlock()
+
+		imgRef = repoRef + ":v1"
+		key = "version"
+	})
+
+	JustBeforeEach(func() {
+		labelledRef, setErr = imgClient.SetLabel(ctx, creds, imgRef, key, "2.0")
+	})
+
+	It("updates the label and keeps the others", func() {
+		Expect(setErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, labelledRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Labels).To(Equal(map[string]string{
+			"version": "2.0",
+			"team":    "payments",
+		}))
+	})
+
+	It("moves the tag to the labelled image", func() {
+		Expect(setErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labelledRef).To(Equal(repoRef + "@" + digest))
+		Expect(digest).NotTo(Equal(originalDigest))
+	})
+
+	It("only uploads the config blob and the manifest", func() {
+		Expect(setErr).NotTo(HaveOccurred())
+		Expect(recorder.recorded(http.MethodPost, "/blobs/uploads/")).To(HaveLen(1))
+		Expect(recorder.recorded(http.MethodPut, "/manifests/sha256:")).To(HaveLen(1))
+		Expect(recorder.recorded(http.MethodPut, "/manifests/v1")).To(HaveLen(1))
+	})
+
+	When("the image is referenced by digest", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + "@" + originalDigest
+		})
+
+		It("keeps the tags", func() {
+			Expect(setErr).NotTo(HaveOccurred())
+			Expect(labelledRef).NotTo(HaveSuffix(originalDigest))
+
+			digest, err := imgClient.Digest(ctx, creds, repoRef+":v1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(originalDigest))
+		})
+	})
+
+	When("the label uses a reserved prefix", func() {
+		BeforeEach(func() {
+			key = "cloudfoundry.org/version"
+		})
+
+		It("fails with a ValidationError", func() {
+			var validationErr *image.ValidationError
+			Expect(errors.As(setErr, &validationErr)).To(BeTrue())
+			Expect(validationErr.Keys).To(Equal([]string{"cloudfoundry.org/version"}))
+		})
+	})
+
+	When("a signer is set", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithCosignSigner(writeCosignKey()))
+		})
+
+		It("signs the labelled image", func() {
+			Expect(setErr).NotTo(HaveOccurred())
+
+			_, err := getCosignSignature(labelledRef)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the image is an index", func() {
+		BeforeEach(func() {
+			index, err := random.Index(64, 1, 2)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(repoRef + ":multi-arch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.WriteIndex(ref, index, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+
+			imgRef = ref.String()
+		})
+
+		It("fails with ErrNotSupported", func() {
+			Expect(setErr).To(MatchError(image.ErrNotSupported))
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + ":not-a-tag"
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(setErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+})
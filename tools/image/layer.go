@@ -0,0 +1,456 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+// layerUploadConcurrency matches the number of blobs remote.Write uploads at
+// once
+const layerUploadConcurrency = 4
+
+// PushLayer uploads the layer blob to the repository, unless it is already
+// there, and returns its digest. Images referencing pushed layers can then be
+// written with PushManifest.
+func (c Client) PushLayer(ctx context.Context, creds Creds, repoRef string, layer v1.Layer) (v1.Hash, error) {
+	c.logger.V(1).Info("pushing layer", "repo", repoRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return v1.Hash{}, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	digest, err := layer.Digest()
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to get layer digest: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write-layer", func() error {
+		return remote.WriteLayer(repo, layer, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return v1.Hash{}, pushError(repoRef, fmt.Errorf("failed to upload layer %s: %w", digest, err))
+	}
+
+	return digest, nil
+}
+
+// MountLayer makes the blob with blobDigest in sourceRepo available in
+// destRepo, e.g. to reuse the stack layers of a base image for app images
+// pushed to another repository. Within the same registry the blob is mounted
+// across repositories without transferring it. When the registry does not
+// allow the mount, or the repositories are in different registries, the blob
+// is streamed from sourceRepo and uploaded instead. Blobs already in destRepo
+// are left alone.
+func (c Client) MountLayer(ctx context.Context, creds Creds, sourceRepo, destRepo string, blobDigest v1.Hash) error {
+	c.logger.V(1).Info("mounting layer", "from", sourceRepo, "repo", destRepo, "digest", blobDigest)
+	src, err := c.parseRepository(sourceRepo)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", sourceRepo, err)
+	}
+
+	dst, err := c.parseRepository(destRepo)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", destRepo, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(destRepo, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	// layers read from a repository are mounted from it by WriteLayer,
+	// which falls back to uploading them when the mount is refused
+	layer, err := remote.Layer(src.Digest(blobDigest.String()), remoteOpts...)
+	if err != nil {
+		return registryError(sourceRepo, fmt.Errorf("failed to get layer %s: %w", blobDigest, err))
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("mount-layer", func() error {
+		return remote.WriteLayer(dst, layer, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return pushError(destRepo, fmt.Errorf("failed to mount layer %s from %s: %w", blobDigest, sourceRepo, err))
+	}
+
+	return nil
+}
+
+// CrossMount makes the layers of the image at srcRef available in dstRepo,
+// e.g. to reuse the stack layers of a base image for the app images pushed
+// to another repository of the same registry, and returns the digests of the
+// layers that were mounted. Each layer is mounted with a cross-repository
+// blob mount request, so its blob is not transferred. Layers whose mount is
+// rejected, and all layers when dstRepo is in another registry, are streamed
+// from srcRef and uploaded instead.
+func (c Client) CrossMount(ctx context.Context, creds Creds, srcRef, dstRepo string) ([]v1.Hash, error) {
+	c.logger.V(1).Info("cross-mounting layers", "ref", srcRef, "repo", dstRepo)
+	ref, err := c.parseReference(srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", srcRef, err)
+	}
+
+	dst, err := c.parseRepository(dstRepo)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", dstRepo, err)
+	}
+
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return nil, authError(dstRepo, fmt.Errorf("error creating keychain: %w", err))
+	}
+	remoteOpts := c.keychainRemoteOpts(ctx, keychain)
+
+	img, err := remote.Image(ref, remoteOpts...)
+	if err != nil {
+		return nil, registryError(srcRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	layers, err := uniqueLayers(img)
+	if err != nil {
+		return nil, err
+	}
+
+	// blobs can only be mounted across repositories of the same registry
+	var mountClient *http.Client
+	if ref.Context().RegistryStr() == dst.RegistryStr() {
+		auth, resolveErr := keychain.Resolve(dst)
+		if resolveErr != nil {
+			return nil, authError(dstRepo, fmt.Errorf("failed to resolve credentials: %w", resolveErr))
+		}
+
+		scopes := []string{dst.Scope(transport.PushScope), ref.Context().Scope(transport.PullScope)}
+		authTransport, transportErr := transport.NewWithContext(ctx, dst.Registry, auth, c.transport, scopes)
+		if transportErr != nil {
+			return nil, pushError(dstRepo, fmt.Errorf("failed to authenticate for mounting layers: %w", transportErr))
+		}
+		mountClient = &http.Client{Transport: authTransport}
+	}
+
+	// mounted is indexed like layers so that the goroutines do not need to
+	// synchronise
+	mounted := make([]bool, len(layers))
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	var group errgroup.Group
+	group.SetLimit(layerUploadConcurrency)
+	for i, layer := range layers {
+		group.Go(func() error {
+			digest, digestErr := layer.Digest()
+			if digestErr != nil {
+				return fmt.Errorf("failed to get layer digest: %w", digestErr)
+			}
+
+			if mountClient != nil {
+				mountErr := c.retryOnError("mount-layer", func() (attemptErr error) {
+					mounted[i], attemptErr = mountBlob(ctx, mountClient, ref.Context(), dst, digest)
+					return attemptErr
+				})
+				if mountErr != nil {
+					return pushError(dstRepo, fmt.Errorf("failed to mount layer %s from %s: %w", digest, ref.Context(), mountErr))
+				}
+				if mounted[i] {
+					return nil
+				}
+				c.logger.V(1).Info("layer mount rejected, uploading it", "repo", dstRepo, "digest", digest)
+			}
+
+			// hide that the layer was read from a repository so that
+			// WriteLayer does not try to mount it again
+			uploadErr := c.retryOnError("write-layer", func() error {
+				return remote.WriteLayer(dst, unmountableLayer{Layer: layer}, writeOpts...)
+			})
+			if uploadErr != nil {
+				return pushError(dstRepo, fmt.Errorf("failed to upload layer %s: %w", digest, uploadErr))
+			}
+			return nil
+		})
+	}
+	if err = group.Wait(); err != nil {
+		c.reportDiagnostics(err)
+		return nil, err
+	}
+
+	mountedDigests := []v1.Hash{}
+	for i, layer := range layers {
+		if !mounted[i] {
+			continue
+		}
+		digest, digestErr := layer.Digest()
+		if digestErr != nil {
+			return nil, fmt.Errorf("failed to get layer digest: %w", digestErr)
+		}
+		mountedDigests = append(mountedDigests, digest)
+	}
+
+	return mountedDigests, nil
+}
+
+// mountBlob asks the registry to mount the blob with digest from the from
+// repository into the to repository and reports whether it did. Registries
+// rejecting the mount start a regular upload instead, which is cancelled.
+func mountBlob(ctx context.Context, httpClient *http.Client, from, to name.Repository, digest v1.Hash) (bool, error) {
+	mountURL := fmt.Sprintf("%s://%s/v2/%s/blobs/uploads/?mount=%s&from=%s",
+		to.Registry.Scheme(), to.RegistryStr(), to.RepositoryStr(), url.QueryEscape(digest.String()), url.QueryEscape(from.RepositoryStr()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mountURL, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err = transport.CheckError(resp, http.StatusCreated, http.StatusAccepted); err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		cancelUpload(ctx, httpClient, resp)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// cancelUpload deletes the upload session the registry started at the
+// Location of resp instead of mounting a blob. Failures are ignored, as
+// registries expire abandoned upload sessions anyway.
+func cancelUpload(ctx context.Context, httpClient *http.Client, resp *http.Response) {
+	location, err := resp.Location()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, location.String(), nil)
+	if err != nil {
+		return
+	}
+
+	cancelResp, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	cancelResp.Body.Close()
+}
+
+// uniqueLayers returns the layers of img, skipping the ones repeating the
+// blob of an earlier layer
+func uniqueLayers(img v1.Image) ([]v1.Layer, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image layers: %w", err)
+	}
+
+	seen := map[v1.Hash]bool{}
+	unique := []v1.Layer{}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get layer digest: %w", err)
+		}
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+		unique = append(unique, layer)
+	}
+
+	return unique, nil
+}
+
+// unmountableLayer is a layer remote.WriteLayer always uploads
+type unmountableLayer struct {
+	v1.Layer
+}
+
+// PushManifest uploads the config blob and the manifest of img to repoRef and
+// returns the digest ref of the image. The layers are not uploaded and must
+// already be in the repository, e.g. pushed with PushLayer.
+func (c Client) PushManifest(ctx context.Context, creds Creds, repoRef string, img v1.Image) (string, error) {
+	c.logger.V(1).Info("pushing manifest", "ref", repoRef)
+	ref, err := c.parseReference(repoRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	if err = c.validateImageLabels(repoRef, img); err != nil {
+		return "", err
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	configLayer, err := partial.ConfigLayer(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to get image config: %w", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image digest: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write-manifest", func() error {
+		if configErr := remote.WriteLayer(ref.Context(), configLayer, writeOpts...); configErr != nil {
+			return configErr
+		}
+		return remote.Put(ref.Context().Digest(digest.String()), img, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return "", pushError(repoRef, fmt.Errorf("failed to upload manifest: %w", err))
+	}
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: img,
+		digest:   digest,
+		tags:     refTags(ref, nil),
+	}, writeOpts)
+}
+
+// PushWithLayerCheck pushes img to repoRef and applies the tags. Like every
+// push with remote.Write, the layer blobs already in the repository, e.g. the
+// buildpack base layers shared by app images, are found with a HEAD request
+// and not uploaded again; PushWithLayerCheck additionally logs how many
+// layers were uploaded and how many were skipped. The digest ref of the image
+// is returned.
+func (c Client) PushWithLayerCheck(ctx context.Context, creds Creds, repoRef string, img v1.Image, tags ...string) (_ string, err error) {
+	defer c.metrics.observe("push", repoRef, time.Now(), &err)
+	ctx, endSpan := c.startSpan(ctx, "Push", repoRef)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("pushing image", "ref", repoRef, "tags", tags)
+	ref, err := c.parseReference(repoRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	if err = c.validateImageLabels(repoRef, img); err != nil {
+		return "", err
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image digest: %w", err)
+	}
+
+	tracked, uploads, err := trackUploads(img)
+	if err != nil {
+		return "", err
+	}
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write", func() error {
+		return remote.Write(ref.Context().Digest(digest.String()), tracked, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return "", pushError(repoRef, fmt.Errorf("failed to upload image: %w", err))
+	}
+	uploaded := uploads.count()
+	c.logger.V(1).Info("pushed image layers", "ref", repoRef, "uploaded", uploaded, "skipped", uploads.layers-uploaded)
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: img,
+		digest:   digest,
+		tags:     refTags(ref, tags),
+	}, writeOpts)
+}
+
+// uploadTracker records the digests of the layer blobs remote.Write reads
+// to upload them, which it only does for blobs missing from the repository
+type uploadTracker struct {
+	// layers is the number of distinct layer blobs
+	layers   int
+	mutex    sync.Mutex
+	uploaded map[v1.Hash]bool
+}
+
+func (t *uploadTracker) count() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.uploaded)
+}
+
+// trackUploads returns img with its layers recording their uploads.
+// Mountable layers are kept mountable.
+func trackUploads(img v1.Image) (v1.Image, *uploadTracker, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get image layers: %w", err)
+	}
+
+	unique, err := uniqueLayers(img)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracker := &uploadTracker{layers: len(unique), uploaded: map[v1.Hash]bool{}}
+
+	tracked := make([]v1.Layer, 0, len(layers))
+	for _, layer := range layers {
+		if mountable, ok := layer.(*remote.MountableLayer); ok {
+			tracked = append(tracked, &remote.MountableLayer{
+				Layer:     &uploadTrackingLayer{Layer: mountable.Layer, tracker: tracker},
+				Reference: mountable.Reference,
+			})
+			continue
+		}
+		tracked = append(tracked, &uploadTrackingLayer{Layer: layer, tracker: tracker})
+	}
+
+	return &uploadTrackingImage{Image: img, layers: tracked}, tracker, nil
+}
+
+type uploadTrackingImage struct {
+	v1.Image
+	layers []v1.Layer
+}
+
+func (i *uploadTrackingImage) Layers() ([]v1.Layer, error) {
+	return i.layers, nil
+}
+
+type uploadTrackingLayer struct {
+	v1.Layer
+	tracker *uploadTracker
+}
+
+func (l *uploadTrackingLayer) Compressed() (io.ReadCloser, error) {
+	if digest, err := l.Layer.Digest(); err == nil {
+		l.tracker.mutex.Lock()
+		l.tracker.uploaded[digest] = true
+		l.tracker.mutex.Unlock()
+	}
+	return l.Layer.Compressed()
+}
@@ -0,0 +1,536 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// blobUploadRecorder records the digests of the blobs uploaded through it
+type blobUploadRecorder struct {
+	mutex   sync.Mutex
+	digests []string
+}
+
+func (r *blobUploadRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, "/blobs/uploads/") && req.Method == http.MethodPut {
+		r.mutex.Lock()
+		r.digests = append(r.digests, req.URL.Query().Get("digest"))
+		r.mutex.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (r *blobUploadRecorder) uploaded() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.digests
+}
+
+func (r *blobUploadRecorder) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.digests = nil
+}
+
+// mountingRegistry is a registry recording blob mounts and uploads. The
+// registry keeps blobs regardless of their repository, so it tracks which
+// repositories have them to tell mounts from uploads.
+type mountingRegistry struct {
+	host string
+
+	mutex     sync.Mutex
+	repoBlobs map[string]bool
+	mounts    []string
+	uploads   []string
+	cancels   []string
+	mountable bool
+}
+
+func newMountingRegistry() *mountingRegistry {
+	r := &mountingRegistry{repoBlobs: map[string]bool{}, mountable: true}
+
+	registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		repo, rest, isBlob := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/blobs/")
+		if !isBlob {
+			registryHandler.ServeHTTP(w, req)
+			return
+		}
+
+		query := req.URL.Query()
+		switch {
+		case req.Method == http.MethodHead && !r.hasBlob(repo, rest):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case req.Method == http.MethodDelete && strings.HasPrefix(rest, "uploads/"):
+			r.mutex.Lock()
+			r.cancels = append(r.cancels, repo)
+			r.mutex.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case req.Method == http.MethodPost && query.Get("mount") != "":
+			digest, from := query.Get("mount"), query.Get("from")
+			r.mutex.Lock()
+			r.mounts = append(r.mounts, from+"@"+digest)
+			mounted := r.mountable && r.repoBlobs[from+"@"+digest]
+			if mounted {
+				r.repoBlobs[repo+"@"+digest] = true
+			}
+			r.mutex.Unlock()
+			if mounted {
+				w.Header().Set("Location", "/v2/"+repo+"/blobs/"+digest)
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			req.URL.RawQuery = ""
+		case req.Method == http.MethodPut && query.Get("digest") != "":
+			r.mutex.Lock()
+			r.uploads = append(r.uploads, repo+"@"+query.Get("digest"))
+			r.repoBlobs[repo+"@"+query.Get("digest")] = true
+			r.mutex.Unlock()
+		}
+		registryHandler.ServeHTTP(w, req)
+	}))
+	DeferCleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	Expect(err).NotTo(HaveOccurred())
+	r.host = serverURL.Host
+
+	return r
+}
+
+func (r *mountingRegistry) hasBlob(repo, digest string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.repoBlobs[repo+"@"+digest]
+}
+
+func (r *mountingRegistry) allowMounts(allow bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.mountable = allow
+}
+
+func (r *mountingRegistry) recordedMounts() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.mounts
+}
+
+func (r *mountingRegistry) recordedUploads() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.uploads
+}
+
+func (r *mountingRegistry) recordedCancels() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cancels
+}
+
+func (r *mountingRegistry) resetUploads() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.uploads = nil
+}
+
+var _ = Describe("Layers", func() {
+	var (
+		creds   image.Creds
+		repoRef string
+		layer   v1.Layer
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("layers/" + uuid.NewString())
+
+		var err error
+		layer, err = random.Layer(256, types.DockerLayer)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("PushLayer", func() {
+		var (
+			digest  v1.Hash
+			pushErr error
+		)
+
+		JustBeforeEach(func() {
+			digest, pushErr = imgClient.PushLayer(ctx, creds, repoRef, layer)
+		})
+
+		It("returns the layer digest", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(layer.Digest()).To(Equal(digest))
+		})
+
+		When("the repository ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("PushManifest", func() {
+		var (
+			img     v1.Image
+			imgRef  string
+			pushErr error
+		)
+
+		BeforeEach(func() {
+			var err error
+			img, err = mutate.AppendLayers(empty.Image, layer)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			imgRef, pushErr = imgClient.PushManifest(ctx, creds, repoRef+":jim", img)
+		})
+
+		When("the layers have been pushed", func() {
+			BeforeEach(func() {
+				_, err := imgClient.PushLayer(ctx, creds, repoRef, layer)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("pushes the image", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+
+				digest, err := img.Digest()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(imgRef).To(Equal(repoRef + "@" + digest.String()))
+
+				config, err := imgClient.Config(ctx, creds, repoRef+":jim")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.LayerCount).To(Equal(1))
+			})
+		})
+
+		When("the image has a label with a reserved prefix", func() {
+			BeforeEach(func() {
+				var err error
+				img, err = mutate.Config(img, v1.Config{Labels: map[string]string{"cloudfoundry.org/app-guid": "app"}})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fails with a ValidationError", func() {
+				var validationErr *image.ValidationError
+				Expect(errors.As(pushErr, &validationErr)).To(BeTrue())
+				Expect(validationErr.Keys).To(ConsistOf("cloudfoundry.org/app-guid"))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("PushWithLayerCheck", func() {
+		var (
+			baseLayers []v1.Layer
+			img        v1.Image
+			uploads    *blobUploadRecorder
+			imgRef     string
+			pushErr    error
+		)
+
+		imageWith := func(layers ...v1.Layer) v1.Image {
+			GinkgoHelper()
+
+			layered, err := mutate.AppendLayers(empty.Image, layers...)
+			Expect(err).NotTo(HaveOccurred())
+			return layered
+		}
+
+		digestOf := func(digester interface{ Digest() (v1.Hash, error) }) string {
+			GinkgoHelper()
+
+			digest, err := digester.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			return digest.String()
+		}
+
+		BeforeEach(func() {
+			baseLayers = nil
+			for i := 0; i < 3; i++ {
+				baseLayer, err := random.Layer(1024, types.DockerLayer)
+				Expect(err).NotTo(HaveOccurred())
+				baseLayers = append(baseLayers, baseLayer)
+			}
+
+			uploads = &blobUploadRecorder{}
+			imgClient = image.NewClient(k8sClientset, image.WithTransport(uploads))
+			img = imageWith(append(baseLayers, layer)...)
+		})
+
+		JustBeforeEach(func() {
+			imgRef, pushErr = imgClient.PushWithLayerCheck(ctx, creds, repoRef, img, "jim", "bob")
+		})
+
+		It("pushes and tags the image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(Equal(repoRef + "@" + digestOf(img)))
+
+			for _, tag := range []string{"jim", "bob"} {
+				config, err := imgClient.Config(ctx, creds, repoRef+":"+tag)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(config.LayerCount).To(Equal(4))
+			}
+		})
+
+		When("an image sharing the base layers was pushed before", func() {
+			BeforeEach(func() {
+				otherLayer, err := random.Layer(256, types.DockerLayer)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = imgClient.PushWithLayerCheck(ctx, creds, repoRef, imageWith(append(baseLayers, otherLayer)...))
+				Expect(err).NotTo(HaveOccurred())
+
+				uploads.reset()
+			})
+
+			It("only uploads the app layer and the config", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+
+				configDigest, err := img.ConfigName()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uploads.uploaded()).To(ConsistOf(digestOf(layer), configDigest.String()))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("MountLayer", func() {
+		var (
+			registry   *mountingRegistry
+			sourceRepo string
+			destRepo   string
+			blobDigest v1.Hash
+			mountErr   error
+		)
+
+		BeforeEach(func() {
+			registry = newMountingRegistry()
+			creds = image.Creds{Namespace: "default"}
+			sourceRepo = registry.host + "/stack"
+			destRepo = registry.host + "/app"
+
+			var err error
+			blobDigest, err = imgClient.PushLayer(ctx, creds, sourceRepo, layer)
+			Expect(err).NotTo(HaveOccurred())
+			registry.resetUploads()
+		})
+
+		JustBeforeEach(func() {
+			mountErr = imgClient.MountLayer(ctx, creds, sourceRepo, destRepo, blobDigest)
+		})
+
+		It("mounts the blob without uploading it", func() {
+			Expect(mountErr).NotTo(HaveOccurred())
+			Expect(registry.recordedMounts()).To(ConsistOf("stack@" + blobDigest.String()))
+			Expect(registry.recordedUploads()).To(BeEmpty())
+			Expect(registry.hasBlob("app", blobDigest.String())).To(BeTrue())
+		})
+
+		When("the registry does not allow the mount", func() {
+			BeforeEach(func() {
+				registry.allowMounts(false)
+			})
+
+			It("uploads the blob", func() {
+				Expect(mountErr).NotTo(HaveOccurred())
+				Expect(registry.recordedMounts()).To(ConsistOf("stack@" + blobDigest.String()))
+				Expect(registry.recordedUploads()).To(ConsistOf("app@" + blobDigest.String()))
+			})
+		})
+
+		When("the blob is already in the destination repository", func() {
+			BeforeEach(func() {
+				_, err := imgClient.PushLayer(ctx, creds, destRepo, layer)
+				Expect(err).NotTo(HaveOccurred())
+				registry.resetUploads()
+			})
+
+			It("does nothing", func() {
+				Expect(mountErr).NotTo(HaveOccurred())
+				Expect(registry.recordedMounts()).To(BeEmpty())
+				Expect(registry.recordedUploads()).To(BeEmpty())
+			})
+		})
+
+		When("the blob does not exist", func() {
+			BeforeEach(func() {
+				blobDigest = v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}
+			})
+
+			It("fails", func() {
+				Expect(mountErr).To(MatchError(ContainSubstring("failed to mount layer")))
+			})
+		})
+
+		When("the source repository ref is invalid", func() {
+			BeforeEach(func() {
+				sourceRepo += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(mountErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("CrossMount", func() {
+		var (
+			registry     *mountingRegistry
+			srcImg       v1.Image
+			srcRef       string
+			destRepo     string
+			layerDigests []string
+			mounted      []v1.Hash
+			mountErr     error
+		)
+
+		BeforeEach(func() {
+			registry = newMountingRegistry()
+			creds = image.Creds{Namespace: "default"}
+			srcRef = registry.host + "/stack:latest"
+			destRepo = registry.host + "/app"
+
+			var err error
+			srcImg, err = random.Image(1024, 2)
+			Expect(err).NotTo(HaveOccurred())
+			layers, err := srcImg.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			layerDigests = nil
+			for _, l := range layers {
+				digest, digestErr := l.Digest()
+				Expect(digestErr).NotTo(HaveOccurred())
+				layerDigests = append(layerDigests, digest.String())
+			}
+
+			_, err = imgClient.PushWithLayerCheck(ctx, creds, srcRef, srcImg)
+			Expect(err).NotTo(HaveOccurred())
+			registry.resetUploads()
+		})
+
+		JustBeforeEach(func() {
+			mounted, mountErr = imgClient.CrossMount(ctx, creds, srcRef, destRepo)
+		})
+
+		withPrefix := func(prefix string, digests []string) []string {
+			prefixed := []string{}
+			for _, digest := range digests {
+				prefixed = append(prefixed, prefix+digest)
+			}
+			return prefixed
+		}
+
+		It("mounts the layers without uploading them", func() {
+			Expect(mountErr).NotTo(HaveOccurred())
+			mountedDigests := []string{}
+			for _, digest := range mounted {
+				mountedDigests = append(mountedDigests, digest.String())
+			}
+			Expect(mountedDigests).To(Equal(layerDigests))
+			Expect(registry.recordedMounts()).To(ConsistOf(withPrefix("stack@", layerDigests)))
+			Expect(registry.recordedUploads()).To(BeEmpty())
+			for _, digest := range layerDigests {
+				Expect(registry.hasBlob("app", digest)).To(BeTrue())
+			}
+		})
+
+		When("the registry does not allow the mounts", func() {
+			BeforeEach(func() {
+				registry.allowMounts(false)
+			})
+
+			It("cancels the uploads the registry started and uploads the layers", func() {
+				Expect(mountErr).NotTo(HaveOccurred())
+				Expect(mounted).To(BeEmpty())
+				Expect(registry.recordedMounts()).To(ConsistOf(withPrefix("stack@", layerDigests)))
+				Expect(registry.recordedCancels()).To(ConsistOf("app", "app"))
+				Expect(registry.recordedUploads()).To(ConsistOf(withPrefix("app@", layerDigests)))
+			})
+		})
+
+		When("the destination repository is in another registry", func() {
+			var otherRegistry *mountingRegistry
+
+			BeforeEach(func() {
+				otherRegistry = newMountingRegistry()
+				destRepo = otherRegistry.host + "/app"
+			})
+
+			It("uploads the layers without trying to mount them", func() {
+				Expect(mountErr).NotTo(HaveOccurred())
+				Expect(mounted).To(BeEmpty())
+				Expect(registry.recordedMounts()).To(BeEmpty())
+				Expect(otherRegistry.recordedMounts()).To(BeEmpty())
+				Expect(otherRegistry.recordedUploads()).To(ConsistOf(withPrefix("app@", layerDigests)))
+			})
+		})
+
+		When("the source image does not exist", func() {
+			BeforeEach(func() {
+				srcRef = registry.host + "/stack:not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(mountErr).To(MatchError(ContainSubstring("failed to get image")))
+			})
+		})
+
+		When("the destination repository ref is invalid", func() {
+			BeforeEach(func() {
+				destRepo += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(mountErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+})
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoBuildpackMetadata is returned by GetBuildpackInfo for images without
+// the io.buildpacks.lifecycle.metadata label, i.e. images that were not
+// built by buildpacks, such as the ones of Docker image apps
+var ErrNoBuildpackMetadata = errors.New("image has no buildpack lifecycle metadata")
+
+// LifecycleMetadata is the content of the io.buildpacks.lifecycle.metadata
+// label the CNB lifecycle sets on the images it exports. It records the
+// layers contributed by the buildpacks, the launcher and the process types,
+// and the run image the app image is based on.
+type LifecycleMetadata struct {
+	App          []LifecycleLayer     `json:"app"`
+	Config       LifecycleLayer       `json:"config"`
+	Launcher     LifecycleLayer       `json:"launcher"`
+	ProcessTypes LifecycleLayer       `json:"process-types"`
+	Buildpacks   []LifecycleBuildpack `json:"buildpacks"`
+	RunImage     LifecycleRunImage    `json:"runImage"`
+	Stack        *LifecycleStack      `json:"stack,omitempty"`
+}
+
+// LifecycleLayer identifies a layer of the image by its diff ID
+type LifecycleLayer struct {
+	SHA string `json:"sha"`
+}
+
+type LifecycleBuildpack struct {
+	ID      string                             `json:"key"`
+	Version string                             `json:"version"`
+	Layers  map[string]LifecycleBuildpackLayer `json:"layers,omitempty"`
+}
+
+type LifecycleBuildpackLayer struct {
+	SHA    string         `json:"sha"`
+	Data   map[string]any `json:"data,omitempty"`
+	Build  bool           `json:"build"`
+	Launch bool           `json:"launch"`
+	Cache  bool           `json:"cache"`
+}
+
+type LifecycleRunImage struct {
+	TopLayer  string   `json:"topLayer"`
+	Reference string   `json:"reference"`
+	Image     string   `json:"image,omitempty"`
+	Mirrors   []string `json:"mirrors,omitempty"`
+}
+
+type LifecycleStack struct {
+	RunImage LifecycleStackRunImage `json:"runImage"`
+}
+
+type LifecycleStackRunImage struct {
+	Image   string   `json:"image"`
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// GetBuildpackInfo returns the lifecycle metadata recorded by the CNB
+// lifecycle in the io.buildpacks.lifecycle.metadata label of the image.
+// ErrNoBuildpackMetadata is returned when the image has no such label.
+func (c Client) GetBuildpackInfo(ctx context.Context, creds Creds, imageRef string) (*LifecycleMetadata, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	rawMetadata, ok := config.Labels[lifecycleMetadataLabel]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoBuildpackMetadata, imageRef)
+	}
+
+	metadata := &LifecycleMetadata{}
+	if err = json.Unmarshal([]byte(rawMetadata), metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lifecycle metadata %q: %w", rawMetadata, err)
+	}
+
+	return metadata, nil
+}
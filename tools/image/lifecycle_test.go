@@ -0,0 +1,104 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetBuildpackInfo", func() {
+	var (
+		creds    image.Creds
+		imgRef   string
+		labels   map[string]string
+		metadata *image.LifecycleMetadata
+		getErr   error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("lifecycle/" + uuid.NewString())
+		labels = map[string]string{
+			"io.buildpacks.lifecycle.metadata": `{
+				"app": [{"sha": "sha256:app"}],
+				"config": {"sha": "sha256:config"},
+				"launcher": {"sha": "sha256:launcher"},
+				"process-types": {"sha": "sha256:process-types"},
+				"buildpacks": [{
+					"key": "paketo-buildpacks/go-dist",
+					"version": "2.5.0",
+					"layers": {"go": {"sha": "sha256:go", "data": {"version": "1.22.3"}, "build": true, "launch": false, "cache": true}}
+				}],
+				"runImage": {"topLayer": "sha256:top", "reference": "sha256:run", "image": "paketobuildpacks/run-jammy-base", "mirrors": ["mirror.example.com/run"]},
+				"stack": {"runImage": {"image": "paketobuildpacks/run-jammy-base"}}
+			}`,
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{Config: v1.Config{Labels: labels}})
+		metadata, getErr = imgClient.GetBuildpackInfo(ctx, creds, imgRef)
+	})
+
+	It("returns the lifecycle metadata", func() {
+		Expect(getErr).NotTo(HaveOccurred())
+		Expect(metadata.App).To(Equal([]image.LifecycleLayer{{SHA: "sha256:app"}}))
+		Expect(metadata.Config).To(Equal(image.LifecycleLayer{SHA: "sha256:config"}))
+		Expect(metadata.Launcher).To(Equal(image.LifecycleLayer{SHA: "sha256:launcher"}))
+		Expect(metadata.ProcessTypes).To(Equal(image.LifecycleLayer{SHA: "sha256:process-types"}))
+		Expect(metadata.Buildpacks).To(Equal([]image.LifecycleBuildpack{{
+			ID:      "paketo-buildpacks/go-dist",
+			Version: "2.5.0",
+			Layers: map[string]image.LifecycleBuildpackLayer{
+				"go": {SHA: "sha256:go", Data: map[string]any{"version": "1.22.3"}, Build: true, Cache: true},
+			},
+		}}))
+		Expect(metadata.RunImage).To(Equal(image.LifecycleRunImage{
+			TopLayer:  "sha256:top",
+			Reference: "sha256:run",
+			Image:     "paketobuildpacks/run-jammy-base",
+			Mirrors:   []string{"mirror.example.com/run"},
+		}))
+		Expect(metadata.Stack).To(Equal(&image.LifecycleStack{
+			RunImage: image.LifecycleStackRunImage{Image: "paketobuildpacks/run-jammy-base"},
+		}))
+	})
+
+	When("the label is missing", func() {
+		BeforeEach(func() {
+			labels = nil
+		})
+
+		It("returns ErrNoBuildpackMetadata", func() {
+			Expect(getErr).To(MatchError(image.ErrNoBuildpackMetadata))
+			Expect(getErr).To(MatchError(ContainSubstring(imgRef)))
+		})
+	})
+
+	When("the label is not valid JSON", func() {
+		BeforeEach(func() {
+			labels["io.buildpacks.lifecycle.metadata"] = "{not-json"
+		})
+
+		It("fails including the label value", func() {
+			Expect(getErr).To(MatchError(ContainSubstring(`failed to unmarshal lifecycle metadata "{not-json"`)))
+		})
+	})
+
+	When("the image does not exist", func() {
+		JustBeforeEach(func() {
+			_, getErr = imgClient.GetBuildpackInfo(ctx, creds, imgRef+":not-a-tag")
+		})
+
+		It("fails", func() {
+			Expect(getErr).To(MatchError(ContainSubstring("failed to get image")))
+			Expect(getErr).NotTo(MatchError(image.ErrNoBuildpackMetadata))
+		})
+	})
+})
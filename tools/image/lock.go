@@ -0,0 +1,216 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools"
+	"github.com/google/uuid"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	pushLeaseDuration      = 60 * time.Second
+	pushLeaseRetryInterval = time.Second
+)
+
+var ErrConcurrentPush = errors.New("another push to the repository is in progress")
+
+// PushWithLock is Push holding a Lease in Creds.Namespace named after
+// repoRef, so that concurrent pushes to the same repository through
+// PushWithLock run one at a time rather than racing on the tags. The lease
+// is renewed while the push runs and taken over once it expires, e.g. when
+// the holder crashed. ErrConcurrentPush is returned when the lease is still
+// held when ctx is done. Registries do not offer conditional manifest writes
+// that could replace the lease.
+func (c Client) PushWithLock(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, tags ...string) (string, error) {
+	if creds.Namespace == "" {
+		return "", errors.New("a namespace is required to lock the repository")
+	}
+
+	lock := pushLock{
+		client:    c,
+		namespace: creds.Namespace,
+		name:      pushLeaseName(repoRef),
+		holder:    uuid.NewString(),
+	}
+	if err := lock.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer lock.release(context.WithoutCancel(ctx))
+
+	stopRenewing := lock.keepRenewed(ctx)
+	defer stopRenewing()
+
+	return c.Push(ctx, creds, repoRef, zipReader, tags...)
+}
+
+// pushLeaseName hashes repoRef as repository refs are not valid object names
+func pushLeaseName(repoRef string) string {
+	sum := sha256.Sum256([]byte(repoRef))
+	return "korifi-image-push-" + hex.EncodeToString(sum[:])[:16]
+}
+
+type pushLock struct {
+	client    Client
+	namespace string
+	name      string
+	holder    string
+}
+
+func (l pushLock) acquire(ctx context.Context) error {
+	for {
+		acquired, err := l.tryAcquire(ctx)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		l.client.logger.V(1).Info("waiting for push lock", "namespace", l.namespace, "lease", l.name)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: lease %s/%s is held", ErrConcurrentPush, l.namespace, l.name)
+		case <-time.After(pushLeaseRetryInterval):
+		}
+	}
+}
+
+func (l pushLock) tryAcquire(ctx context.Context) (bool, error) {
+	leases := l.client.k8sClient.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	_, err := leases.Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: l.namespace, Name: l.name},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       tools.PtrTo(l.holder),
+			LeaseDurationSeconds: tools.PtrTo(int32(pushLeaseDuration.Seconds())),
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}, metav1.CreateOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("failed to create lease %s/%s: %w", l.namespace, l.name, err)
+	}
+
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// released in the meantime
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease %s/%s: %w", l.namespace, l.name, err)
+	}
+
+	if !leaseExpired(lease, now.Time) {
+		return false, nil
+	}
+
+	l.client.logger.Info("taking over expired push lock", "namespace", l.namespace, "lease", l.name, "previousHolder", leaseHolder(lease))
+	lease.Spec.HolderIdentity = tools.PtrTo(l.holder)
+	lease.Spec.LeaseDurationSeconds = tools.PtrTo(int32(pushLeaseDuration.Seconds()))
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		// another pusher took it over first
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to take over lease %s/%s: %w", l.namespace, l.name, err)
+	}
+
+	return true, nil
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return !now.Before(lease.Spec.RenewTime.Add(duration))
+}
+
+func leaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+// keepRenewed renews the lease until the returned function is called
+func (l pushLock) keepRenewed(ctx context.Context) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(pushLeaseDuration / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.renew(ctx); err != nil {
+					l.client.logger.Info("failed to renew push lock", "namespace", l.namespace, "lease", l.name, "reason", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (l pushLock) renew(ctx context.Context) error {
+	leases := l.client.k8sClient.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if leaseHolder(lease) != l.holder {
+		return fmt.Errorf("lease is held by %s", leaseHolder(lease))
+	}
+
+	lease.Spec.RenewTime = tools.PtrTo(metav1.NewMicroTime(time.Now()))
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// release deletes the lease unless it has been taken over by another pusher
+func (l pushLock) release(ctx context.Context) {
+	leases := l.client.k8sClient.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		l.client.logger.Info("failed to release push lock", "namespace", l.namespace, "lease", l.name, "reason", err)
+		return
+	}
+	if leaseHolder(lease) != l.holder {
+		return
+	}
+
+	err = leases.Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		l.client.logger.Info("failed to release push lock", "namespace", l.namespace, "lease", l.name, "reason", err)
+	}
+}
@@ -0,0 +1,117 @@
+package image_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("PushWithLock", func() {
+	var (
+		creds     image.Creds
+		repoRef   string
+		leaseName string
+		pushCtx   context.Context
+		imgRef    string
+		pushErr   error
+	)
+
+	createLease := func(renewedAgo time.Duration) {
+		GinkgoHelper()
+
+		renewTime := metav1.NewMicroTime(time.Now().Add(-renewedAgo))
+		_, err := k8sClientset.CoordinationV1().Leases("default").Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: leaseName},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       tools.PtrTo("another-pusher"),
+				LeaseDurationSeconds: tools.PtrTo(int32(60)),
+				RenewTime:            &renewTime,
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	getLease := func() (*coordinationv1.Lease, error) {
+		return k8sClientset.CoordinationV1().Leases("default").Get(ctx, leaseName, metav1.GetOptions{})
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("lock/" + uuid.NewString())
+		sum := sha256.Sum256([]byte(repoRef))
+		leaseName = "korifi-image-push-" + hex.EncodeToString(sum[:])[:16]
+		pushCtx = ctx
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.PushWithLock(pushCtx, creds, repoRef, zipFile, "jim")
+	})
+
+	It("pushes the image and releases the lock", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(imgRef).To(HavePrefix(repoRef + "@sha256:"))
+
+		_, err := getLease()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	When("another push holds the lock", func() {
+		BeforeEach(func() {
+			createLease(time.Second)
+
+			var cancel context.CancelFunc
+			pushCtx, cancel = context.WithTimeout(ctx, 1500*time.Millisecond)
+			DeferCleanup(cancel)
+		})
+
+		It("fails with ErrConcurrentPush once the context is done", func() {
+			Expect(pushErr).To(MatchError(image.ErrConcurrentPush))
+
+			lease, err := getLease()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lease.Spec.HolderIdentity).To(Equal(tools.PtrTo("another-pusher")))
+		})
+	})
+
+	When("the lock has expired", func() {
+		BeforeEach(func() {
+			createLease(2 * time.Minute)
+		})
+
+		It("takes it over", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			_, err := getLease()
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	When("creds have no namespace", func() {
+		BeforeEach(func() {
+			creds.Namespace = ""
+		})
+
+		It("fails", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("a namespace is required")))
+		})
+	})
+})
@@ -0,0 +1,195 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Exists checks whether the manifest imageRef points to is present in the
+// registry without pulling it
+func (c Client) Exists(ctx context.Context, creds Creds, imageRef string) (bool, error) {
+	c.logger.V(1).Info("checking existence", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return false, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return false, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	_, err = remote.Head(ref, remoteOpts...)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, registryError(imageRef, fmt.Errorf("failed to check image: %w", err))
+	}
+
+	return true, nil
+}
+
+// Digest returns the digest of the manifest imageRef points to, in the form
+// sha256:<hex>. It only fetches the manifest when the registry does not
+// support HEAD requests.
+func (c Client) Digest(ctx context.Context, creds Creds, imageRef string) (string, error) {
+	c.logger.V(1).Info("fetching digest", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	headDescriptor, err := remote.Head(ref, remoteOpts...)
+	if err == nil {
+		return headDescriptor.Digest.String(), nil
+	}
+	if isNotFound(err) {
+		return "", registryError(imageRef, fmt.Errorf("failed to get image digest: %w", err))
+	}
+
+	c.logger.V(1).Info("HEAD failed - falling back to GET", "ref", imageRef, "reason", err)
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get image digest: %w", err))
+	}
+
+	return descriptor.Digest.String(), nil
+}
+
+// GetImageID returns the image ID of the image imageRef points to, i.e. the
+// digest of its config blob in the form sha256:<hex>, as shown by docker
+// images and referenced by some CF plugins. It is not the manifest digest
+// returned by Digest, which is what image refs pin. Only the manifest is
+// fetched, as it records the config digest.
+func (c Client) GetImageID(ctx context.Context, creds Creds, imageRef string) (string, error) {
+	c.logger.V(1).Info("fetching image ID (config digest)", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	if c.platform != nil {
+		remoteOpts = append(remoteOpts, remote.WithPlatform(*c.platform))
+	}
+
+	img, err := c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+	if err != nil {
+		return "", err
+	}
+
+	imageID, err := img.ConfigName()
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get image ID (config digest): %w", err))
+	}
+
+	return imageID.String(), nil
+}
+
+// CompareImages reports whether both refs resolve to the same manifest
+// digest, e.g. to skip updating an app whose new build produced the same
+// image
+func (c Client) CompareImages(ctx context.Context, creds Creds, refA, refB string) (bool, error) {
+	return c.CompareImagesWithCreds(ctx, creds, refA, creds, refB)
+}
+
+// CompareImagesWithCreds is CompareImages for refs needing different
+// credentials, e.g. in different registries
+func (c Client) CompareImagesWithCreds(ctx context.Context, credsA Creds, refA string, credsB Creds, refB string) (bool, error) {
+	digestA, err := c.Digest(ctx, credsA, refA)
+	if err != nil {
+		return false, err
+	}
+
+	digestB, err := c.Digest(ctx, credsB, refB)
+	if err != nil {
+		return false, err
+	}
+
+	return digestA == digestB, nil
+}
+
+// ResolveTag returns the digest ref (registry/repo@sha256:<hex>) of the
+// manifest imageRef currently points to, e.g. to pin a deployment to the
+// image a tag resolves to. Unlike Digest it always fetches the manifest, so a
+// tag whose manifest cannot be retrieved is reported as an error.
+func (c Client) ResolveTag(ctx context.Context, creds Creds, imageRef string) (string, error) {
+	c.logger.V(1).Info("resolving tag", "ref", imageRef)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	readRef, err := c.readReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	descriptor, err := remote.Get(readRef, remoteOpts...)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	return ref.Context().Digest(descriptor.Digest.String()).Name(), nil
+}
+
+// GetManifest returns the raw manifest imageRef points to and its media
+// type, e.g. to submit it to a vulnerability scanner
+func (c Client) GetManifest(ctx context.Context, creds Creds, imageRef string) ([]byte, string, error) {
+	c.logger.V(1).Info("fetching manifest", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return nil, "", registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	manifest, err := descriptor.RawManifest()
+	if err != nil {
+		return nil, "", registryError(imageRef, fmt.Errorf("failed to get manifest: %w", err))
+	}
+
+	return manifest, string(descriptor.MediaType), nil
+}
+
+func isNotFound(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound
+}
+
+// ignoreNotFound returns nil if the registry reported that the manifest or
+// repository does not exist, and err otherwise
+func ignoreNotFound(err error) error {
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,443 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Manifest", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+		imgRef  string
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		pushRef = containerRegistry.ImageRef("manifest/app")
+		imgRef, err = imgClient.Push(ctx, creds, pushRef, zipFile, "jim")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Exists", func() {
+		var (
+			ref       string
+			exists    bool
+			existsErr error
+		)
+
+		BeforeEach(func() {
+			ref = imgRef
+		})
+
+		JustBeforeEach(func() {
+			exists, existsErr = imgClient.Exists(ctx, creds, ref)
+		})
+
+		It("returns true for a pushed digest", func() {
+			Expect(existsErr).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+		})
+
+		When("the ref is a tag", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":jim"
+			})
+
+			It("returns true", func() {
+				Expect(existsErr).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			})
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("returns false", func() {
+				Expect(existsErr).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			})
+		})
+
+		When("the secret doesn't exist", func() {
+			BeforeEach(func() {
+				creds.SecretNames = []string{"not-a-secret"}
+			})
+
+			It("fails", func() {
+				Expect(existsErr).To(MatchError(ContainSubstring("failed to check image")))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				ref += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(existsErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("Digest", func() {
+		var (
+			ref       string
+			digest    string
+			digestErr error
+		)
+
+		BeforeEach(func() {
+			ref = pushRef + ":jim"
+		})
+
+		JustBeforeEach(func() {
+			digest, digestErr = imgClient.Digest(ctx, creds, ref)
+		})
+
+		It("returns the digest of the tagged image", func() {
+			Expect(digestErr).NotTo(HaveOccurred())
+			Expect(digest).To(HavePrefix("sha256:"))
+			Expect(imgRef).To(Equal(pushRef + "@" + digest))
+		})
+
+		When("the registry does not support HEAD requests", func() {
+			BeforeEach(func() {
+				var headAllowed atomic.Bool
+				headAllowed.Store(true)
+
+				registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/manifests/") && !headAllowed.Load() {
+						w.WriteHeader(http.StatusMethodNotAllowed)
+						return
+					}
+					registryHandler.ServeHTTP(w, r)
+				}))
+				DeferCleanup(server.Close)
+
+				serverURL, err := url.Parse(server.URL)
+				Expect(err).NotTo(HaveOccurred())
+				creds.SecretNames = []string{}
+
+				zipFile, err := os.Open("fixtures/layer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(zipFile.Close)
+
+				noHeadRef := serverURL.Host + "/foo/bar"
+				imgRef, err = imgClient.Push(ctx, creds, noHeadRef, zipFile, "jim")
+				Expect(err).NotTo(HaveOccurred())
+				headAllowed.Store(false)
+
+				ref = noHeadRef + ":jim"
+				pushRef = noHeadRef
+			})
+
+			It("falls back to fetching the manifest", func() {
+				Expect(digestErr).NotTo(HaveOccurred())
+				Expect(imgRef).To(Equal(pushRef + "@" + digest))
+			})
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(digestErr).To(MatchError(ContainSubstring("failed to get image digest")))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				ref += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(digestErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("GetImageID", func() {
+		var (
+			ref            string
+			imageID        string
+			imageIDErr     error
+			expectedID     string
+			manifestDigest string
+		)
+
+		BeforeEach(func() {
+			ref = pushRef + ":jim"
+
+			parsedRef, err := name.ParseReference(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			img, err := remote.Image(parsedRef, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+			Expect(err).NotTo(HaveOccurred())
+			configName, err := img.ConfigName()
+			Expect(err).NotTo(HaveOccurred())
+			expectedID = configName.String()
+			manifestDigest = strings.Split(imgRef, "@")[1]
+		})
+
+		JustBeforeEach(func() {
+			imageID, imageIDErr = imgClient.GetImageID(ctx, creds, ref)
+		})
+
+		It("returns the digest of the config blob", func() {
+			Expect(imageIDErr).NotTo(HaveOccurred())
+			Expect(imageID).To(Equal(expectedID))
+			Expect(imageID).NotTo(Equal(manifestDigest))
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("returns a NotFoundError", func() {
+				var notFoundErr *image.NotFoundError
+				Expect(errors.As(imageIDErr, &notFoundErr)).To(BeTrue())
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				ref += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(imageIDErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("CompareImages", func() {
+		var (
+			refA       string
+			refB       string
+			same       bool
+			compareErr error
+		)
+
+		BeforeEach(func() {
+			refA = pushRef + ":jim"
+			refB = imgRef
+		})
+
+		JustBeforeEach(func() {
+			same, compareErr = imgClient.CompareImages(ctx, creds, refA, refB)
+		})
+
+		It("reports refs resolving to the same manifest as the same", func() {
+			Expect(compareErr).NotTo(HaveOccurred())
+			Expect(same).To(BeTrue())
+		})
+
+		When("the refs resolve to different manifests", func() {
+			BeforeEach(func() {
+				zipFile, err := os.Open("fixtures/anotherLayer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(zipFile.Close)
+
+				refB, err = imgClient.Push(ctx, creds, pushRef, zipFile)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reports them as different", func() {
+				Expect(compareErr).NotTo(HaveOccurred())
+				Expect(same).To(BeFalse())
+			})
+		})
+
+		When("an image does not exist", func() {
+			BeforeEach(func() {
+				refB = pushRef + ":not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(compareErr).To(MatchError(ContainSubstring("failed to get image digest")))
+			})
+		})
+	})
+
+	Describe("CompareImagesWithCreds", func() {
+		var (
+			otherRef   string
+			same       bool
+			compareErr error
+		)
+
+		BeforeEach(func() {
+			noAuthRegistry := oci.NewNoAuthContainerRegistry()
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+
+			otherRef, err = imgClient.Push(ctx, image.Creds{}, noAuthRegistry.ImageRef("manifest/app"), zipFile)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			same, compareErr = imgClient.CompareImagesWithCreds(ctx, creds, imgRef, image.Creds{}, otherRef)
+		})
+
+		It("compares images in registries with different credentials", func() {
+			Expect(compareErr).NotTo(HaveOccurred())
+			Expect(same).To(BeTrue())
+		})
+	})
+
+	Describe("GetManifest", func() {
+		var (
+			ref         string
+			manifest    []byte
+			mediaType   string
+			manifestErr error
+		)
+
+		writeImage := func(img v1.Image) (string, []byte) {
+			GinkgoHelper()
+
+			imgName, err := name.ParseReference(containerRegistry.ImageRef("manifest/" + uuid.NewString()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(imgName, img, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+
+			rawManifest, err := img.RawManifest()
+			Expect(err).NotTo(HaveOccurred())
+			return imgName.String(), rawManifest
+		}
+
+		JustBeforeEach(func() {
+			manifest, mediaType, manifestErr = imgClient.GetManifest(ctx, creds, ref)
+		})
+
+		When("the image has a docker v2 manifest", func() {
+			var expectedManifest []byte
+
+			BeforeEach(func() {
+				img, err := random.Image(64, 1)
+				Expect(err).NotTo(HaveOccurred())
+				ref, expectedManifest = writeImage(img)
+			})
+
+			It("returns the raw manifest and its media type", func() {
+				Expect(manifestErr).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(expectedManifest))
+				Expect(mediaType).To(Equal("application/vnd.docker.distribution.manifest.v2+json"))
+			})
+		})
+
+		When("the image has an OCI manifest", func() {
+			var expectedManifest []byte
+
+			BeforeEach(func() {
+				img, err := random.Image(64, 1)
+				Expect(err).NotTo(HaveOccurred())
+				img = mutate.ConfigMediaType(mutate.MediaType(img, types.OCIManifestSchema1), types.OCIConfigJSON)
+				ref, expectedManifest = writeImage(img)
+			})
+
+			It("returns the raw manifest and its media type", func() {
+				Expect(manifestErr).NotTo(HaveOccurred())
+				Expect(manifest).To(Equal(expectedManifest))
+				Expect(mediaType).To(Equal("application/vnd.oci.image.manifest.v1+json"))
+			})
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(manifestErr).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+			})
+		})
+	})
+
+	Describe("ResolveTag", func() {
+		var (
+			ref         string
+			resolvedRef string
+			resolveErr  error
+		)
+
+		BeforeEach(func() {
+			ref = pushRef + ":jim"
+		})
+
+		JustBeforeEach(func() {
+			resolvedRef, resolveErr = imgClient.ResolveTag(ctx, creds, ref)
+		})
+
+		It("returns the digest ref of the tagged image", func() {
+			Expect(resolveErr).NotTo(HaveOccurred())
+			Expect(resolvedRef).To(Equal(imgRef))
+		})
+
+		When("the ref already has a digest", func() {
+			BeforeEach(func() {
+				ref = imgRef
+			})
+
+			It("returns it", func() {
+				Expect(resolveErr).NotTo(HaveOccurred())
+				Expect(resolvedRef).To(Equal(imgRef))
+			})
+		})
+
+		When("the tag does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(resolveErr).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				ref += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(resolveErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+})
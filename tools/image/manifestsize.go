@@ -0,0 +1,41 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+)
+
+const defaultMaxManifestSize = 4 << 20
+
+// ErrManifestTooLarge is returned by pushes whose manifest is larger than
+// the limit set with WithMaxManifestSize
+var ErrManifestTooLarge = errors.New("image manifest too large")
+
+// WithMaxManifestSize sets the largest manifest, in bytes, pushes upload.
+// Larger manifests, e.g. of images with too many layers for the quota of the
+// registry project, fail with ErrManifestTooLarge before anything is
+// uploaded. Defaults to 4MB, the limit of most registries; values below 1 use
+// the default.
+func WithMaxManifestSize(bytes int64) Option {
+	return func(c *Client) {
+		c.maxManifestSize = bytes
+	}
+}
+
+func (c Client) validateManifestSize(repoRef string, a artifact) error {
+	limit := c.maxManifestSize
+	if limit < 1 {
+		limit = defaultMaxManifestSize
+	}
+
+	manifest, err := a.RawManifest()
+	if err != nil {
+		return fmt.Errorf("failed to get image manifest: %w", err)
+	}
+
+	if size := int64(len(manifest)); size > limit {
+		return fmt.Errorf("%w: the manifest for %s is %d bytes, over the limit of %d bytes", ErrManifestTooLarge, repoRef, size, limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package image_test
+
+import (
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithMaxManifestSize", func() {
+	var (
+		recorder   *registryRequestRecorder
+		clientOpts []image.Option
+		creds      image.Creds
+		pushRef    string
+		pushErr    error
+	)
+
+	BeforeEach(func() {
+		recorder = &registryRequestRecorder{}
+		clientOpts = []image.Option{image.WithTransport(recorder)}
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		pushRef = containerRegistry.ImageRef("manifestsize/" + uuid.NewString())
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgClient = image.NewClient(k8sClientset, clientOpts...)
+		_, pushErr = imgClient.Push(ctx, creds, pushRef, zipFile, "latest")
+	})
+
+	It("pushes images whose manifest is within the default limit", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+	})
+
+	When("the manifest is larger than the limit", func() {
+		BeforeEach(func() {
+			clientOpts = append(clientOpts, image.WithMaxManifestSize(100))
+		})
+
+		It("fails with ErrManifestTooLarge before uploading anything", func() {
+			Expect(errors.Is(pushErr, image.ErrManifestTooLarge)).To(BeTrue())
+			Expect(pushErr).To(MatchError(MatchRegexp(`the manifest for .* is \d+ bytes, over the limit of 100 bytes`)))
+			Expect(recorder.requests).To(BeEmpty())
+		})
+	})
+
+	When("the limit is not positive", func() {
+		BeforeEach(func() {
+			clientOpts = append(clientOpts, image.WithMaxManifestSize(0))
+		})
+
+		It("uses the default limit", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type clientMetrics struct {
+	operationDuration *prometheus.HistogramVec
+	operationErrors   *prometheus.CounterVec
+}
+
+// WithMetricsRegisterer makes the client record the duration and errors of
+// Push, Config and Delete calls in metrics registered with r. Clients using
+// the same registerer share the metrics.
+func WithMetricsRegisterer(r prometheus.Registerer) Option {
+	return func(c *Client) {
+		c.metrics = mustRegisterMetrics(r)
+	}
+}
+
+// MustRegisterMetrics registers the client metrics with r ahead of creating
+// clients with WithMetricsRegisterer, so that registration conflicts are
+// reported at startup. It panics if the metrics cannot be registered.
+func MustRegisterMetrics(r prometheus.Registerer) {
+	mustRegisterMetrics(r)
+}
+
+func mustRegisterMetrics(r prometheus.Registerer) *clientMetrics {
+	m := &clientMetrics{
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_client_operation_duration_seconds",
+			Help:    "Duration of image client registry operations",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, []string{"operation", "registry"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "image_client_operation_errors_total",
+			Help: "Number of failed image client registry operations",
+		}, []string{"operation", "registry", "reason"}),
+	}
+
+	m.operationDuration = registerOrExisting(r, m.operationDuration)
+	m.operationErrors = registerOrExisting(r, m.operationErrors)
+
+	return m
+}
+
+func registerOrExisting[T prometheus.Collector](r prometheus.Registerer, collector T) T {
+	err := r.Register(collector)
+	if err == nil {
+		return collector
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		if existing, ok := alreadyRegistered.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+
+	panic(fmt.Errorf("failed to register image client metrics: %w", err))
+}
+
+// observe records an operation that started at start. It is meant to be
+// deferred by public methods with a named error result.
+func (m *clientMetrics) observe(operation, imageRef string, start time.Time, err *error) {
+	if m == nil {
+		return
+	}
+
+	registry := registryLabel(imageRef)
+	m.operationDuration.WithLabelValues(operation, registry).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		m.operationErrors.WithLabelValues(operation, registry, errorReason(*err)).Inc()
+	}
+}
+
+func registryLabel(imageRef string) string {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return "unknown"
+	}
+	return ref.Context().RegistryStr()
+}
+
+// errorReason keeps the reason label to a small set of values: the first
+// registry error code, or the HTTP status when the registry sent none
+func errorReason(err error) string {
+	var transportErr *transport.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &transportErr):
+		if len(transportErr.Errors) > 0 {
+			return string(transportErr.Errors[0].Code)
+		}
+		return fmt.Sprintf("HTTP_%d", transportErr.StatusCode)
+	default:
+		return "other"
+	}
+}
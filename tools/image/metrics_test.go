@@ -0,0 +1,93 @@
+package image_test
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		creds        image.Creds
+		registry     *prometheus.Registry
+		imgRef       string
+		registryHost string
+	)
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		registry = prometheus.NewRegistry()
+		imgClient = image.NewClient(k8sClientset, image.WithMetricsRegisterer(registry))
+
+		imgRef = containerRegistry.ImageRef("metrics/" + uuid.NewString())
+		registryHost = strings.TrimSuffix(containerRegistry.ImageRef(""), "/")
+		containerRegistry.PushImage(imgRef, &v1.ConfigFile{})
+	})
+
+	It("records the duration of operations", func() {
+		_, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(testutil.CollectAndCount(registry, "image_client_operation_duration_seconds")).To(Equal(1))
+		Expect(testutil.CollectAndCount(registry, "image_client_operation_errors_total")).To(BeZero())
+	})
+
+	It("counts failed operations by reason", func() {
+		_, err := imgClient.Config(ctx, creds, imgRef+":missing")
+		Expect(err).To(HaveOccurred())
+		Expect(imgClient.Delete(ctx, image.Creds{Namespace: "default"}, imgRef)).NotTo(Succeed())
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+
+		var reasons []string
+		for _, family := range families {
+			if family.GetName() != "image_client_operation_errors_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				Expect(labels["registry"]).To(Equal(registryHost))
+				reasons = append(reasons, labels["operation"]+"/"+labels["reason"])
+			}
+		}
+		Expect(reasons).To(ConsistOf("config/MANIFEST_UNKNOWN", "delete/UNAUTHORIZED"))
+	})
+
+	It("shares the metrics between clients using the same registerer", func() {
+		otherClient := image.NewClient(k8sClientset, image.WithMetricsRegisterer(registry))
+
+		_, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = otherClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].GetMetric()[0].GetHistogram().GetSampleCount()).To(BeEquivalentTo(2))
+	})
+
+	Describe("MustRegisterMetrics", func() {
+		It("registers the metrics ahead of creating clients", func() {
+			otherRegistry := prometheus.NewRegistry()
+			image.MustRegisterMetrics(otherRegistry)
+
+			Expect(func() {
+				image.NewClient(k8sClientset, image.WithMetricsRegisterer(otherRegistry))
+			}).NotTo(Panic())
+		})
+	})
+})
@@ -0,0 +1,278 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// MirrorDestination is a repository MirrorImage copies the image to, with
+// the creds for pushing to it
+type MirrorDestination struct {
+	RepoRef string
+	Creds   Creds
+}
+
+// MirrorImage copies the image (or image index) at srcRef to all the
+// destinations concurrently, e.g. to registries in several regions. The
+// layers of an image, or of every image of an index, are downloaded from the
+// source once and uploaded to every destination from the downloaded files,
+// see WithPullConcurrency. A
+// failing destination does not stop the others; the failures are returned
+// in a MultiError keyed by destination RepoRef, so no RepoRef may be listed
+// twice.
+func (c Client) MirrorImage(ctx context.Context, creds Creds, srcRef string, destinations []MirrorDestination) (err error) {
+	ctx, endSpan := c.startSpan(ctx, "MirrorImage", srcRef)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("mirroring", "src", srcRef, "destinations", len(destinations))
+	repoRefs := map[string]bool{}
+	for _, destination := range destinations {
+		if repoRefs[destination.RepoRef] {
+			return fmt.Errorf("destination %s is listed more than once", destination.RepoRef)
+		}
+		repoRefs[destination.RepoRef] = true
+	}
+
+	src, err := c.parseReadReference(srcRef)
+	if err != nil {
+		return fmt.Errorf("error parsing source reference %s: %w", srcRef, err)
+	}
+
+	srcOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(srcRef, fmt.Errorf("error creating source keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(src, srcOpts...)
+	if err != nil {
+		return registryError(srcRef, fmt.Errorf("failed to get source image: %w", err))
+	}
+
+	srcArtifact, err := descriptorArtifact(descriptor)
+	if err != nil {
+		return registryError(srcRef, fmt.Errorf("failed to read source image: %w", err))
+	}
+
+	layers, err := artifactLayers(srcArtifact)
+	if err != nil {
+		return err
+	}
+
+	layersDir, err := c.layersDir("mirror-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layersDir)
+
+	prefetch := c.prefetchLayers(layers, layersDir)
+	defer prefetch.stop()
+	srcArtifact, err = withPrefetchedLayers(srcArtifact, layers, prefetch.layers)
+	if err != nil {
+		return err
+	}
+
+	var mutex sync.Mutex
+	failures := map[string]error{}
+
+	var wg sync.WaitGroup
+	for _, destination := range destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if mirrorErr := c.mirrorTo(ctx, srcArtifact, destination); mirrorErr != nil {
+				mutex.Lock()
+				failures[destination.RepoRef] = mirrorErr
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &MultiError{Errors: failures}
+	}
+
+	return nil
+}
+
+func (c Client) mirrorTo(ctx context.Context, src artifact, destination MirrorDestination) error {
+	dst, err := c.parseReference(destination.RepoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing destination reference %s: %w", destination.RepoRef, err)
+	}
+
+	dstOpts, err := c.remoteOpts(ctx, destination.Creds)
+	if err != nil {
+		return authError(destination.RepoRef, fmt.Errorf("error creating destination keychain: %w", err))
+	}
+
+	digest, err := src.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get image digest: %w", err)
+	}
+
+	writeOpts := append(dstOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("mirror", func() error {
+		return writeArtifact(dst.Context().Digest(digest.String()), src, writeOpts...)
+	})
+	if err != nil {
+		c.reportDiagnostics(err)
+		return pushError(destination.RepoRef, fmt.Errorf("failed to write mirrored image: %w", err))
+	}
+
+	_, err = c.finishWrite(ctx, destination.Creds, nil, writtenManifest{
+		repo:     dst.Context(),
+		manifest: src,
+		digest:   digest,
+		tags:     refTags(dst, nil),
+	}, writeOpts)
+	return err
+}
+
+// artifactLayers returns the layers of the image a, or of every image of the
+// index a
+func artifactLayers(a artifact) ([]v1.Layer, error) {
+	if img, ok := a.(v1.Image); ok {
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image layers: %w", err)
+		}
+		return layers, nil
+	}
+
+	children, err := partial.Manifests(a.(v1.ImageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index manifests: %w", err)
+	}
+
+	layers := []v1.Layer{}
+	for _, child := range children {
+		switch child := child.(type) {
+		case v1.Image:
+			childLayers, childErr := artifactLayers(child)
+			if childErr != nil {
+				return nil, childErr
+			}
+			layers = append(layers, childLayers...)
+		case v1.ImageIndex:
+			childLayers, childErr := artifactLayers(child)
+			if childErr != nil {
+				return nil, childErr
+			}
+			layers = append(layers, childLayers...)
+		}
+	}
+
+	return layers, nil
+}
+
+// withPrefetchedLayers returns a with the layers of its images replaced by
+// the prefetched ones, indexed like layers
+func withPrefetchedLayers(a artifact, layers, prefetched []v1.Layer) (artifact, error) {
+	byDigest := map[v1.Hash]v1.Layer{}
+	for i, layer := range layers {
+		if digest, err := layer.Digest(); err == nil {
+			byDigest[digest] = prefetched[i]
+		}
+	}
+
+	if img, ok := a.(v1.Image); ok {
+		return prefetchedImageOf(img, byDigest)
+	}
+	return &prefetchedIndex{index: a.(v1.ImageIndex), layers: byDigest}, nil
+}
+
+func prefetchedImageOf(img v1.Image, byDigest map[v1.Hash]v1.Layer) (*prefetchedImage, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image layers: %w", err)
+	}
+
+	prefetched := make([]v1.Layer, 0, len(layers))
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if l, ok := byDigest[digest]; err == nil && ok {
+			layer = l
+		}
+		prefetched = append(prefetched, layer)
+	}
+
+	return &prefetchedImage{Image: img, layers: prefetched}, nil
+}
+
+// prefetchedIndex is an image index whose images read their layers from the
+// prefetched layers with the same digest
+type prefetchedIndex struct {
+	index  v1.ImageIndex
+	layers map[v1.Hash]v1.Layer
+}
+
+func (i *prefetchedIndex) MediaType() (types.MediaType, error) {
+	return i.index.MediaType()
+}
+
+func (i *prefetchedIndex) Digest() (v1.Hash, error) {
+	return i.index.Digest()
+}
+
+func (i *prefetchedIndex) Size() (int64, error) {
+	return i.index.Size()
+}
+
+func (i *prefetchedIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.index.IndexManifest()
+}
+
+func (i *prefetchedIndex) RawManifest() ([]byte, error) {
+	return i.index.RawManifest()
+}
+
+// Manifests is used by remote.WriteIndex to write the children of the index
+func (i *prefetchedIndex) Manifests() ([]partial.Describable, error) {
+	children, err := partial.Manifests(i.index)
+	if err != nil {
+		return nil, err
+	}
+
+	prefetched := make([]partial.Describable, 0, len(children))
+	for _, child := range children {
+		switch child := child.(type) {
+		case v1.Image:
+			img, imgErr := prefetchedImageOf(child, i.layers)
+			if imgErr != nil {
+				return nil, imgErr
+			}
+			prefetched = append(prefetched, img)
+		case v1.ImageIndex:
+			prefetched = append(prefetched, &prefetchedIndex{index: child, layers: i.layers})
+		default:
+			prefetched = append(prefetched, child)
+		}
+	}
+
+	return prefetched, nil
+}
+
+func (i *prefetchedIndex) Image(digest v1.Hash) (v1.Image, error) {
+	img, err := i.index.Image(digest)
+	if err != nil {
+		return nil, err
+	}
+	return prefetchedImageOf(img, i.layers)
+}
+
+func (i *prefetchedIndex) ImageIndex(digest v1.Hash) (v1.ImageIndex, error) {
+	idx, err := i.index.ImageIndex(digest)
+	if err != nil {
+		return nil, err
+	}
+	return &prefetchedIndex{index: idx, layers: i.layers}, nil
+}
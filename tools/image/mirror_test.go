@@ -0,0 +1,214 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MirrorImage", func() {
+	var (
+		srcCreds     image.Creds
+		srcRef       string
+		noAuthRef    string
+		authRef      string
+		destinations []image.MirrorDestination
+		mirrorErr    error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		srcCreds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		srcRef = containerRegistry.ImageRef("mirror/src")
+		containerRegistry.PushImage(srcRef, &v1.ConfigFile{
+			Config: v1.Config{
+				Labels: map[string]string{"foo": "bar"},
+			},
+		})
+
+		noAuthRef = oci.NewNoAuthContainerRegistry().ImageRef("mirror/dst")
+		authRef = containerRegistry.ImageRef("mirror/dst")
+		destinations = []image.MirrorDestination{
+			{RepoRef: noAuthRef, Creds: image.Creds{Namespace: "default"}},
+			{RepoRef: authRef, Creds: srcCreds},
+		}
+	})
+
+	JustBeforeEach(func() {
+		mirrorErr = imgClient.MirrorImage(ctx, srcCreds, srcRef, destinations)
+	})
+
+	It("copies the image to all destinations", func() {
+		Expect(mirrorErr).NotTo(HaveOccurred())
+
+		srcDigest, err := imgClient.Digest(ctx, srcCreds, srcRef)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, destination := range destinations {
+			config, err := imgClient.Config(ctx, destination.Creds, destination.RepoRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Labels).To(Equal(map[string]string{"foo": "bar"}))
+
+			digest, err := imgClient.Digest(ctx, destination.Creds, destination.RepoRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(srcDigest))
+		}
+	})
+
+	When("the source is an image index", func() {
+		var (
+			mutex     sync.Mutex
+			blobGets  map[string]int
+			srcIndex  v1.ImageIndex
+			srcDigest v1.Hash
+		)
+
+		BeforeEach(func() {
+			blobGets = map[string]int{}
+			registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, digest, isBlob := strings.Cut(r.URL.Path, "/blobs/"); isBlob && r.Method == http.MethodGet {
+					mutex.Lock()
+					blobGets[digest]++
+					mutex.Unlock()
+				}
+				registryHandler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(registry.Close)
+
+			serverURL, err := url.Parse(registry.URL)
+			Expect(err).NotTo(HaveOccurred())
+			srcRef = serverURL.Host + "/mirror/index:latest"
+
+			srcIndex, err = random.Index(256, 2, 2)
+			Expect(err).NotTo(HaveOccurred())
+			srcDigest, err = srcIndex.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(srcRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.WriteIndex(ref, srcIndex)).To(Succeed())
+
+			srcCreds = image.Creds{Namespace: "default"}
+			destinations = []image.MirrorDestination{
+				{RepoRef: oci.NewNoAuthContainerRegistry().ImageRef("mirror/dst"), Creds: srcCreds},
+				{RepoRef: oci.NewNoAuthContainerRegistry().ImageRef("mirror/dst"), Creds: srcCreds},
+			}
+		})
+
+		It("downloads the layers of every image of the index once", func() {
+			Expect(mirrorErr).NotTo(HaveOccurred())
+
+			indexManifest, err := srcIndex.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(indexManifest.Manifests).To(HaveLen(2))
+			for _, desc := range indexManifest.Manifests {
+				child, err := srcIndex.Image(desc.Digest)
+				Expect(err).NotTo(HaveOccurred())
+				layers, err := child.Layers()
+				Expect(err).NotTo(HaveOccurred())
+				for _, layer := range layers {
+					digest, err := layer.Digest()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(blobGets).To(HaveKeyWithValue(digest.String(), 1))
+				}
+			}
+
+			for _, destination := range destinations {
+				digest, err := imgClient.Digest(ctx, destination.Creds, destination.RepoRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(digest).To(Equal(srcDigest.String()))
+			}
+		})
+	})
+
+	When("a destination is unreachable", func() {
+		BeforeEach(func() {
+			destinations = append(destinations, image.MirrorDestination{
+				RepoRef: "127.0.0.1:1/mirror/dst",
+				Creds:   image.Creds{Namespace: "default"},
+			})
+		})
+
+		It("still copies the image to the other destinations", func() {
+			var multiErr *image.MultiError
+			Expect(errors.As(mirrorErr, &multiErr)).To(BeTrue())
+			Expect(multiErr.Errors).To(HaveLen(1))
+			Expect(multiErr.Errors).To(HaveKeyWithValue("127.0.0.1:1/mirror/dst", MatchError(ContainSubstring("failed to write mirrored image"))))
+
+			for _, destination := range destinations[:2] {
+				_, err := imgClient.Config(ctx, destination.Creds, destination.RepoRef)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	})
+
+	When("a destination reference is invalid", func() {
+		BeforeEach(func() {
+			destinations[0].RepoRef += "::bad"
+		})
+
+		It("reports it in the MultiError", func() {
+			var multiErr *image.MultiError
+			Expect(errors.As(mirrorErr, &multiErr)).To(BeTrue())
+			Expect(multiErr.Errors).To(HaveKeyWithValue(noAuthRef+"::bad", MatchError(ContainSubstring("error parsing destination reference"))))
+			Expect(multiErr.Errors).To(HaveLen(1))
+		})
+	})
+
+	When("a destination is listed twice", func() {
+		BeforeEach(func() {
+			destinations = append(destinations, image.MirrorDestination{
+				RepoRef: destinations[0].RepoRef,
+				Creds:   image.Creds{Namespace: "default"},
+			})
+		})
+
+		It("fails without pushing anything", func() {
+			Expect(mirrorErr).To(MatchError(ContainSubstring("destination " + destinations[0].RepoRef + " is listed more than once")))
+
+			exists, err := imgClient.Exists(ctx, destinations[0].Creds, noAuthRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+	})
+
+	When("the source does not exist", func() {
+		BeforeEach(func() {
+			srcRef = containerRegistry.ImageRef("mirror/missing")
+		})
+
+		It("fails without pushing anything", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(mirrorErr, &notFoundErr)).To(BeTrue())
+			Expect(errors.As(mirrorErr, new(*image.MultiError))).To(BeFalse())
+		})
+	})
+
+	When("there are no destinations", func() {
+		BeforeEach(func() {
+			destinations = nil
+		})
+
+		It("succeeds", func() {
+			Expect(mirrorErr).NotTo(HaveOccurred())
+		})
+	})
+})
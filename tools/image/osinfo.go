@@ -0,0 +1,29 @@
+package image
+
+import "context"
+
+// OSInfo is the operating system an image was built for, as recorded in its
+// config
+type OSInfo struct {
+	OS           string
+	Architecture string
+	OSVersion    string
+	OSFeatures   []string
+}
+
+// GetOSInfo returns the operating system and architecture of the image, e.g.
+// to audit which OS versions apps run on during stack upgrades or to find the
+// arm64 workloads of a mixed cluster
+func (c Client) GetOSInfo(ctx context.Context, creds Creds, imageRef string) (OSInfo, error) {
+	config, err := c.Config(ctx, creds, imageRef)
+	if err != nil {
+		return OSInfo{}, err
+	}
+
+	return OSInfo{
+		OS:           config.OS,
+		Architecture: config.Architecture,
+		OSVersion:    config.OSVersion,
+		OSFeatures:   config.OSFeatures,
+	}, nil
+}
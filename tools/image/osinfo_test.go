@@ -0,0 +1,76 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GetOSInfo", func() {
+	var (
+		creds     image.Creds
+		imgRef    string
+		imgCfg    *v1.ConfigFile
+		osInfo    image.OSInfo
+		osInfoErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("osinfo/" + uuid.NewString())
+		imgCfg = &v1.ConfigFile{
+			OS:           "linux",
+			Architecture: "arm64",
+		}
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(imgRef, imgCfg)
+		osInfo, osInfoErr = imgClient.GetOSInfo(ctx, creds, imgRef)
+	})
+
+	It("returns the OS and architecture of the image", func() {
+		Expect(osInfoErr).NotTo(HaveOccurred())
+		Expect(osInfo).To(Equal(image.OSInfo{
+			OS:           "linux",
+			Architecture: "arm64",
+		}))
+	})
+
+	When("the image records the OS version and features", func() {
+		BeforeEach(func() {
+			imgCfg = &v1.ConfigFile{
+				OS:           "windows",
+				Architecture: "amd64",
+				OSVersion:    "10.0.17763.1879",
+				OSFeatures:   []string{"win32k"},
+			}
+		})
+
+		It("returns them", func() {
+			Expect(osInfoErr).NotTo(HaveOccurred())
+			Expect(osInfo).To(Equal(image.OSInfo{
+				OS:           "windows",
+				Architecture: "amd64",
+				OSVersion:    "10.0.17763.1879",
+				OSFeatures:   []string{"win32k"},
+			}))
+		})
+	})
+
+	When("the image does not exist", func() {
+		JustBeforeEach(func() {
+			osInfo, osInfoErr = imgClient.GetOSInfo(ctx, creds, imgRef+":not-a-tag")
+		})
+
+		It("fails", func() {
+			Expect(osInfoErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// WithPinDigestToStatus makes the methods writing manifests check that the
+// registry serves the written manifest at the digest ref they return, for
+// policies requiring images to be run by digest. Replicated registries may
+// not serve the manifest at the digest yet, or still resolve it to another
+// manifest; the check is retried with the backoff set with WithRetry.
+func WithPinDigestToStatus(enabled bool) Option {
+	return func(c *Client) {
+		c.pinDigest = enabled
+	}
+}
+
+// confirmDigest checks that the manifest the registry serves at the digest
+// in repo has that digest. A manifest that is missing or has another digest
+// is retried, as it may not have been replicated yet. The manifest is read
+// with a plain HEAD request as remote.Head fails on any digest mismatch
+// without telling which digest the registry returned.
+func (c Client) confirmDigest(ctx context.Context, keychain authn.Keychain, repo name.Repository, digest v1.Hash) error {
+	ref := repo.Digest(digest.String())
+
+	auth, err := keychain.Resolve(repo)
+	if err != nil {
+		return authError(ref.Name(), fmt.Errorf("failed to resolve credentials: %w", err))
+	}
+
+	authTransport, err := transport.NewWithContext(ctx, repo.Registry, auth, c.transport, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return pushError(ref.Name(), fmt.Errorf("failed to confirm pushed digest: %w", err))
+	}
+	httpClient := &http.Client{Transport: authTransport}
+
+	count := 0
+	err = retry.OnError(c.retryBackoff, func(err error) bool {
+		return isRetryable(err) || errors.Is(err, ErrDigestMismatch) || statusCode(err) == http.StatusNotFound
+	}, func() error {
+		headErr := headDigest(ctx, httpClient, ref)
+		if headErr != nil {
+			count++
+			c.logger.V(1).Info("pushed digest not confirmed", "ref", ref.Name(), "count", count, "reason", headErr)
+		}
+		return headErr
+	})
+	if err == nil || errors.Is(err, ErrDigestMismatch) {
+		return err
+	}
+
+	return pushError(ref.Name(), fmt.Errorf("failed to confirm pushed digest: %w", err))
+}
+
+// headDigest returns a DigestMismatchError when the registry serves the
+// manifest at ref with another digest. Registries that do not send the
+// Docker-Content-Digest header, which is optional, are sent a GET so that
+// the digest of the manifest itself is checked.
+func headDigest(ctx context.Context, httpClient *http.Client, ref name.Digest) error {
+	resp, err := manifestRequest(ctx, httpClient, http.MethodHead, ref)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	actual := resp.Header.Get("Docker-Content-Digest")
+	if actual == "" {
+		actual, err = getDigest(ctx, httpClient, ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	if actual == ref.DigestStr() {
+		return nil
+	}
+
+	return &DigestMismatchError{
+		Ref:        ref.Name(),
+		StatusCode: resp.StatusCode,
+		Expected:   ref.DigestStr(),
+		Actual:     actual,
+		Cause:      fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, ref.DigestStr(), actual),
+	}
+}
+
+// getDigest returns the sha256 digest of the manifest the registry serves at
+// ref
+func getDigest(ctx context.Context, httpClient *http.Client, ref name.Digest) (string, error) {
+	resp, err := manifestRequest(ctx, httpClient, http.MethodGet, ref)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	digest, _, err := v1.SHA256(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	return digest.String(), nil
+}
+
+func manifestRequest(ctx context.Context, httpClient *http.Client, method string, ref name.Digest) (*http.Response, error) {
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", ref.Registry.Scheme(), ref.RegistryStr(), ref.RepositoryStr(), ref.DigestStr())
+	req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join([]string{
+		string(types.OCIManifestSchema1),
+		string(types.DockerManifestSchema2),
+		string(types.OCIImageIndex),
+		string(types.DockerManifestList),
+	}, ","))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = transport.CheckError(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,205 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithPinDigestToStatus", func() {
+	const otherDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	var (
+		mutex        sync.Mutex
+		manifestPut  bool
+		digestHeads  int
+		laggingHeads int
+		lagStatus    int
+		noDigest     bool
+		digestGets   int
+		clientOpts   []image.Option
+		repoRef      string
+		imgRef       string
+		pushErr      error
+	)
+
+	BeforeEach(func() {
+		manifestPut = false
+		digestHeads = 0
+		laggingHeads = 0
+		lagStatus = http.StatusNotFound
+		noDigest = false
+		digestGets = 0
+		clientOpts = []image.Option{image.WithPinDigestToStatus(true)}
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		pushed := func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return manifestPut
+		}
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/sha256:") {
+				mutex.Lock()
+				manifestPut = true
+				mutex.Unlock()
+			}
+			// only the HEADs confirming the pushed digest are counted, not the
+			// one checking whether the manifest exists before the push
+			if r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/manifests/sha256:") && pushed() {
+				mutex.Lock()
+				digestHeads++
+				lagging := digestHeads <= laggingHeads
+				mutex.Unlock()
+
+				if lagging && lagStatus == http.StatusOK {
+					w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+					w.Header().Set("Docker-Content-Digest", otherDigest)
+					w.Header().Set("Content-Length", "2")
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				if lagging {
+					w.WriteHeader(lagStatus)
+					return
+				}
+				if noDigest {
+					recorder := httptest.NewRecorder()
+					registryHandler.ServeHTTP(recorder, r)
+					for key, values := range recorder.Header() {
+						w.Header()[key] = values
+					}
+					w.Header().Del("Docker-Content-Digest")
+					w.WriteHeader(recorder.Code)
+					return
+				}
+			}
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/sha256:") {
+				mutex.Lock()
+				digestGets++
+				mutex.Unlock()
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		repoRef = serverURL.Host + "/pin/" + uuid.NewString()
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgClient = image.NewClient(k8sClientset, clientOpts...)
+		imgRef, pushErr = imgClient.Push(ctx, image.Creds{Namespace: "default"}, repoRef, zipFile, "latest")
+	})
+
+	It("confirms the pushed digest", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(imgRef).To(HavePrefix(repoRef + "@sha256:"))
+		Expect(digestHeads).To(Equal(1))
+	})
+
+	When("pinning is disabled", func() {
+		BeforeEach(func() {
+			clientOpts = nil
+		})
+
+		It("does not check the digest", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(digestHeads).To(BeZero())
+		})
+	})
+
+	When("the registry does not serve the digest yet", func() {
+		BeforeEach(func() {
+			laggingHeads = 2
+			clientOpts = append(clientOpts, image.WithRetry(3, time.Millisecond))
+		})
+
+		It("retries until it does", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(HavePrefix(repoRef + "@sha256:"))
+			Expect(digestHeads).To(Equal(3))
+		})
+
+		When("it keeps not serving it", func() {
+			BeforeEach(func() {
+				laggingHeads = 10
+			})
+
+			It("returns a PushError", func() {
+				var pushErrType *image.PushError
+				Expect(errors.As(pushErr, &pushErrType)).To(BeTrue())
+				Expect(pushErr).To(MatchError(ContainSubstring("failed to confirm pushed digest")))
+				Expect(digestHeads).To(Equal(3))
+			})
+		})
+	})
+
+	When("the registry resolves the digest to another manifest", func() {
+		BeforeEach(func() {
+			laggingHeads = 10
+			lagStatus = http.StatusOK
+			clientOpts = append(clientOpts, image.WithRetry(2, time.Millisecond))
+		})
+
+		It("returns a DigestMismatchError", func() {
+			var mismatchErr *image.DigestMismatchError
+			Expect(errors.As(pushErr, &mismatchErr)).To(BeTrue())
+			Expect(mismatchErr.Actual).To(Equal(otherDigest))
+			Expect(mismatchErr.Ref).To(HavePrefix(repoRef + "@" + mismatchErr.Expected))
+			Expect(pushErr).To(MatchError(image.ErrDigestMismatch))
+			Expect(digestHeads).To(Equal(2))
+		})
+	})
+
+	When("the registry does not send the digest header", func() {
+		BeforeEach(func() {
+			noDigest = true
+		})
+
+		It("confirms the digest of the manifest it serves", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(imgRef).To(HavePrefix(repoRef + "@sha256:"))
+			Expect(digestHeads).To(Equal(1))
+			Expect(digestGets).To(Equal(1))
+		})
+	})
+
+	When("the registry requires authentication", func() {
+		var creds image.Creds
+
+		BeforeEach(func() {
+			creds = image.Creds{
+				Namespace:   "default",
+				SecretNames: []string{secretName},
+			}
+		})
+
+		It("confirms the digest with the credentials", func() {
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			defer zipFile.Close()
+
+			pinnedRef, err := imgClient.Push(ctx, creds, containerRegistry.ImageRef("pin/"+uuid.NewString()), zipFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinnedRef).To(ContainSubstring("@sha256:"))
+		})
+	})
+})
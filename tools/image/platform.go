@@ -0,0 +1,126 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// WithPlatform makes Config return the config of the os/arch image when the
+// ref resolves to an image index, e.g. to read the amd64 config of a
+// multi-arch buildpack image from an arm64 node
+func WithPlatform(os, arch string) Option {
+	return func(c *Client) {
+		c.platform = &v1.Platform{OS: os, Architecture: arch}
+	}
+}
+
+// artifact is either a v1.Image or a v1.ImageIndex
+type artifact interface {
+	remote.Taggable
+	Digest() (v1.Hash, error)
+}
+
+func buildArtifact(layer v1.Layer, cfg pushConfig) (artifact, error) {
+	base, err := baseImage(layer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layer media type: %w", err)
+	}
+
+	image, err := mutate.AppendLayers(base, layer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layer: %w", err)
+	}
+
+	if len(cfg.labels) > 0 {
+		image, err = withLabels(image, cfg.labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.sourceSHA256 != "" {
+		image, err = withSourceSHA256Label(image, cfg.sourceSHA256)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.annotations) > 0 {
+		image = mutate.Annotations(image, cfg.annotations).(v1.Image)
+	}
+
+	if len(cfg.platforms) == 0 {
+		return image, nil
+	}
+
+	if len(cfg.platforms) == 1 {
+		return withPlatform(image, cfg.platforms[0])
+	}
+
+	indexMediaType := types.DockerManifestList
+	if mediaType, _ := image.MediaType(); mediaType == types.OCIManifestSchema1 {
+		indexMediaType = types.OCIImageIndex
+	}
+
+	index := mutate.IndexMediaType(empty.Index, indexMediaType)
+	for _, platform := range cfg.platforms {
+		platformImage, err := withPlatform(image, platform)
+		if err != nil {
+			return nil, err
+		}
+
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add: platformImage,
+			Descriptor: v1.Descriptor{
+				Platform: &platform,
+			},
+		})
+	}
+
+	if len(cfg.annotations) > 0 {
+		index = mutate.Annotations(index, cfg.annotations).(v1.ImageIndex)
+	}
+
+	return index, nil
+}
+
+func withPlatform(image v1.Image, platform v1.Platform) (v1.Image, error) {
+	cfgFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error getting image config file: %w", err)
+	}
+
+	cfgFile = cfgFile.DeepCopy()
+	cfgFile.OS = platform.OS
+	cfgFile.Architecture = platform.Architecture
+	cfgFile.Variant = platform.Variant
+	cfgFile.OSVersion = platform.OSVersion
+	cfgFile.OSFeatures = platform.OSFeatures
+
+	platformImage, err := mutate.ConfigFile(image, cfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set platform %s: %w", platform.String(), err)
+	}
+
+	return platformImage, nil
+}
+
+// annotateArtifact returns a copy of the image or image index whose manifest
+// carries the annotations
+func annotateArtifact(a artifact, annotations map[string]string) artifact {
+	return mutate.Annotations(a, annotations).(artifact)
+}
+
+func writeArtifact(ref name.Reference, a artifact, opts ...remote.Option) error {
+	if index, ok := a.(v1.ImageIndex); ok {
+		return remote.WriteIndex(ref, index, opts...)
+	}
+
+	return remote.Write(ref, a.(v1.Image), opts...)
+}
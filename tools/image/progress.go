@@ -0,0 +1,73 @@
+package image
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const progressInterval = time.Second
+
+type progressReport struct {
+	BytesWritten int64 `json:"bytes_written"`
+	Total        int64 `json:"total,omitempty"`
+}
+
+// WithProgressWriter makes Push report upload progress to w as a stream of
+// JSON objects such as {"bytes_written":N,"total":M}, at most once a second
+// and once the upload completes. total is omitted when it is not known. Blobs
+// already in the registry are skipped and do not count towards progress.
+func WithProgressWriter(w io.Writer) Option {
+	return func(c *Client) {
+		c.progressWriter = w
+	}
+}
+
+// progressOpts returns the options reporting the progress of a single write
+// and a function waiting for the last report. go-containerregistry closes the
+// updates channel when the write ends, so every attempt needs its own.
+func (c Client) progressOpts() ([]remote.Option, func()) {
+	if c.progressWriter == nil {
+		return nil, func() {}
+	}
+
+	updates := make(chan v1.Update, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.reportProgress(updates)
+	}()
+
+	return []remote.Option{remote.WithProgress(updates)}, func() { <-done }
+}
+
+func (c Client) reportProgress(updates <-chan v1.Update) {
+	encoder := json.NewEncoder(c.progressWriter)
+	var latest, reported *v1.Update
+	var reportedAt time.Time
+
+	report := func(update *v1.Update) {
+		if err := encoder.Encode(progressReport{BytesWritten: update.Complete, Total: update.Total}); err != nil {
+			c.logger.V(1).Info("failed to report push progress", "reason", err)
+		}
+		reported = update
+		reportedAt = time.Now()
+	}
+
+	for update := range updates {
+		if update.Error != nil {
+			continue
+		}
+		latest = &update
+		if time.Since(reportedAt) >= progressInterval {
+			report(latest)
+		}
+	}
+
+	if latest != nil && latest != reported {
+		report(latest)
+	}
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImageProvenanceSpec records a push of an image
+type ImageProvenanceSpec struct {
+	// Image is the digest ref of the pushed image
+	Image string
+	// Digest is the digest of the manifest of the pushed image
+	Digest string
+	// Tags that were applied to the image by the push
+	Tags []string
+	// PushedAt is when the push completed
+	PushedAt time.Time
+	// Pusher are the registry credentials used for the push
+	Pusher Creds
+}
+
+// ProvenanceRecorder records the provenance of the images pushed by a client
+// set up with WithProvenanceRecorder
+type ProvenanceRecorder interface {
+	Record(ctx context.Context, provenance ImageProvenanceSpec) error
+}
+
+// WithProvenanceRecorder makes pushes record the digest ref, digest, tags,
+// push time and pusher of every pushed image with recorder, e.g. as
+// ImageProvenance resources. A push fails if its provenance cannot be
+// recorded.
+func WithProvenanceRecorder(recorder ProvenanceRecorder) Option {
+	return func(c *Client) {
+		c.provenanceRecorder = recorder
+	}
+}
+
+// recordProvenance records the push of the image with digest to repo, if the
+// client has a ProvenanceRecorder
+func (c Client) recordProvenance(ctx context.Context, creds Creds, repo name.Repository, digest v1.Hash, tags []string) error {
+	if c.provenanceRecorder == nil {
+		return nil
+	}
+
+	imageRef := repo.Digest(digest.String()).Name()
+	err := c.provenanceRecorder.Record(ctx, ImageProvenanceSpec{
+		Image:    imageRef,
+		Digest:   digest.String(),
+		Tags:     tags,
+		PushedAt: time.Now(),
+		Pusher:   creds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record provenance of %s: %w", imageRef, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package image_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type provenanceRecorderFunc func(ctx context.Context, provenance image.ImageProvenanceSpec) error
+
+func (f provenanceRecorderFunc) Record(ctx context.Context, provenance image.ImageProvenanceSpec) error {
+	return f(ctx, provenance)
+}
+
+var _ = Describe("WithProvenanceRecorder", func() {
+	var (
+		creds       image.Creds
+		repoRef     string
+		recorded    []image.ImageProvenanceSpec
+		recordErr   error
+		imgRef      string
+		pushErr     error
+		pushStarted time.Time
+	)
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("provenance/" + uuid.NewString())
+		recorded = nil
+		recordErr = nil
+
+		imgClient = image.NewClient(k8sClientset, image.WithProvenanceRecorder(provenanceRecorderFunc(
+			func(_ context.Context, provenance image.ImageProvenanceSpec) error {
+				recorded = append(recorded, provenance)
+				return recordErr
+			},
+		)))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		pushStarted = time.Now().Truncate(time.Second)
+		imgRef, pushErr = imgClient.Push(ctx, creds, repoRef, zipFile, "latest", "v1")
+	})
+
+	It("records the provenance of the pushed image", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(recorded).To(HaveLen(1))
+
+		provenance := recorded[0]
+		Expect(provenance.Image).To(Equal(imgRef))
+		Expect(imgRef).To(HaveSuffix("@" + provenance.Digest))
+		Expect(provenance.Tags).To(Equal([]string{"latest", "v1"}))
+		Expect(provenance.PushedAt).To(BeTemporally(">=", pushStarted))
+		Expect(provenance.Pusher).To(Equal(creds))
+	})
+
+	When("recording fails", func() {
+		BeforeEach(func() {
+			recordErr = errors.New("boom")
+		})
+
+		It("fails the push", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("failed to record provenance")))
+			Expect(pushErr).To(MatchError(recordErr))
+		})
+	})
+})
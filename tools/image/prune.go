@@ -0,0 +1,128 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/go-multierror"
+)
+
+// PrunePolicy describes which manifests Prune deletes. Manifests older than
+// MaxAge are deleted, but the KeepCount newest manifests are always kept.
+// A zero MaxAge only enforces KeepCount.
+type PrunePolicy struct {
+	MaxAge    time.Duration
+	KeepCount int
+}
+
+type taggedManifest struct {
+	digest  string
+	tags    []string
+	created time.Time
+}
+
+// Prune deletes the tagged manifests in the repository that exceed the policy
+// and returns how many were deleted. The age of a manifest is taken from the
+// creation time in its config file. A zero policy deletes nothing.
+func (c Client) Prune(ctx context.Context, creds Creds, repoRef string, policy PrunePolicy) (int, error) {
+	c.logger.V(1).Info("pruning repository", "repo", repoRef, "maxAge", policy.MaxAge, "keepCount", policy.KeepCount)
+	if policy == (PrunePolicy{}) {
+		return 0, nil
+	}
+
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return 0, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	tags, err := remote.List(repo, remoteOpts...)
+	if err != nil {
+		if isNotFound(err) {
+			return 0, nil
+		}
+		return 0, registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	// the manifests that cannot be resolved have an unknown age and would
+	// shift which manifests KeepCount protects, so nothing is pruned then
+	manifests, err := c.resolveTaggedManifests(repo, tags, remoteOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].created.After(manifests[j].created)
+	})
+
+	var pruneErr *multierror.Error
+	deleted := 0
+	now := time.Now()
+	for i, manifest := range manifests {
+		if i < policy.KeepCount {
+			continue
+		}
+		if policy.MaxAge > 0 && now.Sub(manifest.created) <= policy.MaxAge {
+			continue
+		}
+
+		if err = c.deleteManifests(repo, manifest.tags, []string{manifest.digest}, remoteOpts); err != nil {
+			pruneErr = multierror.Append(pruneErr, err)
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, pruneErr.ErrorOrNil()
+}
+
+// resolveTaggedManifests groups the tags by the manifest they point to and
+// reads the creation time of each manifest. The errors of the manifests that
+// cannot be resolved are combined.
+func (c Client) resolveTaggedManifests(repo name.Repository, tags []string, remoteOpts []remote.Option) ([]taggedManifest, error) {
+	var resolveErr *multierror.Error
+	manifests := []taggedManifest{}
+	byDigest := map[string]int{}
+	for _, tag := range tags {
+		descriptor, err := remote.Get(repo.Tag(tag), remoteOpts...)
+		if err != nil {
+			resolveErr = multierror.Append(resolveErr, registryError(repo.String(), fmt.Errorf("failed to resolve tag %q: %w", tag, err)))
+			continue
+		}
+
+		digest := descriptor.Digest.String()
+		if i, ok := byDigest[digest]; ok {
+			manifests[i].tags = append(manifests[i].tags, tag)
+			continue
+		}
+
+		img, err := descriptor.Image()
+		if err != nil {
+			resolveErr = multierror.Append(resolveErr, registryError(repo.String(), fmt.Errorf("failed to get image for tag %q: %w", tag, err)))
+			continue
+		}
+
+		cfgFile, err := img.ConfigFile()
+		if err != nil {
+			resolveErr = multierror.Append(resolveErr, fmt.Errorf("failed to get config file for tag %q: %w", tag, err))
+			continue
+		}
+
+		byDigest[digest] = len(manifests)
+		manifests = append(manifests, taggedManifest{
+			digest:  digest,
+			tags:    []string{tag},
+			created: cfgFile.Created.Time,
+		})
+	}
+
+	return manifests, resolveErr.ErrorOrNil()
+}
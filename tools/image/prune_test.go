@@ -0,0 +1,200 @@
+package image_test
+
+import (
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prune", func() {
+	var (
+		creds    image.Creds
+		repoRef  string
+		policy   image.PrunePolicy
+		imgRefs  map[string]string
+		deleted  int
+		pruneErr error
+	)
+
+	pushImageCreatedAgo := func(tag string, age time.Duration) string {
+		img, err := random.Image(64, 1)
+		Expect(err).NotTo(HaveOccurred())
+		img, err = mutate.CreatedAt(img, v1.Time{Time: time.Now().Add(-age)})
+		Expect(err).NotTo(HaveOccurred())
+
+		ref, err := name.ParseReference(repoRef + ":" + tag)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, img, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+
+		digest, err := img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		return repoRef + "@" + digest.String()
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("prune/" + uuid.NewString())
+		policy = image.PrunePolicy{}
+
+		imgRefs = map[string]string{}
+		for tag, age := range map[string]time.Duration{
+			"newest": time.Hour,
+			"newer":  2 * time.Hour,
+			"older":  48 * time.Hour,
+			"oldest": 72 * time.Hour,
+		} {
+			imgRefs[tag] = pushImageCreatedAgo(tag, age)
+		}
+	})
+
+	JustBeforeEach(func() {
+		deleted, pruneErr = imgClient.Prune(ctx, creds, repoRef, policy)
+	})
+
+	expectRemaining := func(tags ...string) {
+		GinkgoHelper()
+
+		remaining := []string{}
+		for tag, imgRef := range imgRefs {
+			exists, err := imgClient.Exists(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			if exists {
+				remaining = append(remaining, tag)
+			}
+		}
+		Expect(remaining).To(ConsistOf(tags))
+	}
+
+	It("deletes nothing for a zero policy", func() {
+		Expect(pruneErr).NotTo(HaveOccurred())
+		Expect(deleted).To(BeZero())
+		expectRemaining("newest", "newer", "older", "oldest")
+	})
+
+	When("max age is set", func() {
+		BeforeEach(func() {
+			policy.MaxAge = 24 * time.Hour
+		})
+
+		It("deletes the manifests older than max age", func() {
+			Expect(pruneErr).NotTo(HaveOccurred())
+			Expect(deleted).To(Equal(2))
+			expectRemaining("newest", "newer")
+		})
+
+		When("keep count protects manifests older than max age", func() {
+			BeforeEach(func() {
+				policy.MaxAge = 90 * time.Minute
+				policy.KeepCount = 3
+			})
+
+			It("keeps the newest manifests", func() {
+				Expect(pruneErr).NotTo(HaveOccurred())
+				Expect(deleted).To(Equal(1))
+				expectRemaining("newest", "newer", "older")
+			})
+		})
+	})
+
+	When("only keep count is set", func() {
+		BeforeEach(func() {
+			policy.KeepCount = 1
+		})
+
+		It("keeps only the newest manifests", func() {
+			Expect(pruneErr).NotTo(HaveOccurred())
+			Expect(deleted).To(Equal(3))
+			expectRemaining("newest")
+		})
+	})
+
+	When("a manifest has several tags", func() {
+		BeforeEach(func() {
+			policy.KeepCount = 1
+			Expect(imgClient.Tag(ctx, creds, imgRefs["oldest"], "also-oldest")).To(Succeed())
+		})
+
+		It("counts it once and removes all its tags", func() {
+			Expect(pruneErr).NotTo(HaveOccurred())
+			Expect(deleted).To(Equal(3))
+
+			tags, err := imgClient.ListTags(ctx, creds, repoRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tags).To(ConsistOf("newest"))
+		})
+	})
+
+	When("a manifest cannot be resolved", func() {
+		BeforeEach(func() {
+			policy.KeepCount = 1
+
+			auth := remote.WithAuth(&authn.Basic{Username: "user", Password: "password"})
+			ref, err := name.ParseReference(repoRef + ":broken")
+			Expect(err).NotTo(HaveOccurred())
+
+			config := static.NewLayer([]byte("not a config file"), types.OCIConfigJSON)
+			Expect(remote.WriteLayer(ref.Context(), config, auth)).To(Succeed())
+			configDigest, err := config.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(remote.Put(ref, rawManifest{
+				mediaType: types.OCIManifestSchema1,
+				manifest: []byte(fmt.Sprintf(`{
+					"schemaVersion": 2,
+					"mediaType": "application/vnd.oci.image.manifest.v1+json",
+					"config": {
+						"mediaType": "application/vnd.oci.image.config.v1+json",
+						"digest": %q,
+						"size": 17
+					},
+					"layers": []
+				}`, configDigest)),
+			}, auth)).To(Succeed())
+		})
+
+		It("fails without deleting anything", func() {
+			Expect(pruneErr).To(MatchError(ContainSubstring(`failed to get config file for tag "broken"`)))
+			Expect(deleted).To(BeZero())
+			expectRemaining("newest", "newer", "older", "oldest")
+		})
+	})
+
+	When("the repository does not exist", func() {
+		BeforeEach(func() {
+			repoRef = containerRegistry.ImageRef("prune/not-there")
+			policy.KeepCount = 1
+		})
+
+		It("succeeds", func() {
+			Expect(pruneErr).NotTo(HaveOccurred())
+			Expect(deleted).To(BeZero())
+		})
+	})
+
+	When("the repository ref is invalid", func() {
+		BeforeEach(func() {
+			repoRef += ":tag"
+			policy.KeepCount = 1
+		})
+
+		It("fails", func() {
+			Expect(pruneErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+		})
+	})
+})
@@ -0,0 +1,286 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultPullConcurrency = 3
+
+// ErrDigestMismatch is returned by PullVerified when the pulled manifest does
+// not have the expected digest, and by pushes with WithPinDigestToStatus when
+// the registry serves another manifest at the pushed digest
+var ErrDigestMismatch = errors.New("image digest mismatch")
+
+// WithPullConcurrency sets how many layers Pull downloads in parallel.
+// Defaults to 3; values below 1 use the default.
+func WithPullConcurrency(n int) Option {
+	return func(c *Client) {
+		c.pullConcurrency = n
+	}
+}
+
+// Pull streams the whole image, layers included, as a tarball. The layers are
+// downloaded in parallel ahead of being written to the tarball, in order, see
+// WithPullConcurrency. The caller is responsible for closing the returned
+// reader. Callers only interested in the
+// image configuration should use Config instead.
+func (c Client) Pull(ctx context.Context, creds Creds, imageRef string) (io.ReadCloser, error) {
+	c.logger.V(1).Info("pulling", "ref", imageRef)
+	return c.pull(ctx, creds, imageRef, nil)
+}
+
+// PullVerified is like Pull but fails with a DigestMismatchError unless the
+// digest of the pulled manifest is expectedDigest (sha256:<hex>). The config
+// and layers are checked against the digests in the manifest while
+// streaming, so a corrupted blob makes reading the tarball fail.
+func (c Client) PullVerified(ctx context.Context, creds Creds, imageRef, expectedDigest string) (io.ReadCloser, error) {
+	c.logger.V(1).Info("pulling", "ref", imageRef, "expectedDigest", expectedDigest)
+	expected, err := v1.NewHash(expectedDigest)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing expected digest %s: %w", expectedDigest, err)
+	}
+
+	return c.pull(ctx, creds, imageRef, &expected)
+}
+
+func (c Client) pull(ctx context.Context, creds Creds, imageRef string, expectedDigest *v1.Hash) (io.ReadCloser, error) {
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	img, err := c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedDigest != nil {
+		var digest v1.Hash
+		digest, err = img.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image digest: %w", err)
+		}
+
+		if digest != *expectedDigest {
+			return nil, &DigestMismatchError{
+				Ref:      imageRef,
+				Expected: expectedDigest.String(),
+				Actual:   digest.String(),
+				Cause:    fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, expectedDigest, digest),
+			}
+		}
+	}
+
+	// the config is cached by the image, so the tarball writer does not
+	// fetch it alongside the layers
+	if _, err = img.RawConfigFile(); err != nil {
+		return nil, registryError(imageRef, fmt.Errorf("failed to get image config: %w", err))
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image layers: %w", err)
+	}
+
+	layersDir, err := c.layersDir("pull-")
+	if err != nil {
+		return nil, err
+	}
+
+	prefetch := c.prefetchLayers(layers, layersDir)
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		defer os.RemoveAll(layersDir)
+		defer prefetch.stop()
+
+		if err := tarball.Write(ref, &prefetchedImage{Image: img, layers: prefetch.layers}, pipeWriter); err != nil {
+			pipeWriter.CloseWithError(fmt.Errorf("failed to write image tarball: %w", err))
+			return
+		}
+		pipeWriter.Close()
+	}()
+
+	return pipeReader, nil
+}
+
+// layersDir creates a temp dir for downloading layers into
+func (c Client) layersDir(pattern string) (string, error) {
+	tmpDir := c.tempDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+
+	dir, err := os.MkdirTemp(tmpDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create a temp dir for layers: %w", err)
+	}
+
+	return dir, nil
+}
+
+// layerPrefetch downloads the blobs of layers into files while they are
+// being written elsewhere
+type layerPrefetch struct {
+	layers []v1.Layer
+	stop   func()
+}
+
+// prefetchLayers starts downloading the blobs of layers into dir, in order
+// and at most pullConcurrency at once. The returned layers read their blob
+// from the downloaded file, waiting for the download to complete. stop
+// skips the downloads that have not started yet, waits for the others and
+// closes the files opened by the tarball writer.
+func (c Client) prefetchLayers(layers []v1.Layer, dir string) layerPrefetch {
+	limit := c.pullConcurrency
+	if limit < 1 {
+		limit = defaultPullConcurrency
+	}
+
+	done := make(chan struct{})
+	var group errgroup.Group
+	group.SetLimit(limit)
+
+	var mutex sync.Mutex
+	var opened []io.Closer
+	open := func(path string) (io.ReadCloser, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, f)
+		return f, nil
+	}
+
+	byDigest := map[v1.Hash]*prefetchedLayer{}
+	prefetched := make([]v1.Layer, 0, len(layers))
+	toFetch := []*prefetchedLayer{}
+	for i, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			// leave it to the tarball writer to fail on the layer
+			prefetched = append(prefetched, layer)
+			continue
+		}
+
+		if l, ok := byDigest[digest]; ok {
+			prefetched = append(prefetched, l)
+			continue
+		}
+
+		l := &prefetchedLayer{
+			Layer:   layer,
+			path:    filepath.Join(dir, fmt.Sprintf("layer-%d", i)),
+			fetched: make(chan struct{}),
+			open:    open,
+		}
+		byDigest[digest] = l
+		prefetched = append(prefetched, l)
+		toFetch = append(toFetch, l)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		for _, l := range toFetch {
+			group.Go(func() error {
+				defer close(l.fetched)
+				select {
+				case <-done:
+					l.err = errors.New("pull stopped")
+				default:
+					l.err = l.download()
+				}
+				return nil
+			})
+		}
+	}()
+
+	return layerPrefetch{
+		layers: prefetched,
+		stop: func() {
+			close(done)
+			<-started
+			_ = group.Wait()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, f := range opened {
+				f.Close()
+			}
+		},
+	}
+}
+
+// prefetchedImage is an image whose layers are downloaded ahead of being
+// read
+type prefetchedImage struct {
+	v1.Image
+	layers []v1.Layer
+}
+
+func (i *prefetchedImage) Layers() ([]v1.Layer, error) {
+	return i.layers, nil
+}
+
+type prefetchedLayer struct {
+	v1.Layer
+	path    string
+	fetched chan struct{}
+	err     error
+	open    func(string) (io.ReadCloser, error)
+}
+
+// download copies the compressed blob of the layer into its file. Blobs read
+// from a registry are checked against their digest while they are copied.
+func (l *prefetchedLayer) download() error {
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get layer digest: %w", err)
+	}
+
+	blob, err := l.Layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed to get layer %s: %w", digest, err)
+	}
+	defer blob.Close()
+
+	f, err := os.Create(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to create a temp file for layer %s: %w", digest, err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, blob); err != nil {
+		return fmt.Errorf("failed to download layer %s: %w", digest, err)
+	}
+
+	return nil
+}
+
+func (l *prefetchedLayer) Compressed() (io.ReadCloser, error) {
+	<-l.fetched
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	return l.open(l.path)
+}
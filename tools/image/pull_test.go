@@ -0,0 +1,274 @@
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pull", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+		imgRef  string
+		reader  io.ReadCloser
+		pullErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		pushRef = containerRegistry.ImageRef("pull/app")
+		imgRef, err = imgClient.Push(ctx, creds, pushRef, zipFile)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		reader, pullErr = imgClient.Pull(ctx, creds, imgRef)
+	})
+
+	It("streams the image as a tarball", func() {
+		Expect(pullErr).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		contents, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		img, err := tarball.Image(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(contents)), nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest, err := img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imgRef).To(HaveSuffix("@" + digest.String()))
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = pushRef + ":not-a-tag"
+		})
+
+		It("fails", func() {
+			Expect(pullErr).To(MatchError(ContainSubstring("failed to get image")))
+		})
+	})
+
+	Describe("PullVerified", func() {
+		var expectedDigest string
+
+		BeforeEach(func() {
+			expectedDigest = imgRef[strings.LastIndex(imgRef, "@")+1:]
+		})
+
+		JustBeforeEach(func() {
+			reader, pullErr = imgClient.PullVerified(ctx, creds, pushRef+":latest", expectedDigest)
+		})
+
+		It("streams the image", func() {
+			Expect(pullErr).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			_, err := io.Copy(io.Discard, reader)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		When("the digest does not match", func() {
+			BeforeEach(func() {
+				expectedDigest = "sha256:" + strings.Repeat("0", 64)
+			})
+
+			It("fails", func() {
+				Expect(pullErr).To(MatchError(image.ErrDigestMismatch))
+			})
+		})
+
+		When("the expected digest is invalid", func() {
+			BeforeEach(func() {
+				expectedDigest = "not-a-digest"
+			})
+
+			It("fails", func() {
+				Expect(pullErr).To(MatchError(ContainSubstring("error parsing expected digest")))
+			})
+		})
+	})
+
+	When("the image has many layers", func() {
+		var (
+			registry *slowRegistry
+			img      v1.Image
+		)
+
+		BeforeEach(func() {
+			registry = newSlowRegistry(50 * time.Millisecond)
+			DeferCleanup(registry.Close)
+
+			var err error
+			img, err = random.Image(1024, 6)
+			Expect(err).NotTo(HaveOccurred())
+
+			imgRef = registry.host + "/pull/layers:latest"
+			imageName, err := name.ParseReference(imgRef, name.Insecure)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(imageName, img)).To(Succeed())
+
+			imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(registry.host))
+			creds = image.Creds{Namespace: "default"}
+		})
+
+		It("downloads the layers in parallel and writes them in order", func() {
+			Expect(pullErr).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			contents, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registry.maxInFlight()).To(Equal(3))
+
+			pulled, err := tarball.Image(func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(contents)), nil
+			}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			expectedManifest, err := img.RawManifest()
+			Expect(err).NotTo(HaveOccurred())
+			pulledManifest, err := pulled.RawManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pulledManifest).To(MatchJSON(expectedManifest))
+		})
+
+		When("the pull concurrency is set", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset,
+					image.WithInsecureRegistries(registry.host),
+					image.WithPullConcurrency(1),
+				)
+			})
+
+			It("downloads that many layers at once", func() {
+				Expect(pullErr).NotTo(HaveOccurred())
+				defer reader.Close()
+
+				_, err := io.Copy(io.Discard, reader)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(registry.maxInFlight()).To(Equal(1))
+			})
+		})
+	})
+})
+
+// BenchmarkPull compares pulling an image with 10 layers sequentially and in
+// parallel from a registry taking 20ms to serve each blob
+func BenchmarkPull(b *testing.B) {
+	registry := newSlowRegistry(20 * time.Millisecond)
+	defer registry.Close()
+
+	img, err := random.Image(64*1024, 10)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	imgRef := registry.host + "/bench/pull:latest"
+	imageName, err := name.ParseReference(imgRef, name.Insecure)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = remote.Write(imageName, img); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			client := image.NewClient(nil, image.WithInsecureRegistries(registry.host), image.WithPullConcurrency(concurrency))
+
+			for i := 0; i < b.N; i++ {
+				reader, err := client.Pull(context.Background(), image.Creds{}, imgRef)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err = io.Copy(io.Discard, reader); err != nil {
+					b.Fatal(err)
+				}
+				reader.Close()
+			}
+		})
+	}
+}
+
+// slowRegistry delays blob downloads and records how many were served at once
+type slowRegistry struct {
+	*httptest.Server
+	host string
+
+	mutex    sync.Mutex
+	inFlight int
+	max      int
+}
+
+func newSlowRegistry(latency time.Duration) *slowRegistry {
+	registry := &slowRegistry{}
+	handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+
+	registry.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/blobs/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		registry.mutex.Lock()
+		registry.inFlight++
+		registry.max = max(registry.max, registry.inFlight)
+		registry.mutex.Unlock()
+
+		time.Sleep(latency)
+		handler.ServeHTTP(w, r)
+
+		registry.mutex.Lock()
+		registry.inFlight--
+		registry.mutex.Unlock()
+	}))
+
+	serverURL, err := url.Parse(registry.URL)
+	if err != nil {
+		panic(err)
+	}
+	registry.host = serverURL.Host
+
+	return registry
+}
+
+func (r *slowRegistry) maxInFlight() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.max
+}
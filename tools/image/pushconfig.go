@@ -0,0 +1,88 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// ErrEntrypointChanged is returned by PushConfig when the new config changes
+// the Entrypoint or Cmd of the image, unless WithAllowEntrypointChange is set
+var ErrEntrypointChanged = errors.New("image config change alters the entrypoint or command")
+
+// WithAllowEntrypointChange controls whether PushConfig accepts configs that
+// change the Entrypoint or Cmd of the image. It is disabled by default, as
+// such changes alter how the app is started and call for a restage.
+func WithAllowEntrypointChange(allowed bool) Option {
+	return func(c *Client) {
+		c.allowEntrypointChange = allowed
+	}
+}
+
+// PushConfig replaces the config of the image at imageRef with newConfig and
+// returns the digest ref of the updated image, e.g. to update the labels
+// holding the environment of an app during a rolling deployment without
+// restaging it. Only the new config blob and manifest are uploaded, the
+// layers are left as they are. Like SetLabel, a tag is moved to the updated
+// image while an image referenced by digest is kept, and the updated image is
+// signed when a signer is set. Added or changed labels with a reserved prefix
+// are rejected with a ValidationError and image indexes with ErrNotSupported.
+func (c Client) PushConfig(ctx context.Context, creds Creds, imageRef string, newConfig v1.Config) (string, error) {
+	c.logger.V(1).Info("pushing config", "ref", imageRef)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	img, err := updatableImage(ref, imageRef, remoteOpts)
+	if err != nil {
+		return "", err
+	}
+
+	cfgFile, err := img.ConfigFile()
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get image config: %w", err))
+	}
+
+	if err = c.validateConfigChange(imageRef, cfgFile.Config, newConfig); err != nil {
+		return "", err
+	}
+
+	updated, err := mutate.Config(img, newConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to set image config: %w", err)
+	}
+
+	return c.putUpdatedImage(ctx, creds, ref, imageRef, updated, remoteOpts)
+}
+
+// validateConfigChange rejects changes to the entrypoint and command, unless
+// allowed, and labels with a reserved prefix that are added or changed.
+// Reserved labels the image already has, e.g. set by the client itself,
+// are kept.
+func (c Client) validateConfigChange(imageRef string, current, desired v1.Config) error {
+	if !c.allowEntrypointChange {
+		if !slices.Equal(current.Entrypoint, desired.Entrypoint) {
+			return fmt.Errorf("%w: %s: Entrypoint %q would become %q", ErrEntrypointChanged, imageRef, current.Entrypoint, desired.Entrypoint)
+		}
+		if !slices.Equal(current.Cmd, desired.Cmd) {
+			return fmt.Errorf("%w: %s: Cmd %q would become %q", ErrEntrypointChanged, imageRef, current.Cmd, desired.Cmd)
+		}
+	}
+
+	added, _, changed := diffLabels(current.Labels, desired.Labels)
+	for key, value := range changed {
+		added[key] = value
+	}
+
+	return c.validateLabels(imageRef, added)
+}
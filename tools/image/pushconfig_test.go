@@ -0,0 +1,230 @@
+package image_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PushConfig", func() {
+	var (
+		creds          image.Creds
+		recorder       *registryRequestRecorder
+		clientOpts     []image.Option
+		repoRef        string
+		imgRef         string
+		originalDigest string
+		layerDigests   []v1.Hash
+		newConfig      v1.Config
+		updatedRef     string
+		pushErr        error
+	)
+
+	BeforeEach(func() {
+		recorder = &registryRequestRecorder{}
+		clientOpts = []image.Option{image.WithTransport(recorder)}
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("pushconfig/" + uuid.NewString())
+
+		img, err := random.Image(1024, 2)
+		Expect(err).NotTo(HaveOccurred())
+		config := v1.Config{
+			Entrypoint: []string{"/cnb/lifecycle/launcher"},
+			Cmd:        []string{"web"},
+			Labels: map[string]string{
+				"cloudfoundry.org/app-guid": "app",
+				"version":                   "1.0",
+			},
+		}
+		img, err = mutate.Config(img, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		layers, err := img.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		layerDigests = nil
+		for _, layer := range layers {
+			digest, digestErr := layer.Digest()
+			Expect(digestErr).NotTo(HaveOccurred())
+			layerDigests = append(layerDigests, digest)
+		}
+
+		digestRef, err := image.NewClient(k8sClientset, image.WithReservedLabelPrefixes()).PushWithLayerCheck(ctx, creds, repoRef, img, "v1")
+		Expect(err).NotTo(HaveOccurred())
+		originalDigest = strings.Split(digestRef, "@")[1]
+
+		imgRef = repoRef + ":v1"
+		newConfig = *config.DeepCopy()
+		newConfig.Labels["version"] = "2.0"
+		newConfig.Labels["io.buildpacks.launch.env.GREETING"] = "hello"
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, clientOpts...)
+		updatedRef, pushErr = imgClient.PushConfig(ctx, creds, imgRef, newConfig)
+	})
+
+	It("replaces the config", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, updatedRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Labels).To(Equal(map[string]string{
+			"cloudfoundry.org/app-guid":         "app",
+			"version":                           "2.0",
+			"io.buildpacks.launch.env.GREETING": "hello",
+		}))
+
+		env, err := imgClient.GetEnvironment(ctx, creds, updatedRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal(map[string]string{"GREETING": "hello"}))
+	})
+
+	It("keeps the layers", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		rawManifest, _, err := imgClient.GetManifest(ctx, creds, updatedRef)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(HaveLen(len(layerDigests)))
+		for i, layer := range manifest.Layers {
+			Expect(layer.Digest).To(Equal(layerDigests[i]))
+		}
+	})
+
+	It("only uploads the config blob and the manifest", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(recorder.recorded(http.MethodPost, "/blobs/uploads/")).To(HaveLen(1))
+		Expect(recorder.recorded(http.MethodPut, "/manifests/sha256:")).To(HaveLen(1))
+		Expect(recorder.recorded(http.MethodPut, "/manifests/v1")).To(HaveLen(1))
+	})
+
+	It("moves the tag to the updated image", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updatedRef).To(Equal(repoRef + "@" + digest))
+		Expect(digest).NotTo(Equal(originalDigest))
+	})
+
+	When("the image is referenced by digest", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + "@" + originalDigest
+		})
+
+		It("keeps the tags", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(updatedRef).NotTo(HaveSuffix(originalDigest))
+
+			digest, err := imgClient.Digest(ctx, creds, repoRef+":v1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(digest).To(Equal(originalDigest))
+		})
+	})
+
+	When("the new config changes the entrypoint", func() {
+		BeforeEach(func() {
+			newConfig.Entrypoint = []string{"/bin/sh"}
+		})
+
+		It("fails with ErrEntrypointChanged without uploading anything", func() {
+			Expect(pushErr).To(MatchError(image.ErrEntrypointChanged))
+			Expect(pushErr).To(MatchError(ContainSubstring("Entrypoint")))
+			Expect(recorder.recorded(http.MethodPost, "/blobs/uploads/")).To(BeEmpty())
+			Expect(recorder.recorded(http.MethodPut, "/manifests/")).To(BeEmpty())
+		})
+
+		When("entrypoint changes are allowed", func() {
+			BeforeEach(func() {
+				clientOpts = append(clientOpts, image.WithAllowEntrypointChange(true))
+			})
+
+			It("replaces the config", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+
+				entrypoint, _, err := imgClient.InspectEntrypoint(ctx, creds, updatedRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entrypoint).To(Equal([]string{"/bin/sh"}))
+			})
+		})
+	})
+
+	When("the new config changes the command", func() {
+		BeforeEach(func() {
+			newConfig.Cmd = []string{"worker"}
+		})
+
+		It("fails with ErrEntrypointChanged", func() {
+			Expect(pushErr).To(MatchError(image.ErrEntrypointChanged))
+			Expect(pushErr).To(MatchError(ContainSubstring("Cmd")))
+		})
+	})
+
+	When("the new config adds a label with a reserved prefix", func() {
+		BeforeEach(func() {
+			newConfig.Labels["cloudfoundry.org/space-guid"] = "space"
+		})
+
+		It("fails with a ValidationError", func() {
+			var validationErr *image.ValidationError
+			Expect(errors.As(pushErr, &validationErr)).To(BeTrue())
+			Expect(validationErr.Keys).To(Equal([]string{"cloudfoundry.org/space-guid"}))
+		})
+	})
+
+	When("a signer is set", func() {
+		BeforeEach(func() {
+			clientOpts = append(clientOpts, image.WithCosignSigner(writeCosignKey()))
+		})
+
+		It("signs the updated image", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			_, err := getCosignSignature(updatedRef)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the image is an index", func() {
+		BeforeEach(func() {
+			index, err := random.Index(64, 1, 2)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(repoRef + ":multi-arch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.WriteIndex(ref, index, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))).To(Succeed())
+
+			imgRef = ref.String()
+		})
+
+		It("fails with ErrNotSupported", func() {
+			Expect(pushErr).To(MatchError(image.ErrNotSupported))
+		})
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + ":not-a-tag"
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(pushErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+})
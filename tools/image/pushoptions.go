@@ -0,0 +1,62 @@
+package image
+
+import (
+	"context"
+	"io"
+	"maps"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// PushOption configures a single PushWithOptions call
+type PushOption func(*pushConfig)
+
+// WithTags tags the pushed image with the given tags in addition to latest
+func WithTags(tags ...string) PushOption {
+	return func(cfg *pushConfig) {
+		cfg.tags = append(cfg.tags, tags...)
+	}
+}
+
+// WithExtraLabels adds the labels to the config of the pushed image. Like
+// with PushWithLabels, labels using a reserved prefix fail the push.
+func WithExtraLabels(labels map[string]string) PushOption {
+	return func(cfg *pushConfig) {
+		if cfg.labels == nil {
+			cfg.labels = map[string]string{}
+		}
+		maps.Copy(cfg.labels, labels)
+	}
+}
+
+// WithAnnotations adds the annotations to the manifest of the pushed image,
+// see PushWithAnnotations
+func WithAnnotations(annotations map[string]string) PushOption {
+	return func(cfg *pushConfig) {
+		if cfg.annotations == nil {
+			cfg.annotations = map[string]string{}
+		}
+		maps.Copy(cfg.annotations, annotations)
+	}
+}
+
+// WithPushPlatform sets the platform of the pushed image. When given more
+// than once an image index with an image for each platform is pushed, like
+// with PushMultiPlatform.
+func WithPushPlatform(os, arch string) PushOption {
+	return func(cfg *pushConfig) {
+		cfg.platforms = append(cfg.platforms, v1.Platform{OS: os, Architecture: arch})
+	}
+}
+
+// PushWithOptions pushes the zip archive like Push, configured by opts. Like
+// the other push methods apart from Push, it does not deduplicate, as the
+// existing image would lack the labels, annotations and platforms of opts.
+func (c Client) PushWithOptions(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, opts ...PushOption) (string, error) {
+	cfg := pushConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return c.push(ctx, creds, repoRef, zipReader, cfg)
+}
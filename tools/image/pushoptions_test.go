@@ -0,0 +1,118 @@
+package image_test
+
+import (
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PushWithOptions", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+		opts    []image.PushOption
+		imgRef  string
+		pushErr error
+	)
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgClient = image.NewClient(k8sClientset)
+		pushRef = containerRegistry.ImageRef("pushoptions/" + uuid.NewString())
+		opts = nil
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.PushWithOptions(ctx, creds, pushRef, zipFile, opts...)
+	})
+
+	It("pushes the image", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.LayerCount).To(Equal(1))
+
+		tags, err := imgClient.ListTags(ctx, creds, pushRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(ConsistOf("latest"))
+	})
+
+	When("options are given", func() {
+		BeforeEach(func() {
+			opts = []image.PushOption{
+				image.WithTags("jim", "bob"),
+				image.WithExtraLabels(map[string]string{"foo": "bar"}),
+				image.WithExtraLabels(map[string]string{"baz": "qux"}),
+				image.WithAnnotations(map[string]string{"org.opencontainers.image.vendor": "Cloud Foundry"}),
+				image.WithPushPlatform("linux", "arm64"),
+			}
+		})
+
+		It("applies them", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			tags, err := imgClient.ListTags(ctx, creds, pushRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tags).To(ConsistOf("latest", "jim", "bob"))
+
+			info, err := imgClient.Inspect(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Labels).To(Equal(map[string]string{"foo": "bar", "baz": "qux"}))
+			Expect(info.Annotations).To(HaveKeyWithValue("org.opencontainers.image.vendor", "Cloud Foundry"))
+			Expect(info.OS).To(Equal("linux"))
+			Expect(info.Architecture).To(Equal("arm64"))
+		})
+	})
+
+	When("several platforms are given", func() {
+		BeforeEach(func() {
+			opts = []image.PushOption{
+				image.WithPushPlatform("linux", "amd64"),
+				image.WithPushPlatform("linux", "arm64"),
+			}
+		})
+
+		It("pushes an image index", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			ref, err := name.ParseReference(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			index, err := remote.Index(ref, remote.WithAuth(&authn.Basic{Username: "user", Password: "password"}))
+			Expect(err).NotTo(HaveOccurred())
+
+			manifest, err := index.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.Manifests).To(HaveLen(2))
+			Expect(manifest.Manifests[0].Platform.Architecture).To(Equal("amd64"))
+			Expect(manifest.Manifests[1].Platform.Architecture).To(Equal("arm64"))
+		})
+	})
+
+	When("a label uses a reserved prefix", func() {
+		BeforeEach(func() {
+			opts = []image.PushOption{
+				image.WithExtraLabels(map[string]string{"cloudfoundry.org/app-guid": "guid"}),
+			}
+		})
+
+		It("fails", func() {
+			var validationErr *image.ValidationError
+			Expect(errors.As(pushErr, &validationErr)).To(BeTrue())
+		})
+	})
+})
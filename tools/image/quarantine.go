@@ -0,0 +1,84 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+type artifactQuarantine struct {
+	Quarantined bool `json:"quarantined"`
+}
+
+// Quarantine marks the image at imageRef as quarantined, e.g. after it failed
+// a vulnerability scan, so that it is no longer run. The artifact is patched
+// through the Harbor style management API set with
+// WithRepositoryManagementAPI. Without a management API, e.g. for ECR which
+// has no quarantine mechanism, it does nothing.
+func (c Client) Quarantine(ctx context.Context, creds Creds, imageRef string) error {
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	if c.repositoryManagementAPI == "" {
+		c.logger.V(1).Info("no repository management API configured, skipping quarantine", "ref", imageRef)
+		return nil
+	}
+	c.logger.V(1).Info("quarantining image", "ref", imageRef)
+
+	resp, err := c.managementAPIRequest(ctx, creds, ref.Context(), http.MethodPatch, artifactPath(ref), artifactQuarantine{Quarantined: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = transport.CheckError(resp, http.StatusOK, http.StatusNoContent); err != nil {
+		return pushError(imageRef, fmt.Errorf("failed to quarantine image: %w", err))
+	}
+
+	return nil
+}
+
+// IsQuarantined reports whether the image at imageRef has been quarantined
+// with Quarantine. Images are never quarantined when no management API is
+// configured.
+func (c Client) IsQuarantined(ctx context.Context, creds Creds, imageRef string) (bool, error) {
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return false, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	if c.repositoryManagementAPI == "" {
+		return false, nil
+	}
+	c.logger.V(1).Info("checking image quarantine", "ref", imageRef)
+
+	resp, err := c.managementAPIRequest(ctx, creds, ref.Context(), http.MethodGet, artifactPath(ref), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err = transport.CheckError(resp, http.StatusOK); err != nil {
+		return false, registryError(imageRef, fmt.Errorf("failed to get artifact: %w", err))
+	}
+
+	quarantine := artifactQuarantine{}
+	if err = json.NewDecoder(resp.Body).Decode(&quarantine); err != nil {
+		return false, fmt.Errorf("failed to decode artifact of %s: %w", imageRef, err)
+	}
+
+	return quarantine.Quarantined, nil
+}
+
+// artifactPath returns the management API path of the artifact ref points
+// to, identified by its tag or digest
+func artifactPath(ref name.Reference) string {
+	return fmt.Sprintf("/repositories/%s/artifacts/%s", url.PathEscape(ref.Context().RepositoryStr()), url.PathEscape(ref.Identifier()))
+}
@@ -0,0 +1,164 @@
+package image_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quarantine", func() {
+	var (
+		mutex       sync.Mutex
+		quarantined map[string]bool
+		apiStatus   int
+		methods     []string
+		creds       image.Creds
+		imgRef      string
+	)
+
+	BeforeEach(func() {
+		quarantined = map[string]bool{}
+		apiStatus = http.StatusOK
+		methods = nil
+
+		managementAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			methods = append(methods, r.Method)
+			username, password, ok := r.BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("password"))
+
+			if apiStatus != http.StatusOK {
+				w.WriteHeader(apiStatus)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodPatch:
+				body := map[string]any{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				Expect(body).To(Equal(map[string]any{"quarantined": true}))
+				quarantined[r.URL.EscapedPath()] = true
+			case http.MethodGet:
+				Expect(json.NewEncoder(w).Encode(map[string]any{
+					"digest":      "sha256:abc",
+					"quarantined": quarantined[r.URL.EscapedPath()],
+				})).To(Succeed())
+			}
+		}))
+		DeferCleanup(managementAPI.Close)
+
+		imgClient = image.NewClient(k8sClientset, image.WithRepositoryManagementAPI(managementAPI.URL+"/api/v2.0"))
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgRef = containerRegistry.ImageRef("quarantine/app") + ":droplet"
+	})
+
+	Describe("Quarantine", func() {
+		var quarantineErr error
+
+		JustBeforeEach(func() {
+			quarantineErr = imgClient.Quarantine(ctx, creds, imgRef)
+		})
+
+		It("patches the artifact", func() {
+			Expect(quarantineErr).NotTo(HaveOccurred())
+			Expect(quarantined).To(Equal(map[string]bool{
+				"/api/v2.0/repositories/quarantine%2Fapp/artifacts/droplet": true,
+			}))
+		})
+
+		It("makes IsQuarantined report the image", func() {
+			Expect(quarantineErr).NotTo(HaveOccurred())
+
+			isQuarantined, err := imgClient.IsQuarantined(ctx, creds, imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(isQuarantined).To(BeTrue())
+		})
+
+		When("the management API fails", func() {
+			BeforeEach(func() {
+				apiStatus = http.StatusInternalServerError
+			})
+
+			It("returns a PushError", func() {
+				var pushErr *image.PushError
+				Expect(errors.As(quarantineErr, &pushErr)).To(BeTrue())
+				Expect(pushErr).To(MatchError(ContainSubstring("failed to quarantine image")))
+			})
+		})
+
+		When("no management API is configured", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset)
+			})
+
+			It("does nothing", func() {
+				Expect(quarantineErr).NotTo(HaveOccurred())
+				Expect(methods).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("IsQuarantined", func() {
+		var (
+			isQuarantined bool
+			checkErr      error
+		)
+
+		JustBeforeEach(func() {
+			isQuarantined, checkErr = imgClient.IsQuarantined(ctx, creds, imgRef)
+		})
+
+		It("returns false for images that are not quarantined", func() {
+			Expect(checkErr).NotTo(HaveOccurred())
+			Expect(isQuarantined).To(BeFalse())
+			Expect(methods).To(Equal([]string{http.MethodGet}))
+		})
+
+		When("the artifact does not exist", func() {
+			BeforeEach(func() {
+				apiStatus = http.StatusNotFound
+			})
+
+			It("returns a NotFoundError", func() {
+				var notFoundErr *image.NotFoundError
+				Expect(errors.As(checkErr, &notFoundErr)).To(BeTrue())
+			})
+		})
+
+		When("no management API is configured", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset)
+			})
+
+			It("returns false", func() {
+				Expect(checkErr).NotTo(HaveOccurred())
+				Expect(isQuarantined).To(BeFalse())
+				Expect(methods).To(BeEmpty())
+			})
+		})
+
+		When("the image ref is invalid", func() {
+			BeforeEach(func() {
+				imgRef = "not a ref"
+			})
+
+			It("fails", func() {
+				Expect(checkErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+})
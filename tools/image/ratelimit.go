@@ -0,0 +1,115 @@
+package image
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// maxRateLimitRetries is how many times a rate limited request is sent
+// again after waiting for the Retry-After duration
+const maxRateLimitRetries = 3
+
+// defaultMaxRateLimitWait is used unless WithMaxRateLimitWait is set
+const defaultMaxRateLimitWait = 2 * time.Minute
+
+// WithRateLimitObserver makes the client call observe with the Retry-After
+// duration whenever a registry rate limits a request, e.g. to count Docker
+// Hub pull limit hits in a metrics system
+func WithRateLimitObserver(observe func(retryAfter time.Duration)) Option {
+	return func(c *Client) {
+		c.rateLimitObserver = observe
+	}
+}
+
+// WithMaxRateLimitWait sets the longest Retry-After duration the client waits
+// for, two minutes by default. Rate limited responses asking to wait longer,
+// e.g. once the Docker Hub pull limit is hit for hours, are returned as they
+// are so that the operation fails instead of blocking its caller.
+func WithMaxRateLimitWait(maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRateLimitWait = maxWait
+	}
+}
+
+// rateLimitTransport waits for the duration of the Retry-After header of 429
+// responses, as Docker Hub sends once its pull limit is hit, and sends the
+// request again, instead of leaving it to the exponential backoff of the
+// retries. Responses without a Retry-After, with one longer than maxWait and
+// to requests whose body cannot be sent again are returned as they are.
+type rateLimitTransport struct {
+	inner   http.RoundTripper
+	logger  logr.Logger
+	observe func(time.Duration)
+	maxWait time.Duration
+}
+
+func newRateLimitTransport(inner http.RoundTripper, logger logr.Logger, observe func(time.Duration), maxWait time.Duration) http.RoundTripper {
+	if maxWait <= 0 {
+		maxWait = defaultMaxRateLimitWait
+	}
+	return rateLimitTransport{inner: inner, logger: logger, observe: observe, maxWait: maxWait}
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retries := 0; ; retries++ {
+		resp, err := t.inner.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || retries == maxRateLimitRetries {
+			return resp, err
+		}
+
+		retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+		if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		if t.observe != nil {
+			t.observe(retryAfter)
+		}
+		if retryAfter > t.maxWait {
+			t.logger.Info("rate limited by the registry for longer than the maximum wait", "host", req.URL.Host, "retryAfter", retryAfter, "maxWait", t.maxWait)
+			return resp, nil
+		}
+
+		t.logger.Info("rate limited by the registry - waiting before retrying", "host", req.URL.Host, "retryAfter", retryAfter)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			retried := req.Clone(req.Context())
+			if retried.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+			req = retried
+		}
+	}
+}
+
+// parseRetryAfter parses a Retry-After header holding either a number of
+// seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,142 @@
+package image_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limits", func() {
+	var (
+		mutex       sync.Mutex
+		rateLimited int
+		retryAfter  string
+		observed    []time.Duration
+		creds       image.Creds
+		imgRef      string
+		configCtx   context.Context
+		configErr   error
+		elapsed     time.Duration
+		maxWait     time.Duration
+	)
+
+	BeforeEach(func() {
+		rateLimited = 0
+		retryAfter = "1"
+		observed = nil
+		creds = image.Creds{Namespace: "default"}
+		configCtx = ctx
+		maxWait = 0
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			limited := r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") && rateLimited > 0
+			if limited {
+				rateLimited--
+			}
+			mutex.Unlock()
+
+			if limited {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, err = image.NewClient(k8sClientset).Push(ctx, creds, serverURL.Host+"/ratelimit/"+uuid.NewString(), zipFile)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, image.WithMaxRateLimitWait(maxWait), image.WithRateLimitObserver(func(d time.Duration) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			observed = append(observed, d)
+		}))
+
+		start := time.Now()
+		_, configErr = imgClient.Config(configCtx, creds, imgRef)
+		elapsed = time.Since(start)
+	})
+
+	It("does not wait when the registry does not rate limit", func() {
+		Expect(configErr).NotTo(HaveOccurred())
+		Expect(observed).To(BeEmpty())
+	})
+
+	When("the registry rate limits a request", func() {
+		BeforeEach(func() {
+			rateLimited = 1
+		})
+
+		It("waits for the Retry-After duration and retries", func() {
+			Expect(configErr).NotTo(HaveOccurred())
+			Expect(elapsed).To(BeNumerically(">=", time.Second))
+			Expect(observed).To(Equal([]time.Duration{time.Second}))
+		})
+
+		When("Retry-After is an HTTP date", func() {
+			BeforeEach(func() {
+				retryAfter = time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+			})
+
+			It("waits until the date", func() {
+				Expect(configErr).NotTo(HaveOccurred())
+				Expect(observed).To(Equal([]time.Duration{0}))
+			})
+		})
+
+		When("Retry-After is longer than the maximum wait", func() {
+			BeforeEach(func() {
+				retryAfter = "60"
+				maxWait = time.Second
+			})
+
+			It("returns the rate limited response without waiting", func() {
+				Expect(configErr).To(MatchError(ContainSubstring("429")))
+				Expect(elapsed).To(BeNumerically("<", 10*time.Second))
+				Expect(observed).To(Equal([]time.Duration{time.Minute}))
+			})
+		})
+
+		When("ctx is done while waiting", func() {
+			BeforeEach(func() {
+				retryAfter = "60"
+
+				var cancel context.CancelFunc
+				configCtx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+				DeferCleanup(cancel)
+			})
+
+			It("stops waiting", func() {
+				Expect(errors.Is(configErr, context.DeadlineExceeded)).To(BeTrue())
+				Expect(elapsed).To(BeNumerically("<", 10*time.Second))
+			})
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	rebasableLabel         = "io.buildpacks.rebasable"
+	lifecycleMetadataLabel = "io.buildpacks.lifecycle.metadata"
+)
+
+// ErrNotRebasable is returned by Rebase when the io.buildpacks.rebasable
+// label of the app image is not set to true
+var ErrNotRebasable = errors.New("image is not rebasable")
+
+// Rebase replaces the stack layers of the droplet image at appImageRef with
+// the layers of the stack image at newStackRef, like the rebaser of the CNB
+// lifecycle does, and pushes the result to appImageRef. The app layers are
+// kept as they are, so nothing is rebuilt. The stack layers of the app image
+// are the layers up to the runImage.topLayer recorded in its
+// io.buildpacks.lifecycle.metadata label, which is updated to point to the
+// new stack. The digest ref of the rebased image is returned.
+func (c Client) Rebase(ctx context.Context, creds Creds, appImageRef, newStackRef string) (string, error) {
+	c.logger.V(1).Info("rebasing image", "ref", appImageRef, "stack", newStackRef)
+	ref, err := c.parseReference(appImageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", appImageRef, err)
+	}
+
+	appImage, err := c.remoteImage(ctx, creds, appImageRef)
+	if err != nil {
+		return "", err
+	}
+
+	appConfig, err := appImage.ConfigFile()
+	if err != nil {
+		return "", fmt.Errorf("error getting image config file: %w", err)
+	}
+	if appConfig.Config.Labels[rebasableLabel] != "true" {
+		return "", fmt.Errorf("%w: %s", ErrNotRebasable, appImageRef)
+	}
+
+	rawMetadata, ok := appConfig.Config.Labels[lifecycleMetadataLabel]
+	if !ok {
+		return "", fmt.Errorf("image %s has no %s label", appImageRef, lifecycleMetadataLabel)
+	}
+	metadata := map[string]any{}
+	if err = json.Unmarshal([]byte(rawMetadata), &metadata); err != nil {
+		return "", fmt.Errorf("failed to unmarshal lifecycle metadata %q: %w", rawMetadata, err)
+	}
+	runImage, _ := metadata["runImage"].(map[string]any)
+	topLayer, _ := runImage["topLayer"].(string)
+	if topLayer == "" {
+		return "", fmt.Errorf("lifecycle metadata of image %s does not record the top layer of its run image", appImageRef)
+	}
+
+	stackTop := -1
+	for i, diffID := range appConfig.RootFS.DiffIDs {
+		if diffID.String() == topLayer {
+			stackTop = i
+		}
+	}
+	if stackTop < 0 {
+		return "", fmt.Errorf("image %s has no layer %s recorded as the top layer of its run image", appImageRef, topLayer)
+	}
+
+	stackRef, err := c.parseReference(newStackRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", newStackRef, err)
+	}
+
+	stackImage, err := c.remoteImage(ctx, creds, newStackRef)
+	if err != nil {
+		return "", err
+	}
+
+	stackConfig, err := stackImage.ConfigFile()
+	if err != nil {
+		return "", fmt.Errorf("error getting image config file: %w", err)
+	}
+	if len(stackConfig.RootFS.DiffIDs) == 0 {
+		return "", fmt.Errorf("stack image %s has no layers", newStackRef)
+	}
+	stackDigest, err := stackImage.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image digest: %w", err)
+	}
+
+	runImage["topLayer"] = stackConfig.RootFS.DiffIDs[len(stackConfig.RootFS.DiffIDs)-1].String()
+	runImage["reference"] = stackRef.Context().Digest(stackDigest.String()).Name()
+	updatedMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal lifecycle metadata: %w", err)
+	}
+
+	rebased, err := rebaseImage(appImage, stackTop, stackImage, string(updatedMetadata))
+	if err != nil {
+		return "", fmt.Errorf("failed to rebase image %s onto %s: %w", appImageRef, newStackRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(appImageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	digest, err := rebased.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get digest of rebased image: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write", func() error {
+		return remote.Write(ref.Context().Digest(digest.String()), rebased, writeOpts...)
+	})
+	if err != nil {
+		return "", pushError(appImageRef, fmt.Errorf("failed to upload rebased image: %w", err))
+	}
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: rebased,
+		digest:   digest,
+		tags:     refTags(ref, nil),
+	}, writeOpts)
+}
+
+// rebaseImage stacks the layers of appImage above stackTop onto the layers
+// of stackImage, keeping the config and media types of appImage and the
+// platform of stackImage, and sets the lifecycle metadata label to metadata
+func rebaseImage(appImage v1.Image, stackTop int, stackImage v1.Image, metadata string) (v1.Image, error) {
+	appConfig, err := appImage.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error getting image config file: %w", err)
+	}
+	stackConfig, err := stackImage.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("error getting stack image config file: %w", err)
+	}
+	if stackConfig.OS != appConfig.OS || stackConfig.Architecture != appConfig.Architecture {
+		return nil, fmt.Errorf("stack platform %s/%s does not match image platform %s/%s",
+			stackConfig.OS, stackConfig.Architecture, appConfig.OS, appConfig.Architecture)
+	}
+
+	appLayers, err := appImage.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image layers: %w", err)
+	}
+	stackLayers, err := stackImage.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stack image layers: %w", err)
+	}
+
+	manifestMediaType, err := appImage.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image media type: %w", err)
+	}
+	appManifest, err := appImage.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("error getting image manifest: %w", err)
+	}
+
+	rebasedConfig := appConfig.DeepCopy()
+	rebasedConfig.Config.Labels[lifecycleMetadataLabel] = metadata
+	rebasedConfig.OSVersion = stackConfig.OSVersion
+	rebasedConfig.Variant = stackConfig.Variant
+	rebasedConfig.RootFS.DiffIDs = nil
+	rebasedConfig.History = nil
+
+	base := mutate.MediaType(mutate.ConfigMediaType(empty.Image, appManifest.Config.MediaType), manifestMediaType)
+	rebased, err := mutate.ConfigFile(base, rebasedConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	rebased, err = mutate.AppendLayers(rebased, append(stackLayers, appLayers[stackTop+1:]...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append layers: %w", err)
+	}
+
+	return rebased, nil
+}
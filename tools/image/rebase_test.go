@@ -0,0 +1,199 @@
+package image_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rebase", func() {
+	var (
+		creds       image.Creds
+		appRef      string
+		newStackRef string
+		oldStack    v1.Image
+		newStack    v1.Image
+		appLayer    v1.Layer
+		labels      map[string]string
+		rebasedRef  string
+		rebaseErr   error
+	)
+
+	auth := remote.WithAuth(&authn.Basic{Username: "user", Password: "password"})
+
+	stackImage := func() v1.Image {
+		GinkgoHelper()
+
+		img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{OS: "linux", Architecture: "amd64"})
+		Expect(err).NotTo(HaveOccurred())
+		for range 2 {
+			var layer v1.Layer
+			layer, err = random.Layer(256, types.DockerLayer)
+			Expect(err).NotTo(HaveOccurred())
+			img, err = mutate.AppendLayers(img, layer)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		return img
+	}
+
+	diffIDs := func(img v1.Image) []v1.Hash {
+		GinkgoHelper()
+
+		configFile, err := img.ConfigFile()
+		Expect(err).NotTo(HaveOccurred())
+		return configFile.RootFS.DiffIDs
+	}
+
+	remoteImage := func(imgRef string) v1.Image {
+		GinkgoHelper()
+
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := remote.Image(ref, auth)
+		Expect(err).NotTo(HaveOccurred())
+		return img
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		appRef = containerRegistry.ImageRef("rebase/" + uuid.NewString())
+		newStackRef = containerRegistry.ImageRef("rebase/" + uuid.NewString())
+
+		oldStack = stackImage()
+		newStack = stackImage()
+		ref, err := name.ParseReference(newStackRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, newStack, auth)).To(Succeed())
+
+		appLayer, err = random.Layer(256, types.DockerLayer)
+		Expect(err).NotTo(HaveOccurred())
+
+		labels = map[string]string{
+			"io.buildpacks.rebasable": "true",
+			"io.buildpacks.lifecycle.metadata": fmt.Sprintf(
+				`{"app": [{"sha": "sha256:abc"}], "runImage": {"topLayer": %q, "reference": "old-stack@sha256:def"}}`,
+				diffIDs(oldStack)[1],
+			),
+			"foo": "bar",
+		}
+	})
+
+	JustBeforeEach(func() {
+		app, err := mutate.AppendLayers(oldStack, appLayer)
+		Expect(err).NotTo(HaveOccurred())
+		app, err = mutate.Config(app, v1.Config{Labels: labels, Entrypoint: []string{"/cnb/lifecycle/launcher"}})
+		Expect(err).NotTo(HaveOccurred())
+		ref, err := name.ParseReference(appRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, app, auth)).To(Succeed())
+
+		rebasedRef, rebaseErr = imgClient.Rebase(ctx, creds, appRef, newStackRef)
+	})
+
+	It("replaces the stack layers and keeps the app layers", func() {
+		Expect(rebaseErr).NotTo(HaveOccurred())
+
+		appLayerDiffID, err := appLayer.DiffID()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diffIDs(remoteImage(rebasedRef))).To(Equal(append(diffIDs(newStack), appLayerDiffID)))
+	})
+
+	It("pushes the rebased image to the app image ref", func() {
+		Expect(rebaseErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, appRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rebasedRef).To(HaveSuffix("@" + digest))
+	})
+
+	It("keeps the app config and points the lifecycle metadata to the new stack", func() {
+		Expect(rebaseErr).NotTo(HaveOccurred())
+
+		configFile, err := remoteImage(rebasedRef).ConfigFile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configFile.Config.Entrypoint).To(Equal([]string{"/cnb/lifecycle/launcher"}))
+		Expect(configFile.Config.Labels).To(HaveKeyWithValue("foo", "bar"))
+
+		metadata := map[string]any{}
+		Expect(json.Unmarshal([]byte(configFile.Config.Labels["io.buildpacks.lifecycle.metadata"]), &metadata)).To(Succeed())
+		stackDigest, err := newStack.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata).To(HaveKeyWithValue("runImage", map[string]any{
+			"topLayer":  diffIDs(newStack)[1].String(),
+			"reference": newStackRef + "@" + stackDigest.String(),
+		}))
+		Expect(metadata).To(HaveKey("app"))
+	})
+
+	When("the image is not rebasable", func() {
+		BeforeEach(func() {
+			labels["io.buildpacks.rebasable"] = "false"
+		})
+
+		It("returns ErrNotRebasable", func() {
+			Expect(errors.Is(rebaseErr, image.ErrNotRebasable)).To(BeTrue())
+		})
+	})
+
+	When("the image has no rebasable label", func() {
+		BeforeEach(func() {
+			delete(labels, "io.buildpacks.rebasable")
+		})
+
+		It("returns ErrNotRebasable", func() {
+			Expect(errors.Is(rebaseErr, image.ErrNotRebasable)).To(BeTrue())
+		})
+	})
+
+	When("the image has no lifecycle metadata", func() {
+		BeforeEach(func() {
+			delete(labels, "io.buildpacks.lifecycle.metadata")
+		})
+
+		It("fails", func() {
+			Expect(rebaseErr).To(MatchError(ContainSubstring("has no io.buildpacks.lifecycle.metadata label")))
+		})
+	})
+
+	When("the top layer of the run image is not a layer of the image", func() {
+		BeforeEach(func() {
+			labels["io.buildpacks.lifecycle.metadata"] = fmt.Sprintf(`{"runImage": {"topLayer": %q}}`, diffIDs(newStack)[1])
+		})
+
+		It("fails", func() {
+			Expect(rebaseErr).To(MatchError(ContainSubstring("recorded as the top layer of its run image")))
+		})
+	})
+
+	When("the new stack is for another platform", func() {
+		BeforeEach(func() {
+			var err error
+			newStack, err = mutate.ConfigFile(newStack, &v1.ConfigFile{OS: "linux", Architecture: "arm64", RootFS: v1.RootFS{Type: "layers", DiffIDs: diffIDs(newStack)}})
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(newStackRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, newStack, auth)).To(Succeed())
+		})
+
+		It("fails", func() {
+			Expect(rebaseErr).To(MatchError(ContainSubstring("stack platform linux/arm64 does not match image platform linux/amd64")))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const defaultMaxDeleteRedirects = 10
+
+// WithMaxDeleteRedirects sets how many redirects a DELETE request follows
+// before failing. Defaults to 10; values below 1 use the default.
+func WithMaxDeleteRedirects(n int) Option {
+	return func(c *Client) {
+		c.maxDeleteRedirects = n
+	}
+}
+
+// deleteRedirectTransport follows redirects of DELETE requests, e.g. from
+// registry proxies answering deletes with a 307. go-containerregistry sends
+// its requests through an http.Client that turns a DELETE redirected with a
+// 301 or 302 into a GET, which succeeds without deleting anything, so the
+// redirects are followed before the client sees them. Like net/http, the
+// Authorization header is only kept for redirects to the same host.
+type deleteRedirectTransport struct {
+	inner        http.RoundTripper
+	maxRedirects int
+}
+
+func newDeleteRedirectTransport(inner http.RoundTripper, maxRedirects int) http.RoundTripper {
+	if maxRedirects < 1 {
+		maxRedirects = defaultMaxDeleteRedirects
+	}
+
+	return deleteRedirectTransport{inner: inner, maxRedirects: maxRedirects}
+}
+
+func (t deleteRedirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodDelete {
+		return t.inner.RoundTrip(req)
+	}
+
+	for redirects := 0; ; redirects++ {
+		resp, err := t.inner.RoundTrip(req)
+		if err != nil || !isRedirect(resp.StatusCode) {
+			return resp, err
+		}
+
+		location, err := resp.Location()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow %d redirect of DELETE %s: %w", resp.StatusCode, req.URL.Redacted(), err)
+		}
+
+		if redirects == t.maxRedirects {
+			return nil, fmt.Errorf("DELETE %s stopped after %d redirects", location.Redacted(), t.maxRedirects)
+		}
+
+		if req, err = redirectedRequest(req, location.String()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// redirectedRequest returns a copy of req with the same method, headers and
+// body sent to location
+func redirectedRequest(req *http.Request, location string) (*http.Request, error) {
+	redirected := req.Clone(req.Context())
+	url, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redirect location %s: %w", location, err)
+	}
+	redirected.URL = url
+	redirected.Host = ""
+
+	if req.GetBody != nil {
+		if redirected.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to rewind DELETE request body: %w", err)
+		}
+	}
+
+	if url.Host != req.URL.Host {
+		redirected.Header.Del("Authorization")
+	}
+
+	return redirected, nil
+}
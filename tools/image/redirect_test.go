@@ -0,0 +1,118 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delete redirects", func() {
+	var (
+		mutex          sync.Mutex
+		redirectStatus int
+		redirects      int
+		deleteMethods  []string
+		clientOpts     []image.Option
+		creds          image.Creds
+		imgRef         string
+		deleteErr      error
+	)
+
+	BeforeEach(func() {
+		redirectStatus = http.StatusTemporaryRedirect
+		redirects = 1
+		deleteMethods = nil
+		clientOpts = nil
+		creds = image.Creds{Namespace: "default"}
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hop, _ := strconv.Atoi(r.URL.Query().Get("hop"))
+			if r.Method == http.MethodDelete && hop < redirects {
+				query := url.Values{"hop": {strconv.Itoa(hop + 1)}}
+				http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), redirectStatus)
+				return
+			}
+
+			if r.URL.Query().Has("hop") {
+				mutex.Lock()
+				deleteMethods = append(deleteMethods, r.Method)
+				mutex.Unlock()
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, err = image.NewClient(k8sClientset).Push(ctx, creds, serverURL.Host+"/redirect/"+uuid.NewString(), zipFile, "latest")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, clientOpts...)
+		deleteErr = imgClient.Delete(ctx, creds, imgRef)
+	})
+
+	It("follows the redirect with a DELETE", func() {
+		Expect(deleteErr).NotTo(HaveOccurred())
+		Expect(deleteMethods).To(HaveEach(http.MethodDelete))
+		Expect(deleteMethods).NotTo(BeEmpty())
+
+		_, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+	})
+
+	When("the registry redirects with a 301", func() {
+		BeforeEach(func() {
+			redirectStatus = http.StatusMovedPermanently
+		})
+
+		It("still deletes the image", func() {
+			Expect(deleteErr).NotTo(HaveOccurred())
+			Expect(deleteMethods).To(HaveEach(http.MethodDelete))
+
+			_, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+		})
+	})
+
+	When("the registry redirects several times", func() {
+		BeforeEach(func() {
+			redirects = 3
+		})
+
+		It("follows all the redirects", func() {
+			Expect(deleteErr).NotTo(HaveOccurred())
+
+			_, err := imgClient.Config(ctx, creds, imgRef)
+			Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+		})
+
+		When("there are more redirects than allowed", func() {
+			BeforeEach(func() {
+				clientOpts = []image.Option{image.WithMaxDeleteRedirects(2)}
+			})
+
+			It("fails", func() {
+				Expect(deleteErr).To(MatchError(ContainSubstring("stopped after 2 redirects")))
+				Expect(deleteMethods).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// WithRegistryMirrors makes the client use mirror registries instead of the
+// upstream ones, e.g. the internal pull-through caches of air-gapped
+// clusters. The keys of mirrors are upstream registry hosts (including the
+// port, if any), docker.io standing for Docker Hub, and the values the
+// hosts of their mirrors, optionally followed by a path the repositories
+// are nested under. Only reads of images and tags, e.g. Config, Pull,
+// Inspect and ListTags, go to the mirror, and the refs they return keep
+// the upstream registry. Pushes, tags, deletes, labels and every other write
+// go to the upstream registry, as do registry-wide operations such as
+// ListRepositories. The credentials for the mirror are used when creds have
+// some, the ones for the upstream registry otherwise. Mirrors must implement
+// the OCI distribution spec.
+func WithRegistryMirrors(mirrors map[string]string) Option {
+	return func(c *Client) {
+		c.registryMirrors = map[string]string{}
+		for upstream, mirror := range mirrors {
+			if registry, err := name.NewRegistry(upstream); err == nil {
+				upstream = registry.RegistryStr()
+			}
+			c.registryMirrors[upstream] = strings.TrimSuffix(mirror, "/")
+		}
+	}
+}
+
+// readReference returns the ref to read the image at ref from, i.e. the one
+// on its mirror when its registry is mirrored
+func (c Client) readReference(ref name.Reference) (name.Reference, error) {
+	mirror, ok := c.registryMirrors[ref.Context().RegistryStr()]
+	if !ok {
+		return ref, nil
+	}
+
+	separator := ":"
+	if _, isDigest := ref.(name.Digest); isDigest {
+		separator = "@"
+	}
+
+	mirrored := mirror + "/" + ref.Context().RepositoryStr() + separator + ref.Identifier()
+	c.logger.V(1).Info("using registry mirror", "ref", ref.Name(), "mirrored", mirrored)
+	return c.parseReference(mirrored)
+}
+
+// readRepository returns the repository to read the tags of repo from, i.e.
+// the one on its mirror when its registry is mirrored
+func (c Client) readRepository(repo name.Repository) (name.Repository, error) {
+	mirror, ok := c.registryMirrors[repo.RegistryStr()]
+	if !ok {
+		return repo, nil
+	}
+
+	mirrored := mirror + "/" + repo.RepositoryStr()
+	c.logger.V(1).Info("using registry mirror", "repo", repo.Name(), "mirrored", mirrored)
+	return c.parseRepository(mirrored)
+}
+
+// parseReadReference parses imageRef into the ref to read the image from
+func (c Client) parseReadReference(imageRef string) (name.Reference, error) {
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.readReference(ref)
+}
+
+// parseReadRepository parses repoRef into the repository to read the tags
+// from
+func (c Client) parseReadRepository(repoRef string) (name.Repository, error) {
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return name.Repository{}, err
+	}
+
+	return c.readRepository(repo)
+}
+
+// mirrorKeychain resolves the credentials for mirror registries from the
+// credentials for their upstream registries when there are none for the
+// mirror itself
+type mirrorKeychain struct {
+	keychain authn.Keychain
+	// upstreams are the upstream registry hosts of each mirror host, sorted
+	upstreams map[string][]string
+}
+
+func (c Client) withMirrorCredentials(keychain authn.Keychain) authn.Keychain {
+	if len(c.registryMirrors) == 0 {
+		return keychain
+	}
+
+	upstreams := map[string][]string{}
+	for upstream, mirror := range c.registryMirrors {
+		host, _, _ := strings.Cut(mirror, "/")
+		upstreams[host] = append(upstreams[host], upstream)
+	}
+	for _, hosts := range upstreams {
+		sort.Strings(hosts)
+	}
+
+	return mirrorKeychain{keychain: keychain, upstreams: upstreams}
+}
+
+func (k mirrorKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	auth, err := k.keychain.Resolve(target)
+	if err != nil || auth != authn.Anonymous {
+		return auth, err
+	}
+
+	for _, upstream := range k.upstreams[target.RegistryStr()] {
+		registry, err := name.NewRegistry(upstream)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing registry %s: %w", upstream, err)
+		}
+
+		auth, err = k.keychain.Resolve(registry)
+		if err != nil || auth != authn.Anonymous {
+			return auth, err
+		}
+	}
+
+	return authn.Anonymous, nil
+}
@@ -0,0 +1,145 @@
+package image_test
+
+import (
+	"errors"
+	"net/url"
+
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithRegistryMirrors", func() {
+	const upstreamHost = "upstream.registry.invalid"
+
+	var (
+		mirrorHost string
+		mirrors    map[string]string
+		creds      image.Creds
+		repo       string
+		imgRef     string
+		config     image.Config
+		configErr  error
+	)
+
+	BeforeEach(func() {
+		registryURL, err := url.Parse(containerRegistry.URL())
+		Expect(err).NotTo(HaveOccurred())
+		mirrorHost = registryURL.Host
+
+		mirrors = map[string]string{upstreamHost: mirrorHost}
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repo = "mirrors/" + uuid.NewString()
+		imgRef = upstreamHost + "/" + repo + ":latest"
+	})
+
+	JustBeforeEach(func() {
+		containerRegistry.PushImage(containerRegistry.ImageRef(repo), &v1.ConfigFile{
+			Config: v1.Config{Labels: map[string]string{"mirrored": "yes"}},
+		})
+
+		imgClient = image.NewClient(k8sClientset, image.WithRegistryMirrors(mirrors))
+		config, configErr = imgClient.Config(ctx, creds, imgRef)
+	})
+
+	It("reads the image from the mirror", func() {
+		Expect(configErr).NotTo(HaveOccurred())
+		Expect(config.Labels).To(HaveKeyWithValue("mirrored", "yes"))
+	})
+
+	It("uses the mirror for the other reads too", func() {
+		tags, err := imgClient.ListTags(ctx, creds, upstreamHost+"/"+repo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(ConsistOf("latest"))
+
+		digestRef, err := imgClient.ResolveTag(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digestRef).To(HavePrefix(upstreamHost + "/" + repo + "@sha256:"))
+	})
+
+	It("writes to the upstream registry", func() {
+		upstreamRef := containerRegistry.ImageRef(repo) + ":latest"
+		writingClient := image.NewClient(k8sClientset, image.WithRegistryMirrors(map[string]string{
+			mirrorHost: "mirror.registry.invalid",
+		}))
+		Expect(writingClient.Tag(ctx, creds, upstreamRef, "written")).To(Succeed())
+
+		tags, err := image.NewClient(k8sClientset).ListTags(ctx, creds, containerRegistry.ImageRef(repo))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(ConsistOf("latest", "written"))
+	})
+
+	When("the mirror nests the repositories under a path", func() {
+		BeforeEach(func() {
+			mirrors = map[string]string{upstreamHost: mirrorHost + "/cache/"}
+			imgRef = upstreamHost + "/" + repo + ":latest"
+			repo = "cache/" + repo
+		})
+
+		It("reads the image from the path", func() {
+			Expect(configErr).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("mirrored", "yes"))
+		})
+	})
+
+	When("Docker Hub is mirrored", func() {
+		BeforeEach(func() {
+			mirrors = map[string]string{"docker.io": mirrorHost}
+			name := "mirrored-" + uuid.NewString()
+			imgRef = name + ":latest"
+			repo = "library/" + name
+		})
+
+		It("reads Docker Hub images from the mirror", func() {
+			Expect(configErr).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("mirrored", "yes"))
+		})
+	})
+
+	When("there are only credentials for the upstream registry", func() {
+		BeforeEach(func() {
+			upstreamSecret, err := dockercfg.CreateDockerConfigSecret("default", uuid.NewString(), dockercfg.DockerServerConfig{
+				Server:   upstreamHost,
+				Username: "user",
+				Password: "password",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, upstreamSecret)).To(Succeed())
+			creds.SecretNames = []string{upstreamSecret.Name}
+		})
+
+		It("authenticates to the mirror with them", func() {
+			Expect(configErr).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("mirrored", "yes"))
+		})
+	})
+
+	When("there are no credentials for either registry", func() {
+		BeforeEach(func() {
+			creds = image.Creds{Namespace: "default"}
+		})
+
+		It("fails with an AuthError", func() {
+			var authErr *image.AuthError
+			Expect(errors.As(configErr, &authErr)).To(BeTrue())
+		})
+	})
+
+	When("the registry is not mirrored", func() {
+		BeforeEach(func() {
+			imgRef = containerRegistry.ImageRef(repo) + ":latest"
+			mirrors = map[string]string{upstreamHost: "mirror.registry.invalid"}
+		})
+
+		It("reads the image from the registry", func() {
+			Expect(configErr).NotTo(HaveOccurred())
+			Expect(config.Labels).To(HaveKeyWithValue("mirrored", "yes"))
+		})
+	})
+})
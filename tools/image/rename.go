@@ -0,0 +1,175 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RenameRepository copies every tag of srcRepo to dstRepo and then deletes
+// srcRepo, e.g. when the space owning the repository is renamed. Blobs are
+// mounted rather than uploaded again when both repositories are in the same
+// registry. Like every manifest the client writes, each copied image is
+// scanned and signed before it is tagged in dstRepo. The digest copied for
+// each tag is recorded in a ConfigMap in srcCreds.Namespace, so that calling
+// RenameRepository again after a failure only copies the tags that were not
+// copied yet or have changed since. The ConfigMap is deleted once srcRepo is.
+func (c Client) RenameRepository(ctx context.Context, srcCreds Creds, srcRepo string, dstCreds Creds, dstRepo string) (err error) {
+	ctx, endSpan := c.startSpan(ctx, "RenameRepository", srcRepo)
+	defer endSpan(&err)
+
+	c.logger.V(1).Info("renaming repository", "src", srcRepo, "dst", dstRepo)
+	if srcCreds.Namespace == "" {
+		return errors.New("a namespace is required to record the rename progress")
+	}
+
+	src, err := c.parseRepository(srcRepo)
+	if err != nil {
+		return fmt.Errorf("error parsing source repository reference %s: %w", srcRepo, err)
+	}
+
+	dst, err := c.parseRepository(dstRepo)
+	if err != nil {
+		return fmt.Errorf("error parsing destination repository reference %s: %w", dstRepo, err)
+	}
+
+	srcOpts, err := c.remoteOpts(ctx, srcCreds)
+	if err != nil {
+		return authError(srcRepo, fmt.Errorf("error creating source keychain: %w", err))
+	}
+
+	dstOpts, err := c.remoteOpts(ctx, dstCreds)
+	if err != nil {
+		return authError(dstRepo, fmt.Errorf("error creating destination keychain: %w", err))
+	}
+
+	progress, err := c.loadRenameProgress(ctx, srcCreds.Namespace, renameProgressName(srcRepo, dstRepo))
+	if err != nil {
+		return err
+	}
+
+	tags, err := remote.List(src, srcOpts...)
+	if err = ignoreNotFound(err); err != nil {
+		return registryError(srcRepo, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	writeOpts := append(dstOpts, c.remoteRetryOpts()...)
+	for _, tag := range tags {
+		if err = c.renameTag(ctx, progress, src.Tag(tag), dstCreds, dst.Tag(tag), srcOpts, writeOpts); err != nil {
+			return err
+		}
+	}
+
+	if err = c.DeleteRepository(ctx, srcCreds, srcRepo); err != nil {
+		return fmt.Errorf("failed to delete source repository: %w", err)
+	}
+
+	return progress.delete(ctx)
+}
+
+func (c Client) renameTag(ctx context.Context, progress *renameProgress, srcTag name.Tag, dstCreds Creds, dstTag name.Tag, srcOpts, writeOpts []remote.Option) error {
+	descriptor, err := remote.Get(srcTag, srcOpts...)
+	if err != nil {
+		return registryError(srcTag.String(), fmt.Errorf("failed to get source image: %w", err))
+	}
+
+	if progress.copied(srcTag.TagStr()) == descriptor.Digest.String() {
+		c.logger.V(1).Info("tag already copied, skipping", "tag", srcTag, "digest", descriptor.Digest)
+		return nil
+	}
+
+	srcArtifact, err := descriptorArtifact(descriptor)
+	if err != nil {
+		return registryError(srcTag.String(), fmt.Errorf("failed to read source image: %w", err))
+	}
+
+	err = c.retryOnError("copy", func() error {
+		return writeArtifact(dstTag.Context().Digest(descriptor.Digest.String()), srcArtifact, writeOpts...)
+	})
+	if err != nil {
+		return pushError(dstTag.String(), fmt.Errorf("failed to write destination image: %w", err))
+	}
+
+	_, err = c.finishWrite(ctx, dstCreds, nil, writtenManifest{
+		repo:     dstTag.Context(),
+		manifest: srcArtifact,
+		digest:   descriptor.Digest,
+		tags:     refTags(dstTag, nil),
+	}, writeOpts)
+	if err != nil {
+		return err
+	}
+
+	return progress.record(ctx, srcTag.TagStr(), descriptor.Digest.String())
+}
+
+// renameProgressName hashes the repository refs as they are not valid
+// object names
+func renameProgressName(srcRepo, dstRepo string) string {
+	sum := sha256.Sum256([]byte(srcRepo + " " + dstRepo))
+	return "korifi-image-rename-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// renameProgress maps the tags copied so far to the digest they were copied
+// at
+type renameProgress struct {
+	client    Client
+	configMap *corev1.ConfigMap
+}
+
+func (c Client) loadRenameProgress(ctx context.Context, namespace, name string) (*renameProgress, error) {
+	configMaps := c.k8sClient.CoreV1().ConfigMaps(namespace)
+
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rename progress from config map %s/%s: %w", namespace, name, err)
+	}
+
+	if len(configMap.Data) > 0 {
+		c.logger.Info("resuming repository rename", "configMap", name, "copiedTags", len(configMap.Data))
+	}
+
+	return &renameProgress{client: c, configMap: configMap}, nil
+}
+
+func (p *renameProgress) copied(tag string) string {
+	return p.configMap.Data[tag]
+}
+
+func (p *renameProgress) record(ctx context.Context, tag, digest string) error {
+	configMap := p.configMap.DeepCopy()
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[tag] = digest
+
+	updated, err := p.client.k8sClient.CoreV1().ConfigMaps(configMap.Namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to record rename progress in config map %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+
+	p.configMap = updated
+	return nil
+}
+
+func (p *renameProgress) delete(ctx context.Context) error {
+	err := p.client.k8sClient.CoreV1().ConfigMaps(p.configMap.Namespace).Delete(ctx, p.configMap.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete rename progress config map %s/%s: %w", p.configMap.Namespace, p.configMap.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("RenameRepository", func() {
+	var (
+		mutex        sync.Mutex
+		manifestPuts []string
+		failingTag   string
+		creds        image.Creds
+		srcRepo      string
+		dstRepo      string
+		digests      map[string]string
+		renameErr    error
+		registryHost string
+	)
+
+	progressConfigMaps := func() []string {
+		GinkgoHelper()
+
+		configMaps, err := k8sClientset.CoreV1().ConfigMaps(creds.Namespace).List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, configMap := range configMaps.Items {
+			names = append(names, configMap.Name)
+		}
+		return names
+	}
+
+	recordedPuts := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return manifestPuts
+	}
+
+	pushTagged := func(fixture string, tags ...string) string {
+		GinkgoHelper()
+
+		zipFile, err := os.Open(fixture)
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		digestRef, err := imgClient.Push(ctx, creds, srcRepo, zipFile, tags...)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(digestRef, "@")[1]
+	}
+
+	BeforeEach(func() {
+		manifestPuts = nil
+		failingTag = ""
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/spaces/new-") && strings.Contains(r.URL.Path, "/manifests/") {
+				mutex.Lock()
+				manifestPuts = append(manifestPuts, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+				fail := failingTag != "" && strings.HasSuffix(r.URL.Path, "/manifests/"+failingTag)
+				mutex.Unlock()
+
+				if fail {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		registryHost = serverURL.Host
+
+		namespace, err := k8sClientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: uuid.NewString()},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{Namespace: namespace.Name}
+		srcRepo = registryHost + "/spaces/old-" + uuid.NewString()
+		dstRepo = registryHost + "/spaces/new-" + uuid.NewString()
+
+		digests = map[string]string{
+			"a": pushTagged("fixtures/layer.zip", "a"),
+			"b": pushTagged("fixtures/anotherLayer.zip", "b"),
+		}
+	})
+
+	JustBeforeEach(func() {
+		renameErr = imgClient.RenameRepository(ctx, creds, srcRepo, creds, dstRepo)
+	})
+
+	It("moves the tags to the destination repository", func() {
+		Expect(renameErr).NotTo(HaveOccurred())
+
+		for tag, digest := range digests {
+			dstDigest, err := imgClient.Digest(ctx, creds, dstRepo+":"+tag)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dstDigest).To(Equal(digest))
+
+			exists, err := imgClient.Exists(ctx, creds, srcRepo+":"+tag)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		}
+	})
+
+	It("deletes the progress config map", func() {
+		Expect(renameErr).NotTo(HaveOccurred())
+		Expect(progressConfigMaps()).To(BeEmpty())
+	})
+
+	When("copying a tag fails", func() {
+		BeforeEach(func() {
+			failingTag = "b"
+		})
+
+		It("fails", func() {
+			Expect(renameErr).To(MatchError(ContainSubstring("failed to tag image")))
+		})
+
+		It("records the copied tags", func() {
+			Expect(progressConfigMaps()).To(HaveLen(1))
+		})
+
+		It("keeps the source repository", func() {
+			exists, err := imgClient.Exists(ctx, creds, srcRepo+":b")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+		})
+
+		When("the rename is retried", func() {
+			var putsBeforeRetry int
+
+			JustBeforeEach(func() {
+				mutex.Lock()
+				failingTag = ""
+				putsBeforeRetry = len(manifestPuts)
+				mutex.Unlock()
+
+				renameErr = imgClient.RenameRepository(ctx, creds, srcRepo, creds, dstRepo)
+			})
+
+			It("only copies the tags that were not copied", func() {
+				Expect(renameErr).NotTo(HaveOccurred())
+				Expect(recordedPuts()[putsBeforeRetry:]).To(ConsistOf("b", "latest"))
+
+				dstDigest, err := imgClient.Digest(ctx, creds, dstRepo+":b")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dstDigest).To(Equal(digests["b"]))
+			})
+
+			It("deletes the progress config map", func() {
+				Expect(renameErr).NotTo(HaveOccurred())
+				Expect(progressConfigMaps()).To(BeEmpty())
+			})
+		})
+	})
+
+	When("the source repository does not exist", func() {
+		BeforeEach(func() {
+			srcRepo = registryHost + "/spaces/missing-" + uuid.NewString()
+		})
+
+		It("succeeds", func() {
+			Expect(renameErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("no namespace is given", func() {
+		BeforeEach(func() {
+			creds = image.Creds{}
+		})
+
+		It("fails", func() {
+			Expect(renameErr).To(MatchError(ContainSubstring("a namespace is required")))
+		})
+	})
+})
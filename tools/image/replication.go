@@ -0,0 +1,116 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const defaultReplicationPollInterval = 5 * time.Second
+
+// WaitForReplication polls the registries, e.g. the regional replicas of a
+// registry the image was mirrored to, until all of them serve imageRef. The
+// image is looked up at the same repository and tag or digest in every
+// registry (host[:port]), with a HEAD request per registry in parallel every
+// pollInterval (5s when not positive). Registries which already have the
+// image are not polled again. The context error is returned if ctx is done
+// before the image is available everywhere, including while the credentials
+// are still being read.
+func (c Client) WaitForReplication(ctx context.Context, creds Creds, imageRef string, registries []string, pollInterval time.Duration) error {
+	c.logger.V(1).Info("waiting for replication", "ref", imageRef, "registries", registries)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	pending := map[string]name.Reference{}
+	for _, registry := range registries {
+		replica, replicaErr := c.replicaReference(ref, registry)
+		if replicaErr != nil {
+			return fmt.Errorf("error parsing replica reference in registry %s: %w", registry, replicaErr)
+		}
+		pending[registry] = replica
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("image %s not replicated to %v: %w", imageRef, sortedKeys(pending), ctx.Err())
+		}
+		return authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	if pollInterval <= 0 {
+		pollInterval = defaultReplicationPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, registry := range c.pollReplicas(pending, remoteOpts) {
+			delete(pending, registry)
+		}
+
+		if len(pending) == 0 {
+			c.logger.Info("image replicated", "ref", imageRef, "registries", len(registries))
+			return nil
+		}
+		c.logger.Info("waiting for replication", "ref", imageRef, "replicated", len(registries)-len(pending), "pending", sortedKeys(pending))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("image %s not replicated to %v: %w", imageRef, sortedKeys(pending), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollReplicas returns the registries of pending which serve their replica
+func (c Client) pollReplicas(pending map[string]name.Reference, remoteOpts []remote.Option) []string {
+	var mutex sync.Mutex
+	replicated := []string{}
+
+	var wg sync.WaitGroup
+	for registry, replica := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := remote.Head(replica, remoteOpts...); err != nil {
+				c.logger.V(1).Info("image not replicated yet", "ref", replica.String(), "reason", err)
+				return
+			}
+
+			mutex.Lock()
+			replicated = append(replicated, registry)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return replicated
+}
+
+// replicaReference returns ref with its registry replaced by registry
+func (c Client) replicaReference(ref name.Reference, registry string) (name.Reference, error) {
+	separator := ":"
+	if _, isDigest := ref.(name.Digest); isDigest {
+		separator = "@"
+	}
+
+	return c.parseReference(fmt.Sprintf("%s/%s%s%s", registry, ref.Context().RepositoryStr(), separator, ref.Identifier()))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,118 @@
+package image_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WaitForReplication", func() {
+	var (
+		creds       image.Creds
+		replica     *oci.Registry
+		imageConfig *v1.ConfigFile
+		imageRef    string
+		registries  []string
+		waitCtx     context.Context
+		waitErr     chan error
+	)
+
+	registryHost := func(r *oci.Registry) string {
+		serverURL, err := url.Parse(r.URL())
+		Expect(err).NotTo(HaveOccurred())
+		return serverURL.Host
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		imageConfig = &v1.ConfigFile{
+			Config: v1.Config{
+				Labels: map[string]string{"replicated": "true"},
+			},
+		}
+		imageRef = containerRegistry.ImageRef("replication/app:v1")
+		containerRegistry.PushImage(imageRef, imageConfig)
+
+		replica = oci.NewNoAuthContainerRegistry()
+		registries = []string{registryHost(containerRegistry), registryHost(replica)}
+
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		DeferCleanup(cancel)
+	})
+
+	JustBeforeEach(func() {
+		waitErr = make(chan error, 1)
+		go func() {
+			waitErr <- imgClient.WaitForReplication(waitCtx, creds, imageRef, registries, 20*time.Millisecond)
+		}()
+	})
+
+	It("waits until every registry has the image", func() {
+		Consistently(waitErr, 200*time.Millisecond).ShouldNot(Receive())
+
+		replica.PushImage(replica.ImageRef("replication/app:v1"), imageConfig)
+		Eventually(waitErr).Should(Receive(BeNil()))
+	})
+
+	When("the image is referenced by digest", func() {
+		BeforeEach(func() {
+			digest, err := imgClient.Digest(ctx, creds, imageRef)
+			Expect(err).NotTo(HaveOccurred())
+			imageRef = containerRegistry.ImageRef("replication/app@" + digest)
+
+			replica.PushImage(replica.ImageRef("replication/app:v1"), imageConfig)
+		})
+
+		It("looks up the digest in every registry", func() {
+			Eventually(waitErr).Should(Receive(BeNil()))
+		})
+	})
+
+	When("the image never reaches a registry", func() {
+		BeforeEach(func() {
+			var cancel context.CancelFunc
+			waitCtx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+			DeferCleanup(cancel)
+		})
+
+		It("returns the context error", func() {
+			var err error
+			Eventually(waitErr).Should(Receive(&err))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring(registryHost(replica))))
+		})
+	})
+
+	When("there are no registries", func() {
+		BeforeEach(func() {
+			registries = nil
+		})
+
+		It("returns immediately", func() {
+			Eventually(waitErr).Should(Receive(BeNil()))
+		})
+	})
+
+	When("a registry is invalid", func() {
+		BeforeEach(func() {
+			registries = append(registries, "not a registry")
+		})
+
+		It("fails", func() {
+			Eventually(waitErr).Should(Receive(MatchError(ContainSubstring("error parsing replica reference"))))
+		})
+	})
+})
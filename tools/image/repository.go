@@ -0,0 +1,220 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/go-multierror"
+)
+
+// RepositoryConfig configures a repository created with CreateRepository
+type RepositoryConfig struct {
+	Public      bool   `json:"public"`
+	Description string `json:"description,omitempty"`
+	// StorageLimit is the quota of the repository in bytes, 0 for no limit
+	StorageLimit int64 `json:"storageLimit,omitempty"`
+}
+
+// WithRepositoryManagementAPI sets the base URL of the REST management API
+// of the registry, e.g. https://harbor.example.com/api/v2.0. It is used by
+// CreateRepository for registries that need repositories to be created
+// before images can be pushed to them, such as Harbor or Artifactory, and by
+// Quarantine and IsQuarantined.
+func WithRepositoryManagementAPI(baseURL string) Option {
+	return func(c *Client) {
+		c.repositoryManagementAPI = baseURL
+	}
+}
+
+// CreateRepository creates the repository by posting its name and config to
+// the repositories endpoint of the management API set with
+// WithRepositoryManagementAPI, authenticating with the registry credentials.
+// A repository that already exists is not an error. Without a management
+// API, e.g. for registries that create repositories on the first push, it
+// does nothing.
+func (c Client) CreateRepository(ctx context.Context, creds Creds, repoRef string, config RepositoryConfig) error {
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	if c.repositoryManagementAPI == "" {
+		c.logger.V(1).Info("no repository management API configured, skipping repository creation", "repo", repoRef)
+		return nil
+	}
+	c.logger.V(1).Info("creating repository", "repo", repoRef)
+
+	resp, err := c.managementAPIRequest(ctx, creds, repo, http.MethodPost, "/repositories", struct {
+		Name string `json:"name"`
+		RepositoryConfig
+	}{
+		Name:             repo.RepositoryStr(),
+		RepositoryConfig: config,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		c.logger.V(1).Info("repository already exists", "repo", repoRef)
+		return nil
+	}
+
+	if err = transport.CheckError(resp, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return pushError(repoRef, fmt.Errorf("failed to create repository: %w", err))
+	}
+
+	return nil
+}
+
+// DeleteRepository deletes every tag and manifest in the repository. Failures
+// are aggregated so that a partial deletion reports everything that could not
+// be removed.
+func (c Client) DeleteRepository(ctx context.Context, creds Creds, repoRef string) error {
+	c.logger.V(1).Info("deleting repository", "repo", repoRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	tags, err := remote.List(repo, remoteOpts...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	var deleteErr *multierror.Error
+	digests := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		descriptor, err := remote.Head(repo.Tag(tag), remoteOpts...)
+		if err != nil {
+			deleteErr = multierror.Append(deleteErr, registryError(repoRef, fmt.Errorf("failed to resolve tag %q: %w", tag, err)))
+			continue
+		}
+
+		if !seen[descriptor.Digest.String()] {
+			seen[descriptor.Digest.String()] = true
+			digests = append(digests, descriptor.Digest.String())
+		}
+	}
+
+	deleteErr = multierror.Append(deleteErr, c.deleteManifests(repo, tags, digests, remoteOpts))
+
+	return deleteErr.ErrorOrNil()
+}
+
+// ListRepositories lists all repositories in the registry the credentials
+// can see, following the pagination links of the /v2/_catalog endpoint. Some
+// hosted registries (e.g. DockerHub) do not implement the catalog and return
+// an error.
+func (c Client) ListRepositories(ctx context.Context, creds Creds, registryHost string) ([]string, error) {
+	c.logger.V(1).Info("listing repositories", "registry", registryHost)
+	registry, err := c.parseRegistry(registryHost)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing registry %s: %w", registryHost, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(registryHost, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	repos, err := remote.Catalog(ctx, registry, remoteOpts...)
+	if err != nil {
+		return nil, registryError(registryHost, fmt.Errorf("failed to list repositories: %w", err))
+	}
+
+	return repos, nil
+}
+
+// deleteManifests removes the tags and then the manifests with the given
+// digests. Manifests that have already gone are not reported as errors.
+func (c Client) deleteManifests(repo name.Repository, tags []string, digests []string, remoteOpts []remote.Option) error {
+	var manifestsErr *multierror.Error
+
+	// Some registries refuse to delete manifests that are still tagged, so
+	// untag first. Registries that do not support deleting tags drop them
+	// together with the manifest.
+	for _, tag := range tags {
+		if err := remote.Delete(repo.Tag(tag), remoteOpts...); err != nil && !isNotFound(err) {
+			c.logger.V(1).Info("failed to delete tag - continuing", "tag", tag, "reason", err)
+		}
+	}
+
+	for _, digest := range digests {
+		c.logger.V(1).Info("deleting manifest", "digest", digest)
+		if err := remote.Delete(repo.Digest(digest), remoteOpts...); err != nil && !isNotFound(err) {
+			manifestsErr = multierror.Append(manifestsErr, registryError(repo.String(), fmt.Errorf("failed to delete manifest %s: %w", digest, err)))
+		}
+	}
+
+	return manifestsErr.ErrorOrNil()
+}
+
+// managementAPIRequest sends the JSON encoded body, unless nil, to the path
+// under the management API, authenticating with the registry credentials
+// for repo
+func (c Client) managementAPIRequest(ctx context.Context, creds Creds, repo name.Repository, method, path string, body any) (*http.Response, error) {
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return nil, authError(repo.String(), fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	auth, err := keychain.Resolve(repo)
+	if err != nil {
+		return nil, authError(repo.String(), fmt.Errorf("failed to resolve credentials from %s: %w", credsSource(creds), err))
+	}
+
+	authConfig, err := auth.Authorization()
+	if err != nil {
+		return nil, authError(repo.String(), fmt.Errorf("failed to get credentials: %w", err))
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		rawBody, marshalErr := json.Marshal(body)
+		if marshalErr != nil {
+			return nil, fmt.Errorf("failed to marshal management API request: %w", marshalErr)
+		}
+		bodyReader = bytes.NewReader(rawBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.repositoryManagementAPI, "/")+path, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating management API request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case authConfig.RegistryToken != "":
+		req.Header.Set("Authorization", "Bearer "+authConfig.RegistryToken)
+	case authConfig.Username != "" || authConfig.Password != "":
+		req.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+
+	httpClient := http.Client{Transport: c.transport}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach management API: %w", err)
+	}
+
+	return resp, nil
+}
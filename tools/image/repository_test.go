@@ -0,0 +1,245 @@
+package image_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository", func() {
+	var (
+		creds   image.Creds
+		repoRef string
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("repository/app")
+	})
+
+	Describe("DeleteRepository", func() {
+		var (
+			imgRefs   []string
+			deleteErr error
+		)
+
+		BeforeEach(func() {
+			imgRefs = []string{}
+			for fixture, tags := range map[string][]string{
+				"fixtures/layer.zip":        {"jim", "bob"},
+				"fixtures/anotherLayer.zip": {"alice"},
+			} {
+				zipFile, err := os.Open(fixture)
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(zipFile.Close)
+
+				imgRef, err := imgClient.Push(ctx, creds, repoRef, zipFile, tags...)
+				Expect(err).NotTo(HaveOccurred())
+				imgRefs = append(imgRefs, imgRef)
+			}
+		})
+
+		JustBeforeEach(func() {
+			deleteErr = imgClient.DeleteRepository(ctx, creds, repoRef)
+		})
+
+		It("deletes all manifests in the repository", func() {
+			Expect(deleteErr).NotTo(HaveOccurred())
+
+			for _, imgRef := range imgRefs {
+				exists, err := imgClient.Exists(ctx, creds, imgRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeFalse())
+			}
+		})
+
+		When("the repository does not exist", func() {
+			BeforeEach(func() {
+				repoRef = containerRegistry.ImageRef("repository/not-there")
+			})
+
+			It("succeeds", func() {
+				Expect(deleteErr).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the repository ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(deleteErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("ListRepositories", func() {
+		var (
+			registryHost string
+			repos        []string
+			listErr      error
+		)
+
+		BeforeEach(func() {
+			registryHost = strings.TrimSuffix(containerRegistry.ImageRef(""), "/")
+			containerRegistry.PushImage(repoRef+"/one", &v1.ConfigFile{})
+			containerRegistry.PushImage(repoRef+"/two", &v1.ConfigFile{})
+		})
+
+		JustBeforeEach(func() {
+			repos, listErr = imgClient.ListRepositories(ctx, creds, registryHost)
+		})
+
+		It("lists the repositories in the registry", func() {
+			Expect(listErr).NotTo(HaveOccurred())
+			Expect(repos).To(ContainElements("repository/app/one", "repository/app/two"))
+		})
+
+		When("the credentials are not valid for the registry", func() {
+			BeforeEach(func() {
+				creds = image.Creds{Namespace: "default"}
+			})
+
+			It("fails", func() {
+				Expect(listErr).To(MatchError(ContainSubstring("failed to list repositories")))
+			})
+		})
+
+		When("the registry host is invalid", func() {
+			BeforeEach(func() {
+				registryHost = "not a host"
+			})
+
+			It("fails", func() {
+				Expect(listErr).To(MatchError(ContainSubstring("error parsing registry")))
+			})
+		})
+	})
+
+	Describe("CreateRepository", func() {
+		var (
+			config        image.RepositoryConfig
+			apiStatus     int
+			requests      []*http.Request
+			requestBodies []map[string]any
+			createErr     error
+		)
+
+		BeforeEach(func() {
+			config = image.RepositoryConfig{
+				Public:       true,
+				Description:  "droplets of app",
+				StorageLimit: 1024,
+			}
+			apiStatus = http.StatusCreated
+			requests = nil
+			requestBodies = nil
+
+			managementAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+
+				body := map[string]any{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				requests = append(requests, r)
+				requestBodies = append(requestBodies, body)
+				w.WriteHeader(apiStatus)
+			}))
+			DeferCleanup(managementAPI.Close)
+
+			imgClient = image.NewClient(k8sClientset, image.WithRepositoryManagementAPI(managementAPI.URL+"/api/"))
+		})
+
+		JustBeforeEach(func() {
+			createErr = imgClient.CreateRepository(ctx, creds, repoRef, config)
+		})
+
+		It("posts the repository to the management API", func() {
+			Expect(createErr).NotTo(HaveOccurred())
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Method).To(Equal(http.MethodPost))
+			Expect(requests[0].URL.Path).To(Equal("/api/repositories"))
+			Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+			username, password, ok := requests[0].BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("password"))
+
+			Expect(requestBodies[0]).To(Equal(map[string]any{
+				"name":         "repository/app",
+				"public":       true,
+				"description":  "droplets of app",
+				"storageLimit": float64(1024),
+			}))
+		})
+
+		When("the repository already exists", func() {
+			BeforeEach(func() {
+				apiStatus = http.StatusConflict
+			})
+
+			It("succeeds", func() {
+				Expect(createErr).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the management API rejects the credentials", func() {
+			BeforeEach(func() {
+				apiStatus = http.StatusForbidden
+			})
+
+			It("returns an AuthError", func() {
+				var authErr *image.AuthError
+				Expect(errors.As(createErr, &authErr)).To(BeTrue())
+				Expect(authErr.StatusCode).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		When("the management API fails", func() {
+			BeforeEach(func() {
+				apiStatus = http.StatusInternalServerError
+			})
+
+			It("returns a PushError", func() {
+				var pushErr *image.PushError
+				Expect(errors.As(createErr, &pushErr)).To(BeTrue())
+				Expect(pushErr).To(MatchError(ContainSubstring("failed to create repository")))
+			})
+		})
+
+		When("no management API is configured", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset)
+			})
+
+			It("does nothing", func() {
+				Expect(createErr).NotTo(HaveOccurred())
+				Expect(requests).To(BeEmpty())
+			})
+		})
+
+		When("the repository ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(createErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+				Expect(requests).To(BeEmpty())
+			})
+		})
+	})
+})
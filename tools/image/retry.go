@@ -0,0 +1,77 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+var noRetryBackoff = wait.Backoff{Steps: 1}
+
+var retryableStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// WithRetry makes the client retry registry writes up to attempts times,
+// doubling the (jittered) backoff after each transient failure
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retryBackoff = wait.Backoff{
+			Duration: backoff,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    attempts,
+		}
+	}
+}
+
+func (c Client) retryOnError(op string, fn func() error) error {
+	count := 0
+	return retry.OnError(c.retryBackoff, isRetryable, func() error {
+		err := fn()
+		if err != nil {
+			count++
+			c.logger.V(1).Info("registry operation failed", "op", op, "count", count, "reason", err)
+		}
+		return err
+	})
+}
+
+// remoteRetryOpts disables the go-containerregistry internal retries when the
+// client has its own retry policy, so that attempts do not multiply
+func (c Client) remoteRetryOpts() []remote.Option {
+	if c.retryBackoff.Steps <= 1 {
+		return nil
+	}
+
+	return []remote.Option{remote.WithRetryBackoff(remote.Backoff{Steps: 1})}
+}
+
+func isRetryable(err error) bool {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return retryableStatusCodes[transportErr.StatusCode]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,93 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry", func() {
+	var (
+		server           *httptest.Server
+		failureStatus    int
+		failuresLeft     int32
+		manifestAttempts int32
+		pushRef          string
+		imgRef           string
+		pushErr          error
+	)
+
+	BeforeEach(func() {
+		failureStatus = http.StatusServiceUnavailable
+		atomic.StoreInt32(&failuresLeft, 2)
+		atomic.StoreInt32(&manifestAttempts, 0)
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/sha256:") {
+				atomic.AddInt32(&manifestAttempts, 1)
+				if atomic.AddInt32(&failuresLeft, -1) >= 0 {
+					w.WriteHeader(failureStatus)
+					return
+				}
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(server.Close)
+
+		serverURL, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		pushRef = serverURL.Host + "/foo/bar"
+
+		imgClient = image.NewClient(k8sClientset, image.WithRetry(3, time.Millisecond))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.Push(ctx, image.Creds{Namespace: "default"}, pushRef, zipFile)
+	})
+
+	It("retries the transient failures and returns the digest", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(imgRef).To(HavePrefix(pushRef + "@sha256:"))
+		Expect(atomic.LoadInt32(&manifestAttempts)).To(BeEquivalentTo(3))
+
+		_, err := imgClient.Config(ctx, image.Creds{Namespace: "default"}, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	When("the registry keeps failing", func() {
+		BeforeEach(func() {
+			atomic.StoreInt32(&failuresLeft, 10)
+		})
+
+		It("gives up after the configured attempts", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("failed to upload image")))
+			Expect(atomic.LoadInt32(&manifestAttempts)).To(BeEquivalentTo(3))
+		})
+	})
+
+	When("the failure is permanent", func() {
+		BeforeEach(func() {
+			failureStatus = http.StatusNotFound
+		})
+
+		It("does not retry", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring("failed to upload image")))
+			Expect(atomic.LoadInt32(&manifestAttempts)).To(BeEquivalentTo(1))
+		})
+	})
+})
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// PushWithSourceMap pushes the zip archive like Push and attaches the SBOM
+// (e.g. a CycloneDX or SPDX document) to the image as an OCI referrer whose
+// artifact type is sbomMediaType. The digest ref of the image, not of the
+// SBOM, is returned. Registries without the Referrers API are tracked in the
+// sha256-<hex> fallback tag; registries that reject the SBOM manifest
+// altogether silently skip the attachment.
+func (c Client) PushWithSourceMap(ctx context.Context, creds Creds, repoRef string, zipReader io.Reader, sbom []byte, sbomMediaType string, tags ...string) (string, error) {
+	if len(sbom) > 0 && sbomMediaType == "" {
+		return "", errors.New("an SBOM media type is required")
+	}
+
+	return c.push(ctx, creds, repoRef, zipReader, pushConfig{tags: tags, sbom: sbom, sbomMediaType: types.MediaType(sbomMediaType)})
+}
+
+func (c Client) attachSBOM(repo name.Repository, subject artifact, sbom []byte, mediaType types.MediaType, remoteOpts []remote.Option) error {
+	subjectDescriptor, err := partial.Descriptor(subject.(partial.Describable))
+	if err != nil {
+		return fmt.Errorf("failed to describe image: %w", err)
+	}
+
+	sbomImage, err := referrerImage(*subjectDescriptor, sbom, mediaType)
+	if err != nil {
+		return fmt.Errorf("failed to create SBOM image: %w", err)
+	}
+
+	sbomDigest, err := sbomImage.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to get SBOM digest: %w", err)
+	}
+
+	sbomRef := repo.Digest(sbomDigest.String())
+	c.logger.V(1).Info("attaching SBOM", "ref", sbomRef, "mediaType", mediaType)
+	err = c.retryOnError("attach-sbom", func() error {
+		return remote.Write(sbomRef, sbomImage, remoteOpts...)
+	})
+	if isReferrerRejected(err) {
+		c.logger.Info("registry rejected the SBOM, skipping attachment", "ref", sbomRef, "reason", err.Error())
+		return nil
+	}
+	if err != nil {
+		return pushError(repo.String(), fmt.Errorf("failed to upload SBOM: %w", err))
+	}
+
+	return nil
+}
+
+// referrerImage returns an image referring to subject whose single layer is
+// content and whose artifact type is mediaType
+func referrerImage(subject v1.Descriptor, content []byte, mediaType types.MediaType) (v1.Image, error) {
+	// the artifact type of referrers is taken from the config media type
+	img, err := mutate.Append(
+		mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mediaType),
+		mutate.Addendum{Layer: static.NewLayer(content, mediaType)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return mutate.Subject(img, subject).(v1.Image), nil
+}
+
+func isReferrerRejected(err error) bool {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+
+	switch transportErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType:
+		return true
+	default:
+		return false
+	}
+}
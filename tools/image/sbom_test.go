@@ -0,0 +1,111 @@
+package image_test
+
+import (
+	"io"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PushWithSourceMap", func() {
+	const sbomMediaType = "application/vnd.cyclonedx+json"
+
+	var (
+		creds     image.Creds
+		pushRef   string
+		sbom      []byte
+		mediaType string
+		imgRef    string
+		pushErr   error
+	)
+
+	registryAuth := remote.WithAuth(&authn.Basic{Username: "user", Password: "password"})
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgClient = image.NewClient(k8sClientset)
+		pushRef = containerRegistry.ImageRef("sbom/" + uuid.NewString())
+		sbom = []byte(`{"bomFormat":"CycloneDX","specVersion":"1.5"}`)
+		mediaType = sbomMediaType
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		imgRef, pushErr = imgClient.PushWithSourceMap(ctx, creds, pushRef, zipFile, sbom, mediaType, "jim")
+	})
+
+	It("returns the digest ref of the image", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.LayerCount).To(Equal(1))
+
+		digest, err := imgClient.Digest(ctx, creds, pushRef+":jim")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imgRef).To(HaveSuffix("@" + digest))
+	})
+
+	It("attaches the SBOM as a referrer", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		digest, err := name.NewDigest(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		referrers, err := remote.Referrers(digest, registryAuth)
+		Expect(err).NotTo(HaveOccurred())
+		indexManifest, err := referrers.IndexManifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexManifest.Manifests).To(HaveLen(1))
+		Expect(indexManifest.Manifests[0].ArtifactType).To(Equal(sbomMediaType))
+
+		sbomImage, err := remote.Image(digest.Context().Digest(indexManifest.Manifests[0].Digest.String()), registryAuth)
+		Expect(err).NotTo(HaveOccurred())
+		layers, err := sbomImage.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layers).To(HaveLen(1))
+		layerReader, err := layers[0].Uncompressed()
+		Expect(err).NotTo(HaveOccurred())
+		defer layerReader.Close()
+		Expect(io.ReadAll(layerReader)).To(Equal(sbom))
+	})
+
+	When("the SBOM media type is missing", func() {
+		BeforeEach(func() {
+			mediaType = ""
+		})
+
+		It("returns an error", func() {
+			Expect(pushErr).To(MatchError("an SBOM media type is required"))
+		})
+	})
+
+	When("the SBOM is empty", func() {
+		BeforeEach(func() {
+			sbom = nil
+		})
+
+		It("pushes the image without attaching anything", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			digest, err := name.NewDigest(imgRef)
+			Expect(err).NotTo(HaveOccurred())
+			referrers, err := remote.Referrers(digest, registryAuth)
+			Expect(err).NotTo(HaveOccurred())
+			indexManifest, err := referrers.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(indexManifest.Manifests).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ScanFunc scans the pushed image at imageRef, a digest ref, and returns an
+// error when the image must not be used, e.g. because Trivy, Grype or Clair
+// found vulnerabilities. The error should describe the findings.
+type ScanFunc func(ctx context.Context, imageRef string) error
+
+// WithScanFunc makes the client run scan on every manifest it writes, e.g.
+// with Push, SetLabel, Rebase, Copy or MirrorImage, before it is tagged.
+// Images rejected by scan are deleted and the write fails with a
+// ScanFailedError. Images reused by WithDeduplication are not scanned again.
+func WithScanFunc(scan ScanFunc) Option {
+	return func(c *Client) {
+		c.scan = scan
+	}
+}
+
+// scanImage runs the ScanFunc of the client, if any, on the image at ref and
+// deletes the image when it is rejected
+func (c Client) scanImage(ctx context.Context, ref name.Digest, writeOpts []remote.Option) error {
+	if c.scan == nil {
+		return nil
+	}
+
+	c.logger.V(1).Info("scanning image", "ref", ref.Name())
+	scanErr := c.scan(ctx, ref.Name())
+	if scanErr == nil {
+		return nil
+	}
+
+	c.logger.Info("image failed scan, deleting it", "ref", ref.Name(), "reason", scanErr)
+	if err := ignoreNotFound(remote.Delete(ref, writeOpts...)); err != nil {
+		c.logger.Error(err, "failed to delete image that failed scan", "ref", ref.Name())
+	}
+
+	return &ScanFailedError{
+		Ref:   ref.Name(),
+		Cause: fmt.Errorf("image %s failed scan: %w", ref.Name(), scanErr),
+	}
+}
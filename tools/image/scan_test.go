@@ -0,0 +1,143 @@
+package image_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithScanFunc", func() {
+	var (
+		creds      image.Creds
+		repoRef    string
+		scannedRef string
+		scanErr    error
+		// taggedWhileScanning records whether repoRef:latest resolved while
+		// the pushed image was being scanned
+		taggedWhileScanning bool
+		imgRef              string
+		pushErr             error
+	)
+
+	BeforeEach(func() {
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("scan/" + uuid.NewString())
+		scannedRef = ""
+		scanErr = nil
+		taggedWhileScanning = false
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, image.WithScanFunc(func(scanCtx context.Context, imageRef string) error {
+			scannedRef = imageRef
+			if taggedDigest, err := image.NewClient(k8sClientset).Digest(scanCtx, creds, repoRef+":latest"); err == nil {
+				taggedWhileScanning = strings.HasSuffix(imageRef, "@"+taggedDigest)
+			}
+			return scanErr
+		}))
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, pushErr = imgClient.Push(ctx, creds, repoRef, zipFile, "latest")
+	})
+
+	It("scans the pushed image by digest", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(scannedRef).To(Equal(imgRef))
+		Expect(scannedRef).To(HavePrefix(repoRef + "@sha256:"))
+
+		exists, err := imgClient.Exists(ctx, creds, repoRef+":latest")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+	})
+
+	It("tags the image only once it is scanned", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+		Expect(taggedWhileScanning).To(BeFalse())
+	})
+
+	It("scans the manifests written by the other methods", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		labelledRef, err := imgClient.SetLabel(ctx, creds, repoRef+":latest", "version", "2.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scannedRef).To(Equal(labelledRef))
+
+		annotatedRef, err := imgClient.AnnotateManifest(ctx, creds, repoRef+":latest", map[string]string{"team": "payments"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scannedRef).To(Equal(annotatedRef))
+
+		snapshotRef, err := imgClient.Snapshot(ctx, creds, repoRef+":latest", "snapshot")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scannedRef).To(Equal(snapshotRef))
+
+		mirrorRepoRef := containerRegistry.ImageRef("scan/" + uuid.NewString())
+		Expect(imgClient.MirrorImage(ctx, creds, annotatedRef, []image.MirrorDestination{{RepoRef: mirrorRepoRef, Creds: creds}})).To(Succeed())
+		Expect(scannedRef).To(HavePrefix(mirrorRepoRef + "@sha256:"))
+
+		copyRef := containerRegistry.ImageRef("scan/" + uuid.NewString())
+		copiedRef, err := imgClient.Copy(ctx, creds, annotatedRef, creds, copyRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scannedRef).To(Equal(copiedRef))
+
+		renamedRepoRef := containerRegistry.ImageRef("scan/" + uuid.NewString())
+		Expect(imgClient.RenameRepository(ctx, creds, copyRef, creds, renamedRepoRef)).To(Succeed())
+		Expect(scannedRef).To(HavePrefix(renamedRepoRef + "@sha256:"))
+	})
+
+	When("the scan fails", func() {
+		BeforeEach(func() {
+			scanErr = errors.New("CVE-2024-3094: xz-utils 5.6.0")
+		})
+
+		It("returns a ScanFailedError", func() {
+			var scanFailedErr *image.ScanFailedError
+			Expect(errors.As(pushErr, &scanFailedErr)).To(BeTrue())
+			Expect(scanFailedErr.Ref).To(Equal(scannedRef))
+			Expect(pushErr).To(MatchError(scanErr))
+			Expect(pushErr).To(MatchError(ContainSubstring("CVE-2024-3094")))
+		})
+
+		It("deletes the image without tagging it", func() {
+			exists, err := imgClient.Exists(ctx, creds, scannedRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+
+			exists, err = imgClient.Exists(ctx, creds, repoRef+":latest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		When("the tag already points to an image", func() {
+			var previousRef string
+
+			BeforeEach(func() {
+				zipFile, err := os.Open("fixtures/anotherLayer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				defer zipFile.Close()
+
+				previousRef, err = image.NewClient(k8sClientset).Push(ctx, creds, repoRef, zipFile, "latest")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("leaves the tag on the previous image", func() {
+				Expect(pushErr).To(HaveOccurred())
+
+				digest, err := imgClient.Digest(ctx, creds, repoRef+":latest")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(previousRef).To(HaveSuffix("@" + digest))
+			})
+		})
+	})
+})
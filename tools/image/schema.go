@@ -0,0 +1,72 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// schema1Manifest holds the parts of a Docker schema 1 manifest needed to
+// build a Config. The config of the image is the v1Compatibility of the
+// first history entry.
+type schema1Manifest struct {
+	FSLayers []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+type schema1Compatibility struct {
+	Created      *time.Time `json:"created"`
+	OS           string     `json:"os"`
+	Architecture string     `json:"architecture"`
+	Config       struct {
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Labels       map[string]string   `json:"Labels"`
+		Healthcheck  *v1.HealthConfig    `json:"Healthcheck"`
+	} `json:"config"`
+}
+
+func isSchema1(mediaType types.MediaType) bool {
+	return mediaType == types.DockerManifestSchema1 || mediaType == types.DockerManifestSchema1Signed
+}
+
+// schema1Config converts a Docker schema 1 manifest into a Config. Schema 1
+// manifests do not record layer sizes, so the size is always approximate.
+func schema1Config(rawManifest []byte) (Config, error) {
+	var manifest schema1Manifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return Config{}, fmt.Errorf("error parsing schema 1 manifest: %w", err)
+	}
+
+	var compatibility schema1Compatibility
+	if len(manifest.History) > 0 {
+		if err := json.Unmarshal([]byte(manifest.History[0].V1Compatibility), &compatibility); err != nil {
+			return Config{}, fmt.Errorf("error parsing schema 1 image config: %w", err)
+		}
+	}
+
+	ports, err := exposedPorts(compatibility.Config.ExposedPorts)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		Labels:          compatibility.Config.Labels,
+		User:            compatibility.Config.User,
+		ExposedPorts:    ports,
+		LayerCount:      len(manifest.FSLayers),
+		SizeApproximate: true,
+		SchemaVersion:   1,
+		CreatedAt:       compatibility.Created,
+		Healthcheck:     healthcheckConfig(compatibility.Config.Healthcheck),
+		OS:              compatibility.OS,
+		Architecture:    compatibility.Architecture,
+	}, nil
+}
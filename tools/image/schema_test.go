@@ -0,0 +1,91 @@
+package image_test
+
+import (
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+type rawManifest struct {
+	manifest  []byte
+	mediaType types.MediaType
+}
+
+func (m rawManifest) RawManifest() ([]byte, error) {
+	return m.manifest, nil
+}
+
+func (m rawManifest) MediaType() (types.MediaType, error) {
+	return m.mediaType, nil
+}
+
+var _ = Describe("Schema 1 manifests", func() {
+	var (
+		imgRef    string
+		config    image.Config
+		configErr error
+	)
+
+	BeforeEach(func() {
+		server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0))))
+		DeferCleanup(server.Close)
+
+		serverURL, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		imgRef = serverURL.Host + "/legacy/app:v1"
+
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Put(ref, rawManifest{
+			mediaType: types.DockerManifestSchema1,
+			manifest: []byte(`{
+				"schemaVersion": 1,
+				"name": "legacy/app",
+				"tag": "v1",
+				"architecture": "amd64",
+				"fsLayers": [
+					{"blobSum": "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"},
+					{"blobSum": "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"}
+				],
+				"history": [
+					{"v1Compatibility": "{\"created\":\"2015-01-02T03:04:05Z\",\"os\":\"linux\",\"architecture\":\"amd64\",\"config\":{\"User\":\"legacy\",\"ExposedPorts\":{\"8080/tcp\":{}},\"Labels\":{\"foo\":\"bar\"},\"Healthcheck\":{\"Test\":[\"CMD-SHELL\",\"curl -f localhost:8080\"],\"Interval\":30000000000,\"Retries\":3}}}"},
+					{"v1Compatibility": "{}"}
+				]
+			}`),
+		})).To(Succeed())
+
+		imgClient = image.NewClient(k8sClientset)
+	})
+
+	JustBeforeEach(func() {
+		config, configErr = imgClient.Config(ctx, image.Creds{Namespace: "default"}, imgRef)
+	})
+
+	It("converts the manifest into a config", func() {
+		Expect(configErr).NotTo(HaveOccurred())
+		Expect(config.SchemaVersion).To(Equal(1))
+		Expect(config.User).To(Equal("legacy"))
+		Expect(config.Labels).To(Equal(map[string]string{"foo": "bar"}))
+		Expect(config.ExposedPorts).To(ConsistOf(int32(8080)))
+		Expect(config.LayerCount).To(Equal(2))
+		Expect(config.SizeApproximate).To(BeTrue())
+		Expect(config.CreatedAt).To(PointTo(BeTemporally("==", time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC))))
+		Expect(config.Healthcheck).To(Equal(&image.HealthcheckConfig{
+			Test:     []string{"CMD-SHELL", "curl -f localhost:8080"},
+			Interval: 30 * time.Second,
+			Retries:  3,
+		}))
+		Expect(config.OS).To(Equal("linux"))
+		Expect(config.Architecture).To(Equal("amd64"))
+	})
+})
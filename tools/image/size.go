@@ -0,0 +1,56 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ImageSize returns the size of the layers of the image without downloading
+// any of them. compressed is the sum of the sizes the registry reports for
+// the layer blobs, which is what the image takes up in the registry.
+// uncompressed is the sum of the layer sizes recorded in the manifest; the
+// size of a compressed layer once extracted is not known without reading
+// it, so like Config.UncompressedSizeBytes it falls back to the size of the
+// compressed layer.
+func (c Client) ImageSize(ctx context.Context, creds Creds, imageRef string) (compressed, uncompressed int64, err error) {
+	c.logger.V(1).Info("fetching image size", "ref", imageRef)
+	ref, err := c.parseReadReference(imageRef)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return 0, 0, authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	img, err := c.verifiedImage(ctx, creds, ref, imageRef, remoteOpts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting image manifest: %w", err)
+	}
+
+	for _, layerDescriptor := range manifest.Layers {
+		uncompressed += layerDescriptor.Size
+
+		layer, err := remote.Layer(ref.Context().Digest(layerDescriptor.Digest.String()), remoteOpts...)
+		if err != nil {
+			return 0, 0, registryError(imageRef, fmt.Errorf("failed to get layer %s: %w", layerDescriptor.Digest, err))
+		}
+
+		// the size of remote layers is the Content-Length of a HEAD request
+		size, err := layer.Size()
+		if err != nil {
+			return 0, 0, registryError(imageRef, fmt.Errorf("failed to get size of layer %s: %w", layerDescriptor.Digest, err))
+		}
+		compressed += size
+	}
+
+	return compressed, uncompressed, nil
+}
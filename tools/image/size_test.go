@@ -0,0 +1,100 @@
+package image_test
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ImageSize", func() {
+	var (
+		mutex        sync.Mutex
+		blobRequests []string
+		creds        image.Creds
+		imgRef       string
+		compressed   int64
+		uncompressed int64
+		sizeErr      error
+	)
+
+	BeforeEach(func() {
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/blobs/sha256:") {
+				mutex.Lock()
+				blobRequests = append(blobRequests, r.Method)
+				mutex.Unlock()
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{Namespace: "default"}
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		imgRef, err = imgClient.Push(ctx, creds, serverURL.Host+"/size/"+uuid.NewString(), zipFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		mutex.Lock()
+		blobRequests = nil
+		mutex.Unlock()
+	})
+
+	JustBeforeEach(func() {
+		compressed, uncompressed, sizeErr = imgClient.ImageSize(ctx, creds, imgRef)
+	})
+
+	It("returns the size of the layers", func() {
+		Expect(sizeErr).NotTo(HaveOccurred())
+
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := remote.Image(ref)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := img.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(HaveLen(1))
+
+		Expect(compressed).To(Equal(manifest.Layers[0].Size))
+		Expect(uncompressed).To(Equal(manifest.Layers[0].Size))
+	})
+
+	It("does not download the layers", func() {
+		Expect(sizeErr).NotTo(HaveOccurred())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(blobRequests).To(ConsistOf(http.MethodHead))
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = strings.Split(imgRef, "@")[0] + ":missing"
+		})
+
+		It("returns a NotFoundError", func() {
+			var notFoundErr *image.NotFoundError
+			Expect(errors.As(sizeErr, &notFoundErr)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// SnapshotCreatedAtAnnotation is set by Snapshot to the time the snapshot
+// was taken, in RFC 3339 format
+const SnapshotCreatedAtAnnotation = "cloudfoundry.org/snapshot-created-at"
+
+// Snapshot tags the image (or image index) at imageRef with snapshotTag in
+// the same repository, e.g. to keep the image of the running app around
+// during a rolling deployment, and returns the digest ref of the snapshot.
+// The manifest is written back with the SnapshotCreatedAtAnnotation, so the
+// snapshot has a digest of its own, but no layers are copied: only the
+// manifest is uploaded. An existing snapshotTag is moved to the snapshot.
+func (c Client) Snapshot(ctx context.Context, creds Creds, imageRef, snapshotTag string) (string, error) {
+	c.logger.V(1).Info("snapshotting", "ref", imageRef, "tag", snapshotTag)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return "", authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to get manifest: %w", err))
+	}
+
+	original, err := descriptorArtifact(descriptor)
+	if err != nil {
+		return "", registryError(imageRef, fmt.Errorf("failed to read manifest: %w", err))
+	}
+	snapshot := annotateArtifact(original, map[string]string{
+		SnapshotCreatedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+	})
+
+	digest, err := snapshot.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get digest of snapshot manifest: %w", err)
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	err = c.retryOnError("write-manifest", func() error {
+		return remote.Put(ref.Context().Digest(digest.String()), snapshot, writeOpts...)
+	})
+	if err != nil {
+		return "", pushError(imageRef, fmt.Errorf("failed to upload snapshot manifest: %w", err))
+	}
+
+	return c.finishWrite(ctx, creds, nil, writtenManifest{
+		repo:     ref.Context(),
+		manifest: snapshot,
+		digest:   digest,
+		tags:     []string{snapshotTag},
+	}, writeOpts)
+}
@@ -0,0 +1,115 @@
+package image_test
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	var (
+		mutex          sync.Mutex
+		blobUploads    int
+		creds          image.Creds
+		repoRef        string
+		imgRef         string
+		originalDigest string
+		snapshotRef    string
+		snapshotErr    error
+	)
+
+	BeforeEach(func() {
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/blobs/uploads/") {
+				mutex.Lock()
+				blobUploads++
+				mutex.Unlock()
+			}
+			registryHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{Namespace: "default"}
+		repoRef = serverURL.Host + "/snapshot/" + uuid.NewString()
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		digestRef, err := imgClient.Push(ctx, creds, repoRef, zipFile, "current")
+		Expect(err).NotTo(HaveOccurred())
+		originalDigest = strings.Split(digestRef, "@")[1]
+
+		mutex.Lock()
+		blobUploads = 0
+		mutex.Unlock()
+
+		imgRef = repoRef + ":current"
+	})
+
+	JustBeforeEach(func() {
+		snapshotRef, snapshotErr = imgClient.Snapshot(ctx, creds, imgRef, "snapshot-1")
+	})
+
+	It("tags the image with the snapshot tag", func() {
+		Expect(snapshotErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, repoRef+":snapshot-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snapshotRef).To(Equal(repoRef + "@" + digest))
+	})
+
+	It("annotates the snapshot with the time it was taken", func() {
+		Expect(snapshotErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, snapshotRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Annotations).To(HaveKey(image.SnapshotCreatedAtAnnotation))
+
+		createdAt, err := time.Parse(time.RFC3339, config.Annotations[image.SnapshotCreatedAtAnnotation])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(createdAt).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("leaves the image alone", func() {
+		Expect(snapshotErr).NotTo(HaveOccurred())
+
+		digest, err := imgClient.Digest(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(originalDigest))
+	})
+
+	It("does not upload the layers again", func() {
+		Expect(snapshotErr).NotTo(HaveOccurred())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(blobUploads).To(BeZero())
+	})
+
+	When("the image does not exist", func() {
+		BeforeEach(func() {
+			imgRef = repoRef + ":missing"
+		})
+
+		It("fails", func() {
+			Expect(snapshotErr).To(MatchError(ContainSubstring("failed to get manifest")))
+		})
+	})
+})
@@ -0,0 +1,206 @@
+package image
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/pack/pkg/archive"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+const defaultInMemoryThreshold = 50 * 1024 * 1024
+
+// WithInMemoryThreshold sets the size up to which source archives are
+// buffered in memory rather than in a temp file during Push. Defaults to
+// 50MB; a zero threshold always uses a temp file.
+func WithInMemoryThreshold(bytes int64) Option {
+	return func(c *Client) {
+		c.inMemoryThreshold = bytes
+	}
+}
+
+// WithReproducibleTimestamps controls whether the modification times of the
+// files in pushed archives and directories are normalized to a constant
+// (1980-01-01, as for images built by pack), so that pushing the same files
+// always results in the same digest. It is enabled by default; disabling it
+// keeps the original modification times, e.g. for apps that print the time
+// their files were last changed, at the cost of a new digest every time the
+// archive is recreated.
+func WithReproducibleTimestamps(enabled bool) Option {
+	return func(c *Client) {
+		c.reproducibleTimestamps = enabled
+	}
+}
+
+// zipLayer converts the zip archive into an image layer. The returned cleanup
+// function must be called once the layer is no longer needed.
+func (c Client) zipLayer(zipReader io.Reader) (v1.Layer, func(), error) {
+	buf := &bytes.Buffer{}
+	n, err := io.Copy(buf, io.LimitReader(zipReader, c.inMemoryThreshold+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read image source: %w", err)
+	}
+
+	if n <= c.inMemoryThreshold {
+		contents := buf.Bytes()
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return archive.GenerateTar(func(tw archive.TarWriter) error {
+				return writeZipToTar(tw, contents, c.reproducibleTimestamps)
+			}), nil
+		}, c.layerOptions()...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create a layer out of the image source: %w", err)
+		}
+
+		return layer, func() {}, nil
+	}
+
+	return c.tempFileZipLayer(io.MultiReader(buf, zipReader))
+}
+
+func (c Client) tempFileZipLayer(zipReader io.Reader) (v1.Layer, func(), error) {
+	tmpDir := c.tempDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+
+	tmpFile, err := os.CreateTemp(tmpDir, "sourceimg-%s")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create a temp file for image: %w", err)
+	}
+	cleanup := func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}
+
+	if _, err = io.Copy(tmpFile, zipReader); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to copy image source into temp file '%s' %w", tmpFile.Name(), err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return archive.ReadZipAsTar(tmpFile.Name(), "/", 0, 0, -1, c.reproducibleTimestamps, nil), nil
+	}, c.layerOptions()...)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to create a layer out of '%s': %w", tmpFile.Name(), err)
+	}
+
+	return layer, cleanup, nil
+}
+
+// writeZipToTar mirrors archive.WriteZipToTar (which only reads zip files from
+// disk) for the parameters used by Push: root base path, root ownership and
+// original file modes
+func writeZipToTar(tw archive.TarWriter, contents []byte, normalizeModTime bool) error {
+	zipReader, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zipReader.File {
+		header, err := zipEntryHeader(f, normalizeModTime)
+		if err != nil {
+			return err
+		}
+
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if f.Mode().IsRegular() {
+			if err = copyZipEntry(tw, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func zipEntryHeader(f *zip.File, normalizeModTime bool) (*tar.Header, error) {
+	link := f.Name
+	if f.Mode()&os.ModeSymlink != 0 {
+		target := &bytes.Buffer{}
+		if err := copyZipEntry(target, f); err != nil {
+			return nil, err
+		}
+		link = target.String()
+	}
+
+	header, err := tar.FileInfoHeader(f.FileInfo(), link)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Name = filepath.ToSlash(filepath.Join("/", f.Name))
+	archive.NormalizeHeader(header, normalizeModTime)
+	if isFatFile(f.FileHeader) {
+		header.Mode = 0o777
+	}
+
+	return header, nil
+}
+
+func copyZipEntry(w io.Writer, f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func isFatFile(header zip.FileHeader) bool {
+	var (
+		creatorFAT  uint16 = 0
+		creatorVFAT uint16 = 14
+	)
+
+	firstByte := header.CreatorVersion >> 8
+	return firstByte == creatorFAT || firstByte == creatorVFAT
+}
+
+func (c Client) dirLayer(dir string) (v1.Layer, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("image source %q is not a directory", dir)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return archive.ReadDirAsTar(dir, "/", 0, 0, -1, c.reproducibleTimestamps, false, c.skipDeviceFiles(dir)), nil
+	}, c.layerOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a layer out of '%s': %w", dir, err)
+	}
+
+	return layer, nil
+}
+
+func (c Client) skipDeviceFiles(dir string) func(string) bool {
+	return func(relPath string) bool {
+		info, err := os.Lstat(filepath.Join(dir, relPath))
+		if err != nil {
+			// let the archive walker report the error
+			return true
+		}
+
+		if info.Mode()&os.ModeDevice != 0 {
+			c.logger.Info("skipping device file", "path", relPath)
+			return false
+		}
+
+		return true
+	}
+}
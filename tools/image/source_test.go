@@ -0,0 +1,207 @@
+package image_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithReproducibleTimestamps", func() {
+	var (
+		clientOpts []image.Option
+		repoRef    string
+		firstRef   string
+		secondRef  string
+	)
+
+	zipWithModTime := func(modTime time.Time) *bytes.Buffer {
+		GinkgoHelper()
+
+		buf := &bytes.Buffer{}
+		zipWriter := zip.NewWriter(buf)
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "app.log", Method: zip.Deflate, Modified: modTime})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("started"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zipWriter.Close()).To(Succeed())
+
+		return buf
+	}
+
+	layerModTime := func(imgRef string) time.Time {
+		GinkgoHelper()
+
+		ref, err := name.ParseReference(imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := remote.Image(ref)
+		Expect(err).NotTo(HaveOccurred())
+		layers, err := img.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layers).To(HaveLen(1))
+
+		contents, err := layers[0].Uncompressed()
+		Expect(err).NotTo(HaveOccurred())
+		defer contents.Close()
+
+		tr := tar.NewReader(contents)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			if header.Name == "/app.log" {
+				return header.ModTime
+			}
+		}
+
+		Fail("app.log not found in the layer")
+		return time.Time{}
+	}
+
+	BeforeEach(func() {
+		clientOpts = nil
+
+		registry := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0))))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		repoRef = serverURL.Host + "/reproducible/" + uuid.NewString()
+	})
+
+	JustBeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, clientOpts...)
+		creds := image.Creds{Namespace: "default"}
+
+		var err error
+		firstRef, err = imgClient.Push(ctx, creds, repoRef, zipWithModTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+		Expect(err).NotTo(HaveOccurred())
+		secondRef, err = imgClient.Push(ctx, creds, repoRef, zipWithModTime(time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC)))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("pushes the same digest for the same files", func() {
+		Expect(secondRef).To(Equal(firstRef))
+		Expect(layerModTime(firstRef)).To(BeTemporally("==", time.Date(1980, 1, 1, 0, 0, 1, 0, time.UTC)))
+	})
+
+	When("the archive is buffered in a temp file", func() {
+		BeforeEach(func() {
+			clientOpts = append(clientOpts, image.WithInMemoryThreshold(0))
+		})
+
+		It("pushes the same digest for the same files", func() {
+			Expect(secondRef).To(Equal(firstRef))
+		})
+	})
+
+	When("disabled", func() {
+		BeforeEach(func() {
+			clientOpts = append(clientOpts, image.WithReproducibleTimestamps(false))
+		})
+
+		It("keeps the modification times of the archive", func() {
+			Expect(secondRef).NotTo(Equal(firstRef))
+			Expect(layerModTime(firstRef)).To(BeTemporally("==", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+			Expect(layerModTime(secondRef)).To(BeTemporally("==", time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC)))
+		})
+
+		When("the archive is buffered in a temp file", func() {
+			BeforeEach(func() {
+				clientOpts = append(clientOpts, image.WithInMemoryThreshold(0))
+			})
+
+			It("keeps the modification times of the archive", func() {
+				Expect(secondRef).NotTo(Equal(firstRef))
+				Expect(layerModTime(secondRef)).To(BeTemporally("==", time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC)))
+			})
+		})
+	})
+})
+
+func BenchmarkPush(b *testing.B) {
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, sizeMB := range []int64{1, 200} {
+		zipPath := writeRandomZip(b, sizeMB*1024*1024)
+
+		for _, mode := range []struct {
+			name      string
+			threshold int64
+		}{
+			{name: "in-memory", threshold: (sizeMB + 1) * 1024 * 1024},
+			{name: "temp-file", threshold: 0},
+		} {
+			b.Run(fmt.Sprintf("%dMB/%s", sizeMB, mode.name), func(b *testing.B) {
+				client := image.NewClient(nil, image.WithInMemoryThreshold(mode.threshold))
+				repoRef := serverURL.Host + "/bench/" + mode.name
+
+				for i := 0; i < b.N; i++ {
+					zipFile, err := os.Open(zipPath)
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if _, err = client.Push(context.Background(), image.Creds{}, repoRef, zipFile); err != nil {
+						b.Fatal(err)
+					}
+					zipFile.Close()
+				}
+			})
+		}
+	}
+}
+
+func writeRandomZip(b *testing.B, size int64) string {
+	b.Helper()
+
+	zipPath := filepath.Join(b.TempDir(), "source.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "random", Method: zip.Store})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err = io.CopyN(w, rand.Reader, size); err != nil {
+		b.Fatal(err)
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	return zipPath
+}
@@ -0,0 +1,42 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// PushFromURL pushes the zip archive served at sourceURL like Push, e.g. a
+// source package kept in S3 or Artifactory. The archive is fetched with
+// httpClient, which follows redirects and can add auth headers through its
+// transport, or with http.DefaultClient when nil. The response must have an
+// application/zip or application/octet-stream content type.
+func (c Client) PushFromURL(ctx context.Context, creds Creds, repoRef, sourceURL string, httpClient *http.Client, tags ...string) (string, error) {
+	c.logger.V(1).Info("fetching image source", "url", sourceURL)
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request for image source %s: %w", sourceURL, err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch image source: unexpected status %s", resp.Status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/zip" && mediaType != "application/octet-stream") {
+		return "", fmt.Errorf("image source has content type %q, expected application/zip or application/octet-stream", resp.Header.Get("Content-Type"))
+	}
+
+	return c.Push(ctx, creds, repoRef, resp.Body, tags...)
+}
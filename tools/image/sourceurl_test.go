@@ -0,0 +1,130 @@
+package image_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// authTransport adds a bearer token to every request
+type authTransport struct {
+	token string
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var _ = Describe("PushFromURL", func() {
+	var (
+		creds      image.Creds
+		pushRef    string
+		sourceURL  string
+		httpClient *http.Client
+		imgRef     string
+		pushErr    error
+		sourceHost string
+	)
+
+	BeforeEach(func() {
+		zipContents, err := os.ReadFile("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/source.zip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/zip")
+			_, _ = w.Write(zipContents)
+		})
+		mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/source.zip", http.StatusFound)
+		})
+		mux.HandleFunc("/private.zip", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(zipContents)
+		})
+		mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<html></html>"))
+		})
+		sourceServer := httptest.NewServer(mux)
+		DeferCleanup(sourceServer.Close)
+		sourceHost = sourceServer.URL
+
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		imgClient = image.NewClient(k8sClientset)
+		pushRef = containerRegistry.ImageRef("sourceurl/" + uuid.NewString())
+		sourceURL = sourceHost + "/source.zip"
+		httpClient = nil
+	})
+
+	JustBeforeEach(func() {
+		imgRef, pushErr = imgClient.PushFromURL(ctx, creds, pushRef, sourceURL, httpClient, "jim")
+	})
+
+	It("pushes the archive", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		config, err := imgClient.Config(ctx, creds, imgRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.LayerCount).To(Equal(1))
+
+		digest, err := imgClient.Digest(ctx, creds, pushRef+":jim")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imgRef).To(HaveSuffix("@" + digest))
+	})
+
+	When("the URL redirects", func() {
+		BeforeEach(func() {
+			sourceURL = sourceHost + "/redirect"
+		})
+
+		It("follows the redirect", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the archive requires auth", func() {
+		BeforeEach(func() {
+			sourceURL = sourceHost + "/private.zip"
+			httpClient = &http.Client{Transport: authTransport{token: "s3cr3t"}}
+		})
+
+		It("fetches it with the given HTTP client", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+
+		When("no HTTP client is given", func() {
+			BeforeEach(func() {
+				httpClient = nil
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("401 Unauthorized")))
+			})
+		})
+	})
+
+	When("the content type is not an archive", func() {
+		BeforeEach(func() {
+			sourceURL = sourceHost + "/page.html"
+		})
+
+		It("fails", func() {
+			Expect(pushErr).To(MatchError(ContainSubstring(`content type "text/html; charset=utf-8"`)))
+		})
+	})
+})
@@ -0,0 +1,395 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultTagConcurrency = 5
+
+// ErrTagChanged is returned by MigrateTag when the tag does not point to the
+// expected digest
+var ErrTagChanged = errors.New("tag has changed")
+
+// WithTagConcurrency sets how many tags are pushed in parallel. Defaults to
+// 5; values below 1 use the default.
+func WithTagConcurrency(n int) Option {
+	return func(c *Client) {
+		c.tagConcurrency = n
+	}
+}
+
+// Tag applies the tags to the already pushed image without re-uploading it
+func (c Client) Tag(ctx context.Context, creds Creds, imageRef string, tags ...string) error {
+	c.logger.V(1).Info("tagging", "ref", imageRef, "tags", tags)
+	ref, err := c.parseReference(imageRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", imageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(imageRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return registryError(imageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	if err = c.tagAll(ref.Context(), descriptor, tags, writeOpts); err != nil {
+		return pushError(imageRef, fmt.Errorf("failed to tag image: %w", err))
+	}
+
+	return nil
+}
+
+// tagAll pushes the tags concurrently and returns the first error
+func (c Client) tagAll(repo name.Repository, t remote.Taggable, tags []string, writeOpts []remote.Option) error {
+	limit := c.tagConcurrency
+	if limit < 1 {
+		limit = defaultTagConcurrency
+	}
+
+	var group errgroup.Group
+	group.SetLimit(limit)
+	for _, tag := range tags {
+		group.Go(func() error {
+			return c.retryOnError("tag", func() error {
+				return remote.Tag(repo.Tag(tag), t, writeOpts...)
+			})
+		})
+	}
+
+	return group.Wait()
+}
+
+// ListTags lists all tags in the repository, following the registry
+// pagination links
+func (c Client) ListTags(ctx context.Context, creds Creds, repoRef string) ([]string, error) {
+	c.logger.V(1).Info("listing tags", "repo", repoRef)
+	repo, err := c.parseReadRepository(repoRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	tags, err := remote.List(repo, remoteOpts...)
+	if err != nil {
+		return nil, registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	return tags, nil
+}
+
+// TaggedRefs returns the refs (registry/repo:tag) of the tags in the
+// repository that point to digest (sha256:<hex>), e.g. to check that a
+// manifest is no longer tagged before deleting it. Each tag is resolved once
+// with a HEAD request.
+func (c Client) TaggedRefs(ctx context.Context, creds Creds, repoRef, digest string) ([]string, error) {
+	c.logger.V(1).Info("finding tags", "repo", repoRef, "digest", digest)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return nil, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	readRepo, err := c.readRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	tags, err := remote.List(readRepo, remoteOpts...)
+	if err != nil {
+		return nil, registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	tagDigests, err := c.resolveTags(readRepo, tags, remoteOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for i, tag := range tags {
+		if tagDigests[i] == digest {
+			refs = append(refs, repo.Tag(tag).Name())
+		}
+	}
+
+	return refs, nil
+}
+
+// resolveTags returns the digests the tags in repo point to, indexed like
+// tags, with one HEAD request per tag. The digest of a tag deleted in the
+// meantime is empty.
+func (c Client) resolveTags(repo name.Repository, tags []string, remoteOpts []remote.Option) ([]string, error) {
+	limit := c.tagConcurrency
+	if limit < 1 {
+		limit = defaultTagConcurrency
+	}
+
+	// tagDigests is indexed like tags so that the goroutines do not need to
+	// synchronise
+	tagDigests := make([]string, len(tags))
+	var group errgroup.Group
+	group.SetLimit(limit)
+	for i, tag := range tags {
+		group.Go(func() error {
+			descriptor, headErr := remote.Head(repo.Tag(tag), remoteOpts...)
+			if headErr = ignoreNotFound(headErr); headErr != nil {
+				return registryError(repo.String(), fmt.Errorf("failed to get tag %q: %w", tag, headErr))
+			}
+			if descriptor != nil {
+				tagDigests[i] = descriptor.Digest.String()
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	return tagDigests, nil
+}
+
+// MigrateTag moves the tag in the repository to the image newImageRef points
+// to, provided the tag still points to expectedCurrentDigest. An empty
+// expectedCurrentDigest means the tag must not exist yet. Registries offer no
+// compare-and-swap, so a concurrent change between the check and the update
+// cannot be detected.
+func (c Client) MigrateTag(ctx context.Context, creds Creds, repoRef, tag, expectedCurrentDigest, newImageRef string) error {
+	c.logger.V(1).Info("migrating tag", "repo", repoRef, "tag", tag, "expected", expectedCurrentDigest, "new", newImageRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	newRef, err := c.parseReference(newImageRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", newImageRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	currentDigest := ""
+	current, err := remote.Head(repo.Tag(tag), remoteOpts...)
+	if err = ignoreNotFound(err); err != nil {
+		return registryError(repoRef, fmt.Errorf("failed to get tag %q: %w", tag, err))
+	}
+	if current != nil {
+		currentDigest = current.Digest.String()
+	}
+
+	if currentDigest != expectedCurrentDigest {
+		return fmt.Errorf("%w: %q points to %q instead of %q", ErrTagChanged, tag, currentDigest, expectedCurrentDigest)
+	}
+
+	descriptor, err := remote.Get(newRef, remoteOpts...)
+	if err != nil {
+		return registryError(newImageRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	if err = c.tagAll(repo, descriptor, []string{tag}, writeOpts); err != nil {
+		return pushError(repoRef, fmt.Errorf("failed to tag image: %w", err))
+	}
+
+	return nil
+}
+
+// SyncResult lists the tags SyncTags added, deleted and left as they were
+type SyncResult struct {
+	// Added holds the desired tags that were missing or pointed to another
+	// manifest
+	Added     []string
+	Deleted   []string
+	Unchanged []string
+}
+
+// SyncTags makes the tags of the repository the desired tags, all pointing
+// to the manifest digestRef points to, which must be in the repository.
+// Missing tags are added and desired tags pointing to another manifest are
+// moved before the tags that are not desired are deleted with DeleteTag.
+// Like DeleteTag, tags the registry cannot delete are left in place with a
+// warning and are not part of SyncResult.Deleted.
+func (c Client) SyncTags(ctx context.Context, creds Creds, repoRef, digestRef string, desiredTags []string) (SyncResult, error) {
+	c.logger.V(1).Info("syncing tags", "repo", repoRef, "ref", digestRef, "tags", desiredTags)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	ref, err := c.parseReference(digestRef)
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("error parsing repository reference %s: %w", digestRef, err)
+	}
+	if ref.Context().Name() != repo.Name() {
+		return SyncResult{}, fmt.Errorf("image %s is not in repository %s", digestRef, repoRef)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return SyncResult{}, authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	descriptor, err := remote.Get(ref, remoteOpts...)
+	if err != nil {
+		return SyncResult{}, registryError(digestRef, fmt.Errorf("failed to get image: %w", err))
+	}
+
+	tags, err := remote.List(repo, remoteOpts...)
+	if err = ignoreNotFound(err); err != nil {
+		return SyncResult{}, registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	tagDigests, err := c.resolveTags(repo, tags, remoteOpts)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	desired := map[string]bool{}
+	for _, tag := range desiredTags {
+		desired[tag] = true
+	}
+
+	result := SyncResult{Added: []string{}, Deleted: []string{}, Unchanged: []string{}}
+	current := map[string]bool{}
+	toDelete := []string{}
+	for i, tag := range tags {
+		switch {
+		case !desired[tag]:
+			toDelete = append(toDelete, tag)
+		case tagDigests[i] == descriptor.Digest.String():
+			current[tag] = true
+			result.Unchanged = append(result.Unchanged, tag)
+		}
+	}
+
+	for _, tag := range desiredTags {
+		if !current[tag] && !slices.Contains(result.Added, tag) {
+			result.Added = append(result.Added, tag)
+		}
+	}
+
+	writeOpts := append(remoteOpts, c.remoteRetryOpts()...)
+	if err = c.tagAll(repo, descriptor, result.Added, writeOpts); err != nil {
+		return SyncResult{}, pushError(repoRef, fmt.Errorf("failed to tag image: %w", err))
+	}
+
+	for _, tag := range toDelete {
+		deleted, deleteErr := c.removeTag(ctx, creds, repo, tag)
+		if deleteErr != nil {
+			return SyncResult{}, deleteErr
+		}
+		if deleted {
+			result.Deleted = append(result.Deleted, tag)
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteTag removes the tag from the repository, leaving the manifest it
+// points to and the other tags of the manifest in place, unlike Delete. The
+// tag is deleted through the tag API of the management API set with
+// WithRepositoryManagementAPI, if any, and otherwise with the OCI
+// distribution tag delete. Registries that do not support deleting tags
+// only, such as Docker Hub (see DetectRegistry), are left as they are with a
+// warning. Deleting a tag that does not exist succeeds.
+func (c Client) DeleteTag(ctx context.Context, creds Creds, repoRef, tag string) error {
+	c.logger.V(1).Info("deleting tag", "repo", repoRef, "tag", tag)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	_, err = c.removeTag(ctx, creds, repo, tag)
+	return err
+}
+
+// removeTag is DeleteTag, also reporting whether the tag is gone. It is not
+// when the registry does not support deleting tags.
+func (c Client) removeTag(ctx context.Context, creds Creds, repo name.Repository, tag string) (bool, error) {
+	var err error
+	switch {
+	case c.repositoryManagementAPI != "":
+		err = c.deleteTagWithManagementAPI(ctx, creds, repo.Tag(tag))
+	case c.detectVendor(ctx, creds, repo.RegistryStr()) == VendorDockerHub:
+		err = fmt.Errorf("%w: the Docker Hub registry API cannot delete tags", ErrNotSupported)
+	default:
+		err = c.deleteTagWithDistributionAPI(ctx, creds, repo.Tag(tag))
+	}
+
+	if errors.Is(err, ErrNotSupported) || isTagDeleteUnsupported(err) {
+		c.logger.Info("registry does not support deleting tags, leaving the tag in place", "repo", repo.String(), "tag", tag, "reason", err)
+		return false, nil
+	}
+	if err = ignoreNotFound(err); err != nil {
+		return false, pushError(repo.String(), fmt.Errorf("failed to delete tag %q: %w", tag, err))
+	}
+
+	return true, nil
+}
+
+func (c Client) deleteTagWithManagementAPI(ctx context.Context, creds Creds, tag name.Tag) error {
+	resp, err := c.managementAPIRequest(ctx, creds, tag.Context(), http.MethodDelete, artifactPath(tag)+"/tags/"+url.PathEscape(tag.TagStr()), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return transport.CheckError(resp, http.StatusOK, http.StatusAccepted, http.StatusNoContent)
+}
+
+func (c Client) deleteTagWithDistributionAPI(ctx context.Context, creds Creds, tag name.Tag) error {
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(tag.String(), fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	return c.retryOnError("delete-tag", func() error {
+		return remote.Delete(tag, append(remoteOpts, c.remoteRetryOpts()...)...)
+	})
+}
+
+// isTagDeleteUnsupported reports whether the registry rejected deleting a
+// tag as an unsupported operation
+func isTagDeleteUnsupported(err error) bool {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+
+	switch transportErr.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	for _, diagnostic := range transportErr.Errors {
+		if diagnostic.Code == transport.UnsupportedErrorCode {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,660 @@
+package image_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tags", func() {
+	var (
+		creds   image.Creds
+		pushRef string
+		imgRef  string
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		pushRef = containerRegistry.ImageRef("tags/app")
+		imgRef, err = imgClient.Push(ctx, creds, pushRef, zipFile)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Tag", func() {
+		var (
+			ref    string
+			tagErr error
+		)
+
+		BeforeEach(func() {
+			ref = imgRef
+		})
+
+		JustBeforeEach(func() {
+			tagErr = imgClient.Tag(ctx, creds, ref, "latest", "v1.2.3")
+		})
+
+		It("tags the image", func() {
+			Expect(tagErr).NotTo(HaveOccurred())
+
+			for _, tag := range []string{"latest", "v1.2.3"} {
+				exists, err := imgClient.Exists(ctx, creds, pushRef+":"+tag)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			}
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				ref = pushRef + ":not-a-tag"
+			})
+
+			It("fails", func() {
+				Expect(tagErr).To(MatchError(ContainSubstring("failed to get image")))
+			})
+		})
+
+		When("the ref is invalid", func() {
+			BeforeEach(func() {
+				ref += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(tagErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("ListTags", func() {
+		var (
+			repoRef string
+			tags    []string
+			listErr error
+		)
+
+		BeforeEach(func() {
+			repoRef = pushRef
+			Expect(imgClient.Tag(ctx, creds, imgRef, "jim", "bob")).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			tags, listErr = imgClient.ListTags(ctx, creds, repoRef)
+		})
+
+		It("lists the repository tags", func() {
+			Expect(listErr).NotTo(HaveOccurred())
+			Expect(tags).To(ContainElements("jim", "bob"))
+		})
+
+		When("the registry paginates the tags", func() {
+			BeforeEach(func() {
+				pagingRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.URL.Path == "/v2/":
+						w.WriteHeader(http.StatusOK)
+					case r.URL.Path == "/v2/foo/bar/tags/list" && r.URL.Query().Get("last") == "":
+						w.Header().Set("Link", `</v2/foo/bar/tags/list?n=2&last=bob>; rel="next"`)
+						_, _ = w.Write([]byte(`{"name":"foo/bar","tags":["alice","bob"]}`))
+					case r.URL.Path == "/v2/foo/bar/tags/list" && r.URL.Query().Get("last") == "bob":
+						_, _ = w.Write([]byte(`{"name":"foo/bar","tags":["jim"]}`))
+					default:
+						w.WriteHeader(http.StatusNotFound)
+					}
+				}))
+				DeferCleanup(pagingRegistry.Close)
+
+				serverURL, err := url.Parse(pagingRegistry.URL)
+				Expect(err).NotTo(HaveOccurred())
+				repoRef = serverURL.Host + "/foo/bar"
+				creds.SecretNames = []string{}
+			})
+
+			It("returns the tags of all pages", func() {
+				Expect(listErr).NotTo(HaveOccurred())
+				Expect(tags).To(Equal([]string{"alice", "bob", "jim"}))
+			})
+		})
+
+		When("the repository ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(listErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("TaggedRefs", func() {
+		var (
+			repoRef string
+			digest  string
+			refs    []string
+			findErr error
+		)
+
+		BeforeEach(func() {
+			repoRef = containerRegistry.ImageRef("tags/" + uuid.NewString())
+
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+			taggedRef, err := imgClient.Push(ctx, creds, repoRef, zipFile, "jim", "bob")
+			Expect(err).NotTo(HaveOccurred())
+			digest = taggedRef[strings.Index(taggedRef, "@")+1:]
+
+			otherZipFile, err := os.Open("fixtures/anotherLayer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(otherZipFile.Close)
+			_, err = imgClient.Push(ctx, creds, repoRef, otherZipFile, "alice")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			refs, findErr = imgClient.TaggedRefs(ctx, creds, repoRef, digest)
+		})
+
+		It("returns the tags pointing to the digest", func() {
+			Expect(findErr).NotTo(HaveOccurred())
+			Expect(refs).To(ConsistOf(repoRef+":jim", repoRef+":bob"))
+		})
+
+		When("no tag points to the digest", func() {
+			BeforeEach(func() {
+				digest = "sha256:" + strings.Repeat("0", 64)
+			})
+
+			It("returns no refs", func() {
+				Expect(findErr).NotTo(HaveOccurred())
+				Expect(refs).To(BeEmpty())
+			})
+		})
+
+		When("the repository ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += ":tag"
+			})
+
+			It("fails", func() {
+				Expect(findErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+	})
+
+	Describe("tag concurrency", func() {
+		var (
+			inFlight    int32
+			maxInFlight int32
+			failTag     string
+			tags        []string
+			tagErr      error
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&inFlight, 0)
+			atomic.StoreInt32(&maxInFlight, 0)
+			failTag = ""
+			tags = []string{}
+			for i := 0; i < 10; i++ {
+				tags = append(tags, fmt.Sprintf("tag-%d", i))
+			}
+
+			registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+			slowRegistry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/tag-") {
+					current := atomic.AddInt32(&inFlight, 1)
+					defer atomic.AddInt32(&inFlight, -1)
+					for {
+						observed := atomic.LoadInt32(&maxInFlight)
+						if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+							break
+						}
+					}
+					time.Sleep(50 * time.Millisecond)
+
+					if failTag != "" && strings.HasSuffix(r.URL.Path, "/"+failTag) {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+				}
+				registryHandler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(slowRegistry.Close)
+
+			serverURL, err := url.Parse(slowRegistry.URL)
+			Expect(err).NotTo(HaveOccurred())
+			pushRef = serverURL.Host + "/foo/bar"
+			creds.SecretNames = []string{}
+
+			imgClient = image.NewClient(k8sClientset, image.WithTagConcurrency(3))
+		})
+
+		JustBeforeEach(func() {
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+
+			_, tagErr = imgClient.Push(ctx, creds, pushRef, zipFile, tags...)
+		})
+
+		It("pushes the tags concurrently up to the limit", func() {
+			Expect(tagErr).NotTo(HaveOccurred())
+			Expect(atomic.LoadInt32(&maxInFlight)).To(BeEquivalentTo(3))
+
+			pushedTags, err := imgClient.ListTags(ctx, creds, pushRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pushedTags).To(ContainElements(tags))
+		})
+
+		When("a tag fails", func() {
+			BeforeEach(func() {
+				failTag = "tag-4"
+			})
+
+			It("returns the error", func() {
+				Expect(tagErr).To(MatchError(ContainSubstring("failed to tag image")))
+			})
+		})
+	})
+
+	Describe("MigrateTag", func() {
+		var (
+			expectedDigest string
+			newImgRef      string
+			migrateErr     error
+		)
+
+		digestOf := func(ref string) string {
+			GinkgoHelper()
+
+			digest, err := imgClient.Digest(ctx, creds, ref)
+			Expect(err).NotTo(HaveOccurred())
+			return digest
+		}
+
+		BeforeEach(func() {
+			Expect(imgClient.Tag(ctx, creds, imgRef, "live")).To(Succeed())
+			expectedDigest = digestOf(imgRef)
+
+			zipFile, err := os.Open("fixtures/anotherLayer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+
+			newImgRef, err = imgClient.Push(ctx, creds, pushRef, zipFile)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		JustBeforeEach(func() {
+			migrateErr = imgClient.MigrateTag(ctx, creds, pushRef, "live", expectedDigest, newImgRef)
+		})
+
+		It("moves the tag to the new image", func() {
+			Expect(migrateErr).NotTo(HaveOccurred())
+			Expect(digestOf(pushRef + ":live")).To(Equal(digestOf(newImgRef)))
+		})
+
+		When("the tag points to another digest", func() {
+			BeforeEach(func() {
+				expectedDigest = digestOf(newImgRef)
+			})
+
+			It("returns ErrTagChanged and leaves the tag alone", func() {
+				Expect(migrateErr).To(MatchError(image.ErrTagChanged))
+				Expect(digestOf(pushRef + ":live")).To(Equal(digestOf(imgRef)))
+			})
+		})
+
+		When("the tag does not exist and no digest is expected", func() {
+			BeforeEach(func() {
+				Expect(imgClient.Delete(ctx, creds, imgRef, "live")).To(Succeed())
+				expectedDigest = ""
+			})
+
+			It("creates the tag", func() {
+				Expect(migrateErr).NotTo(HaveOccurred())
+				Expect(digestOf(pushRef + ":live")).To(Equal(digestOf(newImgRef)))
+			})
+		})
+
+		When("the tag exists but is expected not to", func() {
+			BeforeEach(func() {
+				expectedDigest = ""
+			})
+
+			It("returns ErrTagChanged", func() {
+				Expect(migrateErr).To(MatchError(image.ErrTagChanged))
+			})
+		})
+	})
+
+	Describe("SyncTags", func() {
+		var (
+			repoRef     string
+			targetRef   string
+			otherRef    string
+			desiredTags []string
+			result      image.SyncResult
+			syncErr     error
+		)
+
+		digestOf := func(ref string) string {
+			GinkgoHelper()
+
+			digest, err := imgClient.Digest(ctx, creds, ref)
+			Expect(err).NotTo(HaveOccurred())
+			return digest
+		}
+
+		BeforeEach(func() {
+			repoRef = containerRegistry.ImageRef("tags/" + uuid.NewString())
+
+			zipFile, err := os.Open("fixtures/layer.zip")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(zipFile.Close)
+			targetRef, err = imgClient.Push(ctx, creds, repoRef, zipFile, "keep", "stale")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = zipFile.Seek(0, 0)
+			Expect(err).NotTo(HaveOccurred())
+			otherRef, err = imgClient.PushWithLabels(ctx, creds, repoRef, zipFile, map[string]string{"version": "2"}, "moved")
+			Expect(err).NotTo(HaveOccurred())
+
+			desiredTags = []string{"keep", "moved", "new"}
+		})
+
+		JustBeforeEach(func() {
+			result, syncErr = imgClient.SyncTags(ctx, creds, repoRef, targetRef, desiredTags)
+		})
+
+		It("makes the tags point to the image", func() {
+			Expect(syncErr).NotTo(HaveOccurred())
+			Expect(result).To(Equal(image.SyncResult{
+				Added:     []string{"moved", "new"},
+				Deleted:   []string{"latest", "stale"},
+				Unchanged: []string{"keep"},
+			}))
+
+			tags, err := imgClient.ListTags(ctx, creds, repoRef)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tags).To(ConsistOf("keep", "moved", "new"))
+
+			targetDigest := strings.Split(targetRef, "@")[1]
+			for _, tag := range tags {
+				Expect(digestOf(repoRef + ":" + tag)).To(Equal(targetDigest))
+			}
+			Expect(imgClient.Exists(ctx, creds, otherRef)).To(BeTrue())
+		})
+
+		When("the tags already match", func() {
+			BeforeEach(func() {
+				desiredTags = []string{"keep", "stale"}
+				Expect(imgClient.DeleteTag(ctx, creds, repoRef, "moved")).To(Succeed())
+				Expect(imgClient.DeleteTag(ctx, creds, repoRef, "latest")).To(Succeed())
+			})
+
+			It("changes nothing", func() {
+				Expect(syncErr).NotTo(HaveOccurred())
+				Expect(result.Added).To(BeEmpty())
+				Expect(result.Deleted).To(BeEmpty())
+				Expect(result.Unchanged).To(ConsistOf("keep", "stale"))
+			})
+		})
+
+		When("no tags are desired", func() {
+			BeforeEach(func() {
+				desiredTags = nil
+			})
+
+			It("deletes all tags", func() {
+				Expect(syncErr).NotTo(HaveOccurred())
+				Expect(result.Deleted).To(ConsistOf("keep", "stale", "moved", "latest"))
+
+				tags, err := imgClient.ListTags(ctx, creds, repoRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tags).To(BeEmpty())
+			})
+		})
+
+		When("the registry does not support deleting tags", func() {
+			BeforeEach(func() {
+				registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+				registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodDelete {
+						w.WriteHeader(http.StatusMethodNotAllowed)
+						return
+					}
+					registryHandler.ServeHTTP(w, r)
+				}))
+				DeferCleanup(registry.Close)
+
+				serverURL, err := url.Parse(registry.URL)
+				Expect(err).NotTo(HaveOccurred())
+				creds = image.Creds{Namespace: "default"}
+				repoRef = serverURL.Host + "/tags/app"
+
+				zipFile, err := os.Open("fixtures/layer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(zipFile.Close)
+				targetRef, err = imgClient.Push(ctx, creds, repoRef, zipFile, "keep", "stale")
+				Expect(err).NotTo(HaveOccurred())
+
+				desiredTags = []string{"keep"}
+			})
+
+			It("leaves the extra tags in place without reporting them as deleted", func() {
+				Expect(syncErr).NotTo(HaveOccurred())
+				Expect(result.Deleted).To(BeEmpty())
+				Expect(result.Unchanged).To(ConsistOf("keep"))
+				Expect(imgClient.Exists(ctx, creds, repoRef+":stale")).To(BeTrue())
+			})
+		})
+
+		When("the image is in another repository", func() {
+			BeforeEach(func() {
+				targetRef = imgRef
+			})
+
+			It("fails without changing the tags", func() {
+				Expect(syncErr).To(MatchError(ContainSubstring("is not in repository")))
+
+				tags, err := imgClient.ListTags(ctx, creds, repoRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tags).To(ConsistOf("keep", "stale", "moved", "latest"))
+			})
+		})
+
+		When("the image does not exist", func() {
+			BeforeEach(func() {
+				targetRef = repoRef + "@sha256:" + strings.Repeat("0", 64)
+			})
+
+			It("returns a NotFoundError", func() {
+				var notFoundErr *image.NotFoundError
+				Expect(errors.As(syncErr, &notFoundErr)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("DeleteTag", func() {
+		var (
+			repoRef   string
+			tag       string
+			deleteErr error
+		)
+
+		exists := func(ref string) bool {
+			GinkgoHelper()
+
+			found, err := imgClient.Exists(ctx, creds, ref)
+			Expect(err).NotTo(HaveOccurred())
+			return found
+		}
+
+		BeforeEach(func() {
+			repoRef = pushRef
+			tag = "jim"
+			Expect(imgClient.Tag(ctx, creds, imgRef, "jim", "bob")).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			deleteErr = imgClient.DeleteTag(ctx, creds, repoRef, tag)
+		})
+
+		It("deletes the tag only", func() {
+			Expect(deleteErr).NotTo(HaveOccurred())
+			Expect(exists(pushRef + ":jim")).To(BeFalse())
+			Expect(exists(pushRef + ":bob")).To(BeTrue())
+			Expect(exists(imgRef)).To(BeTrue())
+		})
+
+		When("the tag does not exist", func() {
+			BeforeEach(func() {
+				tag = "not-a-tag"
+			})
+
+			It("succeeds", func() {
+				Expect(deleteErr).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the repo ref is invalid", func() {
+			BeforeEach(func() {
+				repoRef += "::bad"
+			})
+
+			It("fails", func() {
+				Expect(deleteErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+			})
+		})
+
+		When("the registry does not support deleting tags", func() {
+			BeforeEach(func() {
+				registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+				registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodDelete {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusBadRequest)
+						fmt.Fprint(w, `{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`)
+						return
+					}
+					registryHandler.ServeHTTP(w, r)
+				}))
+				DeferCleanup(registry.Close)
+
+				serverURL, err := url.Parse(registry.URL)
+				Expect(err).NotTo(HaveOccurred())
+				creds = image.Creds{Namespace: "default"}
+				repoRef = serverURL.Host + "/tags/app"
+
+				zipFile, err := os.Open("fixtures/layer.zip")
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(zipFile.Close)
+
+				_, err = imgClient.Push(ctx, creds, repoRef, zipFile, "jim")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("leaves the tag in place", func() {
+				Expect(deleteErr).NotTo(HaveOccurred())
+				Expect(exists(repoRef + ":jim")).To(BeTrue())
+			})
+		})
+
+		When("the registry is Docker Hub", func() {
+			var deletes int32
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&deletes, 0)
+				registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodDelete {
+						atomic.AddInt32(&deletes, 1)
+					}
+					w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`)
+					w.WriteHeader(http.StatusUnauthorized)
+				}))
+				DeferCleanup(registry.Close)
+
+				serverURL, err := url.Parse(registry.URL)
+				Expect(err).NotTo(HaveOccurred())
+				creds = image.Creds{Namespace: "default"}
+				repoRef = serverURL.Host + "/tags/app"
+			})
+
+			It("leaves the tag in place without trying to delete it", func() {
+				Expect(deleteErr).NotTo(HaveOccurred())
+				Expect(atomic.LoadInt32(&deletes)).To(BeZero())
+			})
+		})
+
+		When("a management API is configured", func() {
+			var (
+				requests   []string
+				tagsStatus int
+			)
+
+			BeforeEach(func() {
+				requests = nil
+				tagsStatus = http.StatusOK
+
+				managementAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+					w.WriteHeader(tagsStatus)
+				}))
+				DeferCleanup(managementAPI.Close)
+
+				imgClient = image.NewClient(k8sClientset, image.WithRepositoryManagementAPI(managementAPI.URL+"/api/v2.0"))
+			})
+
+			It("deletes the tag through the tag API", func() {
+				Expect(deleteErr).NotTo(HaveOccurred())
+				Expect(requests).To(Equal([]string{
+					"DELETE /api/v2.0/repositories/tags%2Fapp/artifacts/jim/tags/jim",
+				}))
+			})
+
+			When("the management API has no tag API", func() {
+				BeforeEach(func() {
+					tagsStatus = http.StatusMethodNotAllowed
+				})
+
+				It("leaves the tag in place", func() {
+					Expect(deleteErr).NotTo(HaveOccurred())
+					Expect(exists(pushRef + ":jim")).To(BeTrue())
+				})
+			})
+
+			When("the management API rejects the request", func() {
+				BeforeEach(func() {
+					tagsStatus = http.StatusForbidden
+				})
+
+				It("fails", func() {
+					Expect(deleteErr).To(MatchError(ContainSubstring(`failed to delete tag "jim"`)))
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "korifi/image"
+
+// WithTracerProvider makes the client record the spans of Push, Config,
+// Delete, Copy and RenameRepository calls with tp instead of the global
+// tracer provider. The context passed to the registry transport carries the
+// span, so that a transport instrumented with WithTransport can create
+// child spans for the HTTP requests.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracerProvider = tp
+	}
+}
+
+// startSpan starts a span for operation on imageRef. The returned function
+// ends it and is meant to be deferred by public methods with a named error
+// result.
+func (c Client) startSpan(ctx context.Context, operation, imageRef string) (context.Context, func(*error)) {
+	ctx, span := c.tracerProvider.Tracer(tracerName).Start(ctx, operation, trace.WithAttributes(
+		attribute.String("registry.host", registryLabel(imageRef)),
+		attribute.String("image.ref", imageRef),
+	))
+
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
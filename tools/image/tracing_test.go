@@ -0,0 +1,172 @@
+package image_test
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracerProvider records the spans started by its tracers
+type recordingTracerProvider struct {
+	noop.TracerProvider
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (p *recordingTracerProvider) Tracer(name string, _ ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p, name: name}
+}
+
+func (p *recordingTracerProvider) recorded() []*recordedSpan {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.spans
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	provider *recordingTracerProvider
+	name     string
+}
+
+func (t recordingTracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{
+		tracerName: t.name,
+		name:       spanName,
+		attributes: map[string]string{},
+		parent:     trace.SpanFromContext(ctx),
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	for _, attr := range config.Attributes() {
+		span.attributes[string(attr.Key)] = attr.Value.Emit()
+	}
+
+	t.provider.mutex.Lock()
+	t.provider.spans = append(t.provider.spans, span)
+	t.provider.mutex.Unlock()
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordedSpan struct {
+	noop.Span
+	tracerName string
+	name       string
+	attributes map[string]string
+	parent     trace.Span
+	status     codes.Code
+	err        error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attributes[string(attr.Key)] = attr.Value.Emit()
+	}
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+func (s *recordedSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+var _ = Describe("WithTracerProvider", func() {
+	var (
+		tracerProvider *recordingTracerProvider
+		creds          image.Creds
+		repoRef        string
+		pushErr        error
+	)
+
+	BeforeEach(func() {
+		tracerProvider = &recordingTracerProvider{}
+		imgClient = image.NewClient(k8sClientset, image.WithTracerProvider(tracerProvider))
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("tracing/" + uuid.NewString())
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		_, pushErr = imgClient.Push(ctx, creds, repoRef, zipFile)
+	})
+
+	It("records a span for the push", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+
+		registryURL, err := url.Parse(containerRegistry.URL())
+		Expect(err).NotTo(HaveOccurred())
+
+		spans := tracerProvider.recorded()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].tracerName).To(Equal("korifi/image"))
+		Expect(spans[0].name).To(Equal("Push"))
+		Expect(spans[0].attributes).To(Equal(map[string]string{
+			"registry.host": registryURL.Host,
+			"image.ref":     repoRef,
+		}))
+		Expect(spans[0].status).To(Equal(codes.Unset))
+		Expect(spans[0].ended).To(BeTrue())
+	})
+
+	It("records spans for the other operations", func() {
+		_, err := imgClient.Config(ctx, creds, repoRef)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imgClient.Delete(ctx, creds, repoRef, "latest")).To(Succeed())
+
+		names := []string{}
+		for _, span := range tracerProvider.recorded() {
+			names = append(names, span.name)
+		}
+		Expect(names).To(Equal([]string{"Push", "Config", "Delete"}))
+	})
+
+	When("the operation is called within a span", func() {
+		var parent *recordedSpan
+
+		BeforeEach(func() {
+			var parentCtx context.Context
+			parentCtx, _ = tracerProvider.Tracer("caller").Start(ctx, "stage")
+			parent = tracerProvider.recorded()[0]
+
+			_, err := imgClient.Config(parentCtx, creds, containerRegistry.ImageRef("tracing/"+uuid.NewString()))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("records a child span", func() {
+			spans := tracerProvider.recorded()
+			Expect(spans[1].name).To(Equal("Config"))
+			Expect(spans[1].parent).To(BeIdenticalTo(parent))
+		})
+	})
+
+	When("the operation fails", func() {
+		BeforeEach(func() {
+			creds = image.Creds{}
+		})
+
+		It("records the error on the span", func() {
+			Expect(pushErr).To(HaveOccurred())
+
+			spans := tracerProvider.recorded()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].status).To(Equal(codes.Error))
+			Expect(spans[0].err).To(MatchError(pushErr))
+			Expect(spans[0].ended).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WithTransport makes the client use rt for all registry calls, e.g. to go
+// through a corporate proxy or trust a private CA. Defaults to the transport
+// of the client's registry HTTP client.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithHTTPClient replaces the HTTP client used for registry calls, e.g. with
+// the client of a fake registry server in tests. go-containerregistry only
+// takes a transport, so apart from ValidateCreds only the client's transport
+// is used.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.registryHTTPClient = httpClient
+	}
+}
+
+// WithHTTP2 controls whether the client negotiates HTTP/2 over TLS with
+// registries that offer it through ALPN, which multiplexes parallel layer
+// uploads and tag requests over a single connection. It is enabled by
+// default. Plain HTTP registries always use HTTP/1.1. It has no effect when
+// WithTransport or WithHTTPClient is used.
+func WithHTTP2(enabled bool) Option {
+	return func(c *Client) {
+		c.http2 = enabled
+	}
+}
+
+// WithTLSCACert makes the client trust registries whose certificates are
+// signed by one of the CAs in the PEM bundle, e.g. on-premises registries
+// with a self-signed certificate, in addition to the system CAs. The bundle
+// is parsed right away and an error is returned if it holds no valid
+// certificate. Like WithHTTP2, it has no effect when WithTransport or
+// WithHTTPClient is used.
+func WithTLSCACert(pemBundle []byte) (Option, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	if !rootCAs.AppendCertsFromPEM(pemBundle) {
+		return nil, errors.New("no valid certificates found in the CA bundle")
+	}
+
+	return func(c *Client) {
+		c.rootCAs = rootCAs
+	}, nil
+}
+
+// newRegistryHTTPClient returns a client whose connections are kept alive
+// and reused across the calls made by a Client. rootCAs replaces the system
+// CAs when not nil.
+func newRegistryHTTPClient(http2 bool, rootCAs *x509.CertPool) *http.Client {
+	var tlsConfig *tls.Config
+	if rootCAs != nil {
+		tlsConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			// net/http only negotiates HTTP/2 with a custom dialer when
+			// forced to
+			ForceAttemptHTTP2:     http2,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			MaxConnsPerHost:       50,
+			IdleConnTimeout:       90 * time.Second,
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,245 @@
+package image_test
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+	var (
+		tlsRegistry *httptest.Server
+		pushRef     string
+		pushErr     error
+	)
+
+	BeforeEach(func() {
+		tlsRegistry = httptest.NewTLSServer(ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0))))
+		DeferCleanup(tlsRegistry.Close)
+
+		serverURL, err := url.Parse(tlsRegistry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		pushRef = serverURL.Host + "/foo/bar"
+
+		imgClient = image.NewClient(k8sClientset, image.WithTransport(tlsRegistry.Client().Transport))
+	})
+
+	JustBeforeEach(func() {
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		_, pushErr = imgClient.Push(ctx, image.Creds{Namespace: "default"}, pushRef, zipFile)
+	})
+
+	It("pushes to a registry whose CA is trusted by the transport", func() {
+		Expect(pushErr).NotTo(HaveOccurred())
+	})
+
+	When("no transport is configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset)
+		})
+
+		It("fails to verify the registry certificate", func() {
+			Expect(pushErr).To(HaveOccurred())
+		})
+	})
+
+	When("an HTTP client is configured", func() {
+		BeforeEach(func() {
+			imgClient = image.NewClient(k8sClientset, image.WithHTTPClient(tlsRegistry.Client()))
+		})
+
+		It("uses its transport", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the CA of the registry is configured", func() {
+		BeforeEach(func() {
+			caCert, err := image.WithTLSCACert(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: tlsRegistry.Certificate().Raw,
+			}))
+			Expect(err).NotTo(HaveOccurred())
+
+			imgClient = image.NewClient(k8sClientset, caCert)
+		})
+
+		It("verifies the registry certificate", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("WithTLSCACert", func() {
+		It("fails when the bundle holds no certificate", func() {
+			_, err := image.WithTLSCACert([]byte("not a certificate"))
+			Expect(err).To(MatchError(ContainSubstring("no valid certificates")))
+		})
+	})
+
+	Describe("connection reuse", func() {
+		var newConnections int32
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&newConnections, 0)
+			// plain HTTP registries on localhost are always pinged over HTTPS
+			// first, which opens a connection on every call
+			countingRegistry := httptest.NewUnstartedServer(ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0))))
+			countingRegistry.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&newConnections, 1)
+				}
+			}
+			countingRegistry.StartTLS()
+			DeferCleanup(countingRegistry.Close)
+
+			serverURL, err := url.Parse(countingRegistry.URL)
+			Expect(err).NotTo(HaveOccurred())
+			pushRef = serverURL.Host + "/foo/bar"
+
+			imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(serverURL.Host))
+		})
+
+		It("keeps connections alive across calls", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			connectionsAfterPush := atomic.LoadInt32(&newConnections)
+
+			for i := 0; i < 5; i++ {
+				exists, err := imgClient.Exists(ctx, image.Creds{Namespace: "default"}, pushRef)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exists).To(BeTrue())
+			}
+			Expect(atomic.LoadInt32(&newConnections)).To(Equal(connectionsAfterPush))
+		})
+	})
+
+	Describe("HTTP/2", func() {
+		var (
+			protocols    chan string
+			registryHost string
+		)
+
+		newRecordingRegistry := func(tls bool) string {
+			GinkgoHelper()
+
+			registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+			registry := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case protocols <- r.Proto:
+				default:
+				}
+				registryHandler.ServeHTTP(w, r)
+			}))
+			if tls {
+				registry.EnableHTTP2 = true
+				registry.StartTLS()
+			} else {
+				registry.Start()
+			}
+			DeferCleanup(registry.Close)
+
+			serverURL, err := url.Parse(registry.URL)
+			Expect(err).NotTo(HaveOccurred())
+			return serverURL.Host
+		}
+
+		receivedProtocols := func() []string {
+			close(protocols)
+			received := []string{}
+			for protocol := range protocols {
+				received = append(received, protocol)
+			}
+			return received
+		}
+
+		BeforeEach(func() {
+			protocols = make(chan string, 1000)
+			registryHost = newRecordingRegistry(true)
+			pushRef = registryHost + "/foo/bar"
+			imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(registryHost))
+		})
+
+		It("is negotiated with registries offering it", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(receivedProtocols()).To(HaveEach("HTTP/2.0"))
+		})
+
+		When("it is disabled", func() {
+			BeforeEach(func() {
+				imgClient = image.NewClient(k8sClientset, image.WithHTTP2(false), image.WithInsecureRegistries(registryHost))
+			})
+
+			It("uses HTTP/1.1", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+				Expect(receivedProtocols()).To(HaveEach("HTTP/1.1"))
+			})
+		})
+
+		When("the registry does not use TLS", func() {
+			BeforeEach(func() {
+				registryHost = newRecordingRegistry(false)
+				pushRef = registryHost + "/foo/bar"
+				imgClient = image.NewClient(k8sClientset, image.WithInsecureRegistries(registryHost))
+			})
+
+			It("falls back to HTTP/1.1", func() {
+				Expect(pushErr).NotTo(HaveOccurred())
+				Expect(receivedProtocols()).To(HaveEach("HTTP/1.1"))
+			})
+		})
+	})
+})
+
+// BenchmarkPushTags compares pushing an image with 10 tags, which are applied
+// in parallel, over HTTP/1.1 and HTTP/2
+func BenchmarkPushTags(b *testing.B) {
+	server := httptest.NewUnstartedServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	tags := []string{}
+	for i := 0; i < 10; i++ {
+		tags = append(tags, fmt.Sprintf("tag-%d", i))
+	}
+
+	for _, http2 := range []bool{false, true} {
+		b.Run(fmt.Sprintf("http2=%t", http2), func(b *testing.B) {
+			client := image.NewClient(nil, image.WithHTTP2(http2), image.WithInsecureRegistries(serverURL.Host))
+			repoRef := fmt.Sprintf("%s/bench/http2-%t", serverURL.Host, http2)
+
+			for i := 0; i < b.N; i++ {
+				zipFile, err := os.Open("fixtures/layer.zip")
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err = client.Push(context.Background(), image.Creds{}, repoRef, zipFile, tags...); err != nil {
+					b.Fatal(err)
+				}
+				zipFile.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrCredentialNotFound is returned by ValidateSecrets when a secret named in
+// Creds does not exist
+var ErrCredentialNotFound = errors.New("credential secret not found")
+
+// ValidateSecrets checks that the secrets named in creds exist and hold
+// docker registry credentials. A missing secret is otherwise silently
+// ignored when building the keychain and only shows up as a registry
+// authentication failure.
+func (c Client) ValidateSecrets(ctx context.Context, creds Creds) error {
+	for _, secretName := range creds.SecretNames {
+		secret, err := c.k8sClient.CoreV1().Secrets(creds.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("%w: %s/%s", ErrCredentialNotFound, creds.Namespace, secretName)
+			}
+			return fmt.Errorf("failed to get secret %s/%s: %w", creds.Namespace, secretName, err)
+		}
+
+		// the legacy dockercfg format is still read by the keychain
+		if secret.Type != corev1.SecretTypeDockerConfigJson && secret.Type != corev1.SecretTypeDockercfg {
+			return fmt.Errorf("secret %s/%s has type %q, expected %q", creds.Namespace, secretName, secret.Type, corev1.SecretTypeDockerConfigJson)
+		}
+	}
+
+	return nil
+}
+
+// ValidateCreds checks that the secrets in creds are valid and that the
+// registry accepts them for pushing to repoRef, without uploading anything
+func (c Client) ValidateCreds(ctx context.Context, creds Creds, repoRef string) error {
+	c.logger.V(1).Info("validating credentials", "repo", repoRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	if err = c.ValidateSecrets(ctx, creds); err != nil {
+		return err
+	}
+
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	auth, err := keychain.Resolve(repo)
+	if err != nil {
+		return fmt.Errorf("failed to resolve credentials from %s: %w", credsSource(creds), err)
+	}
+
+	baseTransport := c.transport
+	if baseTransport == nil {
+		baseTransport = remote.DefaultTransport
+	}
+
+	// Token based registries reject the credentials when issuing the push
+	// token, basic auth ones only when the authenticated endpoint is called
+	authTransport, err := transport.NewWithContext(ctx, repo.Registry, auth, baseTransport, []string{repo.Scope(transport.PushScope)})
+	if err != nil {
+		return credsError(creds, repoRef, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", repo.Registry.Scheme(), repo.RegistryStr()), nil)
+	if err != nil {
+		return err
+	}
+
+	httpClient := http.Client{Transport: authTransport}
+	if c.registryHTTPClient != nil {
+		httpClient = *c.registryHTTPClient
+		httpClient.Transport = authTransport
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err = transport.CheckError(resp, http.StatusOK); err != nil {
+		return credsError(creds, repoRef, err)
+	}
+
+	return nil
+}
+
+func credsError(creds Creds, repoRef string, err error) error {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) &&
+		(transportErr.StatusCode == http.StatusUnauthorized || transportErr.StatusCode == http.StatusForbidden) {
+		return authError(repoRef, fmt.Errorf("registry rejected credentials from %s for %s: %w", credsSource(creds), repoRef, err))
+	}
+
+	return fmt.Errorf("failed to validate credentials from %s for %s: %w", credsSource(creds), repoRef, err)
+}
+
+func credsSource(creds Creds) string {
+	sources := []string{}
+	if len(creds.SecretNames) > 0 {
+		sources = append(sources, fmt.Sprintf("secrets %s/%s", creds.Namespace, strings.Join(creds.SecretNames, ",")))
+	}
+	if creds.ServiceAccountName != "" {
+		sources = append(sources, fmt.Sprintf("service account %s/%s", creds.Namespace, creds.ServiceAccountName))
+	}
+	if len(sources) == 0 {
+		return "the default keychain"
+	}
+
+	return strings.Join(sources, " and ")
+}
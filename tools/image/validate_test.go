@@ -0,0 +1,113 @@
+package image_test
+
+import (
+	"code.cloudfoundry.org/korifi/tests/helpers/oci"
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ValidateCreds", func() {
+	var (
+		creds       image.Creds
+		repoRef     string
+		validateErr error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("validate/app")
+	})
+
+	JustBeforeEach(func() {
+		validateErr = imgClient.ValidateCreds(ctx, creds, repoRef)
+	})
+
+	It("succeeds", func() {
+		Expect(validateErr).NotTo(HaveOccurred())
+	})
+
+	When("using a service account for secrets", func() {
+		BeforeEach(func() {
+			creds.SecretNames = []string{}
+			creds.ServiceAccountName = serviceAccountName
+		})
+
+		It("succeeds", func() {
+			Expect(validateErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the secret doesn't exist", func() {
+		BeforeEach(func() {
+			creds.SecretNames = []string{"not-a-secret"}
+		})
+
+		It("fails before calling the registry", func() {
+			Expect(validateErr).To(MatchError(image.ErrCredentialNotFound))
+			Expect(validateErr).To(MatchError(ContainSubstring("default/not-a-secret")))
+		})
+	})
+
+	When("the secret holds the wrong credentials", func() {
+		BeforeEach(func() {
+			secret, err := dockercfg.CreateDockerConfigSecret("default", uuid.NewString(), dockercfg.DockerServerConfig{
+				Server:   containerRegistry.URL(),
+				Username: "user",
+				Password: "not-the-password",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			creds.SecretNames = []string{secret.Name}
+		})
+
+		It("names the rejected credentials", func() {
+			Expect(validateErr).To(MatchError(ContainSubstring("registry rejected credentials from secrets default/" + creds.SecretNames[0])))
+			Expect(validateErr).To(MatchError(ContainSubstring("UNAUTHORIZED")))
+		})
+	})
+
+	When("the secret does not hold registry credentials", func() {
+		BeforeEach(func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: uuid.NewString()},
+				Type:       corev1.SecretTypeOpaque,
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			creds.SecretNames = []string{secret.Name}
+		})
+
+		It("fails", func() {
+			Expect(validateErr).To(MatchError(ContainSubstring(`has type "Opaque", expected "kubernetes.io/dockerconfigjson"`)))
+		})
+	})
+
+	When("the registry does not require authentication", func() {
+		BeforeEach(func() {
+			repoRef = oci.NewNoAuthContainerRegistry().ImageRef("validate/app")
+			creds.SecretNames = []string{}
+		})
+
+		It("succeeds", func() {
+			Expect(validateErr).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the repository ref is invalid", func() {
+		BeforeEach(func() {
+			repoRef += ":tag"
+		})
+
+		It("fails", func() {
+			Expect(validateErr).To(MatchError(ContainSubstring("error parsing repository reference")))
+		})
+	})
+})
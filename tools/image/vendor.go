@@ -0,0 +1,134 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// RegistryVendor is the kind of registry DetectRegistry found, for
+// operations that need vendor specific APIs
+type RegistryVendor string
+
+const (
+	VendorDockerHub  RegistryVendor = "dockerhub"
+	VendorGCR        RegistryVendor = "gcr"
+	VendorHarbor     RegistryVendor = "harbor"
+	VendorECR        RegistryVendor = "ecr"
+	VendorGenericOCI RegistryVendor = "oci"
+)
+
+// DetectRegistry probes the /v2/ endpoint of the registry at host (including
+// the port, if any) and classifies it from the response headers: the
+// X-Registry-Type header when the registry sets one, the Harbor CSRF token
+// and the token realm of the auth challenge. When the anonymous probe is
+// rejected without revealing the vendor, it is repeated with the basic auth
+// credentials for the registry in creds. Registries that cannot be told
+// apart are VendorGenericOCI.
+func (c Client) DetectRegistry(ctx context.Context, creds Creds, host string) (RegistryVendor, error) {
+	c.logger.V(1).Info("detecting registry", "host", host)
+	registry, err := c.parseRegistry(host)
+	if err != nil {
+		return "", fmt.Errorf("error parsing registry %s: %w", host, err)
+	}
+
+	resp, err := c.probeRegistry(ctx, registry, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	vendor := classifyRegistry(registry.RegistryStr(), resp.Header)
+	if vendor != VendorGenericOCI || resp.StatusCode != http.StatusUnauthorized {
+		return vendor, nil
+	}
+
+	keychain, err := c.keychain(ctx, creds)
+	if err != nil {
+		return "", authError(host, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	auth, err := keychain.Resolve(registry)
+	if err != nil {
+		return "", authError(host, fmt.Errorf("failed to resolve credentials from %s: %w", credsSource(creds), err))
+	}
+
+	authConfig, err := auth.Authorization()
+	if err != nil {
+		return "", authError(host, fmt.Errorf("failed to get credentials: %w", err))
+	}
+	if authConfig.Username == "" && authConfig.Password == "" {
+		return vendor, nil
+	}
+
+	resp, err = c.probeRegistry(ctx, registry, authConfig.Username, authConfig.Password)
+	if err != nil {
+		return "", err
+	}
+
+	return classifyRegistry(registry.RegistryStr(), resp.Header), nil
+}
+
+// detectVendor is DetectRegistry for choosing a code path: registries that
+// cannot be probed are treated as VendorGenericOCI
+func (c Client) detectVendor(ctx context.Context, creds Creds, host string) RegistryVendor {
+	vendor, err := c.DetectRegistry(ctx, creds, host)
+	if err != nil {
+		c.logger.V(1).Info("failed to detect registry - assuming a generic OCI registry", "host", host, "reason", err)
+		return VendorGenericOCI
+	}
+
+	return vendor
+}
+
+// probeRegistry sends a GET to the /v2/ endpoint of the registry, with basic
+// auth unless username and password are empty, and returns the response
+// with its body already closed
+func (c Client) probeRegistry(ctx context.Context, registry name.Registry, username, password string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/", registry.Scheme(), registry.RegistryStr()), nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	httpClient := http.Client{Transport: c.transport}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+func classifyRegistry(host string, header http.Header) RegistryVendor {
+	switch vendor := RegistryVendor(strings.ToLower(header.Get("X-Registry-Type"))); vendor {
+	case VendorDockerHub, VendorGCR, VendorHarbor, VendorECR:
+		return vendor
+	}
+
+	if header.Get("X-Harbor-CSRF-Token") != "" {
+		return VendorHarbor
+	}
+
+	challenge := strings.ToLower(header.Get("WWW-Authenticate"))
+	switch {
+	case strings.Contains(challenge, "/service/token"):
+		return VendorHarbor
+	case strings.Contains(challenge, "auth.docker.io") || host == name.DefaultRegistry || host == "registry-1.docker.io":
+		return VendorDockerHub
+	case strings.Contains(challenge, "gcr.io") || strings.Contains(challenge, "pkg.dev") ||
+		strings.HasSuffix(host, "gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		return VendorGCR
+	case strings.Contains(challenge, "amazonaws.com") || strings.Contains(host, ".dkr.ecr."):
+		return VendorECR
+	}
+
+	return VendorGenericOCI
+}
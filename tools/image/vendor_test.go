@@ -0,0 +1,133 @@
+package image_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"code.cloudfoundry.org/korifi/tools/dockercfg"
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DetectRegistry", func() {
+	var (
+		anonymousHeaders map[string]string
+		authHeaders      map[string]string
+		creds            image.Creds
+		host             string
+		vendor           image.RegistryVendor
+		detectErr        error
+	)
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset)
+		anonymousHeaders = map[string]string{}
+		authHeaders = map[string]string{}
+
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/v2/"))
+
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "password" {
+				for key, value := range anonymousHeaders {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			for key, value := range authHeaders {
+				w.Header().Set(key, value)
+			}
+		}))
+		DeferCleanup(registry.Close)
+
+		serverURL, err := url.Parse(registry.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host = serverURL.Host
+
+		registrySecret, err := dockercfg.CreateDockerConfigSecret("default", uuid.NewString(), dockercfg.DockerServerConfig{
+			Server:   host,
+			Username: "user",
+			Password: "password",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Create(ctx, registrySecret)).To(Succeed())
+		creds = image.Creds{Namespace: "default", SecretNames: []string{registrySecret.Name}}
+	})
+
+	JustBeforeEach(func() {
+		vendor, detectErr = imgClient.DetectRegistry(ctx, creds, host)
+	})
+
+	It("detects a generic OCI registry", func() {
+		Expect(detectErr).NotTo(HaveOccurred())
+		Expect(vendor).To(Equal(image.VendorGenericOCI))
+	})
+
+	DescribeTable("classifying the registry from the anonymous response",
+		func(headers map[string]string, expected image.RegistryVendor) {
+			for key, value := range headers {
+				anonymousHeaders[key] = value
+			}
+
+			vendor, detectErr = imgClient.DetectRegistry(ctx, creds, host)
+			Expect(detectErr).NotTo(HaveOccurred())
+			Expect(vendor).To(Equal(expected))
+		},
+		Entry("X-Registry-Type", map[string]string{"X-Registry-Type": "ECR"}, image.VendorECR),
+		Entry("Harbor CSRF token", map[string]string{"X-Harbor-CSRF-Token": "token"}, image.VendorHarbor),
+		Entry("Harbor token realm", map[string]string{"WWW-Authenticate": `Bearer realm="https://harbor.example.com/service/token",service="harbor-registry"`}, image.VendorHarbor),
+		Entry("Docker Hub token realm", map[string]string{"WWW-Authenticate": `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`}, image.VendorDockerHub),
+		Entry("GCR token realm", map[string]string{"WWW-Authenticate": `Bearer realm="https://gcr.io/v2/token",service="gcr.io"`}, image.VendorGCR),
+		Entry("Artifact Registry token realm", map[string]string{"WWW-Authenticate": `Bearer realm="https://europe-docker.pkg.dev/v2/token",service="europe-docker.pkg.dev"`}, image.VendorGCR),
+		Entry("ECR basic realm", map[string]string{"WWW-Authenticate": `Basic realm="https://123456789012.dkr.ecr.eu-west-1.amazonaws.com/",service="ecr.amazonaws.com"`}, image.VendorECR),
+		Entry("unknown registry type", map[string]string{"X-Registry-Type": "quay"}, image.VendorGenericOCI),
+	)
+
+	When("the registry only reveals its vendor to authenticated requests", func() {
+		BeforeEach(func() {
+			anonymousHeaders["WWW-Authenticate"] = `Basic realm="Registry"`
+			authHeaders["X-Harbor-CSRF-Token"] = "token"
+		})
+
+		It("probes again with the credentials", func() {
+			Expect(detectErr).NotTo(HaveOccurred())
+			Expect(vendor).To(Equal(image.VendorHarbor))
+		})
+
+		When("there are no credentials for the registry", func() {
+			BeforeEach(func() {
+				creds = image.Creds{Namespace: "default"}
+			})
+
+			It("detects a generic OCI registry", func() {
+				Expect(detectErr).NotTo(HaveOccurred())
+				Expect(vendor).To(Equal(image.VendorGenericOCI))
+			})
+		})
+	})
+
+	When("the registry is unreachable", func() {
+		BeforeEach(func() {
+			host = "127.0.0.1:1"
+		})
+
+		It("fails", func() {
+			Expect(detectErr).To(MatchError(ContainSubstring("failed to reach registry")))
+		})
+	})
+
+	When("the host is invalid", func() {
+		BeforeEach(func() {
+			host = "not a host"
+		})
+
+		It("fails", func() {
+			Expect(detectErr).To(MatchError(ContainSubstring("error parsing registry")))
+		})
+	})
+})
@@ -0,0 +1,126 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const defaultWatchInterval = 30 * time.Second
+
+type TagEventType string
+
+const (
+	TagPushed  TagEventType = "push"
+	TagDeleted TagEventType = "delete"
+)
+
+type TagEvent struct {
+	Tag    string
+	Digest string
+	Type   TagEventType
+}
+
+// WithWatchInterval sets how often Watch polls the registry for tag changes.
+// Defaults to 30s.
+func WithWatchInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.watchInterval = interval
+	}
+}
+
+// Watch sends an event to events whenever a tag in the repository is pushed,
+// moved to another digest or deleted, until ctx is done. Registries have no
+// common notification API, so the tag list is polled and diffed; tags present
+// when Watch starts are not reported. Failing to poll is logged and retried
+// at the next interval, apart from the first poll whose error is returned.
+func (c Client) Watch(ctx context.Context, creds Creds, repoRef string, events chan<- TagEvent) error {
+	c.logger.V(1).Info("watching", "repo", repoRef)
+	repo, err := c.parseRepository(repoRef)
+	if err != nil {
+		return fmt.Errorf("error parsing repository reference %s: %w", repoRef, err)
+	}
+
+	remoteOpts, err := c.remoteOpts(ctx, creds)
+	if err != nil {
+		return authError(repoRef, fmt.Errorf("error creating keychain: %w", err))
+	}
+
+	known, err := c.tagDigests(repo, remoteOpts)
+	if err != nil {
+		return registryError(repoRef, fmt.Errorf("failed to list tags: %w", err))
+	}
+
+	interval := c.watchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := c.tagDigests(repo, remoteOpts)
+		if err != nil {
+			c.logger.Info("failed to poll tags - retrying", "repo", repoRef, "reason", err)
+			continue
+		}
+
+		for _, event := range diffTags(known, current) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		known = current
+	}
+}
+
+func (c Client) tagDigests(repo name.Repository, remoteOpts []remote.Option) (map[string]string, error) {
+	tags, err := remote.List(repo, remoteOpts...)
+	if err != nil {
+		if isNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+
+	digests := map[string]string{}
+	for _, tag := range tags {
+		descriptor, err := remote.Head(repo.Tag(tag), remoteOpts...)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, registryError(repo.String(), fmt.Errorf("failed to resolve tag %q: %w", tag, err))
+		}
+		digests[tag] = descriptor.Digest.String()
+	}
+
+	return digests, nil
+}
+
+func diffTags(known, current map[string]string) []TagEvent {
+	events := []TagEvent{}
+	for tag, digest := range current {
+		if known[tag] != digest {
+			events = append(events, TagEvent{Tag: tag, Digest: digest, Type: TagPushed})
+		}
+	}
+	for tag, digest := range known {
+		if _, ok := current[tag]; !ok {
+			events = append(events, TagEvent{Tag: tag, Digest: digest, Type: TagDeleted})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,119 @@
+package image_test
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watch", func() {
+	var (
+		creds       image.Creds
+		repoRef     string
+		imgRef      string
+		otherImgRef string
+		events      chan image.TagEvent
+		watchCtx    context.Context
+		cancelWatch context.CancelFunc
+		watchErr    chan error
+	)
+
+	push := func(fixture string, tags ...string) string {
+		GinkgoHelper()
+
+		zipFile, err := os.Open(fixture)
+		Expect(err).NotTo(HaveOccurred())
+		defer zipFile.Close()
+
+		ref, err := imgClient.Push(ctx, creds, repoRef, zipFile, tags...)
+		Expect(err).NotTo(HaveOccurred())
+		return ref
+	}
+
+	digestOf := func(ref string) string {
+		digest, err := imgClient.Digest(ctx, creds, ref)
+		Expect(err).NotTo(HaveOccurred())
+		return digest
+	}
+
+	BeforeEach(func() {
+		imgClient = image.NewClient(k8sClientset, image.WithWatchInterval(50*time.Millisecond))
+		creds = image.Creds{
+			Namespace:   "default",
+			SecretNames: []string{secretName},
+		}
+		repoRef = containerRegistry.ImageRef("watch/" + uuid.NewString())
+		imgRef = push("fixtures/layer.zip", "existing")
+
+		events = make(chan image.TagEvent, 10)
+		watchErr = make(chan error, 1)
+
+		watchCtx, cancelWatch = context.WithCancel(ctx)
+		DeferCleanup(cancelWatch)
+	})
+
+	JustBeforeEach(func() {
+		go func() {
+			defer GinkgoRecover()
+			watchErr <- imgClient.Watch(watchCtx, creds, repoRef, events)
+		}()
+		// let the watch take its initial snapshot
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	It("does not report the tags present when watching starts", func() {
+		Consistently(events, "200ms").ShouldNot(Receive())
+	})
+
+	It("reports pushed tags", func() {
+		otherImgRef = push("fixtures/anotherLayer.zip", "new")
+
+		Eventually(events).Should(Receive(Equal(image.TagEvent{
+			Tag:    "new",
+			Digest: digestOf(otherImgRef),
+			Type:   image.TagPushed,
+		})))
+	})
+
+	It("reports tags moved to another digest", func() {
+		otherImgRef = push("fixtures/anotherLayer.zip", "existing")
+
+		Eventually(events).Should(Receive(Equal(image.TagEvent{
+			Tag:    "existing",
+			Digest: digestOf(otherImgRef),
+			Type:   image.TagPushed,
+		})))
+	})
+
+	It("reports deleted tags", func() {
+		digest := digestOf(imgRef)
+		Expect(imgClient.Delete(ctx, creds, imgRef, "existing")).To(Succeed())
+
+		Eventually(events).Should(Receive(Equal(image.TagEvent{
+			Tag:    "existing",
+			Digest: digest,
+			Type:   image.TagDeleted,
+		})))
+	})
+
+	It("returns when the context is cancelled", func() {
+		Consistently(watchErr, "200ms").ShouldNot(Receive())
+		cancelWatch()
+		Eventually(watchErr).Should(Receive(BeNil()))
+	})
+
+	When("the repository ref is invalid", func() {
+		BeforeEach(func() {
+			repoRef += ":tag"
+		})
+
+		It("fails", func() {
+			Eventually(watchErr).Should(Receive(MatchError(ContainSubstring("error parsing repository reference"))))
+		})
+	})
+})
@@ -0,0 +1,197 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/google/go-containerregistry/pkg/authn"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	workloadIdentityServiceAccount = "default"
+	awsRoleARNAnnotation           = "eks.amazonaws.com/role-arn"
+	googleSTSURL                   = "https://sts.googleapis.com/v1/token"
+	googleCloudPlatformScope       = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// WithWorkloadIdentity makes calls with no secrets and no service account in
+// their Creds authenticate to Google and ECR registries as the default
+// service account of Creds.Namespace. A token for audience is requested for
+// that service account and exchanged with Google STS, using audience as the
+// workload identity provider, or AWS STS, assuming the role in the
+// eks.amazonaws.com/role-arn annotation of the service account. Other
+// registries keep using the environment credentials.
+func WithWorkloadIdentity(audience string) Option {
+	return func(c *Client) {
+		c.workloadIdentityAudience = audience
+	}
+}
+
+// workloadIdentityKeychain exchanges tokens when a matching registry is
+// resolved, so that calls to other registries do not reach the API server
+type workloadIdentityKeychain struct {
+	ctx       context.Context
+	client    Client
+	namespace string
+}
+
+func (k workloadIdentityKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+
+	if isGoogleRegistry(registry) {
+		accessToken, err := k.googleAccessToken()
+		if err != nil {
+			return nil, err
+		}
+		return authn.FromConfig(authn.AuthConfig{Username: "oauth2accesstoken", Password: accessToken}), nil
+	}
+
+	if region, ok := ecrRegion(registry); ok {
+		return k.ecrAuthenticator(region)
+	}
+
+	return authn.Anonymous, nil
+}
+
+func (k workloadIdentityKeychain) serviceAccountToken() (string, error) {
+	tokenRequest, err := k.client.k8sClient.CoreV1().ServiceAccounts(k.namespace).CreateToken(k.ctx, workloadIdentityServiceAccount, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: []string{k.client.workloadIdentityAudience},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to request token for service account %s/%s: %w", k.namespace, workloadIdentityServiceAccount, err)
+	}
+
+	return tokenRequest.Status.Token, nil
+}
+
+func (k workloadIdentityKeychain) httpClient() *http.Client {
+	return &http.Client{Transport: k.client.transport}
+}
+
+func (k workloadIdentityKeychain) googleAccessToken() (string, error) {
+	token, err := k.serviceAccountToken()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {k.client.workloadIdentityAudience},
+		"scope":                {googleCloudPlatformScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token_type":   {"urn:ietf:params:oauth:token-type:jwt"},
+		"subject_token":        {token},
+	}
+	req, err := http.NewRequestWithContext(k.ctx, http.MethodPost, googleSTSURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := k.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange token with Google STS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Google STS rejected the token exchange: %s", resp.Status)
+	}
+
+	var exchanged struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&exchanged); err != nil {
+		return "", fmt.Errorf("failed to decode Google STS response: %w", err)
+	}
+
+	return exchanged.AccessToken, nil
+}
+
+func (k workloadIdentityKeychain) ecrAuthenticator(region string) (authn.Authenticator, error) {
+	serviceAccount, err := k.client.k8sClient.CoreV1().ServiceAccounts(k.namespace).Get(k.ctx, workloadIdentityServiceAccount, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service account %s/%s: %w", k.namespace, workloadIdentityServiceAccount, err)
+	}
+
+	roleARN := serviceAccount.Annotations[awsRoleARNAnnotation]
+	if roleARN == "" {
+		return nil, fmt.Errorf("service account %s/%s has no %s annotation", k.namespace, workloadIdentityServiceAccount, awsRoleARNAnnotation)
+	}
+
+	token, err := k.serviceAccountToken()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := aws.Config{
+		Region:      region,
+		HTTPClient:  k.httpClient(),
+		Credentials: aws.AnonymousCredentials{},
+	}
+
+	assumed, err := sts.NewFromConfig(awsConfig).AssumeRoleWithWebIdentity(k.ctx, &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(roleARN),
+		RoleSessionName:  aws.String("korifi-" + k.namespace),
+		WebIdentityToken: aws.String(token),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %w", roleARN, err)
+	}
+
+	awsConfig.Credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     aws.ToString(assumed.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(assumed.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(assumed.Credentials.SessionToken),
+		}, nil
+	})
+
+	authToken, err := ecr.NewFromConfig(awsConfig).GetAuthorizationToken(k.ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ECR authorization token: %w", err)
+	}
+	if len(authToken.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(aws.ToString(authToken.AuthorizationData[0].AuthorizationToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, fmt.Errorf("ECR authorization token is not in the user:password format")
+	}
+
+	return authn.FromConfig(authn.AuthConfig{Username: username, Password: password}), nil
+}
+
+func isGoogleRegistry(registry string) bool {
+	return registry == "gcr.io" ||
+		strings.HasSuffix(registry, ".gcr.io") ||
+		strings.HasSuffix(registry, "-docker.pkg.dev")
+}
+
+// ecrRegion returns the region of <account>.dkr.ecr.<region>.amazonaws.com
+// registries
+func ecrRegion(registry string) (string, bool) {
+	parts := strings.Split(registry, ".")
+	if len(parts) != 6 || parts[1] != "dkr" || parts[2] != "ecr" || parts[4] != "amazonaws" || parts[5] != "com" {
+		return "", false
+	}
+
+	return parts[3], true
+}
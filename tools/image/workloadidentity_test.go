@@ -0,0 +1,236 @@
+package image_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/korifi/tools/image"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cloudTransport sends every request to the fake cloud server, keeping the
+// original host in the Host header
+type cloudTransport struct {
+	host string
+}
+
+func (t cloudTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = "http"
+	req.URL.Host = t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+var _ = Describe("WithWorkloadIdentity", func() {
+	const (
+		audience     = "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/korifi/providers/k8s"
+		roleARN      = "arn:aws:iam::123456789012:role/korifi"
+		googleHost   = "us-docker.pkg.dev"
+		ecrHost      = "123456789012.dkr.ecr.us-east-1.amazonaws.com"
+		otherHost    = "registry.example.com"
+		googleToken  = "federated-token"
+		ecrPassword  = "ecr-password"
+		assumedKeyID = "ASSUMEDKEYID"
+	)
+
+	var (
+		mutex          sync.Mutex
+		stsRequests    []url.Values
+		stsStatus      int
+		roleAnnotation string
+		pushRef        string
+		pushErr        error
+	)
+
+	recordSTSRequest := func(r *http.Request) url.Values {
+		Expect(r.ParseForm()).To(Succeed())
+		mutex.Lock()
+		defer mutex.Unlock()
+		stsRequests = append(stsRequests, r.PostForm)
+		return r.PostForm
+	}
+
+	receivedSTSRequests := func() []url.Values {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return stsRequests
+	}
+
+	ensureDefaultServiceAccount := func() {
+		GinkgoHelper()
+
+		serviceAccounts := k8sClientset.CoreV1().ServiceAccounts("default")
+		serviceAccount, err := serviceAccounts.Get(ctx, "default", metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			serviceAccount, err = serviceAccounts.Create(ctx, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default"},
+			}, metav1.CreateOptions{})
+		}
+		Expect(err).NotTo(HaveOccurred())
+
+		serviceAccount.Annotations = map[string]string{}
+		if roleAnnotation != "" {
+			serviceAccount.Annotations["eks.amazonaws.com/role-arn"] = roleAnnotation
+		}
+		_, err = serviceAccounts.Update(ctx, serviceAccount, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		stsRequests = nil
+		stsStatus = http.StatusOK
+		roleAnnotation = roleARN
+
+		registryHandler := ggcrregistry.New(ggcrregistry.Logger(log.New(GinkgoWriter, "", 0)))
+		registryPasswords := map[string]string{
+			googleHost: "oauth2accesstoken:" + googleToken,
+			ecrHost:    "AWS:" + ecrPassword,
+		}
+
+		cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Host == "sts.googleapis.com":
+				recordSTSRequest(r)
+				w.WriteHeader(stsStatus)
+				_ = json.NewEncoder(w).Encode(map[string]any{"access_token": googleToken, "token_type": "Bearer"})
+
+			case strings.HasPrefix(r.Host, "sts."):
+				form := recordSTSRequest(r)
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(stsStatus)
+				fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser><Arn>%s</Arn><AssumedRoleId>id</AssumedRoleId></AssumedRoleUser>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, assumedKeyID, form.Get("RoleArn"))
+
+			case strings.HasPrefix(r.Host, "api.ecr."):
+				if !strings.Contains(r.Header.Get("Authorization"), "Credential="+assumedKeyID+"/") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"authorizationData": []map[string]any{{
+						"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:" + ecrPassword)),
+						"expiresAt":          4070908800,
+						"proxyEndpoint":      "https://" + ecrHost,
+					}},
+				})
+
+			default:
+				if expected, ok := registryPasswords[r.Host]; ok {
+					user, password, _ := r.BasicAuth()
+					if user+":"+password != expected {
+						w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+				}
+				registryHandler.ServeHTTP(w, r)
+			}
+		}))
+		DeferCleanup(cloud.Close)
+
+		cloudURL, err := url.Parse(cloud.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		imgClient = image.NewClient(k8sClientset,
+			image.WithWorkloadIdentity(audience),
+			image.WithTransport(cloudTransport{host: cloudURL.Host}),
+		)
+	})
+
+	JustBeforeEach(func() {
+		ensureDefaultServiceAccount()
+
+		zipFile, err := os.Open("fixtures/layer.zip")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(zipFile.Close)
+
+		_, pushErr = imgClient.Push(ctx, image.Creds{Namespace: "default"}, pushRef, zipFile)
+	})
+
+	When("pushing to a Google registry", func() {
+		BeforeEach(func() {
+			pushRef = googleHost + "/project/repo/app"
+		})
+
+		It("authenticates with the token exchanged with Google STS", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			requests := receivedSTSRequests()
+			Expect(requests).NotTo(BeEmpty())
+			Expect(requests[0].Get("audience")).To(Equal(audience))
+			Expect(requests[0].Get("subject_token_type")).To(Equal("urn:ietf:params:oauth:token-type:jwt"))
+			Expect(requests[0].Get("subject_token")).NotTo(BeEmpty())
+		})
+
+		When("Google STS rejects the token", func() {
+			BeforeEach(func() {
+				stsStatus = http.StatusBadRequest
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("Google STS rejected the token exchange")))
+			})
+		})
+	})
+
+	When("pushing to ECR", func() {
+		BeforeEach(func() {
+			pushRef = ecrHost + "/app"
+		})
+
+		It("authenticates with an ECR token for the assumed role", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+
+			requests := receivedSTSRequests()
+			Expect(requests).NotTo(BeEmpty())
+			Expect(requests[0].Get("Action")).To(Equal("AssumeRoleWithWebIdentity"))
+			Expect(requests[0].Get("RoleArn")).To(Equal(roleARN))
+			Expect(requests[0].Get("WebIdentityToken")).NotTo(BeEmpty())
+		})
+
+		When("the service account does not name a role", func() {
+			BeforeEach(func() {
+				roleAnnotation = ""
+			})
+
+			It("fails", func() {
+				Expect(pushErr).To(MatchError(ContainSubstring("has no eks.amazonaws.com/role-arn annotation")))
+			})
+		})
+	})
+
+	When("pushing to another registry", func() {
+		BeforeEach(func() {
+			pushRef = otherHost + "/app"
+		})
+
+		It("does not exchange tokens", func() {
+			Expect(pushErr).NotTo(HaveOccurred())
+			Expect(receivedSTSRequests()).To(BeEmpty())
+		})
+	})
+})